@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"net/http"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -13,7 +19,9 @@ import (
 	"os"
 
 	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
 	atlasbroker "github.com/mongodb/mongodb-atlas-service-broker/pkg/broker"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/telemetry"
 	"github.com/pivotal-cf/brokerapi"
 )
 
@@ -28,6 +36,17 @@ const (
 
 	DefaultServerHost = "127.0.0.1"
 	DefaultServerPort = 4000
+
+	DefaultShutdownTimeout = 30 * time.Second
+
+	DefaultPrewarmRetryInterval = 10 * time.Second
+
+	DefaultSweepInterval = time.Minute
+
+	DefaultMetricsExporters   = telemetry.ExporterPrometheus
+	DefaultTracesExporter     = telemetry.ExporterNone
+	DefaultTracesSampleRatio  = 1.0
+	DefaultOTLPExportInterval = 15 * time.Second
 )
 
 func main() {
@@ -55,7 +74,22 @@ func main() {
 		return
 	}
 
-	startBrokerServer()
+	// The state commands talk to a running broker instead of starting one.
+	var err error
+	switch flag.Arg(0) {
+	case "export":
+		err = runExportCommand(flag.Args()[1:])
+	case "import":
+		err = runImportCommand(flag.Args()[1:])
+	default:
+		startBrokerServer()
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
 func getHelpMessage() string {
@@ -65,6 +99,10 @@ This is a Service Broker which provides access to MongoDB deployments running
 in MongoDB Atlas. It conforms to the Open Service Broker specification and can
 be used with any compatible platform, for example the Kubernetes Service Catalog.
 
+Commands:
+  export    Write the instance and binding state of a running broker to stdout.
+  import    Load a state export from stdin into a running broker.
+
 For instructions on how to install and use the Service Broker please refer to
 the documentation: https://docs.mongodb.com/atlas-open-service-broker
 
@@ -82,26 +120,430 @@ func startBrokerServer() {
 	}
 	defer logger.Sync() // Flushes buffer, if any
 
+	baseURL := strings.TrimRight(getEnvOrDefault("ATLAS_BASE_URL", DefaultAtlasBaseURL), "/")
+	userAgent := atlasbroker.UserAgent(releaseVersion, getEnvOrDefault("BROKER_USER_AGENT_TAG", ""))
+
+	// Providers are fetched from the unauthenticated private API, so
+	// catalog refreshes and prewarming need no credentials.
+	catalogClient := atlas.NewClient(baseURL, "", "", "")
+	catalogClient.UserAgent = userAgent
+
+	config := atlasbroker.Config{
+		CatalogClient:   catalogClient,
+		BrokerID:        getEnvOrDefault("BROKER_ID", atlasbroker.DefaultBrokerID),
+		UserLabelPrefix: getEnvOrDefault("BROKER_USER_LABEL_PREFIX", atlasbroker.DefaultUserLabelPrefix),
+	}
+
 	// Administrators can control what providers/plans are available to users
 	pathToWhitelistFile, hasWhitelist := os.LookupEnv("PROVIDERS_WHITELIST_FILE")
-	var broker *atlasbroker.Broker
-	if !hasWhitelist {
-		broker = atlasbroker.NewBroker(logger)
-	} else {
+	if hasWhitelist {
 		whitelist, err := atlasbroker.ReadWhitelistFile(pathToWhitelistFile)
 		if err != nil {
 			panic(err)
 		}
-		broker = atlasbroker.NewBrokerWithWhitelist(logger, whitelist)
+		config.Whitelist = whitelist
+	}
+
+	// Provision timeouts can be overridden per plan, otherwise they scale with
+	// the instance size.
+	provisionTimeouts, err := atlasbroker.ParseProvisionTimeouts(getEnvOrDefault("BROKER_PROVISION_TIMEOUTS", ""))
+	if err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_PROVISION_TIMEOUTS" is invalid: %v`, err))
+	}
+	config.ProvisionTimeouts = provisionTimeouts
+
+	defaultRegions, err := atlasbroker.ParseDefaultRegions(getEnvOrDefault("BROKER_DEFAULT_REGIONS", ""))
+	if err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_DEFAULT_REGIONS" is invalid: %v`, err))
+	}
+	config.DefaultRegions = defaultRegions
+	config.ValidateRegionAvailability = getBoolEnvOrDefault("BROKER_VALIDATE_REGION_AVAILABILITY", false)
+
+	maxDiskSizes, err := atlasbroker.ParsePlanMaxDiskSizes(getEnvOrDefault("BROKER_PLAN_MAX_DISK_SIZES", ""))
+	if err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_PLAN_MAX_DISK_SIZES" is invalid: %v`, err))
+	}
+	config.PlanMaxDiskSizeGB = maxDiskSizes
+
+	// Default write and read concerns added to the connection strings of
+	// bindings, for the broker and per plan.
+	config.ConnectionConcerns = getConnectionConcerns()
+	if path, ok := os.LookupEnv("BROKER_PLAN_CONNECTION_CONCERNS_FILE"); ok {
+		planConcerns, err := atlasbroker.ReadPlanConnectionConcernsFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.PlanConnectionConcerns = planConcerns
+	}
+
+	// Default database of the connection strings of bindings, for the
+	// broker and per plan.
+	config.DefaultDatabase = getEnvOrDefault("BROKER_DEFAULT_DATABASE", "")
+	if config.DefaultDatabase != "" {
+		if err := atlasbroker.ValidateDatabaseName(config.DefaultDatabase); err != nil {
+			panic(fmt.Sprintf(`Environment variable "BROKER_DEFAULT_DATABASE" is invalid: %v`, err))
+		}
+	}
+	planDatabases, err := atlasbroker.ParsePlanDefaultDatabases(getEnvOrDefault("BROKER_PLAN_DEFAULT_DATABASES", ""))
+	if err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_PLAN_DEFAULT_DATABASES" is invalid: %v`, err))
+	}
+	config.PlanDefaultDatabases = planDatabases
+
+	// The credentials of bindings may be verified to connect before they're
+	// returned.
+	if getBoolEnvOrDefault("BROKER_VERIFY_CONNECTIONS", false) {
+		timeout := getDurationEnvOrDefault("BROKER_VERIFY_CONNECTIONS_TIMEOUT", atlasbroker.DefaultConnectionVerificationTimeout)
+		if timeout >= atlasbroker.PlatformRequestTimeout {
+			logger.Warnw("Connection verification may outlast the platform's request timeout, bindings may be abandoned", "timeout", timeout, "platform_timeout", atlasbroker.PlatformRequestTimeout)
+		}
+		config.ConnectionVerifier = atlasbroker.MongoConnectionVerifier{Timeout: timeout}
+	}
+
+	// Bindings can recommend connection pool sizes sharing the connection
+	// limit of their cluster.
+	config.ExpectedBindings = getIntEnvOrDefault("BROKER_EXPECTED_BINDINGS", 0)
+	if config.ExpectedBindings < 0 {
+		panic(`Environment variable "BROKER_EXPECTED_BINDINGS" must not be negative`)
+	}
+
+	// TLS can be enforced regardless of the connection options.
+	config.RequireTLS = getBoolEnvOrDefault("BROKER_REQUIRE_TLS", false)
+	config.RequireValidCertificates = getBoolEnvOrDefault("BROKER_REQUIRE_VALID_CERTIFICATES", false)
+	config.EnforceTLS = getBoolEnvOrDefault("BROKER_ENFORCE_TLS", false)
+
+	// Intents can be provisioned instead of plans.
+	if path, ok := os.LookupEnv("BROKER_PLAN_INTENTS_FILE"); ok {
+		intents, err := atlasbroker.ReadPlanIntentsFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.PlanIntents = intents
+	}
+
+	// Plans may require parameters instead of defaulting them.
+	if path, ok := os.LookupEnv("BROKER_REQUIRED_PARAMETERS_FILE"); ok {
+		required, err := atlasbroker.ReadRequiredParametersFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.RequiredParameters = required
+	}
+
+	// Provision parameters may have to follow naming conventions.
+	if path, ok := os.LookupEnv("BROKER_PARAMETER_PATTERNS_FILE"); ok {
+		patterns, err := atlasbroker.ReadParameterPatternsFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.ParameterPatterns = patterns
+	}
+
+	// Instance sizes can be excluded by their attributes in addition to the
+	// whitelist.
+	if path, ok := os.LookupEnv("BROKER_INSTANCE_SIZE_EXCLUSIONS_FILE"); ok {
+		exclusions, err := atlasbroker.ReadInstanceSizeExclusionsFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.InstanceSizeExclusions = exclusions
+	}
+
+	// Instances of sizes Atlas stops offering can be mapped to successors.
+	if path, ok := os.LookupEnv("BROKER_INSTANCE_SIZE_FALLBACKS_FILE"); ok {
+		fallbacks, err := atlasbroker.ReadInstanceSizeFallbacksFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.InstanceSizeFallbacks = fallbacks
+	}
+
+	// Plans are ordered by tier unless operators curate the order.
+	if path, ok := os.LookupEnv("BROKER_PLAN_ORDER_FILE"); ok {
+		order, err := atlasbroker.ReadPlanOrderFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.PlanOrder = order
+	}
+
+	// Clusters may be required to have labels for governance.
+	if path, ok := os.LookupEnv("BROKER_LABEL_POLICY_FILE"); ok {
+		policy, err := atlasbroker.ReadLabelPolicyFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.LabelPolicy = policy
+	}
+
+	// Instances are fetched with a cost estimate if a cost table is set.
+	if path, ok := os.LookupEnv("BROKER_COST_TABLE_FILE"); ok {
+		table, err := atlasbroker.ReadCostTableFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.CostTable = table
+	}
+
+	// Instances may be provisioned in the projects mapped to their space,
+	// organization, or namespace rather than the project of the API key.
+	if path, ok := os.LookupEnv("BROKER_PROJECTS_FILE"); ok {
+		resolver, err := atlasbroker.ReadStaticProjectResolverFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.ProjectResolver = resolver
+	}
+	config.ProjectResolutionTimeout = getDurationEnvOrDefault("BROKER_PROJECT_RESOLUTION_TIMEOUT", atlasbroker.DefaultProjectResolutionTimeout)
+
+	// Editions are offered as separate services with features enabled by
+	// default.
+	if path, ok := os.LookupEnv("BROKER_EDITIONS_FILE"); ok {
+		editions, err := atlasbroker.ReadEditionsFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.Editions = editions
+	}
+
+	// The support statuses of MongoDB versions are published in the plan
+	// metadata.
+	if path, ok := os.LookupEnv("BROKER_MONGODB_VERSIONS_FILE"); ok {
+		versions, err := atlasbroker.ReadMongoDBVersionsFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.MongoDBVersions = versions
+	}
+	config.RejectDeprecatedVersions = getBoolEnvOrDefault("BROKER_REJECT_DEPRECATED_VERSIONS", false)
+
+	// Admin requests may act with named Atlas keys instead of the default
+	// credentials.
+	if path, ok := os.LookupEnv("BROKER_ATLAS_KEYS_FILE"); ok {
+		keys, err := atlasbroker.ReadAtlasKeysFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.AtlasKeys = atlasbroker.AtlasKeyClients(keys, baseURL, userAgent)
+	}
+
+	// The state is reconciled with the clusters of one of the named keys on
+	// startup.
+	if name := getEnvOrDefault("BROKER_RECONCILE_ATLAS_KEY", ""); name != "" {
+		client, ok := config.AtlasKeys[name]
+		if !ok {
+			panic(fmt.Sprintf(`Environment variable "BROKER_RECONCILE_ATLAS_KEY" is invalid: unknown Atlas key %s`, name))
+		}
+		config.ReconcileClient = client
+	}
+	config.ReconcileBatchSize = getIntEnvOrDefault("BROKER_RECONCILE_BATCH_SIZE", atlasbroker.DefaultReconcileBatchSize)
+	config.ReconcileConcurrency = getIntEnvOrDefault("BROKER_RECONCILE_CONCURRENCY", atlasbroker.DefaultReconcileConcurrency)
+	if err := atlasbroker.ValidateReconcileSettings(config.ReconcileBatchSize, config.ReconcileConcurrency); err != nil {
+		panic(fmt.Sprintf(`Environment variables "BROKER_RECONCILE_BATCH_SIZE" and "BROKER_RECONCILE_CONCURRENCY" are invalid: %v`, err))
+	}
+	config.ReconcileRateLimitBackoff = getDurationEnvOrDefault("BROKER_RECONCILE_RATE_LIMIT_BACKOFF", atlasbroker.DefaultReconcileRateLimitBackoff)
+
+	// Binding credentials in state exports are encrypted with this key.
+	if encoded := getEnvOrDefault("BROKER_STATE_ENCRYPTION_KEY", ""); encoded != "" {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err == nil && len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			err = fmt.Errorf("expected a 16, 24, or 32 byte key, got %d bytes", len(key))
+		}
+		if err != nil {
+			panic(fmt.Sprintf(`Environment variable "BROKER_STATE_ENCRYPTION_KEY" is invalid: %v`, err))
+		}
+		config.StateEncryptionKey = key
+	}
+
+	config.ProviderCacheTTL = getDurationEnvOrDefault("BROKER_PROVIDER_CACHE_TTL", atlasbroker.DefaultProviderCacheTTL)
+	refreshInterval := getDurationEnvOrDefault("BROKER_CATALOG_REFRESH_INTERVAL", 0)
+	if err := atlasbroker.ValidateCatalogRefreshInterval(refreshInterval, config.ProviderCacheTTL); err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_CATALOG_REFRESH_INTERVAL" is invalid: %v`, err))
+	}
+	config.RequireNonEmptyCatalog = getBoolEnvOrDefault("BROKER_REQUIRE_NON_EMPTY_CATALOG", false)
+	config.PrefixPlanDisplayNames = getBoolEnvOrDefault("BROKER_PREFIX_PLAN_DISPLAY_NAMES", false)
+	config.EphemeralMaxInstanceSize = getEnvOrDefault("BROKER_EPHEMERAL_MAX_INSTANCE_SIZE", "")
+	if err := (atlasbroker.PlanRange{Max: config.EphemeralMaxInstanceSize}).Validate(); err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_EPHEMERAL_MAX_INSTANCE_SIZE" is invalid: %v`, err))
+	}
+	config.EphemeralTTL = getDurationEnvOrDefault("BROKER_EPHEMERAL_TTL", 0)
+	if config.EphemeralTTL < 0 {
+		panic(`Environment variable "BROKER_EPHEMERAL_TTL" must not be negative`)
+	}
+	config.EphemeralDeleteWhenUnbound = getBoolEnvOrDefault("BROKER_EPHEMERAL_DELETE_WHEN_UNBOUND", false)
+	config.EphemeralMaxInstances = getIntEnvOrDefault("BROKER_EPHEMERAL_MAX_INSTANCES", 0)
+	if config.EphemeralMaxInstances < 0 {
+		panic(`Environment variable "BROKER_EPHEMERAL_MAX_INSTANCES" must not be negative`)
+	}
+	config.ApprovalThresholdInstanceSize = getEnvOrDefault("BROKER_APPROVAL_THRESHOLD_INSTANCE_SIZE", "")
+	if err := (atlasbroker.PlanRange{Max: config.ApprovalThresholdInstanceSize}).Validate(); err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_APPROVAL_THRESHOLD_INSTANCE_SIZE" is invalid: %v`, err))
+	}
+	for _, token := range strings.Split(getEnvOrDefault("BROKER_APPROVAL_TOKENS", ""), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			config.ApprovalTokens = append(config.ApprovalTokens, token)
+		}
+	}
+	config.BackupRequiredInstanceSize = getEnvOrDefault("BROKER_BACKUP_REQUIRED_INSTANCE_SIZE", "")
+	if err := (atlasbroker.PlanRange{Min: config.BackupRequiredInstanceSize}).Validate(); err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_BACKUP_REQUIRED_INSTANCE_SIZE" is invalid: %v`, err))
+	}
+	config.IncludeBindings = getBoolEnvOrDefault("BROKER_INCLUDE_BINDINGS", false)
+	config.IncludeParameterHistory = getBoolEnvOrDefault("BROKER_INCLUDE_PARAMETER_HISTORY", false)
+	config.SingleBinding = getBoolEnvOrDefault("BROKER_SINGLE_BINDING", false)
+	if plans := getEnvOrDefault("BROKER_SINGLE_BINDING_PLANS", ""); plans != "" {
+		config.SingleBindingPlans = strings.Split(plans, ",")
+	}
+	if dir, ok := os.LookupEnv("BROKER_SECRETS_DIR"); ok {
+		config.SecretStore = atlasbroker.DirectorySecretStore{Path: dir}
+	}
+	if address, ok := os.LookupEnv("BROKER_VAULT_ADDR"); ok {
+		token := getEnvOrDefault("BROKER_VAULT_TOKEN", "")
+		if token == "" {
+			panic(`Environment variable "BROKER_VAULT_TOKEN" is required when "BROKER_VAULT_ADDR" is set`)
+		}
+
+		config.CredentialStore = atlasbroker.VaultCredentialStore{
+			Address: address,
+			Token:   token,
+			Mount:   getEnvOrDefault("BROKER_VAULT_MOUNT", "secret"),
+			Path:    getEnvOrDefault("BROKER_VAULT_PATH", "atlas-osb/bindings"),
+		}
+	}
+	config.AllowClusterRenames = getBoolEnvOrDefault("BROKER_ALLOW_CLUSTER_RENAMES", false)
+	config.SharedService = getEnvOrDefault("BROKER_SHARED_SERVICE", atlasbroker.SharedServiceAlways)
+	if err := atlasbroker.ValidateSharedServicePolicy(config.SharedService); err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_SHARED_SERVICE" is invalid: %v`, err))
+	}
+	config.ConcurrentOperations = getEnvOrDefault("BROKER_CONCURRENT_OPERATIONS", atlasbroker.ConcurrentOperationsWait)
+	if err := atlasbroker.ValidateConcurrentOperationsPolicy(config.ConcurrentOperations); err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_CONCURRENT_OPERATIONS" is invalid: %v`, err))
+	}
+	config.PartialUpdatePolicy = getEnvOrDefault("BROKER_PARTIAL_UPDATE_POLICY", atlasbroker.PartialUpdatePolicyKeep)
+	if err := atlasbroker.ValidatePartialUpdatePolicy(config.PartialUpdatePolicy); err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_PARTIAL_UPDATE_POLICY" is invalid: %v`, err))
+	}
+	config.TopologyWebhookURL = getEnvOrDefault("BROKER_TOPOLOGY_WEBHOOK_URL", "")
+	config.AutoTerminationGracePeriod = getDurationEnvOrDefault("BROKER_AUTO_TERMINATION_GRACE_PERIOD", atlasbroker.DefaultAutoTerminationGracePeriod)
+	sweepInterval := getDurationEnvOrDefault("BROKER_SWEEP_INTERVAL", DefaultSweepInterval)
+	if sweepInterval <= 0 {
+		panic(`Environment variable "BROKER_SWEEP_INTERVAL" must be positive`)
+	}
+
+	// Operators can limit the plans available to platform contexts, for
+	// example to keep dev spaces on smaller tiers.
+	if path, ok := os.LookupEnv("BROKER_PLAN_POLICY_FILE"); ok {
+		policy, err := atlasbroker.ReadPlanPolicyFile(path)
+		if err != nil {
+			panic(err)
+		}
+		config.PlanPolicy = policy
+	}
+
+	// Set up metrics and tracing. OTLP export starts in the background and is
+	// flushed when the server shuts down.
+	telemetryConfig := getTelemetryConfig()
+	tel, err := telemetry.New(telemetryConfig, func(err error) {
+		logger.Errorw("Failed to export telemetry", "error", err)
+	})
+	if err != nil {
+		panic(err)
+	}
+	config.Metrics = tel.Registry()
+	config.MetricsLabel = getEnvOrDefault("BROKER_METRICS_LABEL", "")
+	if values := getEnvOrDefault("BROKER_METRICS_LABEL_VALUES", ""); values != "" {
+		config.MetricsLabelValues = strings.Split(values, ",")
+	}
+
+	broker := atlasbroker.NewBrokerWithConfig(logger, config)
+
+	// Default regions Atlas doesn't offer would fail every provision
+	// relying on them.
+	if err := broker.ValidateDefaultRegions(catalogClient); err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_DEFAULT_REGIONS" is invalid: %v`, err))
 	}
 
 	router := mux.NewRouter()
-	brokerapi.AttachRoutes(router, broker, NewLagerZapLogger(logger))
+
+	// The metrics endpoint is served outside of the OSB API to not require
+	// Atlas credentials.
+	if tel.PrometheusEnabled() {
+		router.Handle("/metrics", tel.PrometheusHandler()).Methods("GET")
+	}
+
+	// The readiness check is unauthenticated as well. The broker is ready
+	// unless it's waiting for a required catalog prewarm.
+	var ready int32 = 1
+	router.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&ready) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+
+	// The minimal discovery catalog is unauthenticated as it doesn't include
+	// any plans.
+	if getBoolEnvOrDefault("BROKER_DISCOVERY_ENABLED", false) {
+		atlasbroker.AttachDiscoveryRoutes(router, broker)
+	}
+
+	// The admin API is authenticated with its own token and only served if
+	// one is configured.
+	if token := getEnvOrDefault("BROKER_ADMIN_TOKEN", ""); token != "" {
+		atlasbroker.AttachAdminRoutes(router, broker, token)
+	}
+
+	api := router.PathPrefix("/").Subrouter()
+	brokerapi.AttachRoutes(api, broker, NewLagerZapLogger(logger))
+	atlasbroker.AttachExtensionRoutes(api, broker)
+	api.Use(tel.Middleware())
 
 	// The auth middleware will convert basic auth credentials into an Atlas
 	// client.
-	baseURL := strings.TrimRight(getEnvOrDefault("ATLAS_BASE_URL", DefaultAtlasBaseURL), "/")
-	router.Use(atlasbroker.AuthMiddleware(baseURL))
+	api.Use(atlasbroker.AuthMiddleware(baseURL, userAgent))
+
+	// Catalog responses get caching headers, and are optionally compressed,
+	// once the request has been authenticated.
+	api.Use(atlasbroker.CatalogCachingMiddleware(atlasbroker.CatalogCaching{
+		MaxAge: getDurationEnvOrDefault("BROKER_CATALOG_MAX_AGE", 0),
+		Gzip:   getBoolEnvOrDefault("BROKER_CATALOG_GZIP", false),
+	}))
+
+	// Optionally fetch the providers before accepting traffic. If prewarming
+	// is required the broker isn't ready until it has succeeded.
+	if getBoolEnvOrDefault("BROKER_CATALOG_PREWARM", false) {
+		required := getBoolEnvOrDefault("BROKER_CATALOG_PREWARM_REQUIRED", false)
+		if !prewarmCatalog(logger, broker, catalogClient) && required {
+			atomic.StoreInt32(&ready, 0)
+			go func() {
+				for !prewarmCatalog(logger, broker, catalogClient) {
+					time.Sleep(DefaultPrewarmRetryInterval)
+				}
+				atomic.StoreInt32(&ready, 1)
+			}()
+		}
+	}
+
+	// The providers of the catalog may be refreshed on a schedule, before
+	// their cached data expires.
+	refreshCtx, stopRefresher := context.WithCancel(context.Background())
+	defer stopRefresher()
+	if refreshInterval > 0 {
+		go broker.RunCatalogRefresher(refreshCtx, refreshInterval)
+	}
+
+	// The state is reconciled with Atlas in the background, so large
+	// projects don't delay startup.
+	reconcileCtx, stopReconcile := context.WithCancel(context.Background())
+	defer stopReconcile()
+	go broker.RunReconcile(reconcileCtx)
+
+	// The sweeper deletes instances scheduled for deletion in the background
+	// until the server shuts down.
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go broker.RunSweeper(sweepCtx, sweepInterval)
 
 	// Configure TLS from environment variables.
 	tlsEnabled, tlsCertPath, tlsKeyPath := getTLSConfig(logger)
@@ -113,24 +555,111 @@ func startBrokerServer() {
 	if !hasWhitelist {
 		pathToWhitelistFile = "NONE"
 	}
-	logger.Infow("Starting API server", "releaseVersion", releaseVersion, "host", host, "port", port, "tls_enabled", tlsEnabled, "atlas_base_url", baseURL, "whitelist_file", pathToWhitelistFile)
+	logger.Infow("Starting API server", "releaseVersion", releaseVersion, "host", host, "port", port, "tls_enabled", tlsEnabled, "atlas_base_url", baseURL, "user_agent", userAgent, "whitelist_file", pathToWhitelistFile, "broker_id", config.BrokerID, "metrics_exporters", telemetryConfig.MetricsExporters, "traces_exporter", telemetryConfig.TracesExporter)
 
 	// Start broker HTTP server.
 	address := host + ":" + strconv.Itoa(port)
+	server := &http.Server{
+		Addr:    address,
+		Handler: router,
+	}
+
+	go func() {
+		var serverErr error
+		if tlsEnabled {
+			serverErr = server.ListenAndServeTLS(tlsCertPath, tlsKeyPath)
+		} else {
+			logger.Warn("TLS is disabled")
+			serverErr = server.ListenAndServe()
+		}
+
+		if serverErr != nil && serverErr != http.ErrServerClosed {
+			logger.Fatal(serverErr)
+		}
+	}()
+
+	// Wait for a termination signal and shut down gracefully, letting
+	// in-flight requests finish and flushing telemetry.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	logger.Info("Shutting down API server")
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
 
-	var serverErr error
-	if tlsEnabled {
-		serverErr = http.ListenAndServeTLS(address, tlsCertPath, tlsKeyPath, router)
-	} else {
-		logger.Warn("TLS is disabled")
-		serverErr = http.ListenAndServe(address, router)
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Errorw("Failed to shut down API server", "error", err)
 	}
 
-	if serverErr != nil {
-		logger.Fatal(serverErr)
+	if err := tel.Shutdown(ctx); err != nil {
+		logger.Errorw("Failed to flush telemetry", "error", err)
 	}
 }
 
+// prewarmCatalog will fetch the providers of the catalog into the broker's
+// cache, logging failures.
+func prewarmCatalog(logger *zap.SugaredLogger, broker *atlasbroker.Broker, client atlas.Client) bool {
+	err := broker.PrewarmProviders(client)
+	if err != nil {
+		logger.Errorw("Failed to prewarm catalog", "error", err)
+		return false
+	}
+
+	logger.Info("Prewarmed catalog")
+	return true
+}
+
+// getTelemetryConfig reads the metrics and tracing configuration from
+// environment variables.
+func getTelemetryConfig() telemetry.Config {
+	var metricsExporters []string
+	for _, exporter := range strings.Split(getEnvOrDefault("BROKER_METRICS_EXPORTERS", DefaultMetricsExporters), ",") {
+		if exporter = strings.TrimSpace(exporter); exporter != "" {
+			metricsExporters = append(metricsExporters, exporter)
+		}
+	}
+
+	headers, err := telemetry.ParseHeaders(getEnvOrDefault("BROKER_OTLP_HEADERS", ""))
+	if err != nil {
+		panic(fmt.Sprintf(`Environment variable "BROKER_OTLP_HEADERS" is invalid: %v`, err))
+	}
+
+	return telemetry.Config{
+		MetricsExporters:   metricsExporters,
+		TracesExporter:     getEnvOrDefault("BROKER_TRACES_EXPORTER", DefaultTracesExporter),
+		TracesSampleRatio:  getFloatEnvOrDefault("BROKER_TRACES_SAMPLE_RATIO", DefaultTracesSampleRatio),
+		OTLPEndpoint:       getEnvOrDefault("BROKER_OTLP_ENDPOINT", ""),
+		OTLPHeaders:        headers,
+		OTLPExportInterval: getDurationEnvOrDefault("BROKER_OTLP_EXPORT_INTERVAL", DefaultOTLPExportInterval),
+		ServiceName:        "atlas-osb",
+		ServiceVersion:     releaseVersion,
+	}
+}
+
+// getConnectionConcerns reads the broker's default connection concerns from
+// environment variables.
+func getConnectionConcerns() atlasbroker.ConnectionConcerns {
+	concerns := atlasbroker.ConnectionConcerns{
+		W:                getEnvOrDefault("BROKER_WRITE_CONCERN", ""),
+		ReadConcernLevel: getEnvOrDefault("BROKER_READ_CONCERN_LEVEL", ""),
+	}
+
+	if value, exists := os.LookupEnv("BROKER_JOURNAL"); exists {
+		journal, err := strconv.ParseBool(value)
+		if err != nil {
+			panic(`Environment variable "BROKER_JOURNAL" is not a boolean`)
+		}
+		concerns.Journal = &journal
+	}
+
+	if err := concerns.Validate(); err != nil {
+		panic(fmt.Sprintf("Invalid connection concerns: %v", err))
+	}
+
+	return concerns
+}
+
 func getTLSConfig(logger *zap.SugaredLogger) (bool, string, string) {
 	certPath := getEnvOrDefault("BROKER_TLS_CERT_FILE", "")
 	keyPath := getEnvOrDefault("BROKER_TLS_KEY_FILE", "")
@@ -184,6 +713,56 @@ func getIntEnvOrDefault(name string, def int) int {
 	return intValue
 }
 
+// getBoolEnvOrDefault will try getting an environment variable and parse it
+// as a boolean. In case the variable is not set it will return the default
+// value.
+func getBoolEnvOrDefault(name string, def bool) bool {
+	value, exists := os.LookupEnv(name)
+	if !exists {
+		return def
+	}
+
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		panic(fmt.Sprintf(`Environment variable "%s" is not a boolean`, name))
+	}
+
+	return boolValue
+}
+
+// getFloatEnvOrDefault will try getting an environment variable and parse it
+// as a float. In case the variable is not set it will return the default value.
+func getFloatEnvOrDefault(name string, def float64) float64 {
+	value, exists := os.LookupEnv(name)
+	if !exists {
+		return def
+	}
+
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		panic(fmt.Sprintf(`Environment variable "%s" is not a number`, name))
+	}
+
+	return floatValue
+}
+
+// getDurationEnvOrDefault will try getting an environment variable and parse
+// it as a duration, for example "30s". In case the variable is not set it will
+// return the default value.
+func getDurationEnvOrDefault(name string, def time.Duration) time.Duration {
+	value, exists := os.LookupEnv(name)
+	if !exists {
+		return def
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Sprintf(`Environment variable "%s" is not a duration`, name))
+	}
+
+	return duration
+}
+
 // createLogger will create a zap sugared logger with the specified log level.
 func createLogger(levelName string) (*zap.SugaredLogger, error) {
 	levelByName := map[string]zapcore.Level{
@@ -14,8 +14,11 @@ import (
 type Client interface {
 	CreateCluster(cluster Cluster) (*Cluster, error)
 	UpdateCluster(cluster Cluster) (*Cluster, error)
+	RenameCluster(name string, cluster Cluster) (*Cluster, error)
+	PatchCluster(name string, patch ClusterPatch) (*Cluster, error)
 	DeleteCluster(name string) error
 	GetCluster(name string) (*Cluster, error)
+	ListClusters(pageNum int, itemsPerPage int) (*ClusterPage, error)
 	GetDashboardURL(clusterName string) string
 
 	CreateUser(user User) (*User, error)
@@ -23,6 +26,16 @@ type Client interface {
 	DeleteUser(name string) error
 
 	GetProvider(name string) (*Provider, error)
+	CreateSearchDeployment(clusterName string, deployment SearchDeployment) (*SearchDeployment, error)
+	UpdateSearchDeployment(clusterName string, deployment SearchDeployment) (*SearchDeployment, error)
+	GetSearchDeployment(clusterName string) (*SearchDeployment, error)
+	DeleteSearchDeployment(clusterName string) error
+
+	GetProcesses() ([]Process, error)
+	GetOpenAlerts() ([]Alert, error)
+
+	GetProject() (*Project, error)
+	UpdateAuditing(auditing Auditing) (*Auditing, error)
 }
 
 // HTTPClient is the main implementation of the Client interface which
@@ -33,6 +46,10 @@ type HTTPClient struct {
 	PublicKey  string
 	PrivateKey string
 
+	// UserAgent is sent with every request so they can be attributed to the
+	// client in the Atlas logs. The Go default is used if empty.
+	UserAgent string
+
 	HTTP *http.Client
 }
 
@@ -42,6 +59,8 @@ var (
 
 	ErrUnauthorized = errors.New("Invalid API key")
 
+	ErrRateLimited = errors.New("Too many requests to the Atlas API")
+
 	ErrClusterNotFound      = errors.New("Cluster not found")
 	ErrClusterAlreadyExists = errors.New("Cluster already exists")
 
@@ -50,8 +69,13 @@ var (
 )
 
 const (
-	publicAPIPath  = "/api/atlas/v1.0"
-	privateAPIPath = "/api/private/unauth"
+	publicAPIPath   = "/api/atlas/v1.0"
+	publicAPIV2Path = "/api/atlas/v2"
+	privateAPIPath  = "/api/private/unauth"
+
+	// publicAPIV2Version is the resource version requested from the v2
+	// public API, which is versioned using the Accept header.
+	publicAPIV2Version = "application/vnd.atlas.2023-01-01+json"
 )
 
 // NewClient will create a new HTTPClient with the specified connection details.
@@ -65,6 +89,20 @@ func NewClient(baseURL string, groupID string, publicKey string, privateKey stri
 	}
 }
 
+// ForProject returns a copy of the client acting on another project the API
+// key has access to. Both clients share the same HTTP client.
+func (c *HTTPClient) ForProject(groupID string) Client {
+	project := *c
+	project.GroupID = groupID
+	return &project
+}
+
+// Identity returns the API key and project requests are made with, formatted
+// as <PUBLIC_KEY>@<GROUP_ID>.
+func (c *HTTPClient) Identity() string {
+	return c.PublicKey + "@" + c.GroupID
+}
+
 // requestPublic will make a request to an endpoint in the public API.
 // The URL will be constructed by prepending the group to the specified endpoint.
 func (c *HTTPClient) requestPublic(method string, endpoint string, body interface{}, response interface{}) error {
@@ -72,6 +110,14 @@ func (c *HTTPClient) requestPublic(method string, endpoint string, body interfac
 	return c.request(method, url, body, response)
 }
 
+// requestPublicV2 will make a request to an endpoint in the versioned v2
+// public API. Some resources, such as search deployments, are only available
+// in the v2 API.
+func (c *HTTPClient) requestPublicV2(method string, endpoint string, body interface{}, response interface{}) error {
+	url := fmt.Sprintf("%s%s/groups/%s/%s", c.BaseURL, publicAPIV2Path, c.GroupID, endpoint)
+	return c.requestWithAccept(method, url, publicAPIV2Version, body, response)
+}
+
 // requestPrivate will make a request to an endpoint in the private API.
 func (c *HTTPClient) requestPrivate(method string, endpoint string, body interface{}, response interface{}) error {
 	url := fmt.Sprintf("%s%s/%s", c.BaseURL, privateAPIPath, endpoint)
@@ -82,6 +128,12 @@ func (c *HTTPClient) requestPrivate(method string, endpoint string, body interfa
 // If body is passed it will be JSON encoded and included with the request.
 // If the request was successful the response will be decoded into response.
 func (c *HTTPClient) request(method string, url string, body interface{}, response interface{}) error {
+	return c.requestWithAccept(method, url, "", body, response)
+}
+
+// requestWithAccept makes an HTTP request like request, additionally setting
+// the Accept header unless accept is empty.
+func (c *HTTPClient) requestWithAccept(method string, url string, accept string, body interface{}, response interface{}) error {
 	var data io.Reader
 
 	// Construct the JSON payload if a body has been passed
@@ -108,6 +160,10 @@ func (c *HTTPClient) request(method string, url string, body interface{}, respon
 	req.Header.Set("Authorization", auth)
 
 	req.Header.Set("Content-Type", "application/json")
+	c.setUserAgent(req)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
 
 	// Perform HTTP request.
 	resp, err := c.HTTP.Do(req)
@@ -136,6 +192,11 @@ func (c *HTTPClient) request(method string, url string, body interface{}, respon
 		return ErrUnauthorized
 	}
 
+	// Rate limited responses aren't guaranteed to have a JSON body.
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+
 	// Decode error if request was unsuccessful.
 	var errorResponse struct {
 		Code        string `json:"errorCode"`
@@ -146,7 +207,14 @@ func (c *HTTPClient) request(method string, url string, body interface{}, respon
 		return err
 	}
 
-	return errorFromErrorCode(errorResponse.Code, errorResponse.Description)
+	return errorFromErrorCode(resp.StatusCode, errorResponse.Code, errorResponse.Description)
+}
+
+// setUserAgent sets the User-Agent header of a request if the client has one.
+func (c *HTTPClient) setUserAgent(req *http.Request) {
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
 }
 
 // digestAuth performs an unauthenticated request to retrieve a digest nonce.
@@ -157,6 +225,8 @@ func (c *HTTPClient) digestAuth(method string, endpoint string) (string, error)
 		return "", err
 	}
 
+	c.setUserAgent(authReq)
+
 	resp, err := c.HTTP.Do(authReq)
 	if err != nil {
 		return "", err
@@ -179,8 +249,20 @@ func (c *HTTPClient) digestAuth(method string, endpoint string) (string, error)
 	return getDigestAuthrization(parts), nil
 }
 
+// Error is an error returned by the Atlas API which doesn't correspond to
+// one of the predefined errors.
+type Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("atlas error: [%s] %s", e.Code, e.Description)
+}
+
 // errorFromErrorCode converts an Atlas API error code into an error.
-func errorFromErrorCode(code string, description string) error {
+func errorFromErrorCode(statusCode int, code string, description string) error {
 	errorsByCode := map[string]error{
 		"CLUSTER_NOT_FOUND":                  ErrClusterNotFound,
 		"CLUSTER_ALREADY_REQUESTED_DELETION": ErrClusterNotFound,
@@ -194,7 +276,11 @@ func errorFromErrorCode(code string, description string) error {
 	// Default to an error wrapping the Atlas error description.
 	err := errorsByCode[code]
 	if err == nil {
-		return fmt.Errorf("atlas error: [%s] %s", code, description)
+		return &Error{
+			StatusCode:  statusCode,
+			Code:        code,
+			Description: description,
+		}
 	}
 
 	return err
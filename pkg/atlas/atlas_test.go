@@ -16,11 +16,17 @@ import (
 // and the specified method. The HTTP server will simulate the digest
 // authentication and return the specified status and response.
 func setupTest(t *testing.T, expectedPath string, method string, status int, response interface{}) (*HTTPClient, *httptest.Server) {
+	return setupTestWithAPIPath(t, publicAPIPath, expectedPath, method, status, response)
+}
+
+// setupTestWithAPIPath will set up a test like setupTest, for an endpoint in
+// the API served under apiPath.
+func setupTestWithAPIPath(t *testing.T, apiPath string, expectedPath string, method string, status int, response interface{}) (*HTTPClient, *httptest.Server) {
 	const groupID = "group"
 	const publicKey = "pubkey"
 	const privateKey = "privkey"
 
-	fullPath := fmt.Sprintf("%s/groups/%s%s", publicAPIPath, groupID, expectedPath)
+	fullPath := fmt.Sprintf("%s/groups/%s%s", apiPath, groupID, expectedPath)
 
 	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		assert.Equal(t, fullPath, req.URL.String())
@@ -55,3 +61,71 @@ func errorResponse(code string) interface{} {
 		code,
 	}
 }
+
+func TestUnknownErrorCode(t *testing.T) {
+	atlas, server := setupTest(t, "/clusters/Cluster", http.MethodGet, 400, errorResponse("INVALID_ATTRIBUTE"))
+	defer server.Close()
+
+	_, err := atlas.GetCluster("Cluster")
+	assert.Equal(t, &Error{StatusCode: 400, Code: "INVALID_ATTRIBUTE"}, err)
+}
+
+func TestRateLimited(t *testing.T) {
+	atlas, server := setupTest(t, "/clusters/Cluster", http.MethodGet, http.StatusTooManyRequests, nil)
+	defer server.Close()
+
+	_, err := atlas.GetCluster("Cluster")
+	assert.Equal(t, ErrRateLimited, err)
+}
+
+func TestUserAgent(t *testing.T) {
+	userAgents := []string{}
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		userAgents = append(userAgents, req.UserAgent())
+
+		if len(req.Header["Authorization"]) == 0 {
+			rw.Header().Set("WWW-Authenticate", `Digest realm="realm", nonce="nonce", qop="auth"`)
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		rw.Write([]byte(`{"name": "Cluster"}`))
+	}))
+	defer s.Close()
+
+	client := NewClient(s.URL, "group", "pubkey", "privkey")
+	client.HTTP = s.Client()
+	client.UserAgent = "atlas-osb/1.2.0 (production)"
+
+	_, err := client.GetCluster("Cluster")
+	assert.NoError(t, err)
+
+	// Both the digest challenge and the authenticated request are attributed.
+	assert.Equal(t, []string{"atlas-osb/1.2.0 (production)", "atlas-osb/1.2.0 (production)"}, userAgents)
+}
+
+func TestForProject(t *testing.T) {
+	paths := []string{}
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.URL.Path)
+
+		if len(req.Header["Authorization"]) == 0 {
+			rw.Header().Set("WWW-Authenticate", `Digest realm="realm", nonce="nonce", qop="auth"`)
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		rw.Write([]byte(`{"name": "Cluster"}`))
+	}))
+	defer s.Close()
+
+	client := NewClient(s.URL, "group", "pubkey", "privkey")
+	client.HTTP = s.Client()
+
+	_, err := client.ForProject("other").GetCluster("Cluster")
+	assert.NoError(t, err)
+	assert.Equal(t, publicAPIPath+"/groups/other/clusters/Cluster", paths[len(paths)-1])
+
+	// The original client keeps its project.
+	assert.Equal(t, "group", client.GroupID)
+}
@@ -33,7 +33,9 @@ type Cluster struct {
 	EncryptionAtRestProvider string            `json:"encryptionAtRestProvider,omitempty"`
 	MongoDBMajorVersion      string            `json:"mongoDBMajorVersion,omitempty"`
 	NumShards                uint              `json:"numShards,omitempty"`
+	Paused                   bool              `json:"paused,omitempty"`
 	ProviderBackupEnabled    bool              `json:"providerBackupEnabled,omitempty"`
+	ReplicaSetName           string            `json:"replicaSetName,omitempty"`
 	ReplicationSpecs         []ReplicationSpec `json:"replicationSpecs,omitempty"`
 	ProviderSettings         *ProviderSettings `json:"providerSettings"`
 
@@ -73,6 +75,37 @@ type BIConnectorConfig struct {
 	ReadPreference string `json:"readPreference,omitempty"`
 }
 
+// ClusterPatch is a partial update of a cluster. Only the fields which are
+// set are sent. Unlike in Cluster, the booleans are pointers so settings can
+// be switched off.
+type ClusterPatch struct {
+	Name                     string            `json:"name,omitempty"`
+	Labels                   []Label           `json:"labels,omitempty"`
+	AutoScaling              *AutoScalingPatch `json:"autoScaling,omitempty"`
+	BackupEnabled            *bool             `json:"backupEnabled,omitempty"`
+	BIConnector              *BIConnectorPatch `json:"biConnector,omitempty"`
+	ClusterType              string            `json:"clusterType,omitempty"`
+	DiskSizeGB               float64           `json:"diskSizeGB,omitempty"`
+	EncryptionAtRestProvider string            `json:"encryptionAtRestProvider,omitempty"`
+	MongoDBMajorVersion      string            `json:"mongoDBMajorVersion,omitempty"`
+	NumShards                uint              `json:"numShards,omitempty"`
+	Paused                   *bool             `json:"paused,omitempty"`
+	ProviderBackupEnabled    *bool             `json:"providerBackupEnabled,omitempty"`
+	ReplicationSpecs         []ReplicationSpec `json:"replicationSpecs,omitempty"`
+	ProviderSettings         *ProviderSettings `json:"providerSettings,omitempty"`
+}
+
+// AutoScalingPatch is a partial update of the autoscaling settings.
+type AutoScalingPatch struct {
+	DiskGBEnabled *bool `json:"diskGBEnabled,omitempty"`
+}
+
+// BIConnectorPatch is a partial update of the BI connector settings.
+type BIConnectorPatch struct {
+	Enabled        *bool  `json:"enabled,omitempty"`
+	ReadPreference string `json:"readPreference,omitempty"`
+}
+
 // ProviderSettings represents the provider setting for a cluster.
 type ProviderSettings struct {
 	ProviderName        string `json:"providerName"`
@@ -122,6 +155,29 @@ func (c *HTTPClient) UpdateCluster(cluster Cluster) (*Cluster, error) {
 	return &resultingCluster, err
 }
 
+// RenameCluster will update the cluster with the specified name
+// asynchronously, changing its name to the one of the passed cluster. The
+// hosts of the cluster change with its name.
+// PATCH /clusters/{CLUSTER-NAME}
+func (c *HTTPClient) RenameCluster(name string, cluster Cluster) (*Cluster, error) {
+	path := fmt.Sprintf("clusters/%s", name)
+
+	var resultingCluster Cluster
+	err := c.requestPublic(http.MethodPatch, path, cluster, &resultingCluster)
+	return &resultingCluster, err
+}
+
+// PatchCluster will apply a partial update to the cluster with the specified
+// name asynchronously. Passing a name in the patch renames the cluster.
+// PATCH /clusters/{CLUSTER-NAME}
+func (c *HTTPClient) PatchCluster(name string, patch ClusterPatch) (*Cluster, error) {
+	path := fmt.Sprintf("clusters/%s", name)
+
+	var resultingCluster Cluster
+	err := c.requestPublic(http.MethodPatch, path, patch, &resultingCluster)
+	return &resultingCluster, err
+}
+
 // DeleteCluster will terminate a cluster asynchronously.
 // DELETE /clusters/{CLUSTER-NAME}
 func (c *HTTPClient) DeleteCluster(name string) error {
@@ -139,6 +195,23 @@ func (c *HTTPClient) GetCluster(name string) (*Cluster, error) {
 	return &cluster, err
 }
 
+// ClusterPage is a page of the clusters in a project.
+type ClusterPage struct {
+	Results    []Cluster `json:"results"`
+	TotalCount int       `json:"totalCount"`
+}
+
+// ListClusters will list a page of the clusters in the project. Pages are
+// numbered from 1.
+// GET /clusters?pageNum={pageNum}&itemsPerPage={itemsPerPage}
+func (c *HTTPClient) ListClusters(pageNum int, itemsPerPage int) (*ClusterPage, error) {
+	path := fmt.Sprintf("clusters?pageNum=%d&itemsPerPage=%d", pageNum, itemsPerPage)
+
+	var page ClusterPage
+	err := c.requestPublic(http.MethodGet, path, nil, &page)
+	return &page, err
+}
+
 // GetDashboardURL prepares the url where the specific cluster can be found in the Dashboard UI
 func (c *HTTPClient) GetDashboardURL(clusterName string) string {
 	return fmt.Sprintf("%s/v2/%s#clusters/detail/%s", c.BaseURL, c.GroupID, clusterName)
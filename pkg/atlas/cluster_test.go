@@ -1,6 +1,7 @@
 package atlas
 
 import (
+	"encoding/json"
 	"net/http"
 	"testing"
 
@@ -54,6 +55,48 @@ func TestUpdateCluster(t *testing.T) {
 	assert.Equal(t, &expected, cluster)
 }
 
+func TestRenameCluster(t *testing.T) {
+	expected := Cluster{
+		Name:      "Renamed",
+		StateName: ClusterStateUpdating,
+	}
+
+	atlas, server := setupTest(t, "/clusters/Cluster", http.MethodPatch, 200, expected)
+	defer server.Close()
+
+	cluster, err := atlas.RenameCluster("Cluster", expected)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &expected, cluster)
+}
+
+func TestPatchCluster(t *testing.T) {
+	expected := Cluster{
+		Name:      "Cluster",
+		StateName: ClusterStateUpdating,
+	}
+
+	atlas, server := setupTest(t, "/clusters/Cluster", http.MethodPatch, 200, expected)
+	defer server.Close()
+
+	disabled := false
+	cluster, err := atlas.PatchCluster("Cluster", ClusterPatch{BackupEnabled: &disabled})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &expected, cluster)
+}
+
+func TestClusterPatchSwitchesSettingsOff(t *testing.T) {
+	disabled := false
+	body, err := json.Marshal(ClusterPatch{
+		BackupEnabled: &disabled,
+		AutoScaling:   &AutoScalingPatch{DiskGBEnabled: &disabled},
+	})
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"backupEnabled": false, "autoScaling": {"diskGBEnabled": false}}`, string(body))
+}
+
 func TestUpdateNonexistentCluster(t *testing.T) {
 	expected := Cluster{
 		Name:        "Cluster",
@@ -85,6 +128,21 @@ func TestGetCluster(t *testing.T) {
 	assert.Equal(t, expected, cluster)
 }
 
+func TestListClusters(t *testing.T) {
+	expected := &ClusterPage{
+		Results:    []Cluster{Cluster{Name: "Cluster", StateName: ClusterStateIdle}},
+		TotalCount: 3,
+	}
+
+	atlas, server := setupTest(t, "/clusters?pageNum=2&itemsPerPage=1", http.MethodGet, 200, expected)
+	defer server.Close()
+
+	page, err := atlas.ListClusters(2, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, page)
+}
+
 func TestGetNonexistentCluster(t *testing.T) {
 	clusterName := "Cluster"
 	atlas, server := setupTest(t, "/clusters/"+clusterName, http.MethodGet, 404, errorResponse("CLUSTER_NOT_FOUND"))
@@ -14,6 +14,16 @@ type Provider struct {
 
 // InstanceSize represents an available cluster size.
 type InstanceSize struct {
+	Name             string   `json:"name"`
+	NumCPUs          float64  `json:"numCpus,omitempty"`
+	RAMSizeGB        float64  `json:"ramSizeGB,omitempty"`
+	MaxDiskSizeGB    float64  `json:"maxDiskSizeGB,omitempty"`
+	AvailableRegions []Region `json:"availableRegions,omitempty"`
+}
+
+// Region represents a region in which an instance size is available.
+type Region struct {
+	Key  string `json:"key"`
 	Name string `json:"name"`
 }
 
@@ -26,3 +36,44 @@ func (c *HTTPClient) GetProvider(name string) (*Provider, error) {
 	err := c.requestPrivate(http.MethodGet, path, nil, &provider)
 	return &provider, err
 }
+
+// connectionLimits contains the maximum number of concurrent incoming
+// connections for each instance size. Atlas doesn't allow these to be
+// configured per cluster and they aren't returned by the provider options,
+// hence they are kept here as documented by Atlas.
+var connectionLimits = map[string]int{
+	"M0":        500,
+	"M2":        500,
+	"M5":        500,
+	"M10":       1500,
+	"M20":       3000,
+	"M30":       3000,
+	"M40":       6000,
+	"R40":       6000,
+	"M40_NVME":  6000,
+	"M50":       16000,
+	"R50":       16000,
+	"M50_NVME":  16000,
+	"M60":       32000,
+	"R60":       32000,
+	"M60_NVME":  32000,
+	"M80":       96000,
+	"R80":       96000,
+	"M80_NVME":  96000,
+	"M140":      96000,
+	"M200":      128000,
+	"R200":      128000,
+	"M200_NVME": 128000,
+	"M300":      128000,
+	"R300":      128000,
+	"R400":      128000,
+	"M400_NVME": 128000,
+	"R700":      128000,
+}
+
+// ConnectionLimit returns the maximum number of concurrent connections a
+// cluster of the named instance size accepts. Zero is returned for unknown
+// instance sizes.
+func ConnectionLimit(instanceSizeName string) int {
+	return connectionLimits[instanceSizeName]
+}
@@ -0,0 +1,56 @@
+package atlas
+
+import (
+	"net/http"
+)
+
+// The types of processes which accept writes for a cluster.
+var (
+	ProcessTypeReplicaPrimary = "REPLICA_PRIMARY"
+	ProcessTypeShardMongos    = "SHARD_MONGOS"
+)
+
+// AlertStatusOpen is the status of alerts which haven't been resolved.
+var AlertStatusOpen = "OPEN"
+
+// Process represents a single MongoDB process running in the project.
+type Process struct {
+	ID             string `json:"id"`
+	Hostname       string `json:"hostname"`
+	Port           int    `json:"port"`
+	ReplicaSetName string `json:"replicaSetName,omitempty"`
+	TypeName       string `json:"typeName"`
+	LastPing       string `json:"lastPing,omitempty"`
+}
+
+// Alert represents an alert raised in the project.
+type Alert struct {
+	ID              string `json:"id"`
+	EventTypeName   string `json:"eventTypeName"`
+	Status          string `json:"status"`
+	ClusterName     string `json:"clusterName,omitempty"`
+	HostnameAndPort string `json:"hostnameAndPort,omitempty"`
+	Created         string `json:"created,omitempty"`
+}
+
+// GetProcesses will list all MongoDB processes in the project.
+// GET /processes
+func (c *HTTPClient) GetProcesses() ([]Process, error) {
+	var response struct {
+		Results []Process `json:"results"`
+	}
+
+	err := c.requestPublic(http.MethodGet, "processes", nil, &response)
+	return response.Results, err
+}
+
+// GetOpenAlerts will list all unresolved alerts in the project.
+// GET /alerts?status=OPEN
+func (c *HTTPClient) GetOpenAlerts() ([]Alert, error) {
+	var response struct {
+		Results []Alert `json:"results"`
+	}
+
+	err := c.requestPublic(http.MethodGet, "alerts?status="+AlertStatusOpen, nil, &response)
+	return response.Results, err
+}
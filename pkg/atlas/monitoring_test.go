@@ -0,0 +1,36 @@
+package atlas
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProcesses(t *testing.T) {
+	expected := []Process{
+		Process{ID: "host:27017", Hostname: "host", Port: 27017, TypeName: ProcessTypeReplicaPrimary},
+	}
+
+	atlas, server := setupTest(t, "/processes", http.MethodGet, 200, map[string]interface{}{"results": expected})
+	defer server.Close()
+
+	processes, err := atlas.GetProcesses()
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, processes)
+}
+
+func TestGetOpenAlerts(t *testing.T) {
+	expected := []Alert{
+		Alert{ID: "alert", EventTypeName: "OUTSIDE_METRIC_THRESHOLD", Status: AlertStatusOpen, ClusterName: "Cluster"},
+	}
+
+	atlas, server := setupTest(t, "/alerts?status=OPEN", http.MethodGet, 200, map[string]interface{}{"results": expected})
+	defer server.Close()
+
+	alerts, err := atlas.GetOpenAlerts()
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, alerts)
+}
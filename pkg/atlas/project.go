@@ -0,0 +1,38 @@
+package atlas
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Project represents the Atlas project (group) the client is scoped to.
+type Project struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	OrgID string `json:"orgId"`
+}
+
+// GetProject will fetch the project the client is scoped to.
+// GET /groups/{GROUP_ID}
+func (c *HTTPClient) GetProject() (*Project, error) {
+	var project Project
+
+	url := fmt.Sprintf("%s%s/groups/%s", c.BaseURL, publicAPIPath, c.GroupID)
+	err := c.request(http.MethodGet, url, nil, &project)
+	return &project, err
+}
+
+// Auditing is the database auditing configuration of a project.
+type Auditing struct {
+	Enabled bool `json:"enabled"`
+}
+
+// UpdateAuditing will change the database auditing configuration of the
+// project the client is scoped to.
+// PATCH /groups/{GROUP_ID}/auditLog
+func (c *HTTPClient) UpdateAuditing(auditing Auditing) (*Auditing, error) {
+	var result Auditing
+
+	err := c.requestPublic(http.MethodPatch, "auditLog", auditing, &result)
+	return &result, err
+}
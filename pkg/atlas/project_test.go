@@ -0,0 +1,30 @@
+package atlas
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProject(t *testing.T) {
+	expected := &Project{ID: "group", Name: "Project", OrgID: "org"}
+
+	atlas, server := setupTest(t, "", http.MethodGet, 200, expected)
+	defer server.Close()
+
+	project, err := atlas.GetProject()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, project)
+}
+
+func TestUpdateAuditing(t *testing.T) {
+	expected := &Auditing{Enabled: true}
+
+	atlas, server := setupTest(t, "/auditLog", http.MethodPatch, 200, expected)
+	defer server.Close()
+
+	auditing, err := atlas.UpdateAuditing(Auditing{Enabled: true})
+	assert.NoError(t, err)
+	assert.Equal(t, expected, auditing)
+}
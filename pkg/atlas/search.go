@@ -0,0 +1,82 @@
+package atlas
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// All states a search deployment can be in.
+var (
+	SearchDeploymentStateIdle     = "IDLE"
+	SearchDeploymentStateUpdating = "UPDATING"
+)
+
+// ErrSearchDeploymentNotFound is returned when a cluster has no dedicated
+// search nodes.
+var ErrSearchDeploymentNotFound = errors.New("Search deployment not found")
+
+// SearchNodeSpec describes a set of dedicated search nodes.
+type SearchNodeSpec struct {
+	InstanceSize string `json:"instanceSize"`
+	NodeCount    int    `json:"nodeCount"`
+}
+
+// SearchDeployment represents the dedicated search nodes of a cluster.
+type SearchDeployment struct {
+	Specs []SearchNodeSpec `json:"specs"`
+
+	// Read-only attributes
+	ID        string `json:"id,omitempty"`
+	StateName string `json:"stateName,omitempty"`
+}
+
+// CreateSearchDeployment will deploy dedicated search nodes for a cluster
+// asynchronously.
+// POST /clusters/{CLUSTER-NAME}/search/deployment
+func (c *HTTPClient) CreateSearchDeployment(clusterName string, deployment SearchDeployment) (*SearchDeployment, error) {
+	path := fmt.Sprintf("clusters/%s/search/deployment", clusterName)
+
+	var resultingDeployment SearchDeployment
+	err := c.requestPublicV2(http.MethodPost, path, deployment, &resultingDeployment)
+	return &resultingDeployment, err
+}
+
+// UpdateSearchDeployment will change the dedicated search nodes of a cluster
+// asynchronously.
+// PATCH /clusters/{CLUSTER-NAME}/search/deployment
+func (c *HTTPClient) UpdateSearchDeployment(clusterName string, deployment SearchDeployment) (*SearchDeployment, error) {
+	path := fmt.Sprintf("clusters/%s/search/deployment", clusterName)
+
+	var resultingDeployment SearchDeployment
+	err := c.requestPublicV2(http.MethodPatch, path, deployment, &resultingDeployment)
+	return &resultingDeployment, err
+}
+
+// GetSearchDeployment will find the dedicated search nodes of a cluster.
+// GET /clusters/{CLUSTER-NAME}/search/deployment
+func (c *HTTPClient) GetSearchDeployment(clusterName string) (*SearchDeployment, error) {
+	path := fmt.Sprintf("clusters/%s/search/deployment", clusterName)
+
+	var deployment SearchDeployment
+	err := c.requestPublicV2(http.MethodGet, path, nil, &deployment)
+	if atlasErr, ok := err.(*Error); ok && atlasErr.StatusCode == http.StatusNotFound {
+		return nil, ErrSearchDeploymentNotFound
+	}
+
+	return &deployment, err
+}
+
+// DeleteSearchDeployment will remove the dedicated search nodes of a cluster
+// asynchronously.
+// DELETE /clusters/{CLUSTER-NAME}/search/deployment
+func (c *HTTPClient) DeleteSearchDeployment(clusterName string) error {
+	path := fmt.Sprintf("clusters/%s/search/deployment", clusterName)
+
+	err := c.requestPublicV2(http.MethodDelete, path, nil, nil)
+	if atlasErr, ok := err.(*Error); ok && atlasErr.StatusCode == http.StatusNotFound {
+		return ErrSearchDeploymentNotFound
+	}
+
+	return err
+}
@@ -0,0 +1,41 @@
+package atlas
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSearchDeployment(t *testing.T) {
+	expected := SearchDeployment{
+		Specs: []SearchNodeSpec{
+			SearchNodeSpec{InstanceSize: "S20_HIGHCPU_NVME", NodeCount: 2},
+		},
+		StateName: "UPDATING",
+	}
+
+	atlas, server := setupTestWithAPIPath(t, publicAPIV2Path, "/clusters/Cluster/search/deployment", http.MethodPost, 200, expected)
+	defer server.Close()
+
+	deployment, err := atlas.CreateSearchDeployment("Cluster", SearchDeployment{Specs: expected.Specs})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &expected, deployment)
+}
+
+func TestGetNonexistentSearchDeployment(t *testing.T) {
+	atlas, server := setupTestWithAPIPath(t, publicAPIV2Path, "/clusters/Cluster/search/deployment", http.MethodGet, 404, errorResponse("SEARCH_DEPLOYMENT_DOES_NOT_EXIST"))
+	defer server.Close()
+
+	_, err := atlas.GetSearchDeployment("Cluster")
+	assert.Equal(t, ErrSearchDeploymentNotFound, err)
+}
+
+func TestDeleteSearchDeployment(t *testing.T) {
+	atlas, server := setupTestWithAPIPath(t, publicAPIV2Path, "/clusters/Cluster/search/deployment", http.MethodDelete, 202, nil)
+	defer server.Close()
+
+	err := atlas.DeleteSearchDeployment("Cluster")
+	assert.NoError(t, err)
+}
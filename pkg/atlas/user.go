@@ -7,11 +7,43 @@ import (
 
 // User represents a single Atlas database user.
 type User struct {
-	Username     string `json:"username"`
-	Password     string `json:"password"`
-	DatabaseName string `json:"databaseName"`
-	LDAPAuthType string `json:"ldapAuthType,omitempty"`
-	Roles        []Role `json:"roles,omitempty"`
+	Username     string  `json:"username"`
+	Password     string  `json:"password"`
+	DatabaseName string  `json:"databaseName"`
+	LDAPAuthType string  `json:"ldapAuthType,omitempty"`
+	Roles        []Role  `json:"roles,omitempty"`
+	Labels       []Label `json:"labels,omitempty"`
+
+	// Scopes limit the clusters the user can access. Users without scopes
+	// can access all clusters of the project.
+	Scopes []Scope `json:"scopes,omitempty"`
+}
+
+// ScopeTypeCluster is the type of scopes limiting a user to a cluster.
+const ScopeTypeCluster = "CLUSTER"
+
+// Scope represents a resource a database user is limited to.
+type Scope struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// CanAccessCluster returns whether the user's scopes allow it to access the
+// cluster with the specified name.
+func (u User) CanAccessCluster(clusterName string) bool {
+	clusterScopes := 0
+	for _, scope := range u.Scopes {
+		if scope.Type != ScopeTypeCluster {
+			continue
+		}
+
+		clusterScopes++
+		if scope.Name == clusterName {
+			return true
+		}
+	}
+
+	return clusterScopes == 0
 }
 
 // Role represents the role of a database user.
@@ -0,0 +1,267 @@
+package broker
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+)
+
+// The page sizes of admin listings.
+const (
+	defaultAdminPageLimit = 50
+	maxAdminPageLimit     = 500
+)
+
+// AdminInstance is the summary of an instance in admin listings. Overdue is
+// set for expired instances which haven't been deleted yet.
+type AdminInstance struct {
+	ID           string     `json:"id"`
+	ServiceID    string     `json:"service_id"`
+	PlanID       string     `json:"plan_id"`
+	Provider     string     `json:"provider"`
+	ProjectID    string     `json:"project_id"`
+	OrgID        string     `json:"org_id"`
+	ClusterState string     `json:"cluster_state"`
+	Ephemeral    bool       `json:"ephemeral"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Overdue      bool       `json:"overdue"`
+}
+
+// AdminBinding is the summary of a binding in admin listings. Credentials are
+// never listed.
+type AdminBinding struct {
+	ID         string `json:"id"`
+	InstanceID string `json:"instance_id"`
+}
+
+// InstanceList is a page of instances. NextOffset is set if there are more.
+type InstanceList struct {
+	Instances  []AdminInstance `json:"instances"`
+	NextOffset *int            `json:"next_offset,omitempty"`
+}
+
+// BindingList is a page of bindings. NextOffset is set if there are more.
+type BindingList struct {
+	Bindings   []AdminBinding `json:"bindings"`
+	NextOffset *int           `json:"next_offset,omitempty"`
+}
+
+// AttachAdminRoutes will attach the routes of the admin API to a router.
+// Requests must pass the token as a bearer token, and may pass the name of
+// a configured Atlas key to act with.
+func AttachAdminRoutes(router *mux.Router, broker *Broker, token string) {
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/instances", broker.handleListInstances).Methods(http.MethodGet)
+	admin.HandleFunc("/instances/groups", broker.handleGroupInstances).Methods(http.MethodGet)
+	admin.HandleFunc("/instances/{instance_id}/history", broker.handleParameterHistory).Methods(http.MethodGet)
+	admin.HandleFunc("/instances/{instance_id}/update-preview", broker.handleUpdatePreview).Methods(http.MethodPost)
+	admin.HandleFunc("/bindings", broker.handleListBindings).Methods(http.MethodGet)
+	admin.HandleFunc("/state", broker.handleExportState).Methods(http.MethodGet)
+	admin.HandleFunc("/state", broker.handleImportState).Methods(http.MethodPost)
+	admin.HandleFunc("/catalog/refresh", broker.handleRefreshCatalog).Methods(http.MethodPost)
+	admin.Use(adminAuthMiddleware(token), broker.atlasKeyMiddleware)
+}
+
+// adminAuthMiddleware responds with 401 Unauthorized to requests which don't
+// pass the admin token.
+func adminAuthMiddleware(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			passed := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(passed), []byte(token)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// handleListInstances serves a page of instances, filtered by the provider,
+// plan_id, project_id, state, and ephemeral query parameters.
+func (b Broker) handleListInstances(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	offset, limit, err := pageFromQuery(query)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	filter, err := instanceFilterFromQuery(query)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	list, err := b.ListInstances(filter, offset, limit)
+	if err != nil {
+		b.logger.Errorw("Failed to list instances", "error", err)
+		respondWithError(w, err)
+		return
+	}
+
+	respond(w, http.StatusOK, list)
+}
+
+// handleListBindings serves a page of bindings, filtered by the instance_id
+// query parameter.
+func (b Broker) handleListBindings(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	offset, limit, err := pageFromQuery(query)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	list, err := b.ListBindings(state.BindingFilter{InstanceID: query.Get("instance_id")}, offset, limit)
+	if err != nil {
+		b.logger.Errorw("Failed to list bindings", "error", err)
+		respondWithError(w, err)
+		return
+	}
+
+	respond(w, http.StatusOK, list)
+}
+
+// instanceFilterFromQuery reads the provider, plan_id, project_id, state,
+// and ephemeral query parameters filtering instances.
+func instanceFilterFromQuery(query url.Values) (state.InstanceFilter, error) {
+	filter := state.InstanceFilter{
+		Provider:     query.Get("provider"),
+		PlanID:       query.Get("plan_id"),
+		ProjectID:    query.Get("project_id"),
+		ClusterState: query.Get("state"),
+	}
+
+	if value := query.Get("ephemeral"); value != "" {
+		ephemeral, err := strconv.ParseBool(value)
+		if err != nil {
+			return state.InstanceFilter{}, newInvalidQueryError("ephemeral", value)
+		}
+		filter.Ephemeral = &ephemeral
+	}
+
+	return filter, nil
+}
+
+// ListInstances will return a page of the instances recorded by the broker.
+func (b Broker) ListInstances(filter state.InstanceFilter, offset int, limit int) (*InstanceList, error) {
+	// One more instance than requested is fetched to tell whether there's
+	// another page.
+	instances, err := b.store.ListInstances(filter, offset, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &InstanceList{Instances: []AdminInstance{}}
+	if len(instances) > limit {
+		instances = instances[:limit]
+		list.NextOffset = nextOffset(offset, limit)
+	}
+
+	now := time.Now()
+	for _, instance := range instances {
+		summary := AdminInstance{
+			ID:           instance.ID,
+			ServiceID:    instance.ServiceID,
+			PlanID:       instance.PlanID,
+			Provider:     instance.Provider,
+			ProjectID:    instance.ProjectID,
+			OrgID:        instance.OrgID,
+			ClusterState: instance.ClusterState,
+			Ephemeral:    instance.Ephemeral,
+		}
+		if !instance.ExpiresAt.IsZero() {
+			expiresAt := instance.ExpiresAt
+			summary.ExpiresAt = &expiresAt
+			summary.Overdue = isDue(expiresAt, now)
+		}
+		list.Instances = append(list.Instances, summary)
+	}
+
+	return list, nil
+}
+
+// ListBindings will return a page of the bindings recorded by the broker.
+func (b Broker) ListBindings(filter state.BindingFilter, offset int, limit int) (*BindingList, error) {
+	bindings, err := b.store.ListBindings(filter, offset, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &BindingList{Bindings: []AdminBinding{}}
+	if len(bindings) > limit {
+		bindings = bindings[:limit]
+		list.NextOffset = nextOffset(offset, limit)
+	}
+
+	for _, binding := range bindings {
+		list.Bindings = append(list.Bindings, AdminBinding{
+			ID:         binding.ID,
+			InstanceID: binding.InstanceID,
+		})
+	}
+
+	return list, nil
+}
+
+func nextOffset(offset int, limit int) *int {
+	next := offset + limit
+	return &next
+}
+
+// pageFromQuery reads the offset and limit query parameters of a listing.
+func pageFromQuery(query url.Values) (offset int, limit int, err error) {
+	limit = defaultAdminPageLimit
+
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, newInvalidQueryError("offset", value)
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAdminPageLimit {
+			return 0, 0, newInvalidQueryError("limit", value)
+		}
+	}
+
+	return offset, limit, nil
+}
+
+func newInvalidQueryError(parameter string, value string) error {
+	return apiresponses.NewFailureResponse(fmt.Errorf(`Invalid value "%s" for query parameter %s`, value, parameter), http.StatusBadRequest, "invalid-query")
+}
+
+// recordCatalogEntry will store the service and plan of an instance along
+// with the state of its cluster. Empty values leave the recorded ones as is,
+// as updates only include the plan if it changes.
+func (b Broker) recordCatalogEntry(instanceID string, serviceID string, planID string, clusterState string) error {
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		if serviceID != "" {
+			instance.ServiceID = serviceID
+			instance.Provider = providerNameForServiceID(serviceID)
+		}
+
+		if planID != "" {
+			instance.PlanID = planID
+		}
+
+		if clusterState != "" {
+			instance.ClusterState = clusterState
+		}
+	})
+}
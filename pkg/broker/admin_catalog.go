@@ -0,0 +1,72 @@
+package broker
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+)
+
+// CatalogRefresh is the result of refreshing the catalog. Errors lists the
+// providers which couldn't be fetched when rewarming the cache.
+type CatalogRefresh struct {
+	Rewarmed        bool              `json:"rewarmed"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	Errors          map[string]string `json:"errors,omitempty"`
+}
+
+// handleRefreshCatalog invalidates the provider cache so the next catalog
+// requests fetch the providers from Atlas. If the rewarm query parameter is
+// true the providers are fetched again before responding.
+func (b Broker) handleRefreshCatalog(w http.ResponseWriter, r *http.Request) {
+	rewarm := false
+	if value := r.URL.Query().Get("rewarm"); value != "" {
+		var err error
+		rewarm, err = strconv.ParseBool(value)
+		if err != nil {
+			respondWithError(w, newInvalidQueryError("rewarm", value))
+			return
+		}
+	}
+
+	// The Atlas key of the request takes precedence over the catalog client.
+	// It's used directly as the cache is filled with the providers it
+	// fetches.
+	client, ok := r.Context().Value(ContextKeyAtlasClient).(atlas.Client)
+	if !ok {
+		client = b.config.CatalogClient
+	}
+
+	if rewarm && client == nil {
+		respondWithError(w, apiresponses.NewFailureResponse(errors.New("The catalog can't be rewarmed without an Atlas client"), http.StatusBadRequest, "rewarm-unavailable"))
+		return
+	}
+
+	refresh := b.RefreshCatalog(client, rewarm)
+	respond(w, http.StatusOK, refresh)
+}
+
+// RefreshCatalog will invalidate the provider cache and, if rewarm is true,
+// fetch the providers again using the client. Catalog requests in flight
+// aren't affected but don't cache the providers they fetch.
+func (b Broker) RefreshCatalog(client atlas.Client, rewarm bool) CatalogRefresh {
+	start := time.Now()
+	b.providers.invalidate()
+
+	refresh := CatalogRefresh{Rewarmed: rewarm}
+	if rewarm {
+		for providerName, err := range b.prewarmProviders(client) {
+			if refresh.Errors == nil {
+				refresh.Errors = map[string]string{}
+			}
+			refresh.Errors[providerName] = err.Error()
+		}
+	}
+
+	refresh.DurationSeconds = time.Since(start).Seconds()
+	b.logger.Infow("Refreshed catalog", "rewarmed", rewarm, "duration_seconds", refresh.DurationSeconds, "errors", refresh.Errors)
+	return refresh
+}
@@ -0,0 +1,113 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func setupAdminCatalogTest(client atlas.Client) (*Broker, *mux.Router) {
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		Whitelist:     Whitelist{"AWS": []string{"M10"}},
+		CatalogClient: client,
+	})
+
+	router := mux.NewRouter()
+	AttachAdminRoutes(router, broker, testAdminToken)
+
+	return broker, router
+}
+
+func TestAdminRefreshCatalog(t *testing.T) {
+	_, mock, _ := setupTest()
+	client := countingClient{MockAtlasClient: mock, fetched: map[string]int{}}
+	broker, router := setupAdminCatalogTest(client)
+
+	stale := &atlas.Provider{Name: "AWS"}
+	broker.providers.entries["AWS"] = providerCacheEntry{provider: stale, expiresAt: time.Now().Add(time.Hour)}
+
+	w := adminPost(router, "/admin/catalog/refresh", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var refresh CatalogRefresh
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &refresh))
+	assert.False(t, refresh.Rewarmed)
+
+	_, cached := broker.providers.entries["AWS"]
+	assert.False(t, cached, "Expected the stale provider to be gone")
+	assert.Equal(t, 0, client.fetched["AWS"])
+
+	// Rewarming fetches the whitelisted providers again.
+	w = adminPost(router, "/admin/catalog/refresh?rewarm=true", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, client.fetched["AWS"])
+
+	entry, cached := broker.providers.entries["AWS"]
+	if assert.True(t, cached) {
+		assert.NotEqual(t, stale, entry.provider)
+		assert.Contains(t, entry.provider.InstanceSizes, "M10")
+	}
+}
+
+func TestAdminRefreshCatalogErrors(t *testing.T) {
+	_, mock, _ := setupTest()
+	_, router := setupAdminCatalogTest(countingClient{MockAtlasClient: mock, fetched: map[string]int{}, err: errors.New("unavailable")})
+
+	w := adminPost(router, "/admin/catalog/refresh?rewarm=true", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var refresh CatalogRefresh
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &refresh))
+	assert.True(t, refresh.Rewarmed)
+	assert.Equal(t, map[string]string{"AWS": "unavailable"}, refresh.Errors)
+
+	assert.Equal(t, http.StatusBadRequest, adminPost(router, "/admin/catalog/refresh?rewarm=maybe", nil).Code)
+
+	// Rewarming requires a client.
+	_, router = setupAdminCatalogTest(nil)
+	assert.Equal(t, http.StatusBadRequest, adminPost(router, "/admin/catalog/refresh?rewarm=true", nil).Code)
+	assert.Equal(t, http.StatusOK, adminPost(router, "/admin/catalog/refresh", nil).Code)
+}
+
+// blockingClient blocks fetching providers until released.
+type blockingClient struct {
+	MockAtlasClient
+	fetching chan struct{}
+	release  chan struct{}
+}
+
+func (c blockingClient) GetProvider(name string) (*atlas.Provider, error) {
+	c.fetching <- struct{}{}
+	<-c.release
+	return c.MockAtlasClient.GetProvider(name)
+}
+
+func TestProviderCacheInvalidatedWhileFetching(t *testing.T) {
+	_, mock, _ := setupTest()
+	client := blockingClient{MockAtlasClient: mock, fetching: make(chan struct{}), release: make(chan struct{})}
+	cache := newProviderCache(time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		provider, err := cache.get(client, "AWS")
+		assert.NoError(t, err)
+		assert.NotNil(t, provider)
+		close(done)
+	}()
+
+	// Providers fetched before the cache was invalidated aren't cached.
+	<-client.fetching
+	cache.invalidate()
+	close(client.release)
+	<-done
+
+	_, cached := cache.entries["AWS"]
+	assert.False(t, cached)
+}
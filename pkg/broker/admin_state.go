@@ -0,0 +1,77 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+)
+
+// handleExportState serves an export of all instances and bindings. The
+// secrets query parameter controls whether binding credentials are excluded
+// (the default) or encrypted with the state encryption key.
+func (b Broker) handleExportState(w http.ResponseWriter, r *http.Request) {
+	secrets := r.URL.Query().Get("secrets")
+	if secrets == "" {
+		secrets = state.SecretsExclude
+	}
+
+	if secrets != state.SecretsExclude && secrets != state.SecretsEncrypt {
+		respondWithError(w, newInvalidQueryError("secrets", secrets))
+		return
+	}
+
+	if secrets == state.SecretsEncrypt && len(b.config.StateEncryptionKey) == 0 {
+		respondWithError(w, apiresponses.NewFailureResponse(errors.New("Secrets can't be encrypted without a state encryption key"), http.StatusBadRequest, "missing-encryption-key"))
+		return
+	}
+
+	export, err := state.ExportStore(b.store, secrets, b.config.StateEncryptionKey)
+	if err != nil {
+		b.logger.Errorw("Failed to export state", "error", err)
+		respondWithError(w, err)
+		return
+	}
+
+	b.logger.Infow("Exported state", "instances", len(export.Instances), "bindings", len(export.Bindings), "secrets", secrets)
+	respond(w, http.StatusOK, export)
+}
+
+// handleImportState loads an export into the store. Invalid exports are
+// rejected with 400 Bad Request without importing any records. Scheduled
+// deletions are carried out with the Atlas key passed in atlas_key.
+func (b Broker) handleImportState(w http.ResponseWriter, r *http.Request) {
+	var export state.Export
+	err := json.NewDecoder(r.Body).Decode(&export)
+	if err != nil {
+		respondWithError(w, newInvalidExportError(err))
+		return
+	}
+
+	err = state.ImportStore(b.store, &export, b.config.StateEncryptionKey)
+	if err != nil {
+		b.logger.Errorw("Failed to import state", "error", err)
+		respondWithError(w, newInvalidExportError(err))
+		return
+	}
+
+	// Atlas credentials aren't exported, so scheduled deletions of unbound
+	// instances are carried out with the Atlas key of the import, if any.
+	if client, err := b.atlasClientFromContext(r.Context()); err == nil {
+		for _, instance := range export.Instances {
+			if !instance.DeletionScheduledAt.IsZero() {
+				b.sweeper.remember(instance.ID, client)
+			}
+		}
+	}
+
+	b.logger.Infow("Imported state", "instances", len(export.Instances), "bindings", len(export.Bindings), "secrets", export.Secrets)
+	respond(w, http.StatusOK, struct{}{})
+}
+
+func newInvalidExportError(err error) error {
+	return apiresponses.NewFailureResponse(fmt.Errorf("Invalid state export: %v", err), http.StatusBadRequest, "invalid-state-export")
+}
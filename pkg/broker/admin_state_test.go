@@ -0,0 +1,94 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testStateEncryptionKey = []byte("0123456789abcdef")
+
+func setupAdminStateTest() (*Broker, *mux.Router) {
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{StateEncryptionKey: testStateEncryptionKey})
+
+	router := mux.NewRouter()
+	AttachAdminRoutes(router, broker, testAdminToken)
+
+	return broker, router
+}
+
+func adminPost(router *mux.Router, path string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminExportImportState(t *testing.T) {
+	source, sourceRouter := setupAdminStateTest()
+	source.store.PutInstance(state.Instance{ID: "instance", PlanID: testPlanID})
+	source.store.PutBinding(state.Binding{ID: "binding", InstanceID: "instance", Credentials: []byte(`{"password":"hunter2"}`)})
+
+	w := adminGet(sourceRouter, "/admin/state?secrets=encrypt")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "hunter2")
+
+	target, targetRouter := setupAdminStateTest()
+	assert.Equal(t, http.StatusOK, adminPost(targetRouter, "/admin/state", w.Body.Bytes()).Code)
+
+	instance, err := target.store.GetInstance("instance")
+	assert.NoError(t, err)
+	assert.Equal(t, testPlanID, instance.PlanID)
+
+	binding, err := target.store.GetBinding("binding")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"password":"hunter2"}`, string(binding.Credentials))
+}
+
+func TestAdminExportStateSecrets(t *testing.T) {
+	_, router := setupAdminStateTest()
+
+	w := adminGet(router, "/admin/state")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var export state.Export
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Equal(t, state.SecretsExclude, export.Secrets)
+	assert.Equal(t, state.ExportVersion, export.Version)
+
+	assert.Equal(t, http.StatusBadRequest, adminGet(router, "/admin/state?secrets=plaintext").Code)
+
+	// Secrets can only be encrypted with a key.
+	_, router = setupAdminTest()
+	assert.Equal(t, http.StatusBadRequest, adminGet(router, "/admin/state?secrets=encrypt").Code)
+}
+
+func TestAdminImportInvalidState(t *testing.T) {
+	broker, router := setupAdminStateTest()
+
+	w := adminPost(router, "/admin/state", []byte(`{"version": 99, "secrets": "exclude"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unsupported export version 99")
+
+	w = adminPost(router, "/admin/state", []byte(`{
+		"version": 1,
+		"secrets": "exclude",
+		"instances": [{"id": "instance"}],
+		"bindings": [{"id": "binding", "instanceId": "missing"}]
+	}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "binding binding references unknown instance missing")
+
+	_, err := broker.store.GetInstance("instance")
+	assert.Equal(t, state.ErrNotFound, err)
+
+	assert.Equal(t, http.StatusBadRequest, adminPost(router, "/admin/state", []byte(`not json`)).Code)
+}
@@ -0,0 +1,149 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "admin-token"
+
+// setupAdminTest will set up a router serving the admin API of a broker.
+func setupAdminTest() (*Broker, *mux.Router) {
+	broker, _, _ := setupTest()
+
+	router := mux.NewRouter()
+	AttachAdminRoutes(router, broker, testAdminToken)
+
+	return broker, router
+}
+
+func adminGet(router *mux.Router, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminAuth(t *testing.T) {
+	_, router := setupAdminTest()
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/instances", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req.Header.Set("Authorization", "Bearer wrong-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Equal(t, http.StatusOK, adminGet(router, "/admin/instances").Code)
+}
+
+func TestAdminListInstancesPagination(t *testing.T) {
+	broker, router := setupAdminTest()
+	for i := 0; i < 5; i++ {
+		broker.store.PutInstance(state.Instance{ID: fmt.Sprintf("instance-%d", i)})
+	}
+
+	list := func(query string) InstanceList {
+		w := adminGet(router, "/admin/instances"+query)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var list InstanceList
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		return list
+	}
+
+	page := list("?limit=2")
+	assert.Len(t, page.Instances, 2)
+	assert.Equal(t, "instance-0", page.Instances[0].ID)
+	if assert.NotNil(t, page.NextOffset) {
+		assert.Equal(t, 2, *page.NextOffset)
+	}
+
+	// The last full page has no next page.
+	page = list("?offset=3&limit=2")
+	assert.Len(t, page.Instances, 2)
+	assert.Equal(t, "instance-3", page.Instances[0].ID)
+	assert.Nil(t, page.NextOffset)
+
+	page = list("?offset=5")
+	assert.Len(t, page.Instances, 0)
+	assert.Nil(t, page.NextOffset)
+
+	for _, query := range []string{"?limit=0", "?limit=501", "?offset=-1", "?limit=ten", "?ephemeral=maybe"} {
+		assert.Equal(t, http.StatusBadRequest, adminGet(router, "/admin/instances"+query).Code, query)
+	}
+}
+
+func TestAdminListInstancesFilter(t *testing.T) {
+	broker, _, ctx := setupTest()
+	router := mux.NewRouter()
+	AttachAdminRoutes(router, broker, testAdminToken)
+
+	broker.Provision(ctx, "persistent", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	broker.Provision(ctx, "ephemeral", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"ephemeral": true}`),
+	}, true)
+
+	list := func(query string) []string {
+		w := adminGet(router, "/admin/instances"+query)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var list InstanceList
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+
+		ids := []string{}
+		for _, instance := range list.Instances {
+			ids = append(ids, instance.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"ephemeral", "persistent"}, list("?provider=AWS&plan_id="+testPlanID+"&project_id="+testProjectID))
+	assert.Equal(t, []string{"ephemeral", "persistent"}, list("?state="+atlas.ClusterStateCreating))
+	assert.Equal(t, []string{"ephemeral"}, list("?ephemeral=true"))
+	assert.Equal(t, []string{"persistent"}, list("?ephemeral=false"))
+	assert.Equal(t, []string{}, list("?provider=GCP"))
+	assert.Equal(t, []string{}, list("?state="+atlas.ClusterStateIdle))
+}
+
+func TestAdminListBindings(t *testing.T) {
+	broker, router := setupAdminTest()
+	broker.store.PutBinding(state.Binding{ID: "binding-1", InstanceID: "instance-1", Credentials: []byte(`{"password":"secret"}`)})
+	broker.store.PutBinding(state.Binding{ID: "binding-2", InstanceID: "instance-2"})
+	broker.store.PutBinding(state.Binding{ID: "binding-3", InstanceID: "instance-1"})
+
+	w := adminGet(router, "/admin/bindings?instance_id=instance-1&limit=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	var list BindingList
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, []AdminBinding{{ID: "binding-1", InstanceID: "instance-1"}}, list.Bindings)
+	if assert.NotNil(t, list.NextOffset) {
+		assert.Equal(t, 1, *list.NextOffset)
+	}
+
+	w = adminGet(router, "/admin/bindings?instance_id=instance-1&offset=1")
+	var last BindingList
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &last))
+	assert.Equal(t, []AdminBinding{{ID: "binding-3", InstanceID: "instance-1"}}, last.Bindings)
+	assert.Nil(t, last.NextOffset)
+}
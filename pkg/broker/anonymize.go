@@ -0,0 +1,154 @@
+package broker
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// redacted replaces secrets in anonymized connection strings.
+const redacted = "REDACTED"
+
+// sensitiveOptions are the connection string options whose values may
+// contain secrets, such as AWS session tokens.
+var sensitiveOptions = []string{"authMechanismProperties", "tlsCertificateKeyFilePassword", "sslClientCertificateKeyPassword"}
+
+// sensitiveParameters are the request parameters whose values are secrets,
+// such as approval tokens.
+var sensitiveParameters = []string{"approval_token"}
+
+// anonymizeConnectionString masks the credentials and secret options of a
+// connection string, keeping the hosts, database, and other options for
+// debugging. Connection strings must be anonymized before being logged or
+// sent in events; they're only included as is in binding credentials.
+func anonymizeConnectionString(connectionString string) string {
+	if connectionString == "" {
+		return connectionString
+	}
+
+	scheme, rest := "", connectionString
+	if i := strings.Index(rest, "://"); i >= 0 {
+		scheme, rest = rest[:i+len("://")], rest[i+len("://"):]
+	}
+
+	rawQuery := ""
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest, rawQuery = rest[:i], rest[i+1:]
+	}
+
+	// Credentials end at the last "@" so unescaped characters in passwords
+	// aren't mistaken for the start of the hosts.
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		credentials := redacted
+		if strings.Contains(rest[:i], ":") {
+			credentials += ":" + redacted
+		}
+		rest = credentials + rest[i:]
+	}
+
+	if rawQuery == "" {
+		return scheme + rest
+	}
+
+	// Options which can't be parsed are dropped as they may hide secrets.
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return scheme + rest + "?" + redacted
+	}
+
+	masked := false
+	for option := range query {
+		for _, sensitive := range sensitiveOptions {
+			if strings.EqualFold(option, sensitive) {
+				query.Set(option, redacted)
+				masked = true
+			}
+		}
+	}
+
+	// The options are only re-encoded if needed to keep their order.
+	if !masked {
+		return scheme + rest + "?" + rawQuery
+	}
+
+	return scheme + rest + "?" + query.Encode()
+}
+
+// anonymizeConnectionStrings returns a copy of a cluster's connection strings
+// with all of them anonymized.
+func anonymizeConnectionStrings(connectionStrings atlas.ConnectionStrings) atlas.ConnectionStrings {
+	for _, connectionString := range []*string{
+		&connectionStrings.Standard,
+		&connectionStrings.StandardSrv,
+		&connectionStrings.Private,
+		&connectionStrings.PrivateSrv,
+	} {
+		*connectionString = anonymizeConnectionString(*connectionString)
+	}
+
+	return connectionStrings
+}
+
+// anonymizeCluster returns a copy of a cluster which is safe to log.
+func anonymizeCluster(cluster *atlas.Cluster) *atlas.Cluster {
+	if cluster == nil {
+		return nil
+	}
+
+	anonymized := *cluster
+	anonymized.SrvAddress = anonymizeConnectionString(cluster.SrvAddress)
+	anonymized.ConnectionStrings = anonymizeConnectionStrings(cluster.ConnectionStrings)
+	return &anonymized
+}
+
+// anonymizeParameters masks the secret parameters of a request, keeping the
+// others for debugging. Parameters which can't be parsed are masked entirely
+// as they may hide secrets.
+func anonymizeParameters(rawParams json.RawMessage) json.RawMessage {
+	if len(rawParams) == 0 {
+		return rawParams
+	}
+
+	maskedValue := json.RawMessage(`"` + redacted + `"`)
+	params := map[string]json.RawMessage{}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return maskedValue
+	}
+
+	masked := false
+	for _, key := range sensitiveParameters {
+		if _, ok := params[key]; ok {
+			params[key] = maskedValue
+			masked = true
+		}
+	}
+
+	// The parameters are only re-encoded if needed to keep their order.
+	if !masked {
+		return rawParams
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return maskedValue
+	}
+
+	return data
+}
+
+// anonymizeProvisionDetails returns a copy of the details of a provision
+// request which is safe to log.
+func anonymizeProvisionDetails(details brokerapi.ProvisionDetails) brokerapi.ProvisionDetails {
+	details.RawParameters = anonymizeParameters(details.RawParameters)
+	return details
+}
+
+// anonymizeUpdateDetails returns a copy of the details of an update request
+// which is safe to log.
+func anonymizeUpdateDetails(details brokerapi.UpdateDetails) brokerapi.UpdateDetails {
+	details.RawParameters = anonymizeParameters(details.RawParameters)
+	return details
+}
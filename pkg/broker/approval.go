@@ -0,0 +1,73 @@
+package broker
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// approvalTokenFromParams returns the approval token passed as
+// {"approval_token": "..."}, empty if none was passed.
+func approvalTokenFromParams(rawParams []byte) (string, error) {
+	params := struct {
+		ApprovalToken string `json:"approval_token"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return "", newInvalidParamsError(err)
+		}
+	}
+
+	return params.ApprovalToken, nil
+}
+
+// validateApproval requires clusters larger than the approval threshold to
+// pass one of the configured approval tokens. No approval is needed if no
+// threshold is configured.
+func (b Broker) validateApproval(cluster *atlas.Cluster, rawParams []byte) error {
+	threshold := b.config.ApprovalThresholdInstanceSize
+	if threshold == "" || cluster.ProviderSettings == nil {
+		return nil
+	}
+
+	instanceSizeName := cluster.ProviderSettings.InstanceSizeName
+	if (PlanRange{Max: threshold}).allows(instanceSizeName) {
+		return nil
+	}
+
+	token, err := approvalTokenFromParams(rawParams)
+	if err != nil {
+		return err
+	}
+
+	remediation := fmt.Sprintf("pass an approval_token issued by the broker operators, or pick a plan up to %s", threshold)
+	if token == "" {
+		err := fmt.Errorf("Instance size %s is larger than %s and requires approval", instanceSizeName, threshold)
+		return newRemediableError(err, http.StatusUnprocessableEntity, "approval-required", remediation)
+	}
+
+	if !b.isApprovalToken(token) {
+		return newRemediableError(errors.New("Invalid approval token"), http.StatusUnprocessableEntity, "invalid-approval-token", remediation)
+	}
+
+	return nil
+}
+
+// isApprovalToken returns whether a token is one of the configured approval
+// tokens. Tokens are compared in constant time.
+func (b Broker) isApprovalToken(token string) bool {
+	valid := false
+	for _, approvalToken := range b.config.ApprovalTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(approvalToken)) == 1 {
+			valid = true
+		}
+	}
+
+	return valid
+}
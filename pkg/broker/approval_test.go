@@ -0,0 +1,97 @@
+package broker
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestProvisionApproval(t *testing.T) {
+	tests := []struct {
+		name   string
+		planID string
+		params string
+		status int
+	}{
+		{"below threshold", testPlanID, ``, 0},
+		{"at threshold", "aosb-cluster-plan-aws-m20", ``, 0},
+		{"above threshold without token", "aosb-cluster-plan-aws-m30", ``, http.StatusUnprocessableEntity},
+		{"above threshold with invalid token", "aosb-cluster-plan-aws-m30", `{"approval_token": "guess"}`, http.StatusUnprocessableEntity},
+		{"above threshold with valid token", "aosb-cluster-plan-aws-m30", `{"approval_token": "approved-by-finance"}`, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+				ApprovalThresholdInstanceSize: "M20",
+				ApprovalTokens:                []string{"approved-by-platform", "approved-by-finance"},
+			})
+
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:        test.planID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(test.params),
+			}, true)
+
+			if test.status == 0 {
+				assert.NoError(t, err)
+				assert.NotNil(t, client.Clusters["instance"])
+				return
+			}
+
+			if assert.Error(t, err) {
+				assert.Equal(t, test.status, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+			}
+			assert.Nil(t, client.Clusters["instance"])
+		})
+	}
+}
+
+func TestProvisionWithoutApprovalThreshold(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    "aosb-cluster-plan-aws-m30",
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+}
+
+func TestUpdateApproval(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		ApprovalThresholdInstanceSize: "M20",
+		ApprovalTokens:                []string{"approved-by-finance"},
+	})
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+
+	// Resizing above the threshold requires approval as well.
+	_, err = broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:    "aosb-cluster-plan-aws-m30",
+		ServiceID: testServiceID,
+	}, true)
+	assert.Error(t, err)
+	assert.Equal(t, "M10", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+
+	_, err = broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:        "aosb-cluster-plan-aws-m30",
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"approval_token": "approved-by-finance"}`),
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "M30", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+}
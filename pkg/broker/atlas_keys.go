@@ -0,0 +1,84 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+)
+
+// AtlasKey is an Atlas API key operators can refer to by name in admin
+// requests, for example to act on a project owned by a different key.
+type AtlasKey struct {
+	GroupID    string `json:"group_id"`
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"`
+}
+
+// ReadAtlasKeysFile will read named Atlas API keys from a JSON file. The file
+// contains an object with the names as keys, for example
+// {"legacy": {"group_id": "...", "public_key": "...", "private_key": "..."}}.
+func ReadAtlasKeysFile(path string) (map[string]AtlasKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys map[string]AtlasKey
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, key := range keys {
+		if key.GroupID == "" || key.PublicKey == "" || key.PrivateKey == "" {
+			return nil, fmt.Errorf("Atlas key %s must have a group_id, public_key, and private_key", name)
+		}
+	}
+
+	return keys, nil
+}
+
+// AtlasKeyClients creates Atlas clients for named keys, sending requests to
+// baseURL with the specified user agent.
+func AtlasKeyClients(keys map[string]AtlasKey, baseURL string, userAgent string) map[string]atlas.Client {
+	clients := make(map[string]atlas.Client, len(keys))
+	for name, key := range keys {
+		client := atlas.NewClient(baseURL, key.GroupID, key.PublicKey, key.PrivateKey)
+		client.UserAgent = userAgent
+		clients[name] = client
+	}
+
+	return clients
+}
+
+// atlasKeyMiddleware attaches the client of the named key passed in the
+// atlas_key query parameter to the request context, overriding any other
+// client for that request only. Unknown names result in 400 Bad Request.
+// Every use of a key is logged for auditing. It must only be used behind
+// the admin authentication.
+func (b Broker) atlasKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("atlas_key")
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client, ok := b.config.AtlasKeys[name]
+		if !ok {
+			b.logger.Warnw("Admin request with unknown Atlas key", "atlas_key", name, "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			respondWithError(w, apiresponses.NewFailureResponse(fmt.Errorf("Unknown Atlas key %s", name), http.StatusBadRequest, "unknown-atlas-key"))
+			return
+		}
+
+		b.logger.Infow("Admin request with Atlas key override", "atlas_key", name, "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+
+		ctx := context.WithValue(r.Context(), ContextKeyAtlasClient, client)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReadAtlasKeysFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atlas-keys")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys.json")
+	ioutil.WriteFile(path, []byte(`{"legacy": {"group_id": "group", "public_key": "public", "private_key": "private"}}`), 0600)
+
+	keys, err := ReadAtlasKeysFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]AtlasKey{"legacy": {GroupID: "group", PublicKey: "public", PrivateKey: "private"}}, keys)
+
+	clients := AtlasKeyClients(keys, "http://atlas", "atlas-osb/test")
+	client := clients["legacy"].(*atlas.HTTPClient)
+	assert.Equal(t, "group", client.GroupID)
+	assert.Equal(t, "atlas-osb/test", client.UserAgent)
+
+	ioutil.WriteFile(path, []byte(`{"legacy": {"group_id": "group", "public_key": "public"}}`), 0600)
+	_, err = ReadAtlasKeysFile(path)
+	assert.EqualError(t, err, "Atlas key legacy must have a group_id, public_key, and private_key")
+}
+
+func TestAdminAtlasKeyOverride(t *testing.T) {
+	_, client, _ := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		AtlasKeys: map[string]atlas.Client{"legacy": client},
+	})
+
+	router := mux.NewRouter()
+	AttachAdminRoutes(router, broker, testAdminToken)
+
+	// Keys can only be used by authenticated admin requests.
+	req := httptest.NewRequest(http.MethodPost, "/admin/state?atlas_key=legacy", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = adminPost(router, "/admin/state?atlas_key=unknown", []byte(`{}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Unknown Atlas key unknown")
+
+	// The scheduled deletion of an imported instance is carried out with
+	// the key of the import.
+	clusterName := NormalizeClusterName("instance")
+	client.Clusters[clusterName] = &atlas.Cluster{Name: clusterName}
+
+	export, _ := json.Marshal(state.Export{
+		Version:   state.ExportVersion,
+		Secrets:   state.SecretsExclude,
+		Instances: []state.Instance{{ID: "instance", DeleteWhenUnbound: true, DeletionScheduledAt: time.Now()}},
+	})
+	w = adminPost(router, "/admin/state?atlas_key=legacy", export)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	broker.Sweep()
+	assert.Nil(t, client.Clusters[clusterName])
+}
@@ -0,0 +1,146 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// AutoTermination describes whether an instance is deleted once it has no
+// bindings left and, if so, when the deletion is scheduled. ExpiresAt is when
+// an expiring ephemeral instance is deleted regardless, Overdue is set once
+// it has expired but isn't deleted yet.
+type AutoTermination struct {
+	DeleteWhenUnbound   bool       `json:"delete_when_unbound"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	ExpiresAt           *time.Time `json:"expires_at,omitempty"`
+	Overdue             bool       `json:"overdue,omitempty"`
+}
+
+// deleteWhenUnboundFromParams returns whether {"delete_when_unbound": true}
+// was passed to delete the cluster once its last binding has been removed.
+func deleteWhenUnboundFromParams(rawParams []byte) (bool, error) {
+	params := struct {
+		DeleteWhenUnbound bool `json:"delete_when_unbound"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return false, newInvalidParamsError(err)
+		}
+	}
+
+	return params.DeleteWhenUnbound, nil
+}
+
+// setDeleteWhenUnbound records that an instance should be deleted once it has
+// no bindings left.
+func (b Broker) setDeleteWhenUnbound(instanceID string) error {
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.DeleteWhenUnbound = true
+	})
+}
+
+// autoTermination returns the auto-termination status of an instance, or nil
+// if it isn't deleted when unbound and doesn't expire.
+func (b Broker) autoTermination(instanceID string) (*AutoTermination, error) {
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !instance.DeleteWhenUnbound && instance.ExpiresAt.IsZero() {
+		return nil, nil
+	}
+
+	status := &AutoTermination{DeleteWhenUnbound: instance.DeleteWhenUnbound}
+	if !instance.DeletionScheduledAt.IsZero() {
+		status.DeletionScheduledAt = &instance.DeletionScheduledAt
+	}
+	if !instance.ExpiresAt.IsZero() {
+		status.ExpiresAt = &instance.ExpiresAt
+		status.Overdue = isDue(instance.ExpiresAt, time.Now())
+	}
+
+	return status, nil
+}
+
+// scheduleAutoTermination will schedule the deletion of an instance after the
+// grace period if it's deleted when unbound and has no bindings left. The
+// Atlas client of the request is kept for the sweeper to delete the cluster.
+func (b Broker) scheduleAutoTermination(ctx context.Context, instanceID string) error {
+	client, err := b.instanceClient(ctx, instanceID, nil)
+	if err != nil {
+		return err
+	}
+
+	unlock := b.store.Lock("instance/" + instanceID)
+	defer unlock()
+
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !instance.DeleteWhenUnbound {
+		return nil
+	}
+
+	bindings, err := b.store.ListBindings(state.BindingFilter{InstanceID: instanceID}, 0, 1)
+	if err != nil || len(bindings) > 0 {
+		return err
+	}
+
+	instance.DeletionScheduledAt = time.Now().Add(b.config.AutoTerminationGracePeriod)
+	err = b.store.PutInstance(*instance)
+	if err != nil {
+		return err
+	}
+
+	b.sweeper.remember(instanceID, client)
+	b.logger.Infow("Scheduled deletion of unbound instance", "instance_id", instanceID, "deletion_scheduled_at", instance.DeletionScheduledAt)
+	return nil
+}
+
+// cancelAutoTermination will cancel the scheduled deletion of an instance
+// which is being bound again, returning whether one was scheduled. It locks
+// the instance like the sweeper, so either the deletion is cancelled or it
+// has already been started.
+func (b Broker) cancelAutoTermination(instanceID string) (bool, error) {
+	unlock := b.store.Lock("instance/" + instanceID)
+	defer unlock()
+
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if instance.DeletionScheduledAt.IsZero() {
+		return false, nil
+	}
+
+	instance.DeletionScheduledAt = time.Time{}
+	err = b.store.PutInstance(*instance)
+	if err != nil {
+		return false, err
+	}
+
+	// Expiring instances still need the client once they expire.
+	if instance.ExpiresAt.IsZero() {
+		b.sweeper.forget(instanceID)
+	}
+	b.logger.Infow("Cancelled deletion of unbound instance", "instance_id", instanceID)
+	return true, nil
+}
@@ -0,0 +1,123 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupAutoTerminationTest will provision an instance which is deleted when
+// unbound, with two bindings.
+func setupAutoTerminationTest(t *testing.T) (*Broker, MockAtlasClient, context.Context) {
+	broker, client, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"delete_when_unbound": true}`),
+	}, true)
+	assert.NoError(t, err)
+
+	for _, bindingID := range []string{"binding-1", "binding-2"} {
+		_, err = broker.Bind(ctx, "instance", bindingID, brokerapi.BindDetails{
+			PlanID:    testPlanID,
+			ServiceID: testServiceID,
+		}, true)
+		assert.NoError(t, err)
+	}
+
+	return broker, client, ctx
+}
+
+func unbindForTest(t *testing.T, broker *Broker, ctx context.Context, bindingID string) {
+	_, err := broker.Unbind(ctx, "instance", bindingID, brokerapi.UnbindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+}
+
+func TestAutoTerminationAfterLastUnbind(t *testing.T) {
+	broker, client, ctx := setupAutoTerminationTest(t)
+	clusterName := NormalizeClusterName("instance")
+
+	// Deletion is only scheduled once no bindings are left.
+	unbindForTest(t, broker, ctx, "binding-1")
+	status, err := broker.autoTermination("instance")
+	assert.NoError(t, err)
+	assert.Equal(t, &AutoTermination{DeleteWhenUnbound: true}, status)
+
+	unbindForTest(t, broker, ctx, "binding-2")
+
+	spec, err := broker.GetInstance(ctx, "instance")
+	if !assert.NoError(t, err) {
+		return
+	}
+	status = spec.Parameters.(map[string]interface{})["auto_termination"].(*AutoTermination)
+	assert.True(t, status.DeleteWhenUnbound)
+	if assert.NotNil(t, status.DeletionScheduledAt) {
+		assert.WithinDuration(t, time.Now().Add(DefaultAutoTerminationGracePeriod), *status.DeletionScheduledAt, time.Minute)
+	}
+
+	// The cluster is kept during the grace period.
+	broker.Sweep()
+	assert.NotNil(t, client.Clusters[clusterName])
+
+	broker.sweep(time.Now().Add(DefaultAutoTerminationGracePeriod))
+	assert.Nil(t, client.Clusters[clusterName])
+
+	// The instance is forgotten like after a deprovision.
+	instances, _ := broker.ListInstances(state.InstanceFilter{}, 0, 10)
+	assert.Empty(t, instances.Instances)
+}
+
+func TestAutoTerminationCancelledByBind(t *testing.T) {
+	broker, client, ctx := setupAutoTerminationTest(t)
+	unbindForTest(t, broker, ctx, "binding-1")
+	unbindForTest(t, broker, ctx, "binding-2")
+
+	_, err := broker.Bind(ctx, "instance", "binding-3", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	status, err := broker.autoTermination("instance")
+	assert.NoError(t, err)
+	assert.Nil(t, status.DeletionScheduledAt)
+
+	broker.sweep(time.Now().Add(DefaultAutoTerminationGracePeriod))
+	assert.NotNil(t, client.Clusters[NormalizeClusterName("instance")])
+}
+
+func TestAutoTerminationRescheduledAfterFailedBind(t *testing.T) {
+	broker, _, ctx := setupAutoTerminationTest(t)
+	unbindForTest(t, broker, ctx, "binding-1")
+	unbindForTest(t, broker, ctx, "binding-2")
+
+	_, err := broker.Bind(ctx, "instance", "binding-3", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: "unknown-service",
+	}, true)
+	assert.Error(t, err)
+
+	status, err := broker.autoTermination("instance")
+	assert.NoError(t, err)
+	assert.NotNil(t, status.DeletionScheduledAt)
+}
+
+func TestNoAutoTerminationByDefault(t *testing.T) {
+	broker, client, ctx, _ := setupBindingTest(t)
+	unbindForTest(t, broker, ctx, "binding")
+
+	status, err := broker.autoTermination("instance")
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+
+	broker.sweep(time.Now().Add(DefaultAutoTerminationGracePeriod))
+	assert.NotNil(t, client.Clusters[NormalizeClusterName("instance")])
+}
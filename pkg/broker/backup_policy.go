@@ -0,0 +1,60 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// backupParamsFromParams returns the backup settings passed for the cluster,
+// nil for those which weren't passed.
+func backupParamsFromParams(rawParams []byte) (providerBackup *bool, backup *bool, err error) {
+	params := struct {
+		Cluster struct {
+			ProviderBackupEnabled *bool `json:"providerBackupEnabled"`
+			BackupEnabled         *bool `json:"backupEnabled"`
+		} `json:"cluster"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return nil, nil, newInvalidParamsError(err)
+		}
+	}
+
+	return params.Cluster.ProviderBackupEnabled, params.Cluster.BackupEnabled, nil
+}
+
+// enforceBackups enables cloud backups for clusters of production tiers,
+// the instance sizes from BackupRequiredInstanceSize up, and rejects
+// parameters disabling them. Updates pass the existing cluster, whose
+// backups are kept as they are if already enabled. Smaller instance sizes
+// are left as requested.
+func (b Broker) enforceBackups(cluster *atlas.Cluster, existingCluster *atlas.Cluster, instanceSizeName string, rawParams []byte) error {
+	required := b.config.BackupRequiredInstanceSize
+	if required == "" || !(PlanRange{Min: required}).allows(instanceSizeName) {
+		return nil
+	}
+
+	providerBackup, backup, err := backupParamsFromParams(rawParams)
+	if err != nil {
+		return err
+	}
+
+	enabled := (providerBackup != nil && *providerBackup) || (backup != nil && *backup)
+	disabled := (providerBackup != nil && !*providerBackup) || (backup != nil && !*backup)
+	if disabled && !enabled {
+		err := fmt.Errorf("Backups are required for instance sizes %s and can't be disabled for %s", PlanRange{Min: required}, instanceSizeName)
+		return newRemediableError(err, http.StatusUnprocessableEntity, "backup-required", remediationBackupRequired)
+	}
+
+	if enabled || (existingCluster != nil && (existingCluster.ProviderBackupEnabled || existingCluster.BackupEnabled)) {
+		return nil
+	}
+
+	cluster.ProviderBackupEnabled = true
+	return nil
+}
@@ -0,0 +1,103 @@
+package broker
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestProvisionBackupPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		planID   string
+		params   string
+		status   int
+		expected bool
+	}{
+		{"enabled for production tiers", "aosb-cluster-plan-aws-m30", `{}`, 0, true},
+		{"explicitly enabled", "aosb-cluster-plan-aws-m30", `{"cluster": {"providerBackupEnabled": true}}`, 0, true},
+		{"disabled for production tiers", "aosb-cluster-plan-aws-m30", `{"cluster": {"providerBackupEnabled": false}}`, http.StatusUnprocessableEntity, false},
+		{"legacy backups disabled", "aosb-cluster-plan-aws-m30", `{"cluster": {"backupEnabled": false}}`, http.StatusUnprocessableEntity, false},
+		{"optional for lower tiers", testPlanID, `{}`, 0, false},
+		{"disabled for lower tiers", testPlanID, `{"cluster": {"providerBackupEnabled": false}}`, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{BackupRequiredInstanceSize: "M30"})
+
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:        test.planID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(test.params),
+			}, true)
+			if test.status != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, test.status, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+					assert.Contains(t, err.Error(), "Backups are required for instance sizes M30 or larger")
+				}
+				assert.Nil(t, client.Clusters["instance"])
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.expected, client.Clusters["instance"].ProviderBackupEnabled)
+			}
+		})
+	}
+}
+
+func TestUpdateBackupPolicy(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{BackupRequiredInstanceSize: "M30"})
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+	assert.False(t, client.Clusters["instance"].ProviderBackupEnabled)
+
+	// Resizing to a production tier can't keep backups disabled.
+	_, err = broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:        "aosb-cluster-plan-aws-m30",
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"providerBackupEnabled": false}}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+	assert.Equal(t, "M10", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+
+	// Backups are enabled along with the resize.
+	_, err = broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:    "aosb-cluster-plan-aws-m30",
+		ServiceID: testServiceID,
+	}, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "M30", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+		assert.True(t, client.Clusters["instance"].ProviderBackupEnabled)
+	}
+}
+
+func TestProvisionWithoutBackupPolicy(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        "aosb-cluster-plan-aws-m30",
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"providerBackupEnabled": false}}`),
+	}, true)
+	if assert.NoError(t, err) {
+		assert.False(t, client.Clusters["instance"].ProviderBackupEnabled)
+	}
+}
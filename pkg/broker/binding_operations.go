@@ -7,8 +7,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
 	"github.com/pivotal-cf/brokerapi"
 )
 
@@ -18,93 +22,343 @@ type ConnectionDetails struct {
 	Password         string `json:"password"`
 	URI              string `json:"uri"`
 	ConnectionString string `json:"connectionString"`
+	Database         string `json:"database,omitempty"`
+
+	// RecommendedMaxPoolSize is an advisory connection pool size, omitted
+	// if the broker isn't configured to recommend one.
+	RecommendedMaxPoolSize int `json:"recommended_max_pool_size,omitempty"`
 }
 
+// The operations performed on bindings, used to record their results.
+const (
+	operationBind   = "bind"
+	operationUnbind = "unbind"
+)
+
 // Bind will create a new database user with a username matching the binding ID
-// and a randomly generated password. The user credentials will be returned back.
+// and a randomly generated password, or bind an existing user passed as
+// "existing_user". The user credentials will be returned back.
+// Retries of an identical request receive the original credentials.
 func (b Broker) Bind(ctx context.Context, instanceID string, bindingID string, details brokerapi.BindDetails, asyncAllowed bool) (spec brokerapi.Binding, err error) {
 	b.logger.Infow("Creating binding", "instance_id", instanceID, "binding_id", bindingID, "details", details)
 
-	client, err := atlasClientFromContext(ctx)
+	// Instances limited to a single binding are bound one at a time until
+	// the binding has been recorded.
+	unlock := b.lockBindings(instanceID)
+	defer unlock()
+
+	// A pending deletion of the unbound instance is cancelled before the
+	// user is created, and scheduled again if the binding fails.
+	cancelled, err := b.cancelAutoTermination(instanceID)
+	if err != nil {
+		return
+	}
+
+	err = b.idempotent(ctx, operationKey(operationBind, instanceID, bindingID), details, &spec, func() (err error) {
+		spec, err = b.bind(ctx, instanceID, bindingID, details)
+		return
+	})
+	if err != nil {
+		if cancelled {
+			if err := b.scheduleAutoTermination(ctx, instanceID); err != nil {
+				b.logger.Errorw("Failed to reschedule deletion of unbound instance", "error", err, "instance_id", instanceID)
+			}
+		}
+		return
+	}
+
+	// The request was validated when binding, so its parameters are valid.
+	existingUsername, _ := existingUserFromParams(details.RawParameters)
+
+	var roles []string
+	if existingUsername == "" {
+		if user, err := userFromParams(bindingID, "", details.RawParameters); err == nil {
+			roles = roleSummaries(user.Roles)
+		}
+	}
+
+	b.forgetOperations(operationKey(operationUnbind, instanceID, bindingID))
+	b.recordBinding(instanceID, bindingID, spec, existingUsername, roles)
+	return
+}
+
+// recordBinding will record the credentials of a binding so they can be
+// retrieved later, the existing user it was bound to, if any, and the roles
+// of the user created for it. Retries keep the original creation time.
+// Failures are logged as the binding itself was created.
+func (b Broker) recordBinding(instanceID string, bindingID string, spec brokerapi.Binding, existingUsername string, roles []string) {
+	createdAt := time.Now().UTC()
+	if existing, err := b.store.GetBinding(bindingID); err == nil && existing.InstanceID == instanceID && !existing.CreatedAt.IsZero() {
+		createdAt = existing.CreatedAt
+	}
+
+	credentials, err := json.Marshal(spec.Credentials)
+	if err == nil {
+		err = b.store.PutBinding(state.Binding{
+			ID:           bindingID,
+			InstanceID:   instanceID,
+			Credentials:  credentials,
+			ExistingUser: existingUsername,
+			CreatedAt:    createdAt,
+			Roles:        roles,
+		})
+	}
+
+	if err != nil {
+		b.logger.Errorw("Failed to record binding", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+	}
+}
+
+func (b Broker) bind(ctx context.Context, instanceID string, bindingID string, details brokerapi.BindDetails) (spec brokerapi.Binding, err error) {
+	client, err := b.instanceClient(ctx, instanceID, details.RawContext)
 	if err != nil {
 		return
 	}
 
 	// The service_id and plan_id are required to be valid per the specification, despite
 	// not being used for bindings. We look them up to ensure they can be found in the catalog.
-	provider, err := findProviderByServiceID(client, details.ServiceID)
+	serviceID, planID, _ := b.resolveEdition(details.ServiceID, details.PlanID)
+	provider, err := findProviderByServiceID(client, serviceID)
 	if err != nil {
 		return
 	}
 
-	_, err = findInstanceSizeByPlanID(provider, details.PlanID)
+	instanceSize, err := findInstanceSizeByPlanID(provider, planID)
 	if err != nil {
 		return
 	}
 
+	err = b.validateSingleBinding(instanceID, bindingID, details.PlanID, instanceSize.Name)
+	if err != nil {
+		b.logger.Errorw("Instance already has a binding", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+		return
+	}
+
 	// Fetch the cluster from Atlas to ensure it exists.
-	cluster, err := client.GetCluster(NormalizeClusterName(instanceID))
+	cluster, err := b.getInstanceCluster(client, instanceID)
 	if err != nil {
 		b.logger.Errorw("Failed to get existing cluster", "error", err, "instance_id", instanceID)
 		err = atlasToAPIError(err)
 		return
 	}
 
-	// Generate a cryptographically secure random password.
-	password, err := generatePassword()
+	err = rejectDuringMaintenance(ctx, cluster)
+	if err != nil {
+		b.logger.Warnw("Rejected binding during cluster maintenance", "instance_id", instanceID, "binding_id", bindingID, "state", cluster.StateName)
+		return
+	}
+
+	existingUsername, err := existingUserFromParams(details.RawParameters)
+	if err != nil {
+		return
+	}
+
+	var user *atlas.User
+	var password string
+	if existingUsername != "" {
+		// Externally managed users are bound as they are, with their password
+		// from the secret store.
+		user, password, err = b.existingUser(client, cluster, existingUsername)
+		if err != nil {
+			b.logger.Errorw("Can't bind existing database user", "error", err, "instance_id", instanceID, "binding_id", bindingID, "username", existingUsername)
+			return
+		}
+	} else {
+		// Generate a cryptographically secure random password.
+		password, err = generatePassword()
+		if err != nil {
+			b.logger.Errorw("Failed to generate password", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+			err = errors.New("Failed to generate binding password")
+			return
+		}
+
+		// Construct a cluster definition from the instance ID, service, plan, and params.
+		user, err = userFromParams(bindingID, password, details.RawParameters)
+		if err != nil {
+			b.logger.Errorw("Couldn't create user from the passed parameters", "error", err, "instance_id", instanceID, "binding_id", bindingID, "details", details)
+			return
+		}
+	}
+
+	// The connection string options are determined before creating the user
+	// so invalid options are rejected without leaving a user behind.
+	concerns, err := b.connectionConcernsForBinding(details.PlanID, instanceSize.Name, details.RawParameters)
 	if err != nil {
-		b.logger.Errorw("Failed to generate password", "error", err, "instance_id", instanceID, "binding_id", bindingID)
-		err = errors.New("Failed to generate binding password")
+		b.logger.Errorw("Invalid connection concerns passed", "error", err, "instance_id", instanceID, "binding_id", bindingID, "details", details)
 		return
 	}
 
-	// Construct a cluster definition from the instance ID, service, plan, and params.
-	user, err := userFromParams(bindingID, password, details.RawParameters)
+	database, err := b.databaseForBinding(details.PlanID, instanceSize.Name, details.RawParameters)
 	if err != nil {
-		b.logger.Errorw("Couldn't create user from the passed parameters", "error", err, "instance_id", instanceID, "binding_id", bindingID, "details", details)
+		b.logger.Errorw("Invalid database passed", "error", err, "instance_id", instanceID, "binding_id", bindingID, "details", details)
 		return
 	}
 
-	// Create a new Atlas database user from the generated definition.
-	_, err = client.CreateUser(*user)
+	// Drivers which can't resolve SRV records get a seed list of the cluster's
+	// nodes instead. This may fail for clusters whose nodes aren't known.
+	uri, err := bindingURI(client, cluster, details.RawParameters)
 	if err != nil {
-		b.logger.Errorw("Failed to create Atlas database user", "error", err, "instance_id", instanceID, "binding_id", bindingID)
-		err = atlasToAPIError(err)
+		b.logger.Errorw("Failed to build binding connection string", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+		return
+	}
+
+	// Bindings which would connect without TLS are refused before a user is
+	// created if TLS is enforced.
+	err = b.validateTLSEnforced(uri, cluster.ConnectionStrings, details.RawParameters)
+	if err != nil {
+		b.logger.Errorw("Refused plaintext binding", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+		return
+	}
+
+	if existingUsername == "" {
+		// Label the user so it can be attributed to its binding when auditing
+		// the users of the project.
+		user.Labels = b.userLabels(user.Labels, instanceID, bindingID)
+
+		// Create a new Atlas database user from the generated definition.
+		_, err = client.CreateUser(*user)
+		if err != nil {
+			b.logger.Errorw("Failed to create Atlas database user", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+			err = atlasToAPIError(err)
+			return
+		}
+
+		b.logger.Infow("Successfully created Atlas database user", "instance_id", instanceID, "binding_id", bindingID)
+	} else {
+		b.logger.Infow("Binding existing Atlas database user", "instance_id", instanceID, "binding_id", bindingID, "username", existingUsername)
+	}
+	b.logger.Infow("New User ConnectionString", "connectionString", anonymizeConnectionStrings(cluster.ConnectionStrings))
+
+	// Point the connection strings to the default database of the binding.
+	uri = withDatabase(uri, database)
+	connectionStrings := withDatabaseInConnectionStrings(cluster.ConnectionStrings, database)
+
+	// Add the default write and read concerns to the connection strings.
+	uri, err = concerns.apply(uri)
+	if err != nil {
+		return
+	}
+	connectionStrings, err = concerns.applyToConnectionStrings(connectionStrings)
+	if err != nil {
+		return
+	}
+
+	// TLS is enforced last so none of the other options can disable it.
+	uri, connectionStrings, err = b.requireTLSForBinding(instanceID, uri, connectionStrings)
+	if err != nil {
+		return
+	}
+
+	cs, err := json.Marshal(connectionStrings)
+	if err != nil {
+		return
+	}
+
+	connectionDetails := ConnectionDetails{
+		Username:         user.Username,
+		Password:         password,
+		URI:              uri,
+		ConnectionString: string(cs),
+		Database:         database,
+
+		RecommendedMaxPoolSize: b.recommendedMaxPoolSize(cluster, instanceSize.Name),
+	}
+
+	// The credentials may be verified to connect before they're returned.
+	// Users created for the binding are deleted if they can't connect, so
+	// retries start over.
+	err = b.verifyConnection(ctx, connectionDetails)
+	if err != nil {
+		b.logger.Errorw("Failed to verify binding connection", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+		if existingUsername == "" {
+			b.deleteBindingUser(client, instanceID, bindingID, user.Username)
+		}
+		return
+	}
+
+	// The credentials may be stored in a secrets manager, returning only a
+	// reference to them. Users created for the binding are deleted if they
+	// can't be stored.
+	credentials, err := b.deliverCredentials(bindingID, connectionDetails)
+	if err != nil {
+		b.logger.Errorw("Failed to store binding credentials", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+		if existingUsername == "" {
+			b.deleteBindingUser(client, instanceID, bindingID, user.Username)
+		}
+		err = errors.New("Failed to store binding credentials")
 		return
 	}
 
-	b.logger.Infow("Successfully created Atlas database user", "instance_id", instanceID, "binding_id", bindingID)
-	b.logger.Infow("New User ConnectionString", "connectionString", cluster.ConnectionStrings)
-	cs, err := json.Marshal(cluster.ConnectionStrings)
 	spec = brokerapi.Binding{
-		Credentials: ConnectionDetails{
-			Username:         bindingID,
-			Password:         password,
-			URI:              cluster.SrvAddress,
-			ConnectionString: string(cs),
-		},
+		Credentials: credentials,
 	}
 	return
 }
 
 // Unbind will delete the database user for a specific binding. The database
-// user should have the binding ID as its username.
+// user should have the binding ID as its username. Existing users bound with
+// "existing_user" are kept. Retries of an identical
+// request receive the original result.
 func (b Broker) Unbind(ctx context.Context, instanceID string, bindingID string, details brokerapi.UnbindDetails, asyncAllowed bool) (spec brokerapi.UnbindSpec, err error) {
 	b.logger.Infow("Releasing binding", "instance_id", instanceID, "binding_id", bindingID, "details", details)
 
-	client, err := atlasClientFromContext(ctx)
+	err = b.idempotent(ctx, operationKey(operationUnbind, instanceID, bindingID), details, &spec, func() (err error) {
+		spec, err = b.unbind(ctx, instanceID, bindingID)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	// A new binding with the same ID may be created once this one is gone.
+	b.forgetOperations(operationKey(operationBind, instanceID, bindingID))
+
+	if err := b.store.DeleteBinding(bindingID); err != nil {
+		b.logger.Errorw("Failed to remove binding record", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+	}
+
+	// Instances deleted when unbound are scheduled for deletion once the
+	// last binding is gone.
+	if err := b.scheduleAutoTermination(ctx, instanceID); err != nil {
+		b.logger.Errorw("Failed to schedule deletion of unbound instance", "error", err, "instance_id", instanceID)
+	}
+	return
+}
+
+func (b Broker) unbind(ctx context.Context, instanceID string, bindingID string) (spec brokerapi.UnbindSpec, err error) {
+	client, err := b.instanceClient(ctx, instanceID, nil)
 	if err != nil {
 		return
 	}
 
 	// Fetch the cluster from Atlas to ensure it exists.
-	_, err = client.GetCluster(NormalizeClusterName(instanceID))
+	_, err = b.getInstanceCluster(client, instanceID)
 	if err != nil {
 		b.logger.Errorw("Failed to get existing cluster", "error", err, "instance_id", instanceID)
 		err = atlasToAPIError(err)
 		return
 	}
 
+	// Existing users are managed outside of the broker and are kept.
+	binding, err := b.store.GetBinding(bindingID)
+	if err != nil && err != state.ErrNotFound {
+		b.logger.Errorw("Failed to get binding record", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+		return
+	}
+	// Credentials delivered through a secrets manager are deleted first, so
+	// unbinding is retried if they can't be.
+	err = b.deleteDeliveredCredentials(bindingID)
+	if err != nil {
+		b.logger.Errorw("Failed to delete stored binding credentials", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+		return
+	}
+
+	if binding != nil && binding.ExistingUser != "" {
+		b.logger.Infow("Keeping existing Atlas database user of binding", "instance_id", instanceID, "binding_id", bindingID, "username", binding.ExistingUser)
+		spec = brokerapi.UnbindSpec{}
+		return
+	}
+
 	// Delete database user which has the binding ID as its username.
 	err = client.DeleteUser(bindingID)
 	if err != nil {
@@ -119,12 +373,57 @@ func (b Broker) Unbind(ctx context.Context, instanceID string, bindingID string,
 	return
 }
 
-// GetBinding is currently not supported as specified by the
-// BindingsRetrievable setting in the service catalog.
+// GetBinding will return the recorded credentials of a binding after checking
+// its cluster. Credentials for paused clusters are still returned, with a note
+// in the parameters, so clients can reconnect once the cluster is resumed.
+// Credentials issued before the hosts of the cluster changed are flagged as
+// stale in the same way. Bindings of clusters which are gone or being deleted result in a 410.
 func (b Broker) GetBinding(ctx context.Context, instanceID string, bindingID string) (spec brokerapi.GetBindingSpec, err error) {
 	b.logger.Infow("Retrieving binding", "instance_id", instanceID, "binding_id", bindingID)
 
-	err = brokerapi.NewFailureResponse(fmt.Errorf("Unknown binding ID %s", bindingID), 404, "get-binding")
+	binding, err := b.store.GetBinding(bindingID)
+	if err == state.ErrNotFound || (err == nil && binding.InstanceID != instanceID) {
+		err = brokerapi.NewFailureResponse(fmt.Errorf("Unknown binding ID %s", bindingID), 404, "get-binding")
+		return
+	}
+	if err != nil {
+		b.logger.Errorw("Failed to get binding record", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+		return
+	}
+
+	client, err := b.instanceClient(ctx, instanceID, nil)
+	if err != nil {
+		return
+	}
+
+	cluster, err := b.getInstanceCluster(client, instanceID)
+	if err != nil && err != atlas.ErrClusterNotFound {
+		b.logger.Errorw("Failed to get existing cluster", "error", err, "instance_id", instanceID)
+		err = atlasToAPIError(err)
+		return
+	}
+
+	if err == atlas.ErrClusterNotFound || cluster.StateName == atlas.ClusterStateDeleting || cluster.StateName == atlas.ClusterStateDeleted {
+		err = brokerapi.NewFailureResponse(fmt.Errorf("The cluster of binding %s is gone", bindingID), http.StatusGone, "get-binding-cluster-gone")
+		return
+	}
+
+	spec.Credentials = binding.Credentials
+
+	params := map[string]interface{}{}
+	notes := []string{}
+	if cluster.Paused {
+		params["cluster_paused"] = true
+		notes = append(notes, "The cluster is paused. The credentials will work again once it has been resumed.")
+	}
+	if binding.CredentialsStale {
+		params["credentials_stale"] = true
+		notes = append(notes, "The hosts of the cluster have changed. Seed list connection strings in the credentials no longer work, SRV connection strings are unaffected.")
+	}
+	if len(notes) > 0 {
+		params["note"] = strings.Join(notes, " ")
+		spec.Parameters = params
+	}
 	return
 }
 
@@ -160,7 +459,7 @@ func userFromParams(bindingID string, password string, rawParams []byte) (*atlas
 	if len(rawParams) > 0 {
 		err := json.Unmarshal(rawParams, &params)
 		if err != nil {
-			return nil, err
+			return nil, newInvalidParamsError(err)
 		}
 	}
 
@@ -181,3 +480,62 @@ func userFromParams(bindingID string, password string, rawParams []byte) (*atlas
 
 	return params.User, nil
 }
+
+// The suffixes of the label keys used to attribute a database user to the
+// binding it was created for. The keys are prefixed with the configured
+// user label prefix, for example "atlas-osb/binding-id".
+const (
+	userLabelBrokerID   = "broker-id"
+	userLabelInstanceID = "instance-id"
+	userLabelBindingID  = "binding-id"
+)
+
+// userAttribution identifies the binding a database user was created for.
+type userAttribution struct {
+	BrokerID   string
+	InstanceID string
+	BindingID  string
+}
+
+// userLabels adds the labels attributing a database user to a binding to the
+// existing labels. Broker labels replace any existing labels with the same key
+// so users can't be passed off as belonging to another binding.
+func (b Broker) userLabels(existing []atlas.Label, instanceID string, bindingID string) []atlas.Label {
+	brokerLabels := []atlas.Label{
+		atlas.Label{Key: b.userLabelKey(userLabelBrokerID), Value: b.config.BrokerID},
+		atlas.Label{Key: b.userLabelKey(userLabelInstanceID), Value: instanceID},
+		atlas.Label{Key: b.userLabelKey(userLabelBindingID), Value: bindingID},
+	}
+
+	labels := []atlas.Label{}
+	for _, label := range existing {
+		if !strings.HasPrefix(label.Key, b.config.UserLabelPrefix+"/") {
+			labels = append(labels, label)
+		}
+	}
+
+	return append(labels, brokerLabels...)
+}
+
+// userAttributionFromLabels reverses userLabels, returning the binding a
+// database user was created for. false is returned for users which weren't
+// created by this broker, which must never be modified.
+func (b Broker) userAttributionFromLabels(labels []atlas.Label) (userAttribution, bool) {
+	values := map[string]string{}
+	for _, label := range labels {
+		values[label.Key] = label.Value
+	}
+
+	attribution := userAttribution{
+		BrokerID:   values[b.userLabelKey(userLabelBrokerID)],
+		InstanceID: values[b.userLabelKey(userLabelInstanceID)],
+		BindingID:  values[b.userLabelKey(userLabelBindingID)],
+	}
+
+	ok := attribution.BrokerID == b.config.BrokerID && attribution.InstanceID != "" && attribution.BindingID != ""
+	return attribution, ok
+}
+
+func (b Broker) userLabelKey(suffix string) string {
+	return b.config.UserLabelPrefix + "/" + suffix
+}
@@ -1,12 +1,16 @@
 package broker
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
 	"testing"
 
 	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
 	"github.com/pivotal-cf/brokerapi"
 	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 )
 
 func TestBind(t *testing.T) {
@@ -101,11 +105,81 @@ func TestBindAlreadyExisting(t *testing.T) {
 		ServiceID: testServiceID,
 	}, true)
 	_, err := broker.Bind(ctx, instanceID, bindingID, brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"user": {"ldapAuthType": "NONE"}}`),
+	}, true)
+
+	assert.EqualError(t, err, apiresponses.ErrBindingAlreadyExists.Error())
+}
+
+func TestBindReplay(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
 		PlanID:    testPlanID,
 		ServiceID: testServiceID,
 	}, true)
 
+	bindingID := "binding"
+	details := brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}
+
+	// Send identical requests concurrently, simulating a platform retrying a
+	// request which is still in flight.
+	results := make(chan brokerapi.Binding, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			spec, err := broker.Bind(ctx, instanceID, bindingID, details, true)
+			assert.NoError(t, err)
+			results <- spec
+		}()
+	}
+
+	first := <-results
+	second := <-results
+
+	firstJSON, _ := json.Marshal(first)
+	secondJSON, _ := json.Marshal(second)
+	assert.JSONEq(t, string(firstJSON), string(secondJSON), "Expected both requests to receive the same credentials")
+	assert.Contains(t, string(firstJSON), client.Users[bindingID].Password)
+
+	// Once unbound the same request should create a new user.
+	_, err := broker.Unbind(ctx, instanceID, bindingID, brokerapi.UnbindDetails{}, true)
+	assert.NoError(t, err)
+
+	_, err = broker.Bind(ctx, instanceID, bindingID, details, true)
+	assert.NoError(t, err)
+	assert.NotNil(t, client.Users[bindingID], "Expected user to have been recreated")
+}
+
+func TestBindReplayOtherCaller(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	bindingID := "binding"
+	details := brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}
+
+	_, err := broker.Bind(ctx, instanceID, bindingID, details, true)
+	assert.NoError(t, err)
+
+	// An identical request made with another project isn't replayed, so the
+	// credentials aren't returned without Atlas authorizing the request.
+	otherCtx := context.WithValue(context.Background(), ContextKeyAtlasClient, client.ForProject("other-project"))
+	spec, err := broker.Bind(otherCtx, instanceID, bindingID, details, true)
 	assert.EqualError(t, err, apiresponses.ErrBindingAlreadyExists.Error())
+	assert.Nil(t, spec.Credentials)
 }
 
 func TestBindMissingInstance(t *testing.T) {
@@ -172,3 +246,143 @@ func TestUnbindMissingInstance(t *testing.T) {
 
 	assert.EqualError(t, err, apiresponses.ErrInstanceDoesNotExist.Error())
 }
+
+func TestBindUserLabels(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		BrokerID:        "broker-prod",
+		UserLabelPrefix: "osb",
+	})
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	// Labels passed as params which collide with the broker's labels should
+	// be replaced.
+	params := `{
+		"user": {
+			"labels": [
+				{"key": "team", "value": "payments"},
+				{"key": "osb/binding-id", "value": "someone-else"}
+			]
+		}}`
+
+	bindingID := "binding"
+	_, err := broker.Bind(ctx, instanceID, bindingID, brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(params),
+	}, true)
+	assert.NoError(t, err)
+
+	expectedLabels := []atlas.Label{
+		atlas.Label{Key: "team", Value: "payments"},
+		atlas.Label{Key: "osb/broker-id", Value: "broker-prod"},
+		atlas.Label{Key: "osb/instance-id", Value: instanceID},
+		atlas.Label{Key: "osb/binding-id", Value: bindingID},
+	}
+	assert.Equal(t, expectedLabels, client.Users[bindingID].Labels)
+
+	attribution, ok := broker.userAttributionFromLabels(client.Users[bindingID].Labels)
+	assert.True(t, ok)
+	assert.Equal(t, userAttribution{BrokerID: "broker-prod", InstanceID: instanceID, BindingID: bindingID}, attribution)
+}
+
+func TestUserAttributionForeignUser(t *testing.T) {
+	broker, _, _ := setupTest()
+
+	// Users without labels or labelled by another broker deployment must not
+	// be attributed to this broker.
+	_, ok := broker.userAttributionFromLabels(nil)
+	assert.False(t, ok)
+
+	_, ok = broker.userAttributionFromLabels([]atlas.Label{
+		atlas.Label{Key: "atlas-osb/broker-id", Value: "another-broker"},
+		atlas.Label{Key: "atlas-osb/instance-id", Value: "instance"},
+		atlas.Label{Key: "atlas-osb/binding-id", Value: "binding"},
+	})
+	assert.False(t, ok)
+}
+
+// setupBindingTest will provision an instance and create a binding for it,
+// returning the credentials of the binding.
+func setupBindingTest(t *testing.T) (*Broker, MockAtlasClient, context.Context, ConnectionDetails) {
+	broker, client, ctx := setupTest()
+
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	spec, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	return broker, client, ctx, spec.Credentials.(ConnectionDetails)
+}
+
+func TestGetBinding(t *testing.T) {
+	broker, client, ctx, credentials := setupBindingTest(t)
+	client.SetClusterState(NormalizeClusterName("instance"), atlas.ClusterStateIdle)
+
+	spec, err := broker.GetBinding(ctx, "instance", "binding")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var found ConnectionDetails
+	assert.NoError(t, json.Unmarshal(spec.Credentials.(json.RawMessage), &found))
+	assert.Equal(t, credentials, found)
+	assert.Nil(t, spec.Parameters)
+}
+
+func TestGetBindingPausedCluster(t *testing.T) {
+	broker, client, ctx, credentials := setupBindingTest(t)
+	client.Clusters[NormalizeClusterName("instance")].Paused = true
+
+	// The credentials are still returned so clients can reconnect once the
+	// cluster has been resumed.
+	spec, err := broker.GetBinding(ctx, "instance", "binding")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var found ConnectionDetails
+	assert.NoError(t, json.Unmarshal(spec.Credentials.(json.RawMessage), &found))
+	assert.Equal(t, credentials, found)
+	assert.Equal(t, true, spec.Parameters.(map[string]interface{})["cluster_paused"])
+}
+
+func TestGetBindingDeletedCluster(t *testing.T) {
+	broker, client, ctx, _ := setupBindingTest(t)
+
+	client.SetClusterState(NormalizeClusterName("instance"), atlas.ClusterStateDeleting)
+	_, err := broker.GetBinding(ctx, "instance", "binding")
+	assert.Equal(t, http.StatusGone, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+
+	delete(client.Clusters, NormalizeClusterName("instance"))
+	_, err = broker.GetBinding(ctx, "instance", "binding")
+	assert.Equal(t, http.StatusGone, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+}
+
+func TestGetBindingUnknown(t *testing.T) {
+	broker, _, ctx, _ := setupBindingTest(t)
+
+	_, err := broker.GetBinding(ctx, "instance", "unknown")
+	assert.Equal(t, http.StatusNotFound, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+
+	// Bindings are only found through the instance they belong to.
+	_, err = broker.GetBinding(ctx, "other-instance", "binding")
+	assert.Equal(t, http.StatusNotFound, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+
+	// Unbinding removes the record.
+	_, err = broker.Unbind(ctx, "instance", "binding", brokerapi.UnbindDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+	assert.NoError(t, err)
+	_, err = broker.GetBinding(ctx, "instance", "binding")
+	assert.Equal(t, http.StatusNotFound, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+}
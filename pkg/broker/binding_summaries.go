@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// bindingPageSize is the number of bindings fetched from the store at once
+// when summarizing the bindings of an instance.
+const bindingPageSize = 100
+
+// BindingSummaries lists the active bindings of an instance, without their
+// credentials.
+type BindingSummaries struct {
+	Count    int              `json:"count"`
+	Bindings []BindingSummary `json:"bindings"`
+}
+
+// BindingSummary describes a binding without its credentials. CreatedAt is
+// omitted for bindings recorded by older versions of the broker.
+type BindingSummary struct {
+	ID           string     `json:"id"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	Roles        []string   `json:"roles,omitempty"`
+	ExistingUser string     `json:"existing_user,omitempty"`
+}
+
+// roleSummaries summarizes database user roles as "role@database" or
+// "role@database.collection".
+func roleSummaries(roles []atlas.Role) []string {
+	summaries := []string{}
+	for _, role := range roles {
+		summary := role.Name
+		if role.DatabaseName != "" {
+			summary += "@" + role.DatabaseName
+			if role.CollectionName != "" {
+				summary += "." + role.CollectionName
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
+
+// bindingSummaries summarizes the recorded bindings of an instance, ordered
+// by ID.
+func (b Broker) bindingSummaries(instanceID string) (BindingSummaries, error) {
+	summaries := BindingSummaries{Bindings: []BindingSummary{}}
+	filter := state.BindingFilter{InstanceID: instanceID}
+
+	for offset := 0; ; offset += bindingPageSize {
+		bindings, err := b.store.ListBindings(filter, offset, bindingPageSize)
+		if err != nil {
+			return summaries, err
+		}
+
+		for _, binding := range bindings {
+			summary := BindingSummary{
+				ID:           binding.ID,
+				Roles:        binding.Roles,
+				ExistingUser: binding.ExistingUser,
+			}
+			if !binding.CreatedAt.IsZero() {
+				createdAt := binding.CreatedAt
+				summary.CreatedAt = &createdAt
+			}
+			summaries.Bindings = append(summaries.Bindings, summary)
+		}
+
+		if len(bindings) < bindingPageSize {
+			break
+		}
+	}
+
+	summaries.Count = len(summaries.Bindings)
+	return summaries, nil
+}
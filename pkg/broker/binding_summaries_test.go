@@ -0,0 +1,106 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRoleSummaries(t *testing.T) {
+	assert.Equal(t, []string{"readWriteAnyDatabase@admin", "read@app.events", "clusterMonitor"}, roleSummaries([]atlas.Role{
+		{Name: "readWriteAnyDatabase", DatabaseName: "admin"},
+		{Name: "read", DatabaseName: "app", CollectionName: "events"},
+		{Name: "clusterMonitor"},
+	}))
+}
+
+func TestGetInstanceBindings(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{IncludeBindings: true})
+
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.Clusters["instance"].SrvAddress = "mongodb+srv://cluster.mongodb.net"
+
+	bindings := func() BindingSummaries {
+		spec, err := broker.GetInstance(ctx, "instance")
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return spec.Parameters.(map[string]interface{})["bindings"].(BindingSummaries)
+	}
+
+	assert.Equal(t, BindingSummaries{Count: 0, Bindings: []BindingSummary{}}, bindings())
+
+	for _, binding := range []struct{ id, params string }{
+		{"binding-1", ``},
+		{"binding-2", `{"user": {"roles": [{"roleName": "readWrite", "databaseName": "app"}]}}`},
+	} {
+		_, err := broker.Bind(ctx, "instance", binding.id, brokerapi.BindDetails{
+			PlanID:        testPlanID,
+			ServiceID:     testServiceID,
+			RawParameters: []byte(binding.params),
+		}, true)
+		assert.NoError(t, err)
+	}
+
+	summaries := bindings()
+	if assert.Equal(t, 2, summaries.Count) && assert.Len(t, summaries.Bindings, 2) {
+		assert.Equal(t, "binding-1", summaries.Bindings[0].ID)
+		assert.Equal(t, []string{"readWriteAnyDatabase@admin"}, summaries.Bindings[0].Roles)
+		assert.NotNil(t, summaries.Bindings[0].CreatedAt)
+		assert.Equal(t, "binding-2", summaries.Bindings[1].ID)
+		assert.Equal(t, []string{"readWrite@app"}, summaries.Bindings[1].Roles)
+	}
+
+	_, err := broker.Unbind(ctx, "instance", "binding-1", brokerapi.UnbindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	summaries = bindings()
+	if assert.Equal(t, 1, summaries.Count) {
+		assert.Equal(t, "binding-2", summaries.Bindings[0].ID)
+	}
+}
+
+func TestGetInstanceBindingsDisabled(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.Clusters["instance"].SrvAddress = "mongodb+srv://cluster.mongodb.net"
+	broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	spec, err := broker.GetInstance(ctx, "instance")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, spec.Parameters.(map[string]interface{}), "bindings")
+	}
+}
+
+func TestRecordBindingKeepsCreationTime(t *testing.T) {
+	broker, _, _ := setupTest()
+
+	broker.recordBinding("instance", "binding", brokerapi.Binding{}, "", nil)
+	first, err := broker.store.GetBinding("binding")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	broker.recordBinding("instance", "binding", brokerapi.Binding{}, "", nil)
+	second, err := broker.store.GetBinding("binding")
+	if assert.NoError(t, err) {
+		assert.Equal(t, first.CreatedAt, second.CreatedAt)
+	}
+}
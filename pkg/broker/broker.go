@@ -8,6 +8,8 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/telemetry"
 	"github.com/pivotal-cf/brokerapi"
 	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
 	"go.uber.org/zap"
@@ -21,23 +23,66 @@ var _ brokerapi.ServiceBroker = Broker{}
 // an API server.
 type Broker struct {
 	logger    *zap.SugaredLogger
-	whitelist Whitelist
+	config    Config
+	store     state.Store
+	providers *providerCache
+	sweeper   *sweeper
+
+	instanceOperations *telemetry.CounterVec
 }
 
 // NewBroker creates a new Broker with a logger.
 func NewBroker(logger *zap.SugaredLogger) *Broker {
-	return &Broker{
-		logger: logger,
-	}
+	return NewBrokerWithConfig(logger, Config{})
 }
 
 // NewBrokerWithWhitelist creates a new Broker with a given logger and a
 // whitelist for allowed providers and their plans.
 func NewBrokerWithWhitelist(logger *zap.SugaredLogger, whitelist Whitelist) *Broker {
-	return &Broker{
+	return NewBrokerWithConfig(logger, Config{Whitelist: whitelist})
+}
+
+// NewBrokerWithConfig creates a new Broker with a given logger and config.
+func NewBrokerWithConfig(logger *zap.SugaredLogger, config Config) *Broker {
+	config = config.withDefaults()
+
+	broker := &Broker{
 		logger:    logger,
-		whitelist: whitelist,
+		config:    config,
+		store:     state.NewMemoryStore(),
+		providers: newProviderCache(config.ProviderCacheTTL),
+		sweeper:   newSweeper(),
+	}
+
+	if config.Metrics != nil {
+		broker.instanceOperations = config.Metrics.NewCounterVec("broker_instance_operations_total", "Number of started instance operations.", "operation", "ephemeral")
+
+		if config.MetricsLabel != "" {
+			config.Metrics.NewGaugeFunc("broker_active_instances", "Number of instances recorded by the broker.", func(set func(value float64, labelValues ...string)) {
+				broker.collectActiveInstances(set)
+			}, metricLabelName(config.MetricsLabel))
+		}
 	}
+
+	return broker
+}
+
+// updateInstance will modify the record of an instance, creating it if it
+// doesn't exist yet.
+func (b Broker) updateInstance(instanceID string, fn func(instance *state.Instance)) error {
+	unlock := b.store.Lock("instance/" + instanceID)
+	defer unlock()
+
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		instance, err = &state.Instance{ID: instanceID}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fn(instance)
+	return b.store.PutInstance(*instance)
 }
 
 // ContextKey represents the key for a value saved in a context. Linter
@@ -48,11 +93,18 @@ type ContextKey string
 // request context.
 var ContextKeyAtlasClient = ContextKey("atlas-client")
 
+// contextKeyRetryAfter is the key used to store the recorder of the
+// Retry-After of 503 responses in the request context.
+var contextKeyRetryAfter = ContextKey("retry-after")
+
 // AuthMiddleware is used to validate and parse Atlas API credentials passed
 // using basic auth. The credentials parsed into an Atlas client which is
 // attached to the request context. This client can later be retrieved by the
-// broker from the context.
-func AuthMiddleware(baseURL string) mux.MiddlewareFunc {
+// broker from the context. If Atlas rate limits the client, its Retry-After
+// is passed on in the 503 response, as is the Retry-After of requests to
+// clusters under maintenance. Requests to Atlas are sent with the
+// specified user agent.
+func AuthMiddleware(baseURL string, userAgent string) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			username, password, ok := r.BasicAuth()
@@ -74,22 +126,62 @@ func AuthMiddleware(baseURL string) mux.MiddlewareFunc {
 			// Create a new client with the extracted API credentials and
 			// attach it to the request context.
 			client := atlas.NewClient(baseURL, splitUsername[1], splitUsername[0], password)
+			client.UserAgent = userAgent
 			ctx := context.WithValue(r.Context(), ContextKeyAtlasClient, client)
 
-			next.ServeHTTP(w, r.WithContext(ctx))
+			limits := &rateLimitRecorder{transport: client.HTTP.Transport}
+			client.HTTP.Transport = limits
+			ctx = context.WithValue(ctx, contextKeyRetryAfter, limits)
+
+			next.ServeHTTP(&retryAfterWriter{ResponseWriter: w, limits: limits}, r.WithContext(ctx))
 		})
 	}
 }
 
+// userAgentProduct identifies the broker in the user agent of requests to
+// Atlas.
+const userAgentProduct = "atlas-osb"
+
+// UserAgent returns the user agent identifying a version of the broker to
+// Atlas, for example "atlas-osb/1.2.0". An environment tag is appended as a
+// comment if set, for example "atlas-osb/1.2.0 (production)".
+func UserAgent(version string, environment string) string {
+	userAgent := userAgentProduct + "/" + version
+	if environment != "" {
+		userAgent += " (" + environment + ")"
+	}
+
+	return userAgent
+}
+
 // atlasClientFromContext will retrieve an Atlas client stored inside the
-// provided context.
-func atlasClientFromContext(ctx context.Context) (atlas.Client, error) {
+// provided context. Providers are fetched through the broker's cache.
+func (b Broker) atlasClientFromContext(ctx context.Context) (atlas.Client, error) {
 	client, ok := ctx.Value(ContextKeyAtlasClient).(atlas.Client)
 	if !ok {
 		return nil, errors.New("no Atlas client in context")
 	}
 
-	return client, nil
+	return cachingClient{Client: client, cache: b.providers, exclusions: b.config.InstanceSizeExclusions}, nil
+}
+
+// atlasErrorHint is the message and remediation returned for an error code
+// Atlas rejects requests with.
+type atlasErrorHint struct {
+	message     string
+	remediation string
+}
+
+// atlasErrorHints are the hints for the error codes Atlas commonly rejects
+// cluster and database user requests with.
+var atlasErrorHints = map[string]atlasErrorHint{
+	"INVALID_ATTRIBUTE":                 {"A cluster or database user parameter isn't accepted by Atlas", remediationAtlasRejected},
+	"INVALID_ENUM_VALUE":                {"A parameter has a value Atlas doesn't accept", remediationAtlasRejected},
+	"INVALID_JSON":                      {"Atlas couldn't parse the parameters", remediationInvalidParams},
+	"INVALID_REGION":                    {"The region isn't allowed for the cloud provider of the plan", remediationInvalidRegion},
+	"INVALID_CLUSTER_CONFIGURATION":     {"The cluster configuration isn't supported by Atlas", remediationAtlasRejected},
+	"TENANT_CLUSTER_UPDATE_UNSUPPORTED": {"Shared clusters don't support this change", remediationUnsupportedFeature},
+	"NO_PAYMENT_INFORMATION_FOUND":      {"The Atlas organization has no payment method for dedicated clusters", remediationNoPaymentInformation},
 }
 
 // atlasToAPIError converts an Atlas error to a OSB response error.
@@ -104,7 +196,22 @@ func atlasToAPIError(err error) error {
 	case atlas.ErrUserNotFound:
 		return apiresponses.ErrBindingDoesNotExist
 	case atlas.ErrUnauthorized:
-		return apiresponses.NewFailureResponse(err, http.StatusUnauthorized, "")
+		return newRemediableError(err, http.StatusUnauthorized, "", remediationUnauthorized)
+	case atlas.ErrRateLimited:
+		return newRemediableError(err, http.StatusServiceUnavailable, "atlas-rate-limited", remediationRateLimited)
+	}
+
+	// Requests rejected by Atlas are passed on as bad requests. The Atlas
+	// error description refers to the Atlas API rather than the parameters
+	// of the broker, so it's replaced with a message for the error code, and
+	// only logged by the callers.
+	if atlasErr, ok := err.(*atlas.Error); ok && atlasErr.StatusCode == http.StatusBadRequest {
+		hint, ok := atlasErrorHints[atlasErr.Code]
+		if !ok {
+			hint = atlasErrorHint{"Atlas rejected the request", remediationAtlasRejected}
+		}
+
+		return newRemediableError(errors.New(hint.message), http.StatusBadRequest, "atlas-rejected-request", hint.remediation)
 	}
 
 	// Fall back on returning the error again if no others match.
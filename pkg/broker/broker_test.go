@@ -4,9 +4,11 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"testing"
 
 	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -14,11 +16,40 @@ import (
 var (
 	testServiceID = "aosb-cluster-service-aws"
 	testPlanID    = "aosb-cluster-plan-aws-m10"
+	testProjectID = "group-id"
+	testOrgID     = "org-id"
 )
 
 type MockAtlasClient struct {
-	Clusters map[string]*atlas.Cluster
-	Users    map[string]*atlas.User
+	Clusters          map[string]*atlas.Cluster
+	Users             map[string]*atlas.User
+	SearchDeployments map[string]*atlas.SearchDeployment
+
+	// SearchDeploymentErr is returned when creating or updating search
+	// deployments if set.
+	SearchDeploymentErr error
+
+	Processes map[string]*atlas.Process
+	Alerts    map[string]*atlas.Alert
+
+	// MonitoringErr is returned when listing processes and alerts if set.
+	MonitoringErr error
+
+	// UpdateClusterErr is returned when updating clusters if set.
+	UpdateClusterErr error
+
+	// BeforeUpdateCluster is called when updating clusters if set, for
+	// example to block an update.
+	BeforeUpdateCluster func()
+
+	// Auditing is the auditing configuration of the project.
+	Auditing *atlas.Auditing
+
+	// Providers are returned instead of the default AWS provider if set.
+	Providers map[string]*atlas.Provider
+
+	// ProjectID is the project of the client, the test project if empty.
+	ProjectID string
 }
 
 func (m MockAtlasClient) CreateCluster(cluster atlas.Cluster) (*atlas.Cluster, error) {
@@ -34,6 +65,14 @@ func (m MockAtlasClient) CreateCluster(cluster atlas.Cluster) (*atlas.Cluster, e
 }
 
 func (m MockAtlasClient) UpdateCluster(cluster atlas.Cluster) (*atlas.Cluster, error) {
+	if m.BeforeUpdateCluster != nil {
+		m.BeforeUpdateCluster()
+	}
+
+	if m.UpdateClusterErr != nil {
+		return nil, m.UpdateClusterErr
+	}
+
 	if m.Clusters[cluster.Name] == nil {
 		return nil, atlas.ErrClusterNotFound
 	}
@@ -43,6 +82,67 @@ func (m MockAtlasClient) UpdateCluster(cluster atlas.Cluster) (*atlas.Cluster, e
 	return &cluster, nil
 }
 
+func (m MockAtlasClient) RenameCluster(name string, cluster atlas.Cluster) (*atlas.Cluster, error) {
+	if m.Clusters[name] == nil {
+		return nil, atlas.ErrClusterNotFound
+	}
+	if m.Clusters[cluster.Name] != nil {
+		return nil, atlas.ErrClusterAlreadyExists
+	}
+
+	cluster.StateName = atlas.ClusterStateUpdating
+
+	delete(m.Clusters, name)
+	m.Clusters[cluster.Name] = &cluster
+
+	return &cluster, nil
+}
+
+func (m MockAtlasClient) PatchCluster(name string, patch atlas.ClusterPatch) (*atlas.Cluster, error) {
+	if m.UpdateClusterErr != nil {
+		return nil, m.UpdateClusterErr
+	}
+
+	existing := m.Clusters[name]
+	if existing == nil {
+		return nil, atlas.ErrClusterNotFound
+	}
+
+	cluster := *existing
+	if patch.Name != "" {
+		cluster.Name = patch.Name
+	}
+	if patch.Labels != nil {
+		cluster.Labels = patch.Labels
+	}
+	if patch.AutoScaling != nil && patch.AutoScaling.DiskGBEnabled != nil {
+		cluster.AutoScaling.DiskGBEnabled = *patch.AutoScaling.DiskGBEnabled
+	}
+	if patch.BackupEnabled != nil {
+		cluster.BackupEnabled = *patch.BackupEnabled
+	}
+	if patch.BIConnector != nil && patch.BIConnector.Enabled != nil {
+		cluster.BIConnector.Enabled = *patch.BIConnector.Enabled
+	}
+	if patch.DiskSizeGB != 0 {
+		cluster.DiskSizeGB = patch.DiskSizeGB
+	}
+	if patch.Paused != nil {
+		cluster.Paused = *patch.Paused
+	}
+	if patch.ProviderBackupEnabled != nil {
+		cluster.ProviderBackupEnabled = *patch.ProviderBackupEnabled
+	}
+	if patch.ProviderSettings != nil {
+		cluster.ProviderSettings = patch.ProviderSettings
+	}
+
+	delete(m.Clusters, name)
+	m.Clusters[cluster.Name] = &cluster
+
+	return &cluster, nil
+}
+
 func (m MockAtlasClient) DeleteCluster(name string) error {
 	if m.Clusters[name] == nil {
 		return atlas.ErrClusterNotFound
@@ -62,6 +162,23 @@ func (m MockAtlasClient) GetCluster(name string) (*atlas.Cluster, error) {
 	return cluster, nil
 }
 
+func (m MockAtlasClient) ListClusters(pageNum int, itemsPerPage int) (*atlas.ClusterPage, error) {
+	names := make([]string, 0, len(m.Clusters))
+	for name, cluster := range m.Clusters {
+		if cluster != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	page := &atlas.ClusterPage{Results: []atlas.Cluster{}, TotalCount: len(names)}
+	for i := (pageNum - 1) * itemsPerPage; i < len(names) && i < pageNum*itemsPerPage; i++ {
+		page.Results = append(page.Results, *m.Clusters[names[i]])
+	}
+
+	return page, nil
+}
+
 func (m MockAtlasClient) SetClusterState(name string, state string) {
 	cluster := m.Clusters[name]
 	if cluster == nil {
@@ -100,19 +217,130 @@ func (m MockAtlasClient) DeleteUser(name string) error {
 }
 
 func (m MockAtlasClient) GetProvider(name string) (*atlas.Provider, error) {
+	if provider, ok := m.Providers[name]; ok {
+		return provider, nil
+	}
+
 	return &atlas.Provider{
 		Name: "AWS",
 		InstanceSizes: map[string]atlas.InstanceSize{
 			"M10": atlas.InstanceSize{
-				Name: "M10",
+				Name:          "M10",
+				NumCPUs:       2,
+				RAMSizeGB:     2,
+				MaxDiskSizeGB: 128,
+				AvailableRegions: []atlas.Region{
+					atlas.Region{Key: "US_EAST_1", Name: "N. Virginia"},
+				},
 			},
 			"M20": atlas.InstanceSize{
 				Name: "M20",
 			},
+			"M30": atlas.InstanceSize{
+				Name: "M30",
+			},
 		},
 	}, nil
 }
 
+func (m MockAtlasClient) CreateSearchDeployment(clusterName string, deployment atlas.SearchDeployment) (*atlas.SearchDeployment, error) {
+	if m.SearchDeploymentErr != nil {
+		return nil, m.SearchDeploymentErr
+	}
+
+	if m.Clusters[clusterName] == nil {
+		return nil, atlas.ErrClusterNotFound
+	}
+
+	deployment.StateName = atlas.SearchDeploymentStateUpdating
+
+	m.SearchDeployments[clusterName] = &deployment
+
+	return &deployment, nil
+}
+
+func (m MockAtlasClient) UpdateSearchDeployment(clusterName string, deployment atlas.SearchDeployment) (*atlas.SearchDeployment, error) {
+	if m.SearchDeploymentErr != nil {
+		return nil, m.SearchDeploymentErr
+	}
+
+	if m.SearchDeployments[clusterName] == nil {
+		return nil, atlas.ErrSearchDeploymentNotFound
+	}
+
+	deployment.StateName = atlas.SearchDeploymentStateUpdating
+
+	m.SearchDeployments[clusterName] = &deployment
+
+	return &deployment, nil
+}
+
+func (m MockAtlasClient) DeleteSearchDeployment(clusterName string) error {
+	if m.SearchDeployments[clusterName] == nil {
+		return atlas.ErrSearchDeploymentNotFound
+	}
+
+	delete(m.SearchDeployments, clusterName)
+	return nil
+}
+
+func (m MockAtlasClient) GetSearchDeployment(clusterName string) (*atlas.SearchDeployment, error) {
+	deployment := m.SearchDeployments[clusterName]
+	if deployment == nil {
+		return nil, atlas.ErrSearchDeploymentNotFound
+	}
+
+	return deployment, nil
+}
+
+func (m MockAtlasClient) GetProcesses() ([]atlas.Process, error) {
+	if m.MonitoringErr != nil {
+		return nil, m.MonitoringErr
+	}
+
+	processes := []atlas.Process{}
+	for _, process := range m.Processes {
+		processes = append(processes, *process)
+	}
+
+	return processes, nil
+}
+
+func (m MockAtlasClient) GetOpenAlerts() ([]atlas.Alert, error) {
+	if m.MonitoringErr != nil {
+		return nil, m.MonitoringErr
+	}
+
+	alerts := []atlas.Alert{}
+	for _, alert := range m.Alerts {
+		alerts = append(alerts, *alert)
+	}
+
+	return alerts, nil
+}
+
+func (m MockAtlasClient) GetProject() (*atlas.Project, error) {
+	if m.ProjectID != "" {
+		return &atlas.Project{ID: m.ProjectID, Name: "Project", OrgID: testOrgID}, nil
+	}
+
+	return &atlas.Project{ID: testProjectID, Name: "Project", OrgID: testOrgID}, nil
+}
+
+func (m MockAtlasClient) ForProject(projectID string) atlas.Client {
+	m.ProjectID = projectID
+	return m
+}
+
+func (m MockAtlasClient) Identity() string {
+	return m.ProjectID
+}
+
+func (m MockAtlasClient) UpdateAuditing(auditing atlas.Auditing) (*atlas.Auditing, error) {
+	*m.Auditing = auditing
+	return m.Auditing, nil
+}
+
 func (m MockAtlasClient) GetDashboardURL(clusterName string) string {
 	return "http://dashboard"
 }
@@ -121,6 +349,12 @@ func setupTest() (*Broker, MockAtlasClient, context.Context) {
 	client := MockAtlasClient{
 		Clusters: make(map[string]*atlas.Cluster),
 		Users:    make(map[string]*atlas.User),
+
+		SearchDeployments: make(map[string]*atlas.SearchDeployment),
+		Processes:         make(map[string]*atlas.Process),
+		Alerts:            make(map[string]*atlas.Alert),
+		Auditing:          &atlas.Auditing{},
+		Providers:         make(map[string]*atlas.Provider),
 	}
 	ctx := context.WithValue(context.Background(), ContextKeyAtlasClient, client)
 
@@ -134,7 +368,7 @@ func TestAuthMiddleware(t *testing.T) {
 	publicKey := "public-key"
 	privateKey := "private-key"
 
-	middleware := AuthMiddleware(baseURL)
+	middleware := AuthMiddleware(baseURL, "atlas-osb/test")
 
 	// On successful auth the middleware will run testHandler which ensures
 	// the context was set up correctly.
@@ -148,6 +382,7 @@ func TestAuthMiddleware(t *testing.T) {
 		assert.Equal(t, groupID, client.GroupID)
 		assert.Equal(t, publicKey, client.PublicKey)
 		assert.Equal(t, privateKey, client.PrivateKey)
+		assert.Equal(t, "atlas-osb/test", client.UserAgent)
 	})
 
 	// Fake HTTP request which will be sent to middleware. Response is captured
@@ -179,3 +414,31 @@ func TestAuthMiddleware(t *testing.T) {
 	req.SetBasicAuth(publicKey+"@"+groupID, privateKey)
 	middleware(testHandler).ServeHTTP(w, req)
 }
+
+func TestAtlasToAPIErrorHints(t *testing.T) {
+	err := atlasToAPIError(atlas.ErrUnauthorized)
+	assert.EqualError(t, err, "Invalid API key. Remediation: check the broker credentials are formatted as <PUBLIC_KEY>@<GROUP_ID> and the API key has access to the project")
+	assert.Equal(t, http.StatusUnauthorized, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+
+	// Known Atlas error codes are mapped to messages for the user, without
+	// the raw Atlas error.
+	err = atlasToAPIError(&atlas.Error{StatusCode: http.StatusBadRequest, Code: "INVALID_ATTRIBUTE", Description: "Invalid attribute diskSizeGB specified."})
+	assert.EqualError(t, err, "A cluster or database user parameter isn't accepted by Atlas. Remediation: check the parameters against the Atlas API documentation for clusters and database users")
+	assert.Equal(t, http.StatusBadRequest, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+
+	err = atlasToAPIError(&atlas.Error{StatusCode: http.StatusBadRequest, Code: "INVALID_REGION", Description: "No region MARS_1 exists for provider AWS."})
+	assert.Contains(t, err.Error(), "The region isn't allowed for the cloud provider of the plan")
+	assert.NotContains(t, err.Error(), "MARS_1")
+
+	err = atlasToAPIError(&atlas.Error{StatusCode: http.StatusBadRequest, Code: "SOME_NEW_CODE", Description: "Internal detail."})
+	assert.EqualError(t, err, "Atlas rejected the request. Remediation: check the parameters against the Atlas API documentation for clusters and database users")
+
+	// Unexpected errors are passed on as is.
+	serverErr := &atlas.Error{StatusCode: http.StatusInternalServerError, Code: "UNEXPECTED_ERROR"}
+	assert.Equal(t, serverErr, atlasToAPIError(serverErr))
+}
+
+func TestUserAgent(t *testing.T) {
+	assert.Equal(t, "atlas-osb/1.2.0", UserAgent("1.2.0", ""))
+	assert.Equal(t, "atlas-osb/1.2.0 (production)", UserAgent("1.2.0", "production"))
+}
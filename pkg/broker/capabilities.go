@@ -0,0 +1,133 @@
+package broker
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// The optional cluster features whose availability depends on the instance
+// size.
+const (
+	featureAutoScaling      = "autoScaling"
+	featureBackup           = "backup"
+	featureBIConnector      = "biConnector"
+	featureEncryptionAtRest = "encryptionAtRest"
+	featureSearchNodes      = "searchNodes"
+	featureSharding         = "sharding"
+)
+
+// minShardingTier is the smallest tier which can be deployed as a sharded
+// cluster.
+const minShardingTier = 30
+
+// featureRequirements describe the instance sizes each optional feature is
+// available for, included in the errors for unsupported features.
+var featureRequirements = map[string]string{
+	featureAutoScaling:      "M10 or larger",
+	featureBackup:           "M10 or larger",
+	featureBIConnector:      "M10 or larger",
+	featureEncryptionAtRest: "M10 or larger",
+	featureSearchNodes:      "M10 or larger",
+	featureSharding:         fmt.Sprintf("M%d or larger", minShardingTier),
+}
+
+// sharedProviderName is the provider of the shared instance sizes.
+const sharedProviderName = "TENANT"
+
+// sharedInstanceSizes contains the specs of the shared instance sizes, which
+// aren't returned by the Atlas provider options.
+var sharedInstanceSizes = map[string]atlas.InstanceSize{
+	InstanceSizeNameM2: atlas.InstanceSize{Name: InstanceSizeNameM2, MaxDiskSizeGB: 2},
+	InstanceSizeNameM5: atlas.InstanceSize{Name: InstanceSizeNameM5, MaxDiskSizeGB: 5},
+}
+
+// sharedProvider is a synthetic provider for the shared instance sizes, so
+// shared plans are resolved and validated the same way as dedicated plans.
+var sharedProvider = &atlas.Provider{
+	Name:          sharedProviderName,
+	InstanceSizes: sharedInstanceSizes,
+}
+
+// sharedInstanceSizeFeatures is the capability profile of the shared
+// instance sizes, which don't support any of the optional features.
+var sharedInstanceSizeFeatures = []string{}
+
+// providerByName returns a provider with its instance sizes. The shared
+// provider isn't fetched from Atlas.
+func providerByName(client atlas.Client, providerName string) (*atlas.Provider, error) {
+	if providerName == sharedProviderName {
+		return sharedProvider, nil
+	}
+
+	return client.GetProvider(providerName)
+}
+
+// instanceSizeFeatures lists the optional cluster features available for an
+// instance size.
+func instanceSizeFeatures(instanceSizeName string) []string {
+	if isSharedInstanceSize(instanceSizeName) {
+		return sharedInstanceSizeFeatures
+	}
+
+	features := []string{featureAutoScaling, featureBackup, featureBIConnector, featureEncryptionAtRest, featureSearchNodes}
+
+	if tier, ok := instanceSizeTier(instanceSizeName); ok && tier >= minShardingTier {
+		features = append(features, featureSharding)
+	}
+
+	return features
+}
+
+// requestedFeatures lists the optional features a cluster definition enables.
+func requestedFeatures(cluster *atlas.Cluster) []string {
+	features := []string{}
+
+	if cluster.AutoScaling.DiskGBEnabled {
+		features = append(features, featureAutoScaling)
+	}
+
+	if cluster.BackupEnabled || cluster.ProviderBackupEnabled {
+		features = append(features, featureBackup)
+	}
+
+	if cluster.BIConnector.Enabled {
+		features = append(features, featureBIConnector)
+	}
+
+	if cluster.EncryptionAtRestProvider != "" && cluster.EncryptionAtRestProvider != "NONE" {
+		features = append(features, featureEncryptionAtRest)
+	}
+
+	sharded := cluster.ClusterType == atlas.ClusterTypeSharded || cluster.NumShards > 1
+	for _, spec := range cluster.ReplicationSpecs {
+		sharded = sharded || spec.NumShards > 1
+	}
+	if sharded {
+		features = append(features, featureSharding)
+	}
+
+	return features
+}
+
+// validateCapabilities rejects cluster definitions enabling features which
+// aren't available for the instance size, before they're sent to Atlas.
+func validateCapabilities(cluster *atlas.Cluster, instanceSizeName string) error {
+	available := instanceSizeFeatures(instanceSizeName)
+
+	unsupported := []string{}
+	for _, feature := range requestedFeatures(cluster) {
+		if !containsString(available, feature) {
+			unsupported = append(unsupported, fmt.Sprintf("%s (requires %s)", feature, featureRequirements[feature]))
+		}
+	}
+
+	if len(unsupported) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("Instance size %s doesn't support %s", instanceSizeName, strings.Join(unsupported, ", "))
+	return newRemediableError(err, http.StatusUnprocessableEntity, "unsupported-feature", remediationUnsupportedFeature)
+}
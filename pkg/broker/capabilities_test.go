@@ -0,0 +1,81 @@
+package broker
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSharedServiceID = "aosb-cluster-service-tenant"
+	testSharedPlanID    = "aosb-cluster-plan-tenant-m2"
+)
+
+func TestProvisionSharedBackupRejected(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        testSharedPlanID,
+		ServiceID:     testSharedServiceID,
+		RawParameters: []byte(`{"cluster": {"backupEnabled": true}}`),
+	}, true)
+
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		assert.Contains(t, err.Error(), "Instance size M2 doesn't support backup")
+	}
+	assert.Empty(t, client.Clusters)
+}
+
+func TestProvisionShared(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testSharedPlanID,
+		ServiceID:     testSharedServiceID,
+		RawParameters: []byte(`{"cluster": {"providerSettings": {"backingProviderName": "AWS"}}}`),
+	}, true)
+	assert.NoError(t, err)
+
+	cluster := client.Clusters[instanceID]
+	assert.Equal(t, sharedProviderName, cluster.ProviderSettings.ProviderName)
+	assert.Equal(t, InstanceSizeNameM2, cluster.ProviderSettings.InstanceSizeName)
+}
+
+func TestUpdateSharedFeaturesRejected(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testSharedPlanID,
+		ServiceID: testSharedServiceID,
+	}, true)
+
+	_, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		ServiceID:     testSharedServiceID,
+		RawParameters: []byte(`{"cluster": {"biConnector": {"enabled": true}, "clusterType": "SHARDED"}}`),
+	}, true)
+
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		assert.Contains(t, err.Error(), "biConnector (requires M10 or larger), sharding (requires M30 or larger)")
+	}
+}
+
+func TestValidateCapabilities(t *testing.T) {
+	backup := &atlas.Cluster{ProviderBackupEnabled: true}
+	assert.Error(t, validateCapabilities(backup, "M5"))
+	assert.NoError(t, validateCapabilities(backup, "M10"))
+
+	sharded := &atlas.Cluster{ReplicationSpecs: []atlas.ReplicationSpec{atlas.ReplicationSpec{NumShards: 2}}}
+	assert.Error(t, validateCapabilities(sharded, "M20"))
+	assert.NoError(t, validateCapabilities(sharded, "M30"))
+
+	// Disabled features are accepted.
+	assert.NoError(t, validateCapabilities(&atlas.Cluster{EncryptionAtRestProvider: "NONE"}, "M2"))
+}
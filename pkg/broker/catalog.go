@@ -5,16 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
 	"github.com/pivotal-cf/brokerapi"
-	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
 )
 
 // idPrefix will be prepended to service and plan IDs to ensure their uniqueness.
 const idPrefix = "aosb-cluster"
 
+// errEmptyCatalog is returned for catalogs without any plans if the broker
+// requires a non-empty catalog.
+var errEmptyCatalog = errors.New("The catalog is empty, no plans match the whitelist")
+
 // providerNames contains all the available cloud providers on which clusters
 // may be provisioned. The available instance sizes for each provider are
 // fetched dynamically from the Atlas API.
@@ -22,25 +27,23 @@ var (
 	providerNames = []string{"AWS", "GCP", "AZURE", "TENANT"}
 
 	// Hardcode the instance sizes for shared instances
-	sharedService = brokerapi.Service{
-		ID:                   "aosb-cluster-service-tenant",
-		Name:                 "mongodb-atlas-tenant",
-		Description:          "Atlas cluster hosted on \"TENANT\"",
-		Bindable:             true,
-		InstancesRetrievable: false,
-		BindingsRetrievable:  false,
-		Metadata:             nil,
-		PlanUpdatable:        true,
-		Plans: []brokerapi.ServicePlan{
-			brokerapi.ServicePlan{
-				ID:          "aosb-cluster-plan-tenant-m2",
-				Name:        "M2",
-				Description: "Instance size \"M2\"",
+	sharedService = catalogService{
+		ID:          "aosb-cluster-service-tenant",
+		Name:        "mongodb-atlas-tenant",
+		Description: "Atlas cluster hosted on \"TENANT\"",
+		Provider:    "TENANT",
+		Plans: []catalogPlan{
+			catalogPlan{
+				ID:              "aosb-cluster-plan-tenant-m2",
+				Name:            "M2",
+				Description:     "Instance size \"M2\"",
+				ConnectionLimit: atlas.ConnectionLimit("M2"),
 			},
-			brokerapi.ServicePlan{
-				ID:          "aosb-cluster-plan-tenant-m5",
-				Name:        "M5",
-				Description: "Instance size \"M5\"",
+			catalogPlan{
+				ID:              "aosb-cluster-plan-tenant-m5",
+				Name:            "M5",
+				Description:     "Instance size \"M5\"",
+				ConnectionLimit: atlas.ConnectionLimit("M5"),
 			},
 		},
 	}
@@ -48,9 +51,9 @@ var (
 
 // applyWhitelist filters a given service, returning the service with only the
 // whitelisted plans.
-func applyWhitelist(svc brokerapi.Service, whitelistedPlans []string) brokerapi.Service {
+func applyWhitelist(svc catalogService, whitelistedPlans []string) catalogService {
 	whitelistedSvc := svc
-	plans := []brokerapi.ServicePlan{}
+	plans := []catalogPlan{}
 	for _, plan := range whitelistedSvc.Plans {
 		for _, name := range whitelistedPlans {
 			if plan.Name == name {
@@ -64,67 +67,143 @@ func applyWhitelist(svc brokerapi.Service, whitelistedPlans []string) brokerapi.
 	return whitelistedSvc
 }
 
+// missingPlans returns the names which don't match any plan of the service,
+// for example whitelisted instance sizes Atlas no longer offers.
+func missingPlans(svc catalogService, names []string) []string {
+	missing := []string{}
+	for _, name := range names {
+		found := false
+		for _, plan := range svc.Plans {
+			if plan.Name == name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing
+}
+
 // Services generates the service catalog which will be presented to consumers of the API.
 func (b Broker) Services(ctx context.Context) ([]brokerapi.Service, error) {
 	b.logger.Info("Retrieving service catalog")
 
-	services := []brokerapi.Service{}
-	client, err := atlasClientFromContext(ctx)
+	services, err := b.catalog(ctx)
+	return toAPIServices(services), err
+}
+
+// catalog assembles the services of all providers, applying the display
+// names, required parameters, available regions, MongoDB version statuses,
+// plan order, and whitelist.
+func (b Broker) catalog(ctx context.Context) ([]catalogService, error) {
+	services := []catalogService{}
+	client, err := b.atlasClientFromContext(ctx)
 	if err != nil {
 		return services, err
 	}
 
 	for _, providerName := range providerNames {
-		var svc brokerapi.Service
+		var providerServices []catalogService
+		var provider *atlas.Provider
 		if providerName == "TENANT" {
-			svc = sharedService
+			if !b.sharedServiceAvailable(client) {
+				continue
+			}
+
+			providerServices = []catalogService{sharedService}
 		} else {
 
-			provider, err := client.GetProvider(providerName)
+			provider, err = client.GetProvider(providerName)
 			if err != nil {
 				return services, err
 			}
 
-			svc = service(provider)
+			// Editions are derived from the standard service, so they offer
+			// the same plans.
+			svc := service(provider)
+			providerServices = []catalogService{svc}
+			for _, name := range b.config.Editions.names(providerName) {
+				providerServices = append(providerServices, editionService(svc, name, b.config.Editions[name]))
+			}
 		}
 
-		whitelistedPlans, isWhitelisted := b.whitelist[providerName]
-		if b.whitelist == nil || isWhitelisted {
+		whitelistedPlans, isWhitelisted := b.config.Whitelist[providerName]
+		if b.config.Whitelist != nil && !isWhitelisted {
+			continue
+		}
+
+		for _, svc := range providerServices {
+			if b.config.PrefixPlanDisplayNames {
+				svc = withProviderDisplayNames(svc, strings.TrimSpace(providerName+" "+svc.Edition))
+			}
+
+			svc = b.withRequiredParameterSchemas(svc)
+			svc = b.withRegionSchemas(svc, provider)
+			svc = withMongoDBVersions(svc, b.config.MongoDBVersions)
+
+			if order, ok := b.config.PlanOrder[providerName]; ok {
+				var unknown []string
+				svc, unknown = withPlanOrder(svc, order)
+				if len(unknown) > 0 {
+					b.logger.Warnw("Plan order references unknown plans", "provider", providerName, "service_id", svc.ID, "plans", unknown)
+				}
+			}
+
 			if isWhitelisted {
+				missing := missingPlans(svc, whitelistedPlans)
+				if len(missing) > 0 && svc.Edition == "" {
+					b.logger.Warnw("Whitelisted plans aren't offered by Atlas, check the instance size fallbacks", "provider", providerName, "plans", missing)
+				}
+
 				svc = applyWhitelist(svc, whitelistedPlans)
 			}
 			services = append(services, svc)
 		}
 	}
 
+	// A whitelist which matches no plans is most likely a misconfiguration.
+	if catalogIsEmpty(services) {
+		if b.config.RequireNonEmptyCatalog {
+			b.logger.Errorw("Catalog is empty, check the whitelist", "whitelist", b.config.Whitelist)
+			return services, errEmptyCatalog
+		}
+
+		b.logger.Warnw("Catalog is empty, check the whitelist", "whitelist", b.config.Whitelist)
+	}
+
 	return services, nil
 }
 
-func service(provider *atlas.Provider) (service brokerapi.Service) {
-	// Create a CLI-friendly and user-friendly name. Will be displayed in the
-	// marketplace generated by the service catalog.
-	catalogName := fmt.Sprintf("mongodb-atlas-%s", strings.ToLower(provider.Name))
-
-	service = brokerapi.Service{
-		ID:                   serviceIDForProvider(provider),
-		Name:                 catalogName,
-		Description:          fmt.Sprintf(`Atlas cluster hosted on "%s"`, provider.Name),
-		Bindable:             true,
-		InstancesRetrievable: false,
-		BindingsRetrievable:  false,
-		Metadata:             nil,
-		PlanUpdatable:        true,
-		Plans:                plansForProvider(provider),
+// catalogIsEmpty returns whether none of the services have any plans.
+func catalogIsEmpty(services []catalogService) bool {
+	for _, svc := range services {
+		if len(svc.Plans) > 0 {
+			return false
+		}
 	}
 
-	return service
+	return true
+}
+
+func service(provider *atlas.Provider) catalogService {
+	return catalogService{
+		ID:          serviceIDForProvider(provider),
+		Name:        serviceNameForProvider(provider),
+		Description: fmt.Sprintf(`Atlas cluster hosted on "%s"`, provider.Name),
+		Provider:    provider.Name,
+		Plans:       plansForProvider(provider),
+	}
 }
 
 func findProviderByServiceID(client atlas.Client, serviceID string) (*atlas.Provider, error) {
 	for _, providerName := range providerNames {
-		provider, err := client.GetProvider(providerName)
+		provider, err := providerByName(client, providerName)
 		if err != nil {
-			return nil, err
+			return nil, atlasToAPIError(err)
 		}
 
 		if serviceIDForProvider(provider) == serviceID {
@@ -132,7 +211,7 @@ func findProviderByServiceID(client atlas.Client, serviceID string) (*atlas.Prov
 		}
 	}
 
-	return nil, apiresponses.NewFailureResponse(errors.New("Invalid service ID"), http.StatusBadRequest, "invalid-service-id")
+	return nil, newRemediableError(errors.New("Invalid service ID"), http.StatusBadRequest, "invalid-service-id", remediationInvalidServiceID)
 }
 
 func findInstanceSizeByPlanID(provider *atlas.Provider, planID string) (*atlas.InstanceSize, error) {
@@ -142,34 +221,77 @@ func findInstanceSizeByPlanID(provider *atlas.Provider, planID string) (*atlas.I
 		}
 	}
 
-	return nil, apiresponses.NewFailureResponse(errors.New("Invalid plan ID"), http.StatusBadRequest, "invalid-plan-id")
+	return nil, newRemediableError(errors.New("Invalid plan ID"), http.StatusBadRequest, "invalid-plan-id", remediationInvalidPlanID)
 }
 
 // plansForProvider will convert the available instance sizes for a provider
-// to service plans for the broker.
-func plansForProvider(provider *atlas.Provider) []brokerapi.ServicePlan {
-	var plans []brokerapi.ServicePlan
+// to service plans for the broker, ordered by tier. The connection limit of
+// the instance size is included to let consumers size their connection pools
+// accordingly.
+func plansForProvider(provider *atlas.Provider) []catalogPlan {
+	var plans []catalogPlan
 
 	for _, instanceSize := range provider.InstanceSizes {
-		plan := brokerapi.ServicePlan{
-			ID:          planIDForInstanceSize(provider, instanceSize),
-			Name:        instanceSize.Name,
-			Description: fmt.Sprintf("Instance size \"%s\"", instanceSize.Name),
+		plan := catalogPlan{
+			ID:              planIDForInstanceSize(provider, instanceSize),
+			Name:            instanceSize.Name,
+			Description:     fmt.Sprintf("Instance size \"%s\"", instanceSize.Name),
+			ConnectionLimit: atlas.ConnectionLimit(instanceSize.Name),
 		}
 
 		plans = append(plans, plan)
 	}
 
+	sortPlans(plans)
 	return plans
 }
 
+// withProviderDisplayNames returns a copy of the service with the provider
+// prepended to the display names of its plans, for example "AWS M10" or
+// "AWS enterprise M10" for editions. Plan
+// names are the same across services so this helps platforms which show the
+// plans of all services in a single list.
+func withProviderDisplayNames(svc catalogService, providerName string) catalogService {
+	plans := make([]catalogPlan, len(svc.Plans))
+	for i, plan := range svc.Plans {
+		plan.DisplayName = fmt.Sprintf("%s %s", providerName, plan.Name)
+		plans[i] = plan
+	}
+
+	svc.Plans = plans
+	return svc
+}
+
 // serviceIDForProvider will generate a globally unique ID for a provider.
 func serviceIDForProvider(provider *atlas.Provider) string {
 	return fmt.Sprintf("%s-service-%s", idPrefix, strings.ToLower(provider.Name))
 }
 
+// serviceNameForProvider will generate a CLI-friendly and user-friendly name
+// for the service of a provider. It will be displayed in the marketplace
+// generated by the service catalog.
+func serviceNameForProvider(provider *atlas.Provider) string {
+	return fmt.Sprintf("mongodb-atlas-%s", strings.ToLower(provider.Name))
+}
+
 // planIDForInstanceSize will generate a globally unique ID for an instance size
 // on a specific provider.
 func planIDForInstanceSize(provider *atlas.Provider, instanceSize atlas.InstanceSize) string {
 	return fmt.Sprintf("%s-plan-%s-%s", idPrefix, strings.ToLower(provider.Name), strings.ToLower(instanceSize.Name))
 }
+
+// instanceSizeTierPattern extracts the tier number from instance size names
+// such as "M10", "R40", or "M40_NVME".
+var instanceSizeTierPattern = regexp.MustCompile(`^[A-Z]([0-9]+)`)
+
+// instanceSizeTier returns the tier number of an instance size, for example
+// 40 for "R40". False is returned if the name doesn't contain a tier.
+func instanceSizeTier(instanceSizeName string) (int, bool) {
+	match := instanceSizeTierPattern.FindStringSubmatch(instanceSizeName)
+	if match == nil {
+		return 0, false
+	}
+
+	tier, err := strconv.Atoi(match[1])
+	return tier, err == nil
+}
@@ -0,0 +1,163 @@
+package broker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// catalogPath is the path of the OSB catalog endpoint.
+const catalogPath = "/v2/catalog"
+
+// CatalogCaching configures the caching headers and compression of catalog
+// responses. Responses always have an ETag, so pollers can make conditional
+// requests.
+type CatalogCaching struct {
+	// MaxAge is how long platforms may use a catalog without revalidating
+	// it. Platforms revalidate on every request if zero.
+	MaxAge time.Duration
+
+	// Gzip compresses catalogs for platforms accepting gzip.
+	Gzip bool
+}
+
+// CatalogCachingMiddleware adds an ETag derived from the catalog contents and
+// a Cache-Control header to catalog responses, responding with
+// 304 Not Modified if the request's If-None-Match matches the ETag. Other
+// requests and failed catalog requests are passed through unchanged.
+func CatalogCachingMiddleware(caching CatalogCaching) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || r.URL.Path != catalogPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			buffered := &bufferedResponseWriter{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(buffered, r)
+
+			for name, values := range buffered.header {
+				w.Header()[name] = values
+			}
+
+			if buffered.status != http.StatusOK {
+				w.WriteHeader(buffered.status)
+				w.Write(buffered.body.Bytes())
+				return
+			}
+
+			etag := catalogETag(buffered.body.Bytes())
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", caching.cacheControl())
+			if caching.Gzip {
+				w.Header().Add("Vary", "Accept-Encoding")
+			}
+
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.Header().Del("Content-Length")
+				w.Header().Del("Content-Type")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			if !caching.Gzip || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				w.WriteHeader(http.StatusOK)
+				w.Write(buffered.body.Bytes())
+				return
+			}
+
+			w.Header().Del("Content-Length")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusOK)
+
+			gz := gzip.NewWriter(w)
+			gz.Write(buffered.body.Bytes())
+			gz.Close()
+		})
+	}
+}
+
+// cacheControl returns the Cache-Control header of catalog responses.
+// Catalogs are private as they may depend on the broker credentials.
+func (c CatalogCaching) cacheControl() string {
+	if c.MaxAge <= 0 {
+		return "private, no-cache"
+	}
+
+	return fmt.Sprintf("private, max-age=%d", int(c.MaxAge.Seconds()))
+}
+
+// catalogETag returns a strong ETag identifying the version of a catalog,
+// derived from its uncompressed contents.
+func catalogETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches returns whether an If-None-Match header lists the ETag, using
+// the weak comparison RFC 7232 requires for If-None-Match.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// acceptsGzip returns whether an Accept-Encoding header accepts gzip, either
+// by name or with a wildcard, and without a quality of zero.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(coding, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+
+		accepted := true
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				accepted = err == nil && q > 0
+			}
+		}
+
+		if accepted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bufferedResponseWriter keeps a response in memory so its headers can be
+// changed after it has been written.
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
@@ -0,0 +1,138 @@
+package broker
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCatalog = `{"services": [{"id": "aosb-cluster-service-aws"}]}`
+
+// setupCatalogCachingTest returns a router serving a fixed catalog, or
+// failing with 500 if failing is set.
+func setupCatalogCachingTest(caching CatalogCaching, failing *bool) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc(catalogPath, func(w http.ResponseWriter, r *http.Request) {
+		if failing != nil && *failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testCatalog))
+	})
+	router.HandleFunc("/v2/service_instances/instance", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	router.Use(CatalogCachingMiddleware(caching))
+
+	return router
+}
+
+func catalogRequest(router *mux.Router, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, catalogPath, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCatalogETag(t *testing.T) {
+	router := setupCatalogCachingTest(CatalogCaching{}, nil)
+
+	w := catalogRequest(router, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, testCatalog, w.Body.String())
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, catalogETag([]byte(testCatalog)), etag)
+
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w = catalogRequest(router, map[string]string{"If-None-Match": ifNoneMatch})
+		assert.Equal(t, http.StatusNotModified, w.Code, ifNoneMatch)
+		assert.Empty(t, w.Body.String(), ifNoneMatch)
+		assert.Equal(t, etag, w.Header().Get("ETag"), ifNoneMatch)
+	}
+
+	w = catalogRequest(router, map[string]string{"If-None-Match": `"outdated"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, testCatalog, w.Body.String())
+}
+
+func TestCatalogCachingMaxAge(t *testing.T) {
+	router := setupCatalogCachingTest(CatalogCaching{MaxAge: 5 * time.Minute}, nil)
+
+	w := catalogRequest(router, nil)
+	assert.Equal(t, "private, max-age=300", w.Header().Get("Cache-Control"))
+}
+
+func TestCatalogGzip(t *testing.T) {
+	tests := []struct {
+		name           string
+		gzip           bool
+		acceptEncoding string
+		compressed     bool
+	}{
+		{"gzip accepted", true, "gzip, deflate", true},
+		{"wildcard accepted", true, "*", true},
+		{"gzip refused", true, "gzip;q=0, identity", false},
+		{"no accept encoding", true, "", false},
+		{"compression disabled", false, "gzip", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := setupCatalogCachingTest(CatalogCaching{Gzip: test.gzip}, nil)
+
+			w := catalogRequest(router, map[string]string{"Accept-Encoding": test.acceptEncoding})
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, catalogETag([]byte(testCatalog)), w.Header().Get("ETag"), "Expected the ETag not to depend on the encoding")
+
+			if !test.compressed {
+				assert.Empty(t, w.Header().Get("Content-Encoding"))
+				assert.Equal(t, testCatalog, w.Body.String())
+				return
+			}
+
+			assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+			reader, err := gzip.NewReader(w.Body)
+			if !assert.NoError(t, err) {
+				return
+			}
+			body, err := ioutil.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, testCatalog, string(body))
+		})
+	}
+}
+
+func TestCatalogCachingPassThrough(t *testing.T) {
+	failing := true
+	router := setupCatalogCachingTest(CatalogCaching{Gzip: true}, &failing)
+
+	// Failed catalog requests aren't cached.
+	w := catalogRequest(router, map[string]string{"If-None-Match": "*", "Accept-Encoding": "gzip"})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+
+	// Other endpoints are unchanged.
+	req := httptest.NewRequest(http.MethodGet, "/v2/service_instances/instance", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, `{}`, w.Body.String())
+	assert.Empty(t, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+}
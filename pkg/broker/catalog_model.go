@@ -0,0 +1,158 @@
+package broker
+
+import (
+	"fmt"
+
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// catalogService is the broker's model of a service in the catalog. The
+// catalog is assembled, filtered, and ordered using these types and only
+// mapped to the brokerapi types by toAPIServices, so upgrading brokerapi only
+// affects this file.
+type catalogService struct {
+	ID          string
+	Name        string
+	Description string
+	Provider    string
+
+	// Edition is the name of the edition the service offers, empty for the
+	// standard services.
+	Edition string
+
+	Plans []catalogPlan
+}
+
+// catalogPlan is the broker's model of a plan in the catalog.
+type catalogPlan struct {
+	ID          string
+	Name        string
+	Description string
+
+	// DisplayName is shown by platforms instead of the name if set.
+	DisplayName string
+
+	// ConnectionLimit is the connection limit of the instance size, or zero
+	// if it's unknown.
+	ConnectionLimit int
+
+	// Features are the features of an edition enabled for the plan by
+	// default.
+	Features []string
+
+	// MongoDBVersions are the support statuses of MongoDB versions, nil if
+	// no statuses are configured.
+	MongoDBVersions MongoDBVersions
+
+	// ProvisionSchema is the JSON schema of the provision parameters, or nil
+	// if the parameters aren't described.
+	ProvisionSchema map[string]interface{}
+}
+
+// openParametersSchema accepts any parameters. It's served for the
+// operations without a schema of their own when a plan has schemas.
+func openParametersSchema() map[string]interface{} {
+	return map[string]interface{}{"$schema": jsonSchemaDraft, "type": "object"}
+}
+
+// toAPIServices maps the catalog to the services served by the OSB API.
+func toAPIServices(services []catalogService) []brokerapi.Service {
+	apiServices := make([]brokerapi.Service, len(services))
+	for i, svc := range services {
+		apiServices[i] = toAPIService(svc)
+	}
+
+	return apiServices
+}
+
+// toAPIService maps a service of the catalog to the OSB API. All services
+// are bindable, retrievable, and allow plan updates.
+func toAPIService(svc catalogService) brokerapi.Service {
+	plans := make([]brokerapi.ServicePlan, len(svc.Plans))
+	for i, plan := range svc.Plans {
+		plans[i] = toAPIPlan(plan)
+	}
+
+	apiService := brokerapi.Service{
+		ID:                   svc.ID,
+		Name:                 svc.Name,
+		Description:          svc.Description,
+		Bindable:             true,
+		InstancesRetrievable: true,
+		BindingsRetrievable:  true,
+		Metadata:             nil,
+		PlanUpdatable:        true,
+		Plans:                plans,
+	}
+
+	if svc.Edition != "" {
+		apiService.Metadata = &brokerapi.ServiceMetadata{
+			AdditionalMetadata: map[string]interface{}{"edition": svc.Edition},
+		}
+	}
+
+	return apiService
+}
+
+// toAPIPlan maps a plan of the catalog to the OSB API. Metadata is only
+// included if the plan has a display name, a known connection limit, which
+// is included to let consumers size their connection pools accordingly, the
+// features of an edition, or the statuses of MongoDB versions.
+func toAPIPlan(plan catalogPlan) brokerapi.ServicePlan {
+	apiPlan := brokerapi.ServicePlan{
+		ID:          plan.ID,
+		Name:        plan.Name,
+		Description: plan.Description,
+	}
+
+	if plan.DisplayName != "" || plan.ConnectionLimit > 0 || len(plan.Features) > 0 || len(plan.MongoDBVersions) > 0 {
+		apiPlan.Metadata = &brokerapi.ServicePlanMetadata{DisplayName: plan.DisplayName}
+	}
+
+	if plan.ConnectionLimit > 0 {
+		apiPlan.Metadata.Bullets = []string{fmt.Sprintf("Up to %d concurrent connections", plan.ConnectionLimit)}
+		apiPlan.Metadata.AdditionalMetadata = map[string]interface{}{
+			"connectionLimit": plan.ConnectionLimit,
+		}
+	}
+
+	if len(plan.Features) > 0 {
+		if apiPlan.Metadata.AdditionalMetadata == nil {
+			apiPlan.Metadata.AdditionalMetadata = map[string]interface{}{}
+		}
+		apiPlan.Metadata.AdditionalMetadata["features"] = plan.Features
+	}
+
+	if len(plan.MongoDBVersions) > 0 {
+		if apiPlan.Metadata.AdditionalMetadata == nil {
+			apiPlan.Metadata.AdditionalMetadata = map[string]interface{}{}
+		}
+		apiPlan.Metadata.AdditionalMetadata["mongodbVersions"] = plan.MongoDBVersions
+	}
+
+	if plan.ProvisionSchema != nil {
+		schemas := parameterSchemas(plan)
+		apiPlan.Schemas = &schemas
+	}
+
+	return apiPlan
+}
+
+// parameterSchemas returns the parameter schemas of a plan's operations.
+// Operations without a schema of their own accept any parameters.
+func parameterSchemas(plan catalogPlan) brokerapi.ServiceSchemas {
+	provisionSchema := plan.ProvisionSchema
+	if provisionSchema == nil {
+		provisionSchema = openParametersSchema()
+	}
+
+	return brokerapi.ServiceSchemas{
+		Instance: brokerapi.ServiceInstanceSchema{
+			Create: brokerapi.Schema{Parameters: provisionSchema},
+			Update: brokerapi.Schema{Parameters: openParametersSchema()},
+		},
+		Binding: brokerapi.ServiceBindingSchema{
+			Create: brokerapi.Schema{Parameters: openParametersSchema()},
+		},
+	}
+}
@@ -0,0 +1,115 @@
+package broker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+)
+
+// fromAPIService reverses toAPIService to check that the mapping is lossless.
+func fromAPIService(apiService brokerapi.Service) catalogService {
+	svc := catalogService{
+		ID:          apiService.ID,
+		Name:        apiService.Name,
+		Description: apiService.Description,
+		Provider:    providerNameForServiceID(apiService.ID),
+	}
+
+	if apiService.Metadata != nil {
+		svc.Edition, _ = apiService.Metadata.AdditionalMetadata["edition"].(string)
+	}
+
+	for _, apiPlan := range apiService.Plans {
+		plan := catalogPlan{
+			ID:          apiPlan.ID,
+			Name:        apiPlan.Name,
+			Description: apiPlan.Description,
+		}
+
+		if apiPlan.Metadata != nil {
+			plan.DisplayName = apiPlan.Metadata.DisplayName
+			plan.ConnectionLimit, _ = apiPlan.Metadata.AdditionalMetadata["connectionLimit"].(int)
+			plan.Features, _ = apiPlan.Metadata.AdditionalMetadata["features"].([]string)
+			plan.MongoDBVersions, _ = apiPlan.Metadata.AdditionalMetadata["mongodbVersions"].(MongoDBVersions)
+		}
+
+		if apiPlan.Schemas != nil {
+			plan.ProvisionSchema = apiPlan.Schemas.Instance.Create.Parameters
+		}
+
+		svc.Plans = append(svc.Plans, plan)
+	}
+
+	return svc
+}
+
+// assertAllFieldsSet fails if any field of a struct has its zero value,
+// so new fields of the catalog model must be covered by the tests.
+func assertAllFieldsSet(t *testing.T, value interface{}) {
+	v := reflect.ValueOf(value)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		assert.Falsef(t, reflect.DeepEqual(field.Interface(), reflect.Zero(field.Type()).Interface()), "Expected field %s to be set", v.Type().Field(i).Name)
+	}
+}
+
+func TestCatalogMappingIsLossless(t *testing.T) {
+	plan := catalogPlan{
+		ID:              "aosb-cluster-plan-aws-enterprise-m10",
+		Name:            "M10",
+		Description:     `Instance size "M10"`,
+		DisplayName:     "AWS enterprise M10",
+		ConnectionLimit: 1500,
+		Features:        []string{editionFeatureAuditing},
+		MongoDBVersions: testMongoDBVersions,
+		ProvisionSchema: requiredParametersSchema([]string{"cluster.diskSizeGB"}),
+	}
+	svc := catalogService{
+		ID:          "aosb-cluster-service-aws-enterprise",
+		Name:        "mongodb-atlas-aws-enterprise",
+		Description: `Atlas cluster hosted on "AWS", enterprise edition`,
+		Provider:    "AWS",
+		Edition:     "enterprise",
+		Plans:       []catalogPlan{plan, {ID: "aosb-cluster-plan-aws-enterprise-m0", Name: "M0"}},
+	}
+	assertAllFieldsSet(t, svc)
+	assertAllFieldsSet(t, plan)
+
+	apiService := toAPIService(svc)
+	assert.Equal(t, svc, fromAPIService(apiService))
+
+	// The service options are the same for all services.
+	assert.True(t, apiService.Bindable)
+	assert.True(t, apiService.InstancesRetrievable)
+	assert.True(t, apiService.BindingsRetrievable)
+	assert.True(t, apiService.PlanUpdatable)
+
+	apiPlan := apiService.Plans[0]
+	assert.Equal(t, []string{"Up to 1500 concurrent connections"}, apiPlan.Metadata.Bullets)
+	assert.Equal(t, openParametersSchema(), apiPlan.Schemas.Instance.Update.Parameters)
+	assert.Equal(t, openParametersSchema(), apiPlan.Schemas.Binding.Create.Parameters)
+
+	// Plans without metadata or schemas are served without them.
+	assert.Nil(t, apiService.Plans[1].Metadata)
+	assert.Nil(t, apiService.Plans[1].Schemas)
+}
+
+func TestCatalogMappingRoundTrip(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	services, err := broker.catalog(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	apiServices := toAPIServices(services)
+	if !assert.Len(t, apiServices, len(services)) {
+		return
+	}
+
+	for i, apiService := range apiServices {
+		assert.Equal(t, services[i], fromAPIService(apiService))
+	}
+}
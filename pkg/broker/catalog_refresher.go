@@ -0,0 +1,57 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// ValidateCatalogRefreshInterval checks that scheduled catalog refreshes
+// happen before the cached providers expire, so requests never fetch them.
+// A zero interval disables scheduled refreshes.
+func ValidateCatalogRefreshInterval(interval time.Duration, ttl time.Duration) error {
+	if interval < 0 {
+		return fmt.Errorf("negative catalog refresh interval %s", interval)
+	}
+
+	if interval > 0 && interval >= ttl {
+		return fmt.Errorf("catalog refresh interval %s must be shorter than the provider cache TTL %s", interval, ttl)
+	}
+
+	return nil
+}
+
+// RunCatalogRefresher will fetch the providers of the catalog into the cache
+// with the catalog client on every interval until the context is cancelled.
+// Providers which can't be fetched are logged and keep their cached data.
+func (b Broker) RunCatalogRefresher(ctx context.Context, interval time.Duration) {
+	if b.config.CatalogClient == nil {
+		b.logger.Warn("No catalog client configured, the catalog isn't refreshed on a schedule")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.refreshProviders(b.config.CatalogClient)
+		}
+	}
+}
+
+// refreshProviders will fetch all whitelisted providers into the cache,
+// replacing the cached providers even if they haven't expired yet.
+func (b Broker) refreshProviders(client atlas.Client) {
+	for _, providerName := range b.whitelistedProviderNames() {
+		err := b.providers.refresh(client, providerName)
+		if err != nil {
+			b.logger.Errorw("Failed to refresh provider, keeping the cached provider", "error", err, "provider", providerName)
+		}
+	}
+}
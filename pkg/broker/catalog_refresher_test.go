@@ -0,0 +1,102 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// refreshingClient returns a new provider on every fetch, failing with err
+// if set.
+type refreshingClient struct {
+	MockAtlasClient
+
+	mutex   sync.Mutex
+	fetched int
+	err     error
+}
+
+func (c *refreshingClient) GetProvider(name string) (*atlas.Provider, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	c.fetched++
+	return &atlas.Provider{Name: name}, nil
+}
+
+func (c *refreshingClient) fetches() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.fetched
+}
+
+func TestValidateCatalogRefreshInterval(t *testing.T) {
+	assert.NoError(t, ValidateCatalogRefreshInterval(0, time.Hour))
+	assert.NoError(t, ValidateCatalogRefreshInterval(45*time.Minute, time.Hour))
+	assert.Error(t, ValidateCatalogRefreshInterval(time.Hour, time.Hour))
+	assert.Error(t, ValidateCatalogRefreshInterval(-time.Minute, time.Hour))
+}
+
+func TestRefreshProviders(t *testing.T) {
+	client := &refreshingClient{}
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Whitelist: Whitelist{"AWS": []string{"M10"}}})
+
+	cached, err := broker.providers.get(client, "AWS")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Cached providers are replaced before they expire.
+	broker.refreshProviders(client)
+	refreshed, err := broker.providers.get(client, "AWS")
+	assert.NoError(t, err)
+	assert.False(t, cached == refreshed, "Expected the provider to be refreshed")
+	assert.Equal(t, 2, client.fetches(), "Expected only whitelisted providers to be refreshed")
+
+	// Providers which can't be fetched keep their cached data.
+	client.err = errors.New("connection refused")
+	broker.refreshProviders(client)
+	provider, err := broker.providers.get(client, "AWS")
+	assert.NoError(t, err)
+	assert.True(t, refreshed == provider, "Expected the cached provider to be kept")
+}
+
+func TestRunCatalogRefresher(t *testing.T) {
+	client := &refreshingClient{}
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		CatalogClient: client,
+		Whitelist:     Whitelist{"AWS": []string{"M10"}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		broker.RunCatalogRefresher(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	// The providers are refreshed on every interval until the refresher is
+	// stopped.
+	deadline := time.Now().Add(5 * time.Second)
+	for client.fetches() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	assert.True(t, client.fetches() >= 3, "Expected the providers to be refreshed on schedule")
+
+	fetched := client.fetches()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, fetched, client.fetches(), "Expected no refreshes once stopped")
+}
@@ -0,0 +1,60 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+)
+
+// catalogSchemasTitle is the title of the exported parameter schemas.
+const catalogSchemasTitle = "MongoDB Atlas Service Broker parameters"
+
+// handleCatalogSchemas serves the parameter schemas of all plans in the
+// catalog as a single JSON schema.
+func (b Broker) handleCatalogSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas, err := b.CatalogSchemas(r.Context())
+	if err != nil {
+		b.logger.Errorw("Failed to export catalog schemas", "error", err)
+		respondWithError(w, err)
+		return
+	}
+
+	respond(w, http.StatusOK, schemas)
+}
+
+// CatalogSchemas exports the parameter schemas of every plan in the catalog
+// as one JSON schema. Each plan is a definition named after its ID with the
+// schemas of its provision, update, and bind parameters as properties. The
+// schemas are the ones served in the catalog, so plans without schemas in
+// the catalog accept any parameters.
+func (b Broker) CatalogSchemas(ctx context.Context) (map[string]interface{}, error) {
+	b.logger.Info("Exporting catalog schemas")
+
+	services, err := b.catalog(ctx)
+	if err != nil {
+		return nil, atlasToAPIError(err)
+	}
+
+	definitions := map[string]interface{}{}
+	for _, service := range services {
+		for _, plan := range service.Plans {
+			schemas := parameterSchemas(plan)
+
+			definitions[plan.ID] = map[string]interface{}{
+				"title":       service.Name + " " + plan.Name,
+				"description": plan.Description,
+				"type":        "object",
+				"properties": map[string]interface{}{
+					"provision": schemas.Instance.Create.Parameters,
+					"update":    schemas.Instance.Update.Parameters,
+					"bind":      schemas.Binding.Create.Parameters,
+				},
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"$schema":     jsonSchemaDraft,
+		"title":       catalogSchemasTitle,
+		"definitions": definitions,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCatalogSchemas(t *testing.T) {
+	_, _, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		RequiredParameters: RequiredParameters{testPlanID: []string{"cluster.diskSizeGB"}},
+	})
+
+	schemas, err := broker.CatalogSchemas(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, jsonSchemaDraft, schemas["$schema"])
+
+	services, err := broker.Services(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Every plan in the catalog is exported with the same schemas.
+	definitions := schemas["definitions"].(map[string]interface{})
+	planIDs := map[string]bool{}
+	for _, svc := range services {
+		for _, plan := range svc.Plans {
+			planIDs[plan.ID] = true
+
+			definition, ok := definitions[plan.ID].(map[string]interface{})
+			if !assert.True(t, ok, plan.ID) {
+				continue
+			}
+
+			properties := definition["properties"].(map[string]interface{})
+			if plan.Schemas != nil {
+				assert.Equal(t, plan.Schemas.Instance.Create.Parameters, properties["provision"], plan.ID)
+				assert.Equal(t, plan.Schemas.Instance.Update.Parameters, properties["update"], plan.ID)
+				assert.Equal(t, plan.Schemas.Binding.Create.Parameters, properties["bind"], plan.ID)
+			} else {
+				assert.Equal(t, openParametersSchema(), properties["provision"], plan.ID)
+				assert.Equal(t, openParametersSchema(), properties["bind"], plan.ID)
+			}
+		}
+	}
+	assert.Len(t, definitions, len(planIDs))
+
+	provision := definitions[testPlanID].(map[string]interface{})["properties"].(map[string]interface{})["provision"]
+	assert.Equal(t, []string{"cluster"}, provision.(map[string]interface{})["required"])
+}
+
+func TestCatalogSchemasHandler(t *testing.T) {
+	_, _, ctx := setupTest()
+	broker := NewBrokerWithWhitelist(zap.NewNop().Sugar(), Whitelist{"AWS": []string{"M10"}})
+
+	router := mux.NewRouter()
+	AttachExtensionRoutes(router, broker)
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/catalog/schemas", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var schemas struct {
+		Definitions map[string]interface{} `json:"definitions"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schemas))
+	assert.Len(t, schemas.Definitions, 1)
+	assert.Contains(t, schemas.Definitions, testPlanID)
+}
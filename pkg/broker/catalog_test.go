@@ -3,6 +3,7 @@ package broker
 import (
 	"testing"
 
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -20,6 +21,27 @@ func TestCatalog(t *testing.T) {
 	}
 }
 
+// The IDs are those of the upstream mongodb-atlas-service-broker, so
+// instances provisioned by it keep resolving after a migration.
+func TestUpstreamIDFormat(t *testing.T) {
+	_, client, _ := setupTest()
+
+	provider := &atlas.Provider{Name: "AWS"}
+	assert.Equal(t, "aosb-cluster-service-aws", serviceIDForProvider(provider))
+	assert.Equal(t, "aosb-cluster-plan-aws-m10", planIDForInstanceSize(provider, atlas.InstanceSize{Name: "M10"}))
+	assert.Equal(t, "aosb-cluster-plan-aws-m40_nvme", planIDForInstanceSize(provider, atlas.InstanceSize{Name: "M40_NVME"}))
+	assert.Equal(t, "aosb-cluster-service-tenant", sharedService.ID)
+	assert.Equal(t, "aosb-cluster-plan-tenant-m2", sharedService.Plans[0].ID)
+
+	resolved, err := findProviderByServiceID(client, "aosb-cluster-service-aws")
+	if assert.NoError(t, err) {
+		instanceSize, err := findInstanceSizeByPlanID(resolved, "aosb-cluster-plan-aws-m10")
+		assert.NoError(t, err)
+		assert.Equal(t, "M10", instanceSize.Name)
+	}
+	assert.Equal(t, "AWS", providerNameForServiceID("aosb-cluster-service-aws"))
+}
+
 func TestWhitelist(t *testing.T) {
 	_, _, ctx := setupTest()
 
@@ -33,3 +55,85 @@ func TestWhitelist(t *testing.T) {
 	assert.Len(t, services[0].Plans, 1)
 	assert.NoError(t, err)
 }
+
+func TestEmptyCatalog(t *testing.T) {
+	_, _, ctx := setupTest()
+	whitelist := Whitelist{"AWS": []string{"M99"}}
+
+	// An empty catalog is served by default.
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Whitelist: whitelist})
+	catalog, err := broker.catalog(ctx)
+	assert.NoError(t, err)
+	assert.True(t, catalogIsEmpty(catalog))
+
+	broker = NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Whitelist: whitelist, RequireNonEmptyCatalog: true})
+	_, err = broker.Services(ctx)
+	assert.Equal(t, errEmptyCatalog, err)
+
+	// Catalogs with plans are unaffected.
+	broker = NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Whitelist: Whitelist{"AWS": []string{"M10"}}, RequireNonEmptyCatalog: true})
+	services, err := broker.Services(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+}
+
+func TestPlanConnectionLimitMetadata(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	services, err := broker.Services(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	expectedLimits := map[string]int{
+		"M2":  500,
+		"M5":  500,
+		"M10": 1500,
+		"M20": 3000,
+		"M30": 3000,
+	}
+
+	for _, service := range services {
+		for _, plan := range service.Plans {
+			if !assert.NotNilf(t, plan.Metadata, "Expected plan %s to have metadata", plan.ID) {
+				continue
+			}
+
+			assert.Equal(t, expectedLimits[plan.Name], plan.Metadata.AdditionalMetadata["connectionLimit"])
+		}
+	}
+}
+
+func TestPlanDisplayNames(t *testing.T) {
+	_, _, ctx := setupTest()
+	whitelist := Whitelist{"AWS": []string{"M10"}, "TENANT": []string{"M2"}}
+
+	// By default plans are named per service without display names.
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Whitelist: whitelist})
+	services, err := broker.Services(ctx)
+	if !assert.NoError(t, err) || !assert.Len(t, services, 2) {
+		return
+	}
+
+	for _, service := range services {
+		assert.Empty(t, service.Plans[0].Metadata.DisplayName)
+	}
+
+	// Prefixed display names must leave the IDs and names intact.
+	broker = NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Whitelist: whitelist, PrefixPlanDisplayNames: true})
+	prefixedServices, err := broker.Services(ctx)
+	if !assert.NoError(t, err) || !assert.Len(t, prefixedServices, 2) {
+		return
+	}
+
+	assert.Equal(t, "AWS M10", prefixedServices[0].Plans[0].Metadata.DisplayName)
+	assert.Equal(t, "TENANT M2", prefixedServices[1].Plans[0].Metadata.DisplayName)
+	for i, service := range prefixedServices {
+		assert.Equal(t, services[i].Plans[0].ID, service.Plans[0].ID)
+		assert.Equal(t, services[i].Plans[0].Name, service.Plans[0].Name)
+	}
+	assert.Equal(t, 1500, prefixedServices[0].Plans[0].Metadata.AdditionalMetadata["connectionLimit"])
+
+	// The hardcoded shared plans must not have been modified.
+	assert.Empty(t, sharedService.Plans[0].DisplayName)
+}
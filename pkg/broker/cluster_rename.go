@@ -0,0 +1,178 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// clusterNamePattern matches the cluster names Atlas accepts. Names are
+// limited to the length NormalizeClusterName truncates to.
+var clusterNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]{0,22}$`)
+
+// clusterNameFromParams returns the cluster name passed as
+// {"cluster_name": "..."}, or an empty string to keep the current name.
+func clusterNameFromParams(rawParams []byte) (string, error) {
+	params := struct {
+		ClusterName string `json:"cluster_name"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return "", newInvalidParamsError(err)
+		}
+	}
+
+	return params.ClusterName, nil
+}
+
+// clusterLabelInstanceID is the suffix of the label key identifying the
+// instance of a renamed cluster, so its name can be recovered if the record
+// of the instance is lost.
+const clusterLabelInstanceID = "instance-id"
+
+// clusterName returns the name of the cluster of an instance. Clusters are
+// named after their instance unless they have been renamed.
+func (b Broker) clusterName(instanceID string) string {
+	if name := b.recordedClusterName(instanceID); name != "" {
+		return name
+	}
+
+	return NormalizeClusterName(instanceID)
+}
+
+// recordedClusterName returns the name recorded for the cluster of a renamed
+// instance, or an empty string if there is none.
+func (b Broker) recordedClusterName(instanceID string) string {
+	instance, err := b.store.GetInstance(instanceID)
+	if err != nil && err != state.ErrNotFound {
+		b.logger.Warnw("Failed to get the recorded cluster name of the instance", "error", err, "instance_id", instanceID)
+	}
+
+	if instance != nil {
+		return instance.ClusterName
+	}
+
+	return ""
+}
+
+// getInstanceCluster fetches the cluster of an instance. If renames are
+// enabled and no cluster name is recorded for the instance, a cluster which
+// isn't found by the name of the instance may have been renamed. It's then
+// looked up by its instance label and its name is recorded again.
+func (b Broker) getInstanceCluster(client atlas.Client, instanceID string) (*atlas.Cluster, error) {
+	cluster, err := client.GetCluster(b.clusterName(instanceID))
+	if err != atlas.ErrClusterNotFound || !b.config.AllowClusterRenames || b.recordedClusterName(instanceID) != "" {
+		return cluster, err
+	}
+
+	renamed, findErr := b.findRenamedCluster(client, instanceID)
+	if findErr != nil {
+		b.logger.Warnw("Failed to look up renamed cluster", "error", findErr, "instance_id", instanceID)
+		return cluster, err
+	}
+	if renamed == nil {
+		return cluster, err
+	}
+
+	b.logger.Infow("Recovered name of renamed Atlas cluster", "instance_id", instanceID, "cluster_name", renamed.Name)
+	recordErr := b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.ClusterName = renamed.Name
+	})
+	if recordErr != nil {
+		b.logger.Warnw("Failed to record the recovered cluster name", "error", recordErr, "instance_id", instanceID)
+	}
+
+	return renamed, nil
+}
+
+// findRenamedCluster lists the clusters of the project to find the one
+// labelled with the ID of an instance. Nil is returned if there is none.
+func (b Broker) findRenamedCluster(client atlas.Client, instanceID string) (*atlas.Cluster, error) {
+	key := b.userLabelKey(clusterLabelInstanceID)
+	for pageNum := 1; ; pageNum++ {
+		page, err := client.ListClusters(pageNum, maxReconcileBatchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range page.Results {
+			for _, label := range page.Results[i].Labels {
+				if label.Key == key && label.Value == instanceID {
+					return &page.Results[i], nil
+				}
+			}
+		}
+
+		if len(page.Results) == 0 || pageNum*maxReconcileBatchSize >= page.TotalCount {
+			return nil, nil
+		}
+	}
+}
+
+// validateClusterRename rejects renames unless they're enabled, the name is
+// valid, and the cluster can be renamed in its current state. Atlas only
+// renames idle dedicated clusters.
+func (b Broker) validateClusterRename(existingCluster *atlas.Cluster, name string) error {
+	if !b.config.AllowClusterRenames {
+		err := errors.New("Renaming clusters isn't enabled for this broker")
+		return newRemediableError(err, http.StatusUnprocessableEntity, "cluster-renames-disabled", remediationClusterRenamesDisabled)
+	}
+
+	if !clusterNamePattern.MatchString(name) {
+		err := fmt.Errorf(`Invalid cluster name "%s"`, name)
+		return newRemediableError(err, http.StatusBadRequest, "invalid-cluster-name", remediationInvalidClusterName)
+	}
+
+	if isSharedInstanceSize(existingCluster.ProviderSettings.InstanceSizeName) {
+		err := errors.New("Shared clusters can't be renamed")
+		return newRemediableError(err, http.StatusUnprocessableEntity, "cluster-rename-unsupported", remediationClusterRenameUnsupported)
+	}
+
+	if existingCluster.StateName != atlas.ClusterStateIdle {
+		err := fmt.Errorf("Clusters in state %s can't be renamed", existingCluster.StateName)
+		return newRemediableError(err, http.StatusUnprocessableEntity, "cluster-rename-unsupported", remediationClusterRenameUnsupported)
+	}
+
+	return nil
+}
+
+// renameCluster will apply an update to the cluster of an instance which
+// changes its name, and record the new name. The cluster is labelled with the
+// instance. The hosts recorded before the
+// update are compared once it has completed, which refreshes the seed list
+// connection strings.
+func (b Broker) renameCluster(client atlas.Client, instanceID string, name string, cluster *atlas.Cluster) (*atlas.Cluster, error) {
+	// Renamed clusters are labelled with their instance, so their name can
+	// be recovered without the record of the instance.
+	instanceLabel := atlas.Label{Key: b.userLabelKey(clusterLabelInstanceID), Value: instanceID}
+	renaming := *cluster
+	renaming.Labels = []atlas.Label{}
+	for _, label := range cluster.Labels {
+		if label.Key != instanceLabel.Key {
+			renaming.Labels = append(renaming.Labels, label)
+		}
+	}
+	renaming.Labels = append(renaming.Labels, instanceLabel)
+
+	renamedCluster, err := client.RenameCluster(name, renaming)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.ClusterName = renamedCluster.Name
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b.logger.Infow("Renamed Atlas cluster", "instance_id", instanceID, "cluster_name", name, "new_cluster_name", renamedCluster.Name)
+	return renamedCluster, nil
+}
@@ -0,0 +1,174 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// setupRenameTest provisions and binds an idle instance with cluster renames
+// enabled or disabled.
+func setupRenameTest(t *testing.T, allowRenames bool) (*Broker, MockAtlasClient, context.Context, string) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{AllowClusterRenames: allowRenames})
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	client.Clusters[instanceID].ConnectionStrings.Standard = "mongodb://instance-00.mongodb.net:27017/?ssl=true"
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+
+	_, err = broker.Bind(ctx, instanceID, "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	return broker, client, ctx, instanceID
+}
+
+func TestUpdateRenamesCluster(t *testing.T) {
+	broker, client, ctx, instanceID := setupRenameTest(t, true)
+
+	_, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster_name": "payments"}`),
+	}, true)
+	assert.NoError(t, err)
+
+	assert.Nil(t, client.Clusters[instanceID])
+	if !assert.NotNil(t, client.Clusters["payments"]) {
+		return
+	}
+	assert.Equal(t, atlas.ClusterStateUpdating, client.Clusters["payments"].StateName)
+
+	instance, err := broker.store.GetInstance(instanceID)
+	assert.NoError(t, err)
+	assert.Equal(t, "payments", instance.ClusterName)
+
+	// The instance keeps working with the renamed cluster, and the seed list
+	// connection strings issued before the rename are refreshed.
+	client.Clusters["payments"].ConnectionStrings.Standard = "mongodb://payments-00.mongodb.net:27017/?ssl=true"
+	client.SetClusterState("payments", atlas.ClusterStateIdle)
+
+	resp, err := broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationUpdate,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.Succeeded, resp.State)
+
+	_, err = broker.store.GetOperation(operationKey(operationBind, instanceID, "binding"))
+	assert.Error(t, err)
+
+	_, err = broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+
+	_, err = broker.Deprovision(ctx, instanceID, brokerapi.DeprovisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+	assert.Nil(t, client.Clusters["payments"])
+}
+
+func TestDeprovisionRenamedCluster(t *testing.T) {
+	broker, client, ctx, instanceID := setupRenameTest(t, true)
+
+	_, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster_name": "payments"}`),
+	}, true)
+	assert.NoError(t, err)
+	client.SetClusterState("payments", atlas.ClusterStateIdle)
+
+	deleting := *client.Clusters["payments"]
+	spec, err := broker.Deprovision(ctx, instanceID, brokerapi.DeprovisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	// The record is gone, so polls find the renamed cluster by the name
+	// passed in the operation data.
+	deleting.StateName = atlas.ClusterStateDeleting
+	client.Clusters["payments"] = &deleting
+	resp, err := broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{OperationData: spec.OperationData})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.InProgress, resp.State)
+
+	client.Clusters["payments"] = nil
+	resp, err = broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{OperationData: spec.OperationData})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.Succeeded, resp.State)
+}
+
+func TestRenamedClusterRecoveredByLabel(t *testing.T) {
+	broker, client, ctx, instanceID := setupRenameTest(t, true)
+
+	_, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster_name": "payments"}`),
+	}, true)
+	assert.NoError(t, err)
+	client.SetClusterState("payments", atlas.ClusterStateIdle)
+
+	// Renamed clusters are found by their instance label once the record
+	// of the instance is lost.
+	broker.store.DeleteInstance(instanceID)
+	_, err = broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+	assert.Equal(t, "payments", broker.clusterName(instanceID))
+}
+
+func TestUpdateRenameInvalidClusterState(t *testing.T) {
+	broker, client, ctx, instanceID := setupRenameTest(t, true)
+	client.SetClusterState(instanceID, atlas.ClusterStateUpdating)
+
+	_, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster_name": "payments"}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		assert.Contains(t, err.Error(), "can't be renamed")
+	}
+
+	assert.NotNil(t, client.Clusters[instanceID])
+	assert.Nil(t, client.Clusters["payments"])
+}
+
+func TestUpdateRenameDisabled(t *testing.T) {
+	broker, client, ctx, instanceID := setupRenameTest(t, false)
+
+	_, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster_name": "payments"}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+
+	assert.NotNil(t, client.Clusters[instanceID])
+}
+
+func TestUpdateRenameInvalidName(t *testing.T) {
+	broker, _, ctx, instanceID := setupRenameTest(t, true)
+
+	_, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster_name": "-payments"}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+}
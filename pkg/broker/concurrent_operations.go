@@ -0,0 +1,78 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// The policies for mutating operations on an instance which already has one
+// in progress.
+const (
+	// ConcurrentOperationsWait runs the operation once the one in progress
+	// is done.
+	ConcurrentOperationsWait = "wait"
+
+	// ConcurrentOperationsReject rejects the operation with a 422.
+	ConcurrentOperationsReject = "reject"
+)
+
+// errOperationInProgress is returned for rejected concurrent operations.
+var errOperationInProgress = errors.New("Another operation is in progress for this instance")
+
+// ValidateConcurrentOperationsPolicy returns an error for unknown policies.
+func ValidateConcurrentOperationsPolicy(policy string) error {
+	if policy != ConcurrentOperationsWait && policy != ConcurrentOperationsReject {
+		return fmt.Errorf(`unknown policy "%s", valid policies are %s and %s`, policy, ConcurrentOperationsWait, ConcurrentOperationsReject)
+	}
+
+	return nil
+}
+
+// lockInstanceOperations serializes the provisioning, updates, and
+// deprovisioning of an instance, so they can't interleave their changes to
+// the cluster. Depending on the policy the lock is waited for, or the
+// operation rejected if another one holds it. The returned function releases
+// the lock. Reads don't take the lock. Changes which Atlas is still applying
+// are caught by rejectDuringOperation.
+func (b Broker) lockInstanceOperations(instanceID string) (func(), error) {
+	key := "operations/" + instanceID
+
+	if b.config.ConcurrentOperations != ConcurrentOperationsReject {
+		return b.store.Lock(key), nil
+	}
+
+	unlock, ok := b.store.TryLock(key)
+	if !ok {
+		b.logger.Warnw("Rejected concurrent operation", "instance_id", instanceID)
+		return nil, newRemediableError(errOperationInProgress, http.StatusUnprocessableEntity, "operation-in-progress", remediationOperationInProgress)
+	}
+
+	return unlock, nil
+}
+
+// operationStates are the cluster states in which Atlas is applying a change
+// to a cluster.
+var operationStates = []string{atlas.ClusterStateCreating, atlas.ClusterStateUpdating, atlas.ClusterStateDeleting}
+
+// rejectDuringOperation returns a 422 for an operation on a cluster Atlas is
+// still creating, updating, or deleting, regardless of the policy. The
+// broker's lock is released as soon as a change is handed to Atlas, so only
+// the state of the cluster tells whether the change is still being applied.
+// Atlas takes minutes to apply it, longer than platforms wait for a
+// response, so the operation is rejected rather than waited for.
+// Deprovisioning a cluster which is still being created is allowed, so
+// stuck and abandoned provisions can be cleaned up.
+func rejectDuringOperation(cluster *atlas.Cluster, operation string) error {
+	if !containsString(operationStates, cluster.StateName) {
+		return nil
+	}
+	if operation == OperationDeprovision && cluster.StateName == atlas.ClusterStateCreating {
+		return nil
+	}
+
+	err := fmt.Errorf("%v (cluster state %s)", errOperationInProgress, cluster.StateName)
+	return newRemediableError(err, http.StatusUnprocessableEntity, "operation-in-progress", remediationOperationInProgress)
+}
@@ -0,0 +1,173 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// setupConcurrentUpdateTest provisions an instance with a broker using the
+// policy. The first cluster update blocks until release is closed, and
+// started is closed once it's blocking.
+func setupConcurrentUpdateTest(t *testing.T, policy string) (*Broker, MockAtlasClient, context.Context, chan struct{}, chan struct{}, func() int) {
+	_, client, _ := setupTest()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	calls := 0
+	client.BeforeUpdateCluster = func() {
+		mutex.Lock()
+		calls++
+		first := calls == 1
+		mutex.Unlock()
+
+		if first {
+			close(started)
+			<-release
+		}
+	}
+	ctx := context.WithValue(context.Background(), ContextKeyAtlasClient, client)
+
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ConcurrentOperations: policy})
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+
+	return broker, client, ctx, started, release, func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return calls
+	}
+}
+
+func updatePlan(broker *Broker, ctx context.Context, planID string) error {
+	_, err := broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:    planID,
+		ServiceID: testServiceID,
+	}, true)
+	return err
+}
+
+func TestValidateConcurrentOperationsPolicy(t *testing.T) {
+	assert.NoError(t, ValidateConcurrentOperationsPolicy(ConcurrentOperationsWait))
+	assert.NoError(t, ValidateConcurrentOperationsPolicy(ConcurrentOperationsReject))
+	assert.Error(t, ValidateConcurrentOperationsPolicy("queue"))
+}
+
+func TestConcurrentUpdatesWait(t *testing.T) {
+	broker, client, ctx, started, release, calls := setupConcurrentUpdateTest(t, "")
+
+	errs := make(chan error, 2)
+	go func() { errs <- updatePlan(broker, ctx, "aosb-cluster-plan-aws-m20") }()
+	<-started
+
+	go func() { errs <- updatePlan(broker, ctx, "aosb-cluster-plan-aws-m30") }()
+
+	// The second update waits for the first one instead of updating the
+	// cluster at the same time.
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 1, calls())
+
+	close(release)
+	assert.NoError(t, <-errs)
+	assert.NoError(t, <-errs)
+	assert.Equal(t, 2, calls())
+	assert.Equal(t, "M30", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+}
+
+func TestConcurrentUpdatesReject(t *testing.T) {
+	broker, client, ctx, started, release, calls := setupConcurrentUpdateTest(t, ConcurrentOperationsReject)
+
+	errs := make(chan error, 1)
+	go func() { errs <- updatePlan(broker, ctx, "aosb-cluster-plan-aws-m20") }()
+	<-started
+
+	err := updatePlan(broker, ctx, "aosb-cluster-plan-aws-m30")
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		assert.Contains(t, err.Error(), "in progress")
+	}
+
+	// Reads aren't affected by the operation in progress.
+	_, err = broker.GetInstance(ctx, "instance")
+	assert.NoError(t, err)
+
+	close(release)
+	assert.NoError(t, <-errs)
+	assert.Equal(t, 1, calls())
+	assert.Equal(t, "M20", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+
+	// Once the first update is done, the next one is accepted.
+	assert.NoError(t, updatePlan(broker, ctx, "aosb-cluster-plan-aws-m30"))
+	assert.Equal(t, "M30", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+}
+
+func TestOperationsDuringClusterOperation(t *testing.T) {
+	for _, policy := range []string{ConcurrentOperationsWait, ConcurrentOperationsReject} {
+		t.Run(policy, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ConcurrentOperations: policy})
+
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:    testPlanID,
+				ServiceID: testServiceID,
+			}, true)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// The broker is done with the request, but Atlas is still
+			// applying a previous change to the cluster.
+			client.SetClusterState("instance", atlas.ClusterStateUpdating)
+
+			err = updatePlan(broker, ctx, "aosb-cluster-plan-aws-m20")
+			if assert.Error(t, err) {
+				assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+				assert.Contains(t, err.Error(), "cluster state UPDATING")
+			}
+			assert.Equal(t, "M10", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+
+			_, err = broker.Deprovision(ctx, "instance", brokerapi.DeprovisionDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+			if assert.Error(t, err) {
+				assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+			}
+			assert.NotNil(t, client.Clusters["instance"])
+
+			// Once Atlas is done, the update is accepted.
+			client.SetClusterState("instance", atlas.ClusterStateIdle)
+			assert.NoError(t, updatePlan(broker, ctx, "aosb-cluster-plan-aws-m20"))
+			assert.Equal(t, "M20", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+		})
+	}
+}
+
+func TestDeprovisionDuringClusterCreation(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Provisions can be abandoned while Atlas is still creating the cluster.
+	_, err = broker.Deprovision(ctx, "instance", brokerapi.DeprovisionDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+	assert.NoError(t, err)
+	assert.Nil(t, client.Clusters["instance"])
+}
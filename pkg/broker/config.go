@@ -0,0 +1,346 @@
+package broker
+
+import (
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/telemetry"
+)
+
+// DefaultBrokerID is used to identify the broker in Atlas when no ID has
+// been configured.
+const DefaultBrokerID = "atlas-osb"
+
+// DefaultUserLabelPrefix is the prefix used for the keys of the labels added
+// to database users when no prefix has been configured.
+const DefaultUserLabelPrefix = "atlas-osb"
+
+// DefaultProviderCacheTTL is how long providers fetched from Atlas are
+// cached when no TTL has been configured.
+const DefaultProviderCacheTTL = time.Hour
+
+// DefaultAutoTerminationGracePeriod is how long instances are kept after
+// their last binding has been removed when no grace period has been
+// configured.
+const DefaultAutoTerminationGracePeriod = 5 * time.Minute
+
+// Config contains the settings controlling the behaviour of a Broker. The zero
+// value is a valid configuration using the defaults for all settings.
+type Config struct {
+	// Whitelist limits which providers and plans are available. All
+	// providers and plans are available if nil.
+	Whitelist Whitelist
+
+	// BrokerID identifies this broker deployment in the resources it creates
+	// in Atlas. Defaults to DefaultBrokerID.
+	BrokerID string
+
+	// UserLabelPrefix is prepended to the keys of the labels identifying the
+	// binding a database user belongs to, and of the labels the broker adds
+	// to clusters. Defaults to DefaultUserLabelPrefix.
+	UserLabelPrefix string
+
+	// ProvisionTimeouts overrides how long provisioning may take, both the
+	// provision request and the creation of the cluster. Keys are either plan
+	// IDs or plan names (instance sizes) which apply to the plan on all
+	// providers. Plans without an override use a default scaled by their
+	// instance size.
+	ProvisionTimeouts map[string]time.Duration
+
+	// PlanMaxDiskSizeGB caps the disk size which can be requested per plan
+	// ID or plan name, below the maximum Atlas offers.
+	PlanMaxDiskSizeGB map[string]float64
+
+	// ConnectionConcerns are the default connection string options of
+	// bindings. PlanConnectionConcerns overrides them per plan ID or plan
+	// name, and both are overridden by bind parameters.
+	ConnectionConcerns     ConnectionConcerns
+	PlanConnectionConcerns map[string]ConnectionConcerns
+
+	// DefaultDatabase is the database the connection strings of bindings
+	// point to. PlanDefaultDatabases overrides it per plan ID or plan name,
+	// and both are overridden by the "database" bind parameter. Connection
+	// strings have no database if none is set.
+	DefaultDatabase      string
+	PlanDefaultDatabases map[string]string
+
+	// PlanIntents are the intents which can be provisioned instead of a
+	// plan, passed as the "intent" parameter. Intents are resolved to the
+	// smallest plan of the service satisfying their constraints.
+	PlanIntents PlanIntents
+
+	// ConnectionVerifier checks that the credentials of new bindings can
+	// connect to their cluster before they're returned. Bindings whose
+	// credentials can't connect fail. Connections aren't verified if nil.
+	ConnectionVerifier ConnectionVerifier
+
+	// ExpectedBindings is the number of bindings the connection limit of a
+	// cluster is expected to be shared by. If set, the credentials of
+	// bindings recommend a connection pool size of the cluster's connection
+	// limit divided by it.
+	ExpectedBindings int
+
+	// RequireTLS enables TLS in every connection string of bindings,
+	// overriding options which disable it. RequireValidCertificates
+	// additionally disallows invalid certificates.
+	RequireTLS               bool
+	RequireValidCertificates bool
+
+	// EnforceTLS turns requiring TLS into a hard requirement: TLS is enabled
+	// like with RequireTLS, but bindings which ask for a plaintext
+	// connection, or of clusters whose connection strings disable TLS, are
+	// refused instead of rewritten.
+	EnforceTLS bool
+
+	// ProviderCacheTTL is how long providers and their instance sizes are
+	// cached after being fetched from Atlas. Defaults to
+	// DefaultProviderCacheTTL.
+	ProviderCacheTTL time.Duration
+
+	// InstanceSizeExclusions removes instance sizes returned by Atlas from
+	// the catalog based on their attributes.
+	InstanceSizeExclusions []InstanceSizeExclusion
+
+	// RequiredParameters lists provision parameters which must be passed
+	// for plans, by plan ID or name.
+	RequiredParameters RequiredParameters
+
+	// ParameterPatterns lists provision parameters which must be passed with
+	// values matching a pattern, on all plans.
+	ParameterPatterns ParameterPatterns
+
+	// CatalogClient fetches providers outside of OSB requests, for example
+	// when the catalog is refreshed through the admin API. Providers are
+	// fetched from the unauthenticated private API, so it needs no
+	// credentials.
+	CatalogClient atlas.Client
+
+	// AtlasKeys are the clients of named Atlas API keys admin requests may
+	// act with instead of the default credentials.
+	AtlasKeys map[string]atlas.Client
+
+	// StateEncryptionKey is the AES key used to encrypt binding credentials
+	// in state exports. Credentials can only be excluded without a key.
+	StateEncryptionKey []byte
+
+	// RequireNonEmptyCatalog fails catalog requests if no plans are left
+	// after applying the whitelist, instead of only logging a warning.
+	RequireNonEmptyCatalog bool
+
+	// InstanceSizeFallbacks map instance sizes Atlas no longer offers to
+	// their successors, by plan ID or name.
+	InstanceSizeFallbacks InstanceSizeFallbacks
+
+	// LabelPolicy lists the labels clusters must have to be provisioned,
+	// and defaults for some of them.
+	LabelPolicy LabelPolicy
+
+	// Editions are offered as separate services of the dedicated providers,
+	// with features enabled by default.
+	Editions Editions
+
+	// PlanOrder overrides the order plans are listed in per provider. Plans
+	// are ordered by tier by default.
+	PlanOrder PlanOrder
+
+	// PrefixPlanDisplayNames prepends the provider to the display names of
+	// plans, for platforms which flatten all services into one list. Plan
+	// IDs and names are unaffected.
+	PrefixPlanDisplayNames bool
+
+	// EphemeralMaxInstanceSize is the largest instance size ephemeral
+	// instances may use, for example "M20". Unlimited if empty.
+	EphemeralMaxInstanceSize string
+
+	// EphemeralTTL is how long ephemeral instances are kept before their
+	// cluster is deleted, even if they're still bound. They don't expire if
+	// zero.
+	EphemeralTTL time.Duration
+
+	// EphemeralDeleteWhenUnbound deletes ephemeral instances once their last
+	// binding has been removed, as if they had been provisioned with
+	// delete_when_unbound.
+	EphemeralDeleteWhenUnbound bool
+
+	// EphemeralMaxInstances is how many ephemeral instances may exist at
+	// once. Unlimited if zero.
+	EphemeralMaxInstances int
+
+	// ApprovalThresholdInstanceSize is the largest instance size which can be
+	// used without approval, for example "M30". Larger sizes require one of
+	// the ApprovalTokens to be passed. No approval is needed if empty.
+	ApprovalThresholdInstanceSize string
+	ApprovalTokens                []string
+
+	// BackupRequiredInstanceSize is the smallest instance size which requires
+	// backups, for example "M30". Backups are enabled for clusters of this
+	// size or larger and can't be disabled. Backups are optional if empty.
+	BackupRequiredInstanceSize string
+
+	// DefaultRegions are the regions clusters of dedicated providers are
+	// deployed to if provisioning doesn't pass a region.
+	DefaultRegions DefaultRegions
+
+	// ValidateRegionAvailability rejects clusters deployed to regions in
+	// which Atlas doesn't offer their instance size, and limits the regions
+	// in the provision schemas of plans accordingly.
+	ValidateRegionAvailability bool
+
+	// MongoDBVersions are the support statuses of MongoDB versions published
+	// in the plan metadata. Provisioning a deprecated version logs a
+	// warning, or is rejected if RejectDeprecatedVersions is set.
+	MongoDBVersions          MongoDBVersions
+	RejectDeprecatedVersions bool
+
+	// SecretStore provides the passwords of existing database users bound
+	// with the "existing_user" bind parameter. Existing users can't be
+	// bound if nil.
+	SecretStore SecretStore
+
+	// CredentialStore stores the credentials of new bindings in a secrets
+	// manager, returning a reference to them instead. Credentials are
+	// returned directly if nil.
+	CredentialStore CredentialStore
+
+	// AllowClusterRenames enables renaming clusters with the "cluster_name"
+	// update parameter. Renames change the hosts of the cluster, so they're
+	// disabled by default.
+	AllowClusterRenames bool
+
+	// PlanPolicy limits the plans which may be provisioned per platform
+	// context. The zero value leaves all contexts unrestricted.
+	PlanPolicy PlanPolicy
+
+	// AutoTerminationGracePeriod is how long instances provisioned with
+	// delete_when_unbound are kept after their last binding is removed, so
+	// they can be bound again. Defaults to DefaultAutoTerminationGracePeriod.
+	AutoTerminationGracePeriod time.Duration
+
+	// TopologyWebhookURL receives a TopologyChangeEvent when the hosts of a
+	// cluster change after an update. No notifications are sent if empty.
+	TopologyWebhookURL string
+
+	// SingleBinding limits all instances to a single binding at a time.
+	// SingleBindingPlans does so for the instances of some plans, by plan ID
+	// or name.
+	SingleBinding      bool
+	SingleBindingPlans []string
+
+	// IncludeBindings adds a summary of the active bindings of instances,
+	// without credentials, to the parameters returned when fetching them.
+	IncludeBindings bool
+
+	// IncludeParameterHistory adds the parameter changes of instances to the
+	// parameters returned when fetching them. The history is always
+	// available in the admin API.
+	IncludeParameterHistory bool
+
+	// CostTable is used to estimate the monthly cost of instances when
+	// fetching them. No estimate is included if nil.
+	CostTable *CostTable
+
+	// SharedService is whether the shared service is included in the
+	// catalog, SharedServiceAlways or SharedServiceProbe. Defaults to always
+	// including it.
+	SharedService string
+
+	// ConcurrentOperations is what happens to provisioning, updates, and
+	// deprovisioning of an instance while another one is in progress,
+	// ConcurrentOperationsWait or ConcurrentOperationsReject. Defaults to
+	// waiting.
+	ConcurrentOperations string
+
+	// PartialUpdatePolicy is what happens to the parts of an update which
+	// Atlas applied if other parts failed, PartialUpdatePolicyKeep or
+	// PartialUpdatePolicyRollback. Defaults to keeping them.
+	PartialUpdatePolicy string
+
+	// ParameterTransformers enrich or transform the parameters of
+	// provisioning requests in order before they're validated. They're
+	// registered by builds embedding the broker, the parameters are used as
+	// passed if there are none.
+	ParameterTransformers []ParameterTransformer
+
+	// ProjectResolver determines the Atlas project of new instances from the
+	// platform context, within ProjectResolutionTimeout. Instances are
+	// provisioned in the project of the API key if nil.
+	ProjectResolver          ProjectResolver
+	ProjectResolutionTimeout time.Duration
+
+	// ReconcileClient is used to reconcile the state with the clusters in
+	// Atlas on startup. The state isn't reconciled if nil. Clusters are
+	// listed ReconcileBatchSize at a time, fetching up to
+	// ReconcileConcurrency pages at once, and waiting
+	// ReconcileRateLimitBackoff whenever Atlas rate limits a page.
+	// Interrupted reconciles are resumed after ReconcileRetryInterval.
+	ReconcileClient           atlas.Client
+	ReconcileBatchSize        int
+	ReconcileConcurrency      int
+	ReconcileRateLimitBackoff time.Duration
+	ReconcileRetryInterval    time.Duration
+
+	// Metrics is the registry the broker's own metrics are recorded in. No
+	// metrics are recorded if nil.
+	Metrics *telemetry.Registry
+
+	// MetricsLabel is the cluster label key the active instances gauge is
+	// partitioned by. The gauge isn't exposed if empty. Only the values in
+	// MetricsLabelValues are used as label values, all others are counted
+	// as "other".
+	MetricsLabel       string
+	MetricsLabelValues []string
+}
+
+// withDefaults returns a copy of the config with the defaults applied for all
+// unset settings.
+func (c Config) withDefaults() Config {
+	if c.BrokerID == "" {
+		c.BrokerID = DefaultBrokerID
+	}
+
+	if c.UserLabelPrefix == "" {
+		c.UserLabelPrefix = DefaultUserLabelPrefix
+	}
+
+	if c.ProviderCacheTTL == 0 {
+		c.ProviderCacheTTL = DefaultProviderCacheTTL
+	}
+
+	if c.AutoTerminationGracePeriod == 0 {
+		c.AutoTerminationGracePeriod = DefaultAutoTerminationGracePeriod
+	}
+
+	if c.SharedService == "" {
+		c.SharedService = SharedServiceAlways
+	}
+
+	if c.ConcurrentOperations == "" {
+		c.ConcurrentOperations = ConcurrentOperationsWait
+	}
+
+	if c.PartialUpdatePolicy == "" {
+		c.PartialUpdatePolicy = PartialUpdatePolicyKeep
+	}
+
+	if c.ProjectResolutionTimeout == 0 {
+		c.ProjectResolutionTimeout = DefaultProjectResolutionTimeout
+	}
+
+	if c.ReconcileBatchSize == 0 {
+		c.ReconcileBatchSize = DefaultReconcileBatchSize
+	}
+
+	if c.ReconcileConcurrency == 0 {
+		c.ReconcileConcurrency = DefaultReconcileConcurrency
+	}
+
+	if c.ReconcileRateLimitBackoff == 0 {
+		c.ReconcileRateLimitBackoff = DefaultReconcileRateLimitBackoff
+	}
+
+	if c.ReconcileRetryInterval == 0 {
+		c.ReconcileRetryInterval = DefaultReconcileRetryInterval
+	}
+
+	return c
+}
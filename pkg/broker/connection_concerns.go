@@ -0,0 +1,211 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// ConnectionConcerns are the default write and read concern options added to
+// the connection strings returned for bindings. Unset options aren't added.
+type ConnectionConcerns struct {
+	W                string `json:"w,omitempty"`
+	ReadConcernLevel string `json:"readConcernLevel,omitempty"`
+	Journal          *bool  `json:"journal,omitempty"`
+}
+
+// readConcernLevels are the accepted values for ReadConcernLevel.
+var readConcernLevels = []string{"local", "available", "majority", "linearizable", "snapshot"}
+
+// Validate returns an error if any of the options has a value the MongoDB
+// drivers don't accept.
+func (c ConnectionConcerns) Validate() error {
+	if c.W != "" && c.W != "majority" {
+		nodes, err := strconv.Atoi(c.W)
+		if err != nil || nodes < 0 {
+			return fmt.Errorf(`invalid write concern "%s", expected "majority" or a number of nodes`, c.W)
+		}
+	}
+
+	if c.ReadConcernLevel != "" && !containsString(readConcernLevels, c.ReadConcernLevel) {
+		return fmt.Errorf(`invalid read concern level "%s", valid levels are %s`, c.ReadConcernLevel, strings.Join(readConcernLevels, ", "))
+	}
+
+	if c.W == "0" && c.Journal != nil && *c.Journal {
+		return errors.New("journal can't be enabled for unacknowledged writes (w=0)")
+	}
+
+	return nil
+}
+
+// withDefaults returns a copy of the concerns with unset options taken from
+// defaults.
+func (c ConnectionConcerns) withDefaults(defaults ConnectionConcerns) ConnectionConcerns {
+	if c.W == "" {
+		c.W = defaults.W
+	}
+
+	if c.ReadConcernLevel == "" {
+		c.ReadConcernLevel = defaults.ReadConcernLevel
+	}
+
+	if c.Journal == nil {
+		c.Journal = defaults.Journal
+	}
+
+	return c
+}
+
+// apply adds the set options to the query of a connection string, replacing
+// existing values. Empty connection strings are returned unchanged.
+func (c ConnectionConcerns) apply(connectionString string) (string, error) {
+	return withQuery(connectionString, func(query url.Values) {
+		if c.W != "" {
+			query.Set("w", c.W)
+		}
+
+		if c.ReadConcernLevel != "" {
+			query.Set("readConcernLevel", c.ReadConcernLevel)
+		}
+
+		if c.Journal != nil {
+			query.Set("journal", strconv.FormatBool(*c.Journal))
+		}
+	})
+}
+
+// withQuery lets fn modify the options in the query of a connection string.
+// Empty connection strings are returned unchanged.
+func withQuery(connectionString string, fn func(query url.Values)) (string, error) {
+	if connectionString == "" {
+		return connectionString, nil
+	}
+
+	// Connection strings may contain several comma-separated hosts, which
+	// url.Parse rejects, so only the query is parsed.
+	base, rawQuery := connectionString, ""
+	if i := strings.Index(connectionString, "?"); i >= 0 {
+		base, rawQuery = connectionString[:i], connectionString[i+1:]
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", err
+	}
+
+	fn(query)
+
+	if len(query) == 0 {
+		return base, nil
+	}
+
+	// Options must follow a slash, even if no database is specified.
+	hosts := base
+	if i := strings.Index(base, "://"); i >= 0 {
+		hosts = base[i+len("://"):]
+	}
+	if !strings.Contains(hosts, "/") {
+		base += "/"
+	}
+
+	return base + "?" + query.Encode(), nil
+}
+
+// connectionConcernsForBinding determines the connection concerns of a new
+// binding. Options passed as bind parameters take precedence over the
+// defaults of the plan, which take precedence over the broker defaults.
+func (b Broker) connectionConcernsForBinding(planID string, planName string, rawParams []byte) (ConnectionConcerns, error) {
+	params := struct {
+		ConnectionConcerns ConnectionConcerns `json:"connectionConcerns"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return ConnectionConcerns{}, newInvalidParamsError(err)
+		}
+	}
+
+	err := params.ConnectionConcerns.Validate()
+	if err != nil {
+		return ConnectionConcerns{}, newRemediableError(err, http.StatusBadRequest, "invalid-connection-concerns", remediationInvalidConnectionConcerns)
+	}
+
+	planDefaults, ok := b.config.PlanConnectionConcerns[planID]
+	if !ok {
+		planDefaults = b.config.PlanConnectionConcerns[planName]
+	}
+
+	concerns := params.ConnectionConcerns.
+		withDefaults(planDefaults).
+		withDefaults(b.config.ConnectionConcerns)
+
+	// The passed options may conflict with the defaults.
+	err = concerns.Validate()
+	if err != nil {
+		return ConnectionConcerns{}, newRemediableError(err, http.StatusBadRequest, "invalid-connection-concerns", remediationInvalidConnectionConcerns)
+	}
+
+	return concerns, nil
+}
+
+// applyToConnectionStrings adds the options to all of a cluster's connection
+// strings.
+func (c ConnectionConcerns) applyToConnectionStrings(connectionStrings atlas.ConnectionStrings) (atlas.ConnectionStrings, error) {
+	var err error
+	for _, connectionString := range []*string{
+		&connectionStrings.Standard,
+		&connectionStrings.StandardSrv,
+		&connectionStrings.Private,
+		&connectionStrings.PrivateSrv,
+	} {
+		*connectionString, err = c.apply(*connectionString)
+		if err != nil {
+			return connectionStrings, err
+		}
+	}
+
+	return connectionStrings, nil
+}
+
+// ReadPlanConnectionConcernsFile will read the default connection concerns of
+// plans from a JSON file. The file contains an object with plan IDs or names
+// as keys, for example {"M10": {"w": "majority"}}.
+func ReadPlanConnectionConcernsFile(path string) (map[string]ConnectionConcerns, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var concerns map[string]ConnectionConcerns
+	err = json.Unmarshal(data, &concerns)
+	if err != nil {
+		return nil, err
+	}
+
+	for plan, planConcerns := range concerns {
+		err = planConcerns.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid connection concerns for plan %s: %v", plan, err)
+		}
+	}
+
+	return concerns, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,119 @@
+package broker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestConnectionConcernsApply(t *testing.T) {
+	journal := true
+	concerns := ConnectionConcerns{W: "majority", ReadConcernLevel: "local", Journal: &journal}
+
+	uri, err := concerns.apply("mongodb+srv://cluster.mongodb.net")
+	assert.NoError(t, err)
+	assert.Equal(t, "mongodb+srv://cluster.mongodb.net/?journal=true&readConcernLevel=local&w=majority", uri)
+
+	// Existing options are kept and hosts aren't parsed.
+	uri, err = concerns.apply("mongodb://a:27017,b:27017/?ssl=true&w=1")
+	assert.NoError(t, err)
+	assert.Equal(t, "mongodb://a:27017,b:27017/?journal=true&readConcernLevel=local&ssl=true&w=majority", uri)
+
+	uri, err = concerns.apply("")
+	assert.NoError(t, err)
+	assert.Empty(t, uri)
+
+	uri, err = ConnectionConcerns{}.apply("mongodb+srv://cluster.mongodb.net")
+	assert.NoError(t, err)
+	assert.Equal(t, "mongodb+srv://cluster.mongodb.net", uri)
+}
+
+func TestConnectionConcernsValidate(t *testing.T) {
+	journal := true
+
+	assert.NoError(t, ConnectionConcerns{}.Validate())
+	assert.NoError(t, ConnectionConcerns{W: "2", ReadConcernLevel: "snapshot"}.Validate())
+	assert.Error(t, ConnectionConcerns{W: "all"}.Validate())
+	assert.Error(t, ConnectionConcerns{W: "-1"}.Validate())
+	assert.Error(t, ConnectionConcerns{ReadConcernLevel: "strong"}.Validate())
+	assert.Error(t, ConnectionConcerns{W: "0", Journal: &journal}.Validate())
+}
+
+func TestBindConnectionConcernsPrecedence(t *testing.T) {
+	_, client, ctx := setupTest()
+
+	journal := false
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		ConnectionConcerns: ConnectionConcerns{W: "1", ReadConcernLevel: "local", Journal: &journal},
+		PlanConnectionConcerns: map[string]ConnectionConcerns{
+			"M10": ConnectionConcerns{W: "majority", ReadConcernLevel: "majority"},
+		},
+	})
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.Clusters[instanceID].SrvAddress = "mongodb+srv://cluster.mongodb.net"
+
+	spec, err := broker.Bind(ctx, instanceID, "binding", brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"connectionConcerns": {"readConcernLevel": "linearizable"}}`),
+	}, true)
+	assert.NoError(t, err)
+
+	// w comes from the plan, readConcernLevel from the bind parameters, and
+	// journal from the broker.
+	credentials := spec.Credentials.(ConnectionDetails)
+	assert.Equal(t, "mongodb+srv://cluster.mongodb.net/?journal=false&readConcernLevel=linearizable&w=majority", credentials.URI)
+}
+
+func TestBindInvalidConnectionConcerns(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	bindingID := "binding"
+	_, err := broker.Bind(ctx, instanceID, bindingID, brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"connectionConcerns": {"w": "everyone"}}`),
+	}, true)
+
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+	assert.Nil(t, client.Users[bindingID], "Expected no user to be created")
+}
+
+func TestReadPlanConnectionConcernsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "concerns")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "concerns.json")
+	ioutil.WriteFile(path, []byte(`{"M10": {"w": "majority"}}`), 0600)
+
+	concerns, err := ReadPlanConnectionConcernsFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]ConnectionConcerns{"M10": ConnectionConcerns{W: "majority"}}, concerns)
+
+	ioutil.WriteFile(path, []byte(`{"M10": {"readConcernLevel": "strong"}}`), 0600)
+	_, err = ReadPlanConnectionConcernsFile(path)
+	assert.EqualError(t, err, `invalid connection concerns for plan M10: invalid read concern level "strong", valid levels are local, available, majority, linearizable, snapshot`)
+}
@@ -0,0 +1,116 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// DefaultConnectionVerificationTimeout is how long connections are retried
+// when verifying the credentials of bindings. Atlas may take a while to
+// deploy new database users to the cluster, but binding is synchronous, so
+// the timeout has to leave room for the rest of the request within the
+// timeout of the platform, 60 seconds for Cloud Foundry.
+const DefaultConnectionVerificationTimeout = 30 * time.Second
+
+// PlatformRequestTimeout is the shortest timeout platforms commonly give
+// broker requests before abandoning them, the one of Cloud Foundry.
+const PlatformRequestTimeout = 60 * time.Second
+
+// connectionVerificationInterval is the delay between failed attempts to
+// connect with the credentials of a binding.
+const connectionVerificationInterval = 5 * time.Second
+
+// ConnectionVerifier checks that the credentials of a binding can connect
+// to its cluster before they're returned.
+type ConnectionVerifier interface {
+	VerifyConnection(ctx context.Context, credentials ConnectionDetails) error
+}
+
+// MongoConnectionVerifier verifies credentials by connecting to the cluster
+// and pinging its primary, retrying until the timeout has passed.
+type MongoConnectionVerifier struct {
+	Timeout time.Duration
+}
+
+// VerifyConnection connects to the cluster with the credentials and returns
+// the error of the last attempt if none succeeded within the timeout.
+func (v MongoConnectionVerifier) VerifyConnection(ctx context.Context, credentials ConnectionDetails) error {
+	timeout := v.Timeout
+	if timeout <= 0 {
+		timeout = DefaultConnectionVerificationTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	opts := options.Client().
+		ApplyURI(credentials.URI).
+		SetAuth(options.Credential{
+			AuthSource:  "admin",
+			Username:    credentials.Username,
+			Password:    credentials.Password,
+			PasswordSet: true,
+		}).
+		SetServerSelectionTimeout(timeout)
+
+	for {
+		err := ping(ctx, opts)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(connectionVerificationInterval):
+		}
+	}
+}
+
+// ping connects to a cluster and pings its primary.
+func ping(ctx context.Context, opts *options.ClientOptions) error {
+	client, err := mongo.NewClient(opts)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Connect(ctx); err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	return client.Ping(ctx, readpref.Primary())
+}
+
+// verifyConnection checks that the credentials of a binding connect to its
+// cluster if the broker verifies connections. Failures are returned as a 422
+// including the reason.
+func (b Broker) verifyConnection(ctx context.Context, credentials ConnectionDetails) error {
+	if b.config.ConnectionVerifier == nil {
+		return nil
+	}
+
+	err := b.config.ConnectionVerifier.VerifyConnection(ctx, credentials)
+	if err != nil {
+		err := fmt.Errorf("Failed to connect to the cluster with the binding credentials: %v", err)
+		return newRemediableError(err, http.StatusUnprocessableEntity, "connection-verification-failed", remediationConnectionVerification)
+	}
+
+	return nil
+}
+
+// deleteBindingUser removes the database user created for a binding which
+// failed, so retries start over. Failures are only logged as the binding has
+// already failed.
+func (b Broker) deleteBindingUser(client atlas.Client, instanceID string, bindingID string, username string) {
+	if err := client.DeleteUser(username); err != nil {
+		b.logger.Errorw("Failed to delete Atlas database user", "error", err, "instance_id", instanceID, "binding_id", bindingID)
+	}
+}
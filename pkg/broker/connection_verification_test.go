@@ -0,0 +1,122 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeConnectionVerifier records the verified credentials, failing with err
+// if set.
+type fakeConnectionVerifier struct {
+	err      error
+	verified []ConnectionDetails
+}
+
+func (v *fakeConnectionVerifier) VerifyConnection(ctx context.Context, credentials ConnectionDetails) error {
+	v.verified = append(v.verified, credentials)
+	return v.err
+}
+
+func setupConnectionVerificationTest(verifier ConnectionVerifier) (*Broker, MockAtlasClient, context.Context) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ConnectionVerifier: verifier})
+
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.Clusters["instance"].SrvAddress = "mongodb+srv://cluster.mongodb.net"
+
+	return broker, client, ctx
+}
+
+func TestBindVerifiesConnection(t *testing.T) {
+	verifier := &fakeConnectionVerifier{}
+	broker, client, ctx := setupConnectionVerificationTest(verifier)
+
+	spec, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The returned credentials are the ones which connected.
+	if assert.Len(t, verifier.verified, 1) {
+		assert.Equal(t, spec.Credentials, verifier.verified[0])
+	}
+	assert.NotNil(t, client.Users["binding"])
+}
+
+func TestBindConnectionVerificationFailure(t *testing.T) {
+	verifier := &fakeConnectionVerifier{err: errors.New("connection refused")}
+	broker, client, ctx := setupConnectionVerificationTest(verifier)
+
+	_, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		assert.Contains(t, err.Error(), "connection refused")
+	}
+
+	// The created user is cleaned up and the binding isn't recorded.
+	assert.Len(t, verifier.verified, 1)
+	assert.Nil(t, client.Users["binding"])
+	_, err = broker.GetBinding(ctx, "instance", "binding")
+	assert.Error(t, err)
+}
+
+func TestBindWithoutConnectionVerification(t *testing.T) {
+	broker, client, ctx := setupConnectionVerificationTest(nil)
+
+	_, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+	assert.NotNil(t, client.Users["binding"])
+}
+
+func TestMongoConnectionVerifier(t *testing.T) {
+	verifier := MongoConnectionVerifier{Timeout: 100 * time.Millisecond}
+	credentials := ConnectionDetails{Username: "binding", Password: "s3cret"}
+
+	// Nothing listens on the port, so the cluster is never reachable.
+	credentials.URI = "mongodb://127.0.0.1:1"
+	assert.Error(t, verifier.VerifyConnection(context.Background(), credentials))
+
+	credentials.URI = "not-a-connection-string"
+	assert.Error(t, verifier.VerifyConnection(context.Background(), credentials))
+}
+
+func TestBindConnectionVerificationKeepsExistingUser(t *testing.T) {
+	broker, client, ctx, dir := setupExistingUserTest(t)
+	defer os.RemoveAll(dir)
+
+	broker.config.ConnectionVerifier = &fakeConnectionVerifier{err: errors.New("authentication failed")}
+	client.Users["reporting"] = &atlas.User{Username: "reporting"}
+	ioutil.WriteFile(filepath.Join(dir, "reporting"), []byte("s3cret"), 0600)
+
+	_, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"existing_user": "reporting"}`),
+	}, true)
+	assert.Error(t, err)
+	assert.NotNil(t, client.Users["reporting"], "Expected existing user to be kept")
+}
@@ -0,0 +1,184 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// The components of a cost estimate.
+const (
+	costComponentInstance = "instance"
+	costComponentDisk     = "disk"
+	costComponentBackup   = "backup"
+	costComponentRegion   = "region"
+)
+
+// defaultCostCurrency is used for cost tables which don't name a currency.
+const defaultCostCurrency = "USD"
+
+// costEstimateNote labels cost estimates so they aren't mistaken for billing
+// data.
+const costEstimateNote = "Estimate from the broker's cost table, actual Atlas charges may differ"
+
+// CostTable lists the monthly prices used to estimate the cost of instances,
+// per provider: the price of each instance size, the price per GB of disk
+// and of backed up disk, and multipliers for regions whose prices differ.
+type CostTable struct {
+	Currency          string                        `json:"currency,omitempty"`
+	InstanceSizes     map[string]map[string]float64 `json:"instance_sizes"`
+	DiskGB            map[string]float64            `json:"disk_gb,omitempty"`
+	BackupGB          map[string]float64            `json:"backup_gb,omitempty"`
+	RegionMultipliers map[string]map[string]float64 `json:"region_multipliers,omitempty"`
+}
+
+// CostEstimate is the estimated monthly cost of an instance. Total is the sum
+// of the known components. Components the cost table has no data for are
+// listed in Unknown instead of being guessed, in which case the estimate
+// isn't complete.
+type CostEstimate struct {
+	Currency   string             `json:"currency"`
+	Total      float64            `json:"total"`
+	Components map[string]float64 `json:"components"`
+	Unknown    []string           `json:"unknown,omitempty"`
+	Complete   bool               `json:"complete"`
+	Note       string             `json:"note"`
+}
+
+// Validate returns an error for negative prices and multipliers.
+func (t CostTable) Validate() error {
+	for providerName, prices := range t.InstanceSizes {
+		for instanceSizeName, price := range prices {
+			if price < 0 {
+				return fmt.Errorf("negative price for instance size %s of %s", instanceSizeName, providerName)
+			}
+		}
+	}
+
+	for _, prices := range []map[string]float64{t.DiskGB, t.BackupGB} {
+		for providerName, price := range prices {
+			if price < 0 {
+				return fmt.Errorf("negative price per GB for %s", providerName)
+			}
+		}
+	}
+
+	for providerName, multipliers := range t.RegionMultipliers {
+		for region, multiplier := range multipliers {
+			if multiplier <= 0 {
+				return fmt.Errorf("region multiplier for %s of %s must be positive", region, providerName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReadCostTableFile will read and validate a cost table from a JSON file, for
+// example {"instance_sizes": {"AWS": {"M10": 57}}, "disk_gb": {"AWS": 0.1}}.
+func ReadCostTableFile(path string) (*CostTable, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &CostTable{}
+	if err := json.Unmarshal(data, table); err != nil {
+		return nil, err
+	}
+
+	if len(table.InstanceSizes) == 0 {
+		return nil, errors.New("invalid cost table: no instance size prices")
+	}
+
+	if err := table.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cost table: %v", err)
+	}
+
+	if table.Currency == "" {
+		table.Currency = defaultCostCurrency
+	}
+
+	return table, nil
+}
+
+// estimate computes the monthly cost of a cluster. The region multiplier
+// applies to the instance and disk, and backups are priced per GB of disk.
+// Backups are only included if they're enabled.
+func (t CostTable) estimate(cluster *atlas.Cluster) *CostEstimate {
+	estimate := &CostEstimate{
+		Currency:   t.Currency,
+		Components: map[string]float64{},
+		Note:       costEstimateNote,
+	}
+
+	providerName, instanceSizeName, region := "", "", ""
+	if cluster.ProviderSettings != nil {
+		providerName = cluster.ProviderSettings.ProviderName
+		instanceSizeName = cluster.ProviderSettings.InstanceSizeName
+		region = cluster.ProviderSettings.RegionName
+	}
+
+	multiplier, ok := t.RegionMultipliers[providerName][region]
+	if !ok {
+		estimate.Unknown = append(estimate.Unknown, costComponentRegion)
+		multiplier = 1
+	}
+
+	if price, ok := t.InstanceSizes[providerName][instanceSizeName]; ok {
+		estimate.Components[costComponentInstance] = price * multiplier
+	} else {
+		estimate.Unknown = append(estimate.Unknown, costComponentInstance)
+	}
+
+	if price, ok := t.DiskGB[providerName]; ok && cluster.DiskSizeGB > 0 {
+		estimate.Components[costComponentDisk] = price * cluster.DiskSizeGB * multiplier
+	} else {
+		estimate.Unknown = append(estimate.Unknown, costComponentDisk)
+	}
+
+	if cluster.BackupEnabled || cluster.ProviderBackupEnabled {
+		if price, ok := t.BackupGB[providerName]; ok && cluster.DiskSizeGB > 0 {
+			estimate.Components[costComponentBackup] = price * cluster.DiskSizeGB
+		} else {
+			estimate.Unknown = append(estimate.Unknown, costComponentBackup)
+		}
+	}
+
+	for name, cost := range estimate.Components {
+		cost = roundCents(cost)
+		estimate.Components[name] = cost
+		estimate.Total += cost
+	}
+	estimate.Total = roundCents(estimate.Total)
+
+	sort.Strings(estimate.Unknown)
+	estimate.Complete = len(estimate.Unknown) == 0
+	return estimate
+}
+
+func roundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// costEstimateDescription describes the estimated monthly cost of a cluster
+// in the description of its provision operation. It's empty if no cost table
+// is set or the estimate isn't complete, so a partial estimate isn't
+// mistaken for the full cost.
+func (b Broker) costEstimateDescription(cluster *atlas.Cluster) string {
+	if b.config.CostTable == nil || cluster == nil {
+		return ""
+	}
+
+	estimate := b.config.CostTable.estimate(cluster)
+	if !estimate.Complete {
+		return ""
+	}
+
+	return fmt.Sprintf("Estimated monthly cost: %.2f %s. %s", estimate.Total, estimate.Currency, costEstimateNote)
+}
@@ -0,0 +1,162 @@
+package broker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testCostTable = &CostTable{
+	Currency:          "USD",
+	InstanceSizes:     map[string]map[string]float64{"AWS": {"M10": 57, "M30": 388}},
+	DiskGB:            map[string]float64{"AWS": 0.1},
+	BackupGB:          map[string]float64{"AWS": 0.2},
+	RegionMultipliers: map[string]map[string]float64{"AWS": {"US_EAST_1": 1, "EU_WEST_1": 1.1}},
+}
+
+func TestReadCostTableFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "costs")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "costs.json")
+
+	ioutil.WriteFile(path, []byte(`{"instance_sizes": {"AWS": {"M10": 57}}}`), 0600)
+	table, err := ReadCostTableFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultCostCurrency, table.Currency)
+
+	for _, invalid := range []string{
+		`{}`,
+		`{"instance_sizes": {"AWS": {"M10": -1}}}`,
+		`{"instance_sizes": {"AWS": {"M10": 57}}, "region_multipliers": {"AWS": {"US_EAST_1": 0}}}`,
+	} {
+		ioutil.WriteFile(path, []byte(invalid), 0600)
+		_, err = ReadCostTableFile(path)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCostEstimate(t *testing.T) {
+	cluster := &atlas.Cluster{
+		DiskSizeGB:            100,
+		ProviderBackupEnabled: true,
+		ProviderSettings: &atlas.ProviderSettings{
+			ProviderName:     "AWS",
+			InstanceSizeName: "M30",
+			RegionName:       "EU_WEST_1",
+		},
+	}
+
+	estimate := testCostTable.estimate(cluster)
+	assert.Equal(t, &CostEstimate{
+		Currency: "USD",
+		Total:    457.8,
+		Components: map[string]float64{
+			costComponentInstance: 426.8,
+			costComponentDisk:     11,
+			costComponentBackup:   20,
+		},
+		Complete: true,
+		Note:     costEstimateNote,
+	}, estimate)
+
+	// Backups are only priced if they're enabled.
+	cluster.ProviderBackupEnabled = false
+	estimate = testCostTable.estimate(cluster)
+	assert.NotContains(t, estimate.Components, costComponentBackup)
+	assert.True(t, estimate.Complete)
+}
+
+func TestCostEstimateIncomplete(t *testing.T) {
+	table := &CostTable{
+		Currency:      "USD",
+		InstanceSizes: map[string]map[string]float64{"AWS": {"M10": 57}},
+	}
+
+	cluster := &atlas.Cluster{
+		DiskSizeGB:    10,
+		BackupEnabled: true,
+		ProviderSettings: &atlas.ProviderSettings{
+			ProviderName:     "AWS",
+			InstanceSizeName: "M30",
+			RegionName:       "US_EAST_1",
+		},
+	}
+
+	// Nothing is guessed for missing prices.
+	estimate := table.estimate(cluster)
+	assert.False(t, estimate.Complete)
+	assert.Equal(t, []string{costComponentBackup, costComponentDisk, costComponentInstance, costComponentRegion}, estimate.Unknown)
+	assert.Empty(t, estimate.Components)
+	assert.Equal(t, 0.0, estimate.Total)
+
+	// Known components are still included.
+	cluster.ProviderSettings.InstanceSizeName = "M10"
+	estimate = table.estimate(cluster)
+	assert.Equal(t, map[string]float64{costComponentInstance: 57}, estimate.Components)
+	assert.Equal(t, 57.0, estimate.Total)
+	assert.Contains(t, estimate.Unknown, costComponentDisk)
+}
+
+func TestGetInstanceCostEstimate(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{CostTable: testCostTable})
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"diskSizeGB": 10, "providerSettings": {"regionName": "US_EAST_1"}}}`),
+	}, true)
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+
+	spec, err := broker.GetInstance(ctx, instanceID)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	estimate := spec.Parameters.(map[string]interface{})["estimated_monthly_cost"].(*CostEstimate)
+	assert.Equal(t, 58.0, estimate.Total)
+	assert.True(t, estimate.Complete)
+
+	// Without a cost table no estimate is included.
+	broker, _, _ = setupTest()
+	spec, err = broker.GetInstance(ctx, instanceID)
+	if assert.NoError(t, err) {
+		assert.NotContains(t, spec.Parameters, "estimated_monthly_cost")
+	}
+}
+
+func TestLastOperationCostEstimate(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{CostTable: testCostTable})
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"diskSizeGB": 10, "providerSettings": {"regionName": "US_EAST_1"}}}`),
+	}, true)
+
+	resp, err := broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{OperationData: OperationProvision})
+	if assert.NoError(t, err) {
+		assert.Equal(t, brokerapi.InProgress, resp.State)
+		assert.Equal(t, "Estimated monthly cost: 58.00 USD. "+costEstimateNote, resp.Description)
+	}
+
+	// Incomplete estimates are left out.
+	client.Clusters[instanceID].DiskSizeGB = 0
+	resp, err = broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{OperationData: OperationProvision})
+	if assert.NoError(t, err) {
+		assert.Empty(t, resp.Description)
+	}
+}
@@ -0,0 +1,177 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// vaultTimeout is how long requests to Vault may take.
+const vaultTimeout = 10 * time.Second
+
+// CredentialStore stores the credentials of bindings in a secrets manager,
+// so bindings return a reference to them instead of the credentials.
+type CredentialStore interface {
+	// PutCredentials stores the credentials of a binding, replacing existing
+	// ones, and returns the reference apps fetch them with.
+	PutCredentials(bindingID string, credentials map[string]string) (string, error)
+
+	// DeleteCredentials removes the credentials of a binding.
+	// ErrSecretNotFound is returned if there are none.
+	DeleteCredentials(bindingID string) error
+}
+
+// CredentialReference is returned as the credentials of bindings whose
+// credentials are stored in a secrets manager, along with the advisory
+// values which aren't secret.
+type CredentialReference struct {
+	CredentialRef          string `json:"credential_ref"`
+	RecommendedMaxPoolSize int    `json:"recommended_max_pool_size,omitempty"`
+}
+
+// VaultCredentialStore stores credentials in a Vault KV version 2 secrets
+// engine, as a secret per binding under Path.
+type VaultCredentialStore struct {
+	Address string
+	Token   string
+
+	// Mount is the path the secrets engine is mounted at, for example
+	// "secret".
+	Mount string
+
+	// Path is the path of the binding secrets in the secrets engine, for
+	// example "atlas-osb/bindings".
+	Path string
+}
+
+// secretPath returns the path of the secret of a binding in the secrets
+// engine. Binding IDs are escaped so they can't address other secrets, and
+// IDs which would address the path itself or its parent are rejected.
+func (s VaultCredentialStore) secretPath(bindingID string) (string, error) {
+	if bindingID == "" || bindingID == "." || bindingID == ".." {
+		return "", fmt.Errorf(`Binding ID "%s" can't be used as a secret name`, bindingID)
+	}
+
+	return path.Join(s.Path, url.PathEscape(bindingID)), nil
+}
+
+func (s VaultCredentialStore) request(method string, endpoint string, body interface{}) (*http.Response, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: vaultTimeout}
+	return client.Do(req)
+}
+
+// PutCredentials writes the credentials as the fields of the secret and
+// returns the secret as "vault:<mount>/<path>".
+func (s VaultCredentialStore) PutCredentials(bindingID string, credentials map[string]string) (string, error) {
+	secretPath, err := s.secretPath(bindingID)
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(s.Address, "/"), s.Mount, secretPath)
+
+	resp, err := s.request(http.MethodPost, endpoint, map[string]interface{}{"data": credentials})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("Vault responded with status %d", resp.StatusCode)
+	}
+
+	return fmt.Sprintf("vault:%s/%s", s.Mount, secretPath), nil
+}
+
+// DeleteCredentials removes all versions of the secret. Binding IDs which
+// can't be used as a secret name never have credentials.
+func (s VaultCredentialStore) DeleteCredentials(bindingID string) error {
+	secretPath, err := s.secretPath(bindingID)
+	if err != nil {
+		return ErrSecretNotFound
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/metadata/%s", strings.TrimRight(s.Address, "/"), s.Mount, secretPath)
+
+	resp, err := s.request(http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrSecretNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Vault responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// deliverCredentials stores the credentials of a binding in the credential
+// store and returns the reference to them, so the credentials aren't
+// included in the response. The credentials are returned as they are if no
+// credential store is configured.
+func (b Broker) deliverCredentials(bindingID string, credentials ConnectionDetails) (interface{}, error) {
+	if b.config.CredentialStore == nil {
+		return credentials, nil
+	}
+
+	// The advisory pool size isn't secret and is returned with the
+	// reference instead.
+	poolSize := credentials.RecommendedMaxPoolSize
+	credentials.RecommendedMaxPoolSize = 0
+
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	ref, err := b.config.CredentialStore.PutCredentials(bindingID, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return CredentialReference{CredentialRef: ref, RecommendedMaxPoolSize: poolSize}, nil
+}
+
+// deleteDeliveredCredentials removes the credentials of a binding from the
+// credential store, if one is configured. Credentials which are already gone
+// are ignored so unbinding can be retried.
+func (b Broker) deleteDeliveredCredentials(bindingID string) error {
+	if b.config.CredentialStore == nil {
+		return nil
+	}
+
+	err := b.config.CredentialStore.DeleteCredentials(bindingID)
+	if err == ErrSecretNotFound {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,160 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// memoryCredentialStore keeps credentials in memory, optionally failing to
+// store them.
+type memoryCredentialStore struct {
+	mutex       sync.Mutex
+	credentials map[string]map[string]string
+	putErr      error
+}
+
+func newMemoryCredentialStore() *memoryCredentialStore {
+	return &memoryCredentialStore{credentials: map[string]map[string]string{}}
+}
+
+func (s *memoryCredentialStore) PutCredentials(bindingID string, credentials map[string]string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.putErr != nil {
+		return "", s.putErr
+	}
+
+	s.credentials[bindingID] = credentials
+	return "memory:" + bindingID, nil
+}
+
+func (s *memoryCredentialStore) DeleteCredentials(bindingID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.credentials[bindingID]; !ok {
+		return ErrSecretNotFound
+	}
+
+	delete(s.credentials, bindingID)
+	return nil
+}
+
+func TestBindCredentialReference(t *testing.T) {
+	_, client, ctx := setupTest()
+	store := newMemoryCredentialStore()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{CredentialStore: store})
+
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.Clusters["instance"].SrvAddress = "mongodb+srv://cluster.mongodb.net"
+
+	spec, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Only the reference is returned, the credentials are in the store.
+	assert.Equal(t, CredentialReference{CredentialRef: "memory:binding"}, spec.Credentials)
+	credentials := store.credentials["binding"]
+	assert.Equal(t, "binding", credentials["username"])
+	assert.NotEmpty(t, credentials["password"])
+	assert.Equal(t, "mongodb+srv://cluster.mongodb.net", credentials["uri"])
+	assert.NotNil(t, client.Users["binding"])
+
+	// The broker doesn't keep the credentials either.
+	binding, err := broker.GetBinding(ctx, "instance", "binding")
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"credential_ref": "memory:binding"}`, string(binding.Credentials.(json.RawMessage)))
+	}
+
+	_, err = broker.Unbind(ctx, "instance", "binding", brokerapi.UnbindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+	assert.NotContains(t, store.credentials, "binding")
+	assert.Nil(t, client.Users["binding"])
+}
+
+func TestBindCredentialStoreFailure(t *testing.T) {
+	_, client, ctx := setupTest()
+	store := newMemoryCredentialStore()
+	store.putErr = errors.New("vault sealed")
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{CredentialStore: store})
+
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	_, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "password")
+	assert.Nil(t, client.Users["binding"], "Expected the user to be deleted")
+}
+
+func TestVaultCredentialStore(t *testing.T) {
+	var requests []string
+	var body map[string]map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		assert.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"))
+
+		if r.Method == http.MethodPost {
+			data, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(data, &body)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	store := VaultCredentialStore{Address: server.URL + "/", Token: "vault-token", Mount: "secret", Path: "atlas-osb/bindings"}
+
+	ref, err := store.PutCredentials("a/../b", map[string]string{"username": "a/../b", "password": "s3cret"})
+	assert.NoError(t, err)
+	assert.Equal(t, "vault:secret/atlas-osb/bindings/a%2F..%2Fb", ref)
+	assert.Equal(t, map[string]map[string]string{"data": {"username": "a/../b", "password": "s3cret"}}, body)
+
+	assert.NoError(t, store.DeleteCredentials("a/../b"))
+	assert.Equal(t, []string{
+		"POST /v1/secret/data/atlas-osb/bindings/a%2F..%2Fb",
+		"DELETE /v1/secret/metadata/atlas-osb/bindings/a%2F..%2Fb",
+	}, requests)
+}
+
+func TestVaultCredentialStoreRejectsPathNames(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	store := VaultCredentialStore{Address: server.URL, Token: "vault-token", Mount: "secret", Path: "atlas-osb/bindings"}
+
+	for _, bindingID := range []string{"", ".", ".."} {
+		_, err := store.PutCredentials(bindingID, map[string]string{"password": "s3cret"})
+		assert.Error(t, err, bindingID)
+		assert.Equal(t, ErrSecretNotFound, store.DeleteCredentials(bindingID), bindingID)
+	}
+	assert.Equal(t, 0, requests)
+}
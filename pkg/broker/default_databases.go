@@ -0,0 +1,129 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// maxDatabaseNameLength is the longest database name MongoDB accepts.
+const maxDatabaseNameLength = 63
+
+// invalidDatabaseNameCharacters can't be used in database names on any
+// platform MongoDB runs on.
+const invalidDatabaseNameCharacters = "/\\. \"$*<>:|?\x00"
+
+// ValidateDatabaseName returns an error for names MongoDB doesn't accept as
+// database names.
+func ValidateDatabaseName(name string) error {
+	if name == "" {
+		return fmt.Errorf("database name can't be empty")
+	}
+
+	if len(name) > maxDatabaseNameLength {
+		return fmt.Errorf(`database name "%s" is longer than %d characters`, name, maxDatabaseNameLength)
+	}
+
+	if strings.ContainsAny(name, invalidDatabaseNameCharacters) {
+		return fmt.Errorf(`database name "%s" contains one of the invalid characters /\. "$*<>:|?`, name)
+	}
+
+	return nil
+}
+
+// ParsePlanDefaultDatabases parses comma-separated plan=database pairs, with
+// plan IDs or names as plans, for example "M10=app,timeseries=metrics".
+func ParsePlanDefaultDatabases(value string) (map[string]string, error) {
+	databases := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf(`invalid default database "%s", expected "plan=database"`, pair)
+		}
+
+		plan, database := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if err := ValidateDatabaseName(database); err != nil {
+			return nil, fmt.Errorf("invalid default database for plan %s: %v", plan, err)
+		}
+
+		databases[plan] = database
+	}
+
+	return databases, nil
+}
+
+// databaseForBinding determines the database the connection strings of a new
+// binding point to. A database passed as the "database" bind parameter takes
+// precedence over the default of the plan, which takes precedence over the
+// broker default. Empty if none of them is set.
+func (b Broker) databaseForBinding(planID string, planName string, rawParams []byte) (string, error) {
+	params := struct {
+		Database *string `json:"database"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return "", newInvalidParamsError(err)
+		}
+	}
+
+	if params.Database != nil {
+		if err := ValidateDatabaseName(*params.Database); err != nil {
+			return "", newRemediableError(err, http.StatusBadRequest, "invalid-database", remediationInvalidDatabase)
+		}
+
+		return *params.Database, nil
+	}
+
+	if database, ok := b.config.PlanDefaultDatabases[planID]; ok {
+		return database, nil
+	}
+
+	if database, ok := b.config.PlanDefaultDatabases[planName]; ok {
+		return database, nil
+	}
+
+	return b.config.DefaultDatabase, nil
+}
+
+// withDatabase sets the database in the path of a connection string,
+// replacing the existing one. Empty connection strings and databases leave
+// the connection string unchanged.
+func withDatabase(connectionString string, database string) string {
+	if connectionString == "" || database == "" {
+		return connectionString
+	}
+
+	base, query := connectionString, ""
+	if i := strings.Index(connectionString, "?"); i >= 0 {
+		base, query = connectionString[:i], connectionString[i:]
+	}
+
+	scheme, hosts := "", base
+	if i := strings.Index(base, "://"); i >= 0 {
+		scheme, hosts = base[:i+len("://")], base[i+len("://"):]
+	}
+	if i := strings.Index(hosts, "/"); i >= 0 {
+		hosts = hosts[:i]
+	}
+
+	return scheme + hosts + "/" + database + query
+}
+
+// withDatabaseInConnectionStrings sets the database in all of a cluster's
+// connection strings.
+func withDatabaseInConnectionStrings(connectionStrings atlas.ConnectionStrings, database string) atlas.ConnectionStrings {
+	connectionStrings.Standard = withDatabase(connectionStrings.Standard, database)
+	connectionStrings.StandardSrv = withDatabase(connectionStrings.StandardSrv, database)
+	connectionStrings.Private = withDatabase(connectionStrings.Private, database)
+	connectionStrings.PrivateSrv = withDatabase(connectionStrings.PrivateSrv, database)
+	return connectionStrings
+}
@@ -0,0 +1,141 @@
+package broker
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestValidateDatabaseName(t *testing.T) {
+	assert.NoError(t, ValidateDatabaseName("metrics"))
+	assert.NoError(t, ValidateDatabaseName(strings.Repeat("a", 63)))
+
+	for _, invalid := range []string{"", strings.Repeat("a", 64), "app.metrics", "app/metrics", "my db", "$app", "app\x00"} {
+		assert.Error(t, ValidateDatabaseName(invalid), invalid)
+	}
+}
+
+func TestParsePlanDefaultDatabases(t *testing.T) {
+	databases, err := ParsePlanDefaultDatabases(" M10=app, aosb-cluster-plan-aws-m20=metrics ")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"M10": "app", "aosb-cluster-plan-aws-m20": "metrics"}, databases)
+
+	databases, err = ParsePlanDefaultDatabases("")
+	assert.NoError(t, err)
+	assert.Empty(t, databases)
+
+	for _, invalid := range []string{"M10", "=app", "M10=", "M10=app.metrics"} {
+		_, err = ParsePlanDefaultDatabases(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestWithDatabase(t *testing.T) {
+	tests := map[string]string{
+		"mongodb+srv://cluster.mongodb.net":                              "mongodb+srv://cluster.mongodb.net/metrics",
+		"mongodb+srv://cluster.mongodb.net/?ssl=true":                    "mongodb+srv://cluster.mongodb.net/metrics?ssl=true",
+		"mongodb://a.mongodb.net:27017,b.mongodb.net:27017/app?ssl=true": "mongodb://a.mongodb.net:27017,b.mongodb.net:27017/metrics?ssl=true",
+		"": "",
+	}
+
+	for connectionString, expected := range tests {
+		assert.Equal(t, expected, withDatabase(connectionString, "metrics"), connectionString)
+	}
+
+	assert.Equal(t, "mongodb+srv://cluster.mongodb.net/app", withDatabase("mongodb+srv://cluster.mongodb.net/app", ""))
+}
+
+func TestBindDefaultDatabase(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   string
+		expected string
+	}{
+		{"plan default by name", `{}`, "app"},
+		{"bind parameter takes precedence", `{"database": "reporting"}`, "reporting"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+				DefaultDatabase:      "broker",
+				PlanDefaultDatabases: map[string]string{"M10": "app", "aosb-cluster-plan-aws-m20": "metrics"},
+			})
+
+			broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:    testPlanID,
+				ServiceID: testServiceID,
+			}, true)
+			client.Clusters["instance"].SrvAddress = "mongodb+srv://cluster.mongodb.net"
+			client.Clusters["instance"].ConnectionStrings.StandardSrv = "mongodb+srv://cluster.mongodb.net"
+
+			spec, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+				PlanID:        testPlanID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(test.params),
+			}, true)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			credentials := spec.Credentials.(ConnectionDetails)
+			assert.Equal(t, test.expected, credentials.Database)
+			assert.Equal(t, "mongodb+srv://cluster.mongodb.net/"+test.expected, credentials.URI)
+			assert.Contains(t, credentials.ConnectionString, "mongodb+srv://cluster.mongodb.net/"+test.expected)
+		})
+	}
+}
+
+func TestDatabaseForBindingPrecedence(t *testing.T) {
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		DefaultDatabase:      "broker",
+		PlanDefaultDatabases: map[string]string{"M10": "app", "aosb-cluster-plan-aws-m10": "metrics"},
+	})
+
+	// Plan IDs take precedence over plan names.
+	database, err := broker.databaseForBinding("aosb-cluster-plan-aws-m10", "M10", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "metrics", database)
+
+	database, err = broker.databaseForBinding("aosb-cluster-plan-gcp-m10", "M10", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "app", database)
+
+	database, err = broker.databaseForBinding("aosb-cluster-plan-aws-m20", "M20", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "broker", database)
+
+	database, err = broker.databaseForBinding("aosb-cluster-plan-aws-m20", "M20", []byte(`{"database": "reporting"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "reporting", database)
+
+	// Without any defaults the connection strings have no database.
+	broker, _, _ = setupTest()
+	database, err = broker.databaseForBinding("aosb-cluster-plan-aws-m20", "M20", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, database)
+}
+
+func TestBindInvalidDatabase(t *testing.T) {
+	broker, client, ctx := setupTest()
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	_, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"database": "app.metrics"}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+	assert.Nil(t, client.Users["binding"], "Expected no user to be created")
+}
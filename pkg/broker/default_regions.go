@@ -0,0 +1,100 @@
+package broker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// DefaultRegions maps dedicated providers to the region clusters are
+// deployed to when provisioning doesn't pass one, for example
+// {"AWS": "US_EAST_1"}. Atlas picks the region for other providers.
+type DefaultRegions map[string]string
+
+// ParseDefaultRegions parses comma-separated provider=region pairs, for
+// example "AWS=US_EAST_1,GCP=CENTRAL_US".
+func ParseDefaultRegions(value string) (DefaultRegions, error) {
+	regions := DefaultRegions{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf(`invalid default region "%s", expected "provider=region"`, pair)
+		}
+
+		regions[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	if err := regions.Validate(); err != nil {
+		return nil, err
+	}
+
+	return regions, nil
+}
+
+// Validate returns an error for providers which aren't dedicated providers.
+func (r DefaultRegions) Validate() error {
+	for providerName := range r {
+		if !containsString(dedicatedProviderNames, providerName) {
+			return fmt.Errorf(`unknown provider "%s", valid providers are %s`, providerName, strings.Join(dedicatedProviderNames, ", "))
+		}
+	}
+
+	return nil
+}
+
+// ValidateDefaultRegions checks that Atlas offers the default regions for
+// their providers. It's meant to be called on startup. Providers which can't
+// be fetched are skipped with a warning, as Atlas rejects clusters in
+// unknown regions anyway.
+func (b Broker) ValidateDefaultRegions(client atlas.Client) error {
+	for _, providerName := range dedicatedProviderNames {
+		region, ok := b.config.DefaultRegions[providerName]
+		if !ok {
+			continue
+		}
+
+		provider, err := client.GetProvider(providerName)
+		if err != nil {
+			b.logger.Warnw("Failed to fetch provider, its default region isn't validated", "error", err, "provider", providerName, "region", region)
+			continue
+		}
+
+		if !providerOffersRegion(provider, region) {
+			return fmt.Errorf(`provider %s doesn't offer the default region "%s"`, providerName, region)
+		}
+	}
+
+	return nil
+}
+
+// providerOffersRegion returns whether any instance size of the provider is
+// available in a region.
+func providerOffersRegion(provider *atlas.Provider, region string) bool {
+	for _, instanceSize := range provider.InstanceSizes {
+		for _, availableRegion := range instanceSize.AvailableRegions {
+			if availableRegion.Key == region {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// applyDefaultRegion sets the default region of the cluster's provider
+// unless the parameters set a region, either in the provider settings or in
+// the replication specs of multi-region clusters.
+func (b Broker) applyDefaultRegion(cluster *atlas.Cluster) {
+	if cluster.ProviderSettings == nil || cluster.ProviderSettings.RegionName != "" || len(cluster.ReplicationSpecs) > 0 {
+		return
+	}
+
+	if region, ok := b.config.DefaultRegions[cluster.ProviderSettings.ProviderName]; ok {
+		cluster.ProviderSettings.RegionName = region
+	}
+}
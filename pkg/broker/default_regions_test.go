@@ -0,0 +1,75 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestParseDefaultRegions(t *testing.T) {
+	regions, err := ParseDefaultRegions(" AWS=US_EAST_1, GCP=CENTRAL_US ")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultRegions{"AWS": "US_EAST_1", "GCP": "CENTRAL_US"}, regions)
+
+	regions, err = ParseDefaultRegions("")
+	assert.NoError(t, err)
+	assert.Empty(t, regions)
+
+	for _, invalid := range []string{"AWS", "AWS=", "=US_EAST_1", "TENANT=US_EAST_1", "aws=US_EAST_1"} {
+		_, err = ParseDefaultRegions(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestValidateDefaultRegions(t *testing.T) {
+	_, client, _ := setupTest()
+
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{DefaultRegions: DefaultRegions{"AWS": "US_EAST_1"}})
+	assert.NoError(t, broker.ValidateDefaultRegions(client))
+
+	broker = NewBrokerWithConfig(zap.NewNop().Sugar(), Config{DefaultRegions: DefaultRegions{"AWS": "EU_WEST_1"}})
+	assert.Error(t, broker.ValidateDefaultRegions(client))
+}
+
+func TestProvisionWithDefaultRegion(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   string
+		expected string
+	}{
+		{"default region when omitted", `{}`, "US_EAST_1"},
+		{"passed region takes precedence", `{"cluster": {"providerSettings": {"regionName": "EU_WEST_1"}}}`, "EU_WEST_1"},
+		{"multi-region clusters are unchanged", `{"cluster": {"replicationSpecs": [{"numShards": 1}]}}`, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{DefaultRegions: DefaultRegions{"AWS": "US_EAST_1"}})
+
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:        testPlanID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(test.params),
+			}, true)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, test.expected, client.Clusters["instance"].ProviderSettings.RegionName)
+		})
+	}
+}
+
+func TestProvisionWithoutDefaultRegion(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+	assert.Empty(t, client.Clusters["instance"].ProviderSettings.RegionName)
+}
@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// DiscoveryCatalog is the minimal catalog served without credentials. It only
+// contains metadata derived from the configuration, no plans.
+type DiscoveryCatalog struct {
+	Services []DiscoveryService `json:"services"`
+}
+
+// DiscoveryService identifies a service of the catalog by its provider.
+type DiscoveryService struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+}
+
+// AttachDiscoveryRoutes will attach the unauthenticated discovery endpoint
+// to a router. The catalog is built once from the configuration, without
+// calling Atlas.
+func AttachDiscoveryRoutes(router *mux.Router, broker *Broker) {
+	catalog := broker.DiscoveryCatalog()
+
+	router.HandleFunc("/discovery", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, catalog)
+	}).Methods(http.MethodGet)
+}
+
+// DiscoveryCatalog lists the services of the whitelisted providers, including
+// their editions. Services are listed even if their plans would all be
+// filtered out, as plans aren't known without fetching them from Atlas.
+func (b Broker) DiscoveryCatalog() DiscoveryCatalog {
+	catalog := DiscoveryCatalog{Services: []DiscoveryService{}}
+
+	for _, providerName := range providerNames {
+		if _, whitelisted := b.config.Whitelist[providerName]; b.config.Whitelist != nil && !whitelisted {
+			continue
+		}
+
+		provider := &atlas.Provider{Name: providerName}
+		catalog.Services = append(catalog.Services, DiscoveryService{
+			ID:       serviceIDForProvider(provider),
+			Name:     serviceNameForProvider(provider),
+			Provider: providerName,
+		})
+
+		if providerName == sharedProviderName {
+			continue
+		}
+
+		for _, name := range b.config.Editions.names(providerName) {
+			catalog.Services = append(catalog.Services, DiscoveryService{
+				ID:       serviceIDForEdition(provider, name),
+				Name:     serviceNameForEdition(provider, name),
+				Provider: providerName,
+			})
+		}
+	}
+
+	return catalog
+}
@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDiscoveryCatalog(t *testing.T) {
+	broker := NewBroker(zap.NewNop().Sugar())
+
+	catalog := broker.DiscoveryCatalog()
+	assert.Len(t, catalog.Services, len(providerNames))
+	assert.Equal(t, DiscoveryService{ID: "aosb-cluster-service-aws", Name: "mongodb-atlas-aws", Provider: "AWS"}, catalog.Services[0])
+	assert.Equal(t, DiscoveryService{ID: "aosb-cluster-service-tenant", Name: "mongodb-atlas-tenant", Provider: "TENANT"}, catalog.Services[3])
+
+	broker = NewBrokerWithWhitelist(zap.NewNop().Sugar(), Whitelist{"GCP": []string{"M10"}})
+	catalog = broker.DiscoveryCatalog()
+	assert.Equal(t, []DiscoveryService{{ID: "aosb-cluster-service-gcp", Name: "mongodb-atlas-gcp", Provider: "GCP"}}, catalog.Services)
+}
+
+func TestDiscoveryEndpoint(t *testing.T) {
+	broker := NewBrokerWithWhitelist(zap.NewNop().Sugar(), Whitelist{"AWS": []string{"M10"}})
+
+	router := mux.NewRouter()
+	AttachDiscoveryRoutes(router, broker)
+
+	// No credentials nor Atlas client are needed.
+	req := httptest.NewRequest(http.MethodGet, "/discovery", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var catalog DiscoveryCatalog
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &catalog))
+	assert.Equal(t, broker.DiscoveryCatalog(), catalog)
+	assert.NotContains(t, w.Body.String(), "plans")
+}
@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// ParsePlanMaxDiskSizes parses comma-separated plan=size pairs, with plan IDs
+// or names as plans and sizes in GB, for example "M10=100,M30=500".
+func ParsePlanMaxDiskSizes(value string) (map[string]float64, error) {
+	sizes := map[string]float64{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf(`invalid max disk size "%s", expected "plan=size"`, pair)
+		}
+
+		plan := strings.TrimSpace(parts[0])
+		size, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf(`invalid max disk size for plan %s: "%s" is not a positive number of GB`, plan, strings.TrimSpace(parts[1]))
+		}
+
+		sizes[plan] = size
+	}
+
+	return sizes, nil
+}
+
+// diskSizeGuardrail returns the configured max disk size of a plan, by plan
+// ID or name. False is returned for plans without a guardrail.
+func (b Broker) diskSizeGuardrail(planID string, planName string) (float64, bool) {
+	if size, ok := b.config.PlanMaxDiskSizeGB[planID]; ok {
+		return size, true
+	}
+
+	size, ok := b.config.PlanMaxDiskSizeGB[planName]
+	return size, ok
+}
+
+// validateDiskSize rejects requested disk sizes above the guardrail of the
+// plan. The effective maximum is the smaller of the guardrail and the maximum
+// Atlas offers for the instance size. Clusters which don't pass a disk size,
+// and plans without a guardrail, are left for Atlas to validate.
+func (b Broker) validateDiskSize(client atlas.Client, cluster *atlas.Cluster, planID string, providerName string, instanceSizeName string) error {
+	if cluster.DiskSizeGB == 0 {
+		return nil
+	}
+
+	guardrail, ok := b.diskSizeGuardrail(planID, instanceSizeName)
+	if !ok {
+		return nil
+	}
+
+	// The guardrail is still enforced if the provider can't be fetched.
+	atlasMax := 0.0
+	if provider, err := providerByName(client, providerName); err == nil {
+		atlasMax = provider.InstanceSizes[instanceSizeName].MaxDiskSizeGB
+	}
+
+	if atlasMax > 0 && atlasMax < guardrail && cluster.DiskSizeGB > atlasMax {
+		err := fmt.Errorf("Disk size of %g GB exceeds the maximum of %g GB Atlas offers for %s", cluster.DiskSizeGB, atlasMax, instanceSizeName)
+		return newRemediableError(err, http.StatusUnprocessableEntity, "disk-size-too-large", remediationDiskSizeTooLarge)
+	}
+
+	if cluster.DiskSizeGB > guardrail {
+		err := fmt.Errorf("Disk size of %g GB exceeds the guardrail of %g GB for plan %s", cluster.DiskSizeGB, guardrail, instanceSizeName)
+		return newRemediableError(err, http.StatusUnprocessableEntity, "disk-size-guardrail", remediationDiskSizeTooLarge)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package broker
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestParsePlanMaxDiskSizes(t *testing.T) {
+	sizes, err := ParsePlanMaxDiskSizes(" M10=100, aosb-cluster-plan-aws-m30=512.5 ")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]float64{"M10": 100, "aosb-cluster-plan-aws-m30": 512.5}, sizes)
+
+	sizes, err = ParsePlanMaxDiskSizes("")
+	assert.NoError(t, err)
+	assert.Empty(t, sizes)
+
+	for _, invalid := range []string{"M10", "=100", "M10=", "M10=large", "M10=0", "M10=-5"} {
+		_, err = ParsePlanMaxDiskSizes(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestProvisionDiskSizeGuardrail(t *testing.T) {
+	tests := []struct {
+		name     string
+		diskSize string
+		code     string
+	}{
+		{"within the guardrail", "100", ""},
+		{"above the guardrail but within the Atlas max", "120", "guardrail of 100 GB"},
+		{"above the Atlas max", "200", "guardrail of 100 GB"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{PlanMaxDiskSizeGB: map[string]float64{"M10": 100}})
+
+			// The mock offers M10 with disks of up to 128 GB.
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:        testPlanID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(`{"cluster": {"diskSizeGB": ` + test.diskSize + `}}`),
+			}, true)
+
+			if test.code == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if assert.Error(t, err) {
+				assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+				assert.Contains(t, err.Error(), test.code)
+			}
+			assert.Nil(t, client.Clusters["instance"])
+		})
+	}
+}
+
+func TestProvisionDiskSizeAtlasMax(t *testing.T) {
+	_, _, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{PlanMaxDiskSizeGB: map[string]float64{testPlanID: 500}})
+
+	// Guardrails above the Atlas max are capped by it.
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"diskSizeGB": 200}}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		assert.Contains(t, err.Error(), "maximum of 128 GB Atlas offers")
+	}
+}
+
+func TestUpdateDiskSizeGuardrail(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{PlanMaxDiskSizeGB: map[string]float64{"M10": 100}})
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+
+	_, err = broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"diskSizeGB": 120}}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+	assert.Zero(t, client.Clusters["instance"].DiskSizeGB)
+
+	// Plans without a guardrail are left for Atlas to validate.
+	_, err = broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:        "aosb-cluster-plan-aws-m20",
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"diskSizeGB": 120}}`),
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(120), client.Clusters["instance"].DiskSizeGB)
+}
@@ -0,0 +1,297 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// editionFeatureAuditing enables database auditing for the project of the
+// cluster. Encryption at rest is the capability of the same name.
+const editionFeatureAuditing = "auditing"
+
+// editionFeatures are the features an edition may enable by default.
+var editionFeatures = []string{editionFeatureAuditing, featureEncryptionAtRest}
+
+// editionNamePattern matches edition names, which are part of the generated
+// service and plan IDs.
+var editionNamePattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// Edition is a variant of the services of dedicated providers, offered as
+// separate services with the listed features enabled by default.
+type Edition struct {
+	// Providers are the providers the edition is offered for, all dedicated
+	// providers if empty.
+	Providers []string `json:"providers,omitempty"`
+
+	// Features are enabled for clusters provisioned with the edition and
+	// advertised in the catalog.
+	Features []string `json:"features"`
+}
+
+// Editions maps edition names, for example "enterprise", to their
+// configuration.
+type Editions map[string]Edition
+
+// Validate returns an error if the edition references unknown providers or
+// features.
+func (e Edition) Validate() error {
+	for _, providerName := range e.Providers {
+		if !containsString(dedicatedProviderNames, providerName) {
+			return fmt.Errorf(`unknown provider "%s", valid providers are %s`, providerName, strings.Join(dedicatedProviderNames, ", "))
+		}
+	}
+
+	if len(e.Features) == 0 {
+		return fmt.Errorf("no features, set at least one of %s", strings.Join(editionFeatures, ", "))
+	}
+
+	for _, feature := range e.Features {
+		if !containsString(editionFeatures, feature) {
+			return fmt.Errorf(`unknown feature "%s", valid features are %s`, feature, strings.Join(editionFeatures, ", "))
+		}
+	}
+
+	return nil
+}
+
+// offeredFor returns whether the edition is offered for a provider.
+func (e Edition) offeredFor(providerName string) bool {
+	return len(e.Providers) == 0 || containsString(e.Providers, providerName)
+}
+
+// ReadEditionsFile will read and validate the editions from a JSON file, for
+// example {"enterprise": {"features": ["auditing", "encryptionAtRest"]}}.
+func ReadEditionsFile(path string) (Editions, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	editions := Editions{}
+	if err := json.Unmarshal(data, &editions); err != nil {
+		return nil, err
+	}
+
+	for name, edition := range editions {
+		if !editionNamePattern.MatchString(name) {
+			return nil, fmt.Errorf(`invalid edition name "%s", only lowercase letters and digits are allowed`, name)
+		}
+
+		if err := edition.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid edition %s: %v", name, err)
+		}
+	}
+
+	return editions, nil
+}
+
+// names returns the names of the editions offered for a provider, sorted so
+// the catalog is stable.
+func (e Editions) names(providerName string) []string {
+	names := []string{}
+	for name, edition := range e {
+		if edition.offeredFor(providerName) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// serviceIDForEdition will generate a globally unique ID for the edition of a
+// provider's service.
+func serviceIDForEdition(provider *atlas.Provider, editionName string) string {
+	return fmt.Sprintf("%s-%s", serviceIDForProvider(provider), editionName)
+}
+
+// serviceNameForEdition will generate the name of the edition of a
+// provider's service, for example "mongodb-atlas-aws-enterprise".
+func serviceNameForEdition(provider *atlas.Provider, editionName string) string {
+	return fmt.Sprintf("%s-%s", serviceNameForProvider(provider), editionName)
+}
+
+// planIDPrefixForEdition is prepended to the instance size names of an
+// edition's plans to generate their IDs.
+func planIDPrefixForEdition(provider *atlas.Provider, editionName string) string {
+	return fmt.Sprintf("%s-plan-%s-%s-", idPrefix, strings.ToLower(provider.Name), editionName)
+}
+
+// planIDForEdition will generate a globally unique ID for an instance size in
+// the edition of a provider's service.
+func planIDForEdition(provider *atlas.Provider, editionName string, instanceSize atlas.InstanceSize) string {
+	return planIDPrefixForEdition(provider, editionName) + strings.ToLower(instanceSize.Name)
+}
+
+// editionService derives the service of an edition from the standard service
+// of a provider. The plans advertise the features of the edition and their
+// provisioning defaults.
+func editionService(svc catalogService, editionName string, edition Edition) catalogService {
+	provider := &atlas.Provider{Name: svc.Provider}
+
+	editionSvc := svc
+	editionSvc.ID = serviceIDForEdition(provider, editionName)
+	editionSvc.Name = serviceNameForEdition(provider, editionName)
+	editionSvc.Description = fmt.Sprintf(`Atlas cluster hosted on "%s", %s edition`, svc.Provider, editionName)
+	editionSvc.Edition = editionName
+
+	plans := make([]catalogPlan, len(svc.Plans))
+	for i, plan := range svc.Plans {
+		plan.ID = planIDForEdition(provider, editionName, atlas.InstanceSize{Name: plan.Name})
+		plan.Features = edition.featuresFor(plan.Name)
+		plan.ProvisionSchema = edition.provisionSchema(svc.Provider, plan.Features)
+		plans[i] = plan
+	}
+
+	editionSvc.Plans = plans
+	return editionSvc
+}
+
+// featuresFor lists the features of the edition an instance size supports.
+// Auditing is a project setting and supported by all dedicated sizes.
+func (e Edition) featuresFor(instanceSizeName string) []string {
+	available := instanceSizeFeatures(instanceSizeName)
+
+	features := []string{}
+	for _, feature := range e.Features {
+		if feature == editionFeatureAuditing || containsString(available, feature) {
+			features = append(features, feature)
+		}
+	}
+
+	return features
+}
+
+// provisionSchema describes the provision parameters the features of an
+// edition default, so platforms can show and override the defaults.
+func (e Edition) provisionSchema(providerName string, features []string) map[string]interface{} {
+	properties := map[string]interface{}{}
+
+	if containsString(features, featureEncryptionAtRest) {
+		properties["cluster"] = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"encryptionAtRestProvider": map[string]interface{}{
+					"type":    "string",
+					"default": providerName,
+				},
+			},
+		}
+	}
+
+	if containsString(features, editionFeatureAuditing) {
+		properties["auditing"] = map[string]interface{}{
+			"type":        "boolean",
+			"default":     true,
+			"description": "Enable database auditing for the project of the cluster",
+		}
+	}
+
+	return map[string]interface{}{
+		"$schema":    jsonSchemaDraft,
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// resolveEdition maps the service and plan IDs of an edition to those of the
+// provider's standard service, which the rest of the broker works with, and
+// returns the name of the edition. IDs which don't belong to an edition are
+// returned unchanged with an empty name.
+func (b Broker) resolveEdition(serviceID string, planID string) (string, string, string) {
+	for _, providerName := range dedicatedProviderNames {
+		provider := &atlas.Provider{Name: providerName}
+
+		for _, name := range b.config.Editions.names(providerName) {
+			if serviceIDForEdition(provider, name) != serviceID {
+				continue
+			}
+
+			prefix := planIDPrefixForEdition(provider, name)
+			if strings.HasPrefix(planID, prefix) {
+				planID = fmt.Sprintf("%s-plan-%s-%s", idPrefix, strings.ToLower(providerName), strings.TrimPrefix(planID, prefix))
+			}
+
+			return serviceIDForProvider(provider), planID, name
+		}
+	}
+
+	return serviceID, planID, ""
+}
+
+// editionParams are the provision parameters controlling the features of
+// an edition.
+type editionParams struct {
+	Auditing *bool `json:"auditing"`
+}
+
+// editionParamsFromParams parses the edition parameters of a provision
+// request.
+func editionParamsFromParams(rawParams []byte) (editionParams, error) {
+	params := editionParams{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return params, newInvalidParamsError(err)
+		}
+	}
+
+	return params, nil
+}
+
+// applyEditionDefaults enables encryption at rest with the cluster's
+// provider unless the parameters set a provider, and returns whether
+// auditing should be enabled once the cluster is created.
+func (b Broker) applyEditionDefaults(editionName string, cluster *atlas.Cluster, rawParams []byte) (bool, error) {
+	edition, ok := b.config.Editions[editionName]
+	if !ok || cluster.ProviderSettings == nil {
+		return false, nil
+	}
+
+	params, err := editionParamsFromParams(rawParams)
+	if err != nil {
+		return false, err
+	}
+
+	features := edition.featuresFor(cluster.ProviderSettings.InstanceSizeName)
+
+	if containsString(features, featureEncryptionAtRest) && cluster.EncryptionAtRestProvider == "" {
+		cluster.EncryptionAtRestProvider = cluster.ProviderSettings.ProviderName
+	}
+
+	auditing := containsString(features, editionFeatureAuditing) && (params.Auditing == nil || *params.Auditing)
+	return auditing, nil
+}
+
+// setEdition records the edition an instance was provisioned with.
+func (b Broker) setEdition(instanceID string, editionName string) error {
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.Edition = editionName
+	})
+}
+
+// editionIDs returns the service and plan IDs of an instance's recorded
+// edition, or empty IDs if it wasn't provisioned with one.
+func (b Broker) editionIDs(instanceID string, provider *atlas.Provider, instanceSize atlas.InstanceSize) (string, string, error) {
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if instance.Edition == "" {
+		return "", "", nil
+	}
+
+	return serviceIDForEdition(provider, instance.Edition), planIDForEdition(provider, instance.Edition, instanceSize), nil
+}
@@ -0,0 +1,237 @@
+package broker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testEditions = Editions{
+	"enterprise": Edition{
+		Providers: []string{"AWS"},
+		Features:  []string{editionFeatureAuditing, featureEncryptionAtRest},
+	},
+}
+
+const (
+	testEditionServiceID = "aosb-cluster-service-aws-enterprise"
+	testEditionPlanID    = "aosb-cluster-plan-aws-enterprise-m10"
+)
+
+func TestReadEditionsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "editions")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "editions.json")
+
+	ioutil.WriteFile(path, []byte(`{"enterprise": {"providers": ["AWS"], "features": ["auditing", "encryptionAtRest"]}}`), 0600)
+	editions, err := ReadEditionsFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, testEditions, editions)
+
+	for _, invalid := range []string{
+		`{"Enterprise": {"features": ["auditing"]}}`,
+		`{"enterprise": {"providers": ["TENANT"], "features": ["auditing"]}}`,
+		`{"enterprise": {"features": ["ldap"]}}`,
+		`{"enterprise": {}}`,
+	} {
+		ioutil.WriteFile(path, []byte(invalid), 0600)
+		_, err = ReadEditionsFile(path)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestEditionCatalog(t *testing.T) {
+	_, _, ctx := setupTest()
+
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Editions: testEditions})
+	services, err := broker.catalog(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var standard, enterprise *catalogService
+	for i, svc := range services {
+		switch svc.ID {
+		case testServiceID:
+			standard = &services[i]
+		case testEditionServiceID:
+			enterprise = &services[i]
+		case "aosb-cluster-service-gcp-enterprise":
+			t.Error("Expected the edition to only be offered for AWS")
+		}
+	}
+	if !assert.NotNil(t, standard) || !assert.NotNil(t, enterprise) {
+		return
+	}
+
+	assert.Equal(t, "mongodb-atlas-aws-enterprise", enterprise.Name)
+	assert.Equal(t, "enterprise", enterprise.Edition)
+	assert.Equal(t, planNames(toAPIService(*standard).Plans), planNames(toAPIService(*enterprise).Plans))
+
+	plan := enterprise.Plans[0]
+	assert.Equal(t, testEditionPlanID, plan.ID)
+	assert.Equal(t, []string{editionFeatureAuditing, featureEncryptionAtRest}, plan.Features)
+
+	properties := plan.ProvisionSchema["properties"].(map[string]interface{})
+	assert.Equal(t, true, properties["auditing"].(map[string]interface{})["default"])
+
+	// The standard service is unchanged.
+	assert.Empty(t, standard.Edition)
+	assert.Nil(t, standard.Plans[0].Features)
+	assert.Nil(t, standard.Plans[0].ProvisionSchema)
+
+	apiPlan := toAPIPlan(plan)
+	assert.Equal(t, plan.Features, apiPlan.Metadata.AdditionalMetadata["features"])
+}
+
+func TestEditionCatalogWithRequiredParameters(t *testing.T) {
+	_, _, ctx := setupTest()
+
+	config := Config{
+		Editions:           testEditions,
+		RequiredParameters: RequiredParameters{"M10": []string{"cluster.diskSizeGB"}},
+	}
+
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), config)
+	services, err := broker.catalog(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, svc := range services {
+		if svc.ID != testEditionServiceID {
+			continue
+		}
+
+		// The required parameters are merged into the edition's schema.
+		schema := svc.Plans[0].ProvisionSchema
+		cluster := schema["properties"].(map[string]interface{})["cluster"].(map[string]interface{})
+		assert.Equal(t, []string{"diskSizeGB"}, cluster["required"])
+		assert.Contains(t, cluster["properties"], "encryptionAtRestProvider")
+		assert.Contains(t, schema["properties"], "auditing")
+		return
+	}
+
+	t.Error("Expected the edition service in the catalog")
+}
+
+func TestProvisionEdition(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Editions: testEditions})
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		ServiceID: testEditionServiceID,
+		PlanID:    testEditionPlanID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cluster := client.Clusters[instanceID]
+	assert.Equal(t, "M10", cluster.ProviderSettings.InstanceSizeName)
+	assert.Equal(t, "AWS", cluster.EncryptionAtRestProvider)
+	assert.True(t, client.Auditing.Enabled)
+
+	instance, err := broker.store.GetInstance(instanceID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "enterprise", instance.Edition)
+		assert.Equal(t, testEditionServiceID, instance.ServiceID)
+		assert.Equal(t, "AWS", instance.Provider)
+	}
+
+	spec, err := broker.GetInstance(ctx, instanceID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testEditionServiceID, spec.ServiceID)
+		assert.Equal(t, testEditionPlanID, spec.PlanID)
+	}
+
+	_, err = broker.Bind(ctx, instanceID, "binding", brokerapi.BindDetails{
+		ServiceID: testEditionServiceID,
+		PlanID:    testEditionPlanID,
+	}, true)
+	assert.NoError(t, err)
+}
+
+func TestProvisionEditionOverridingDefaults(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Editions: testEditions})
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		ServiceID:     testEditionServiceID,
+		PlanID:        testEditionPlanID,
+		RawParameters: []byte(`{"auditing": false, "cluster": {"encryptionAtRestProvider": "NONE"}}`),
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "NONE", client.Clusters[instanceID].EncryptionAtRestProvider)
+	assert.False(t, client.Auditing.Enabled)
+}
+
+func TestProvisionStandardServiceWithEditions(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Editions: testEditions})
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		ServiceID: testServiceID,
+		PlanID:    testPlanID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Empty(t, client.Clusters[instanceID].EncryptionAtRestProvider)
+	assert.False(t, client.Auditing.Enabled)
+
+	spec, err := broker.GetInstance(ctx, instanceID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testServiceID, spec.ServiceID)
+	}
+}
+
+func TestResolveEdition(t *testing.T) {
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Editions: testEditions})
+
+	serviceID, planID, edition := broker.resolveEdition(testEditionServiceID, testEditionPlanID)
+	assert.Equal(t, testServiceID, serviceID)
+	assert.Equal(t, testPlanID, planID)
+	assert.Equal(t, "enterprise", edition)
+
+	// Updates may omit the plan.
+	serviceID, planID, edition = broker.resolveEdition(testEditionServiceID, "")
+	assert.Equal(t, testServiceID, serviceID)
+	assert.Empty(t, planID)
+	assert.Equal(t, "enterprise", edition)
+
+	// Editions which aren't offered for a provider aren't resolved.
+	gcp := &atlas.Provider{Name: "GCP"}
+	serviceID, _, edition = broker.resolveEdition(serviceIDForEdition(gcp, "enterprise"), "")
+	assert.Equal(t, serviceIDForEdition(gcp, "enterprise"), serviceID)
+	assert.Empty(t, edition)
+}
+
+func TestDiscoveryCatalogWithEditions(t *testing.T) {
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Editions: testEditions})
+
+	ids := []string{}
+	for _, svc := range broker.DiscoveryCatalog().Services {
+		ids = append(ids, svc.ID)
+	}
+
+	assert.Contains(t, ids, testEditionServiceID)
+	assert.NotContains(t, ids, "aosb-cluster-service-tenant-enterprise")
+}
@@ -0,0 +1,139 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// clusterLabelEphemeral is the suffix of the label key marking clusters of
+// ephemeral instances, for example "atlas-osb/ephemeral".
+const clusterLabelEphemeral = "ephemeral"
+
+// ephemeralFromParams returns whether {"ephemeral": true} was passed to mark
+// an instance as a throwaway instance, for example in shared sandboxes.
+func ephemeralFromParams(rawParams []byte) (bool, error) {
+	params := struct {
+		Ephemeral bool `json:"ephemeral"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return false, newInvalidParamsError(err)
+		}
+	}
+
+	return params.Ephemeral, nil
+}
+
+// validateEphemeralInstanceSize rejects ephemeral clusters larger than the
+// configured maximum instance size. All sizes are allowed if no maximum is
+// configured.
+func (b Broker) validateEphemeralInstanceSize(cluster *atlas.Cluster) error {
+	if b.config.EphemeralMaxInstanceSize == "" || cluster.ProviderSettings == nil {
+		return nil
+	}
+
+	instanceSizeName := cluster.ProviderSettings.InstanceSizeName
+	if (PlanRange{Max: b.config.EphemeralMaxInstanceSize}).allows(instanceSizeName) {
+		return nil
+	}
+
+	err := fmt.Errorf("Instance size %s is larger than the maximum of %s for ephemeral instances", instanceSizeName, b.config.EphemeralMaxInstanceSize)
+	return newRemediableError(err, http.StatusUnprocessableEntity, "ephemeral-instance-size", fmt.Sprintf("pick a plan up to %s or provision a persistent instance", b.config.EphemeralMaxInstanceSize))
+}
+
+// lockEphemeralQuota serializes the provisioning of ephemeral instances while
+// a quota is configured, so concurrent provisions can't exceed it. The
+// returned function releases the lock.
+func (b Broker) lockEphemeralQuota() func() {
+	if b.config.EphemeralMaxInstances == 0 {
+		return func() {}
+	}
+
+	return b.store.Lock("quota/ephemeral")
+}
+
+// validateEphemeralQuota rejects ephemeral instances beyond the configured
+// maximum number of ephemeral instances.
+func (b Broker) validateEphemeralQuota() error {
+	if b.config.EphemeralMaxInstances == 0 {
+		return nil
+	}
+
+	ephemeral := true
+	count := 0
+	for offset := 0; ; offset += sweepPageSize {
+		instances, err := b.store.ListInstances(state.InstanceFilter{Ephemeral: &ephemeral}, offset, sweepPageSize)
+		if err != nil {
+			return err
+		}
+		count += len(instances)
+
+		if len(instances) < sweepPageSize {
+			break
+		}
+	}
+
+	if count < b.config.EphemeralMaxInstances {
+		return nil
+	}
+
+	err := fmt.Errorf("The maximum of %d ephemeral instances has been reached", b.config.EphemeralMaxInstances)
+	return newRemediableError(err, http.StatusUnprocessableEntity, "ephemeral-quota", remediationEphemeralQuota)
+}
+
+// ephemeralClusterLabel returns the label marking the cluster of an
+// ephemeral instance.
+func (b Broker) ephemeralClusterLabel() atlas.Label {
+	return atlas.Label{Key: b.userLabelKey(clusterLabelEphemeral), Value: "true"}
+}
+
+// isEphemeralCluster returns whether a cluster is labeled as ephemeral.
+func (b Broker) isEphemeralCluster(cluster *atlas.Cluster) bool {
+	for _, label := range cluster.Labels {
+		if label == b.ephemeralClusterLabel() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setEphemeral records that an instance is ephemeral, and when it expires if
+// ephemeral instances have a TTL.
+func (b Broker) setEphemeral(instanceID string) error {
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.Ephemeral = true
+		if b.config.EphemeralTTL > 0 {
+			instance.ExpiresAt = time.Now().Add(b.config.EphemeralTTL)
+		}
+	})
+}
+
+// isEphemeral returns whether an instance has been recorded as ephemeral.
+func (b Broker) isEphemeral(instanceID string) (bool, error) {
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return instance.Ephemeral, nil
+}
+
+// recordInstanceOperation counts a successfully started instance operation,
+// partitioned by whether the instance is ephemeral.
+func (b Broker) recordInstanceOperation(operation string, ephemeral bool) {
+	if b.instanceOperations != nil {
+		b.instanceOperations.Inc(operation, strconv.FormatBool(ephemeral))
+	}
+}
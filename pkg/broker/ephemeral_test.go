@@ -0,0 +1,263 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/telemetry"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestProvisionEphemeral(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"ephemeral": true}`),
+	}, true)
+	assert.NoError(t, err)
+
+	cluster := client.Clusters[instanceID]
+	assert.Contains(t, cluster.Labels, atlas.Label{Key: "atlas-osb/ephemeral", Value: "true"})
+
+	instance, err := broker.store.GetInstance(instanceID)
+	assert.NoError(t, err)
+	assert.True(t, instance.Ephemeral)
+
+	spec, err := broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+	assert.Equal(t, true, spec.Parameters.(map[string]interface{})["ephemeral"])
+}
+
+func TestProvisionPersistent(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	assert.False(t, broker.isEphemeralCluster(client.Clusters[instanceID]))
+
+	ephemeral, err := broker.isEphemeral(instanceID)
+	assert.NoError(t, err)
+	assert.False(t, ephemeral)
+}
+
+func TestEphemeralMaxInstanceSize(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		EphemeralMaxInstanceSize: "M10",
+	})
+
+	// Persistent instances aren't limited.
+	_, err := broker.Provision(ctx, "persistent", brokerapi.ProvisionDetails{
+		PlanID:    "aosb-cluster-plan-aws-m20",
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	_, err = broker.Provision(ctx, "large", brokerapi.ProvisionDetails{
+		PlanID:        "aosb-cluster-plan-aws-m20",
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"ephemeral": true}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+	assert.Nil(t, client.Clusters["large"])
+
+	instanceID := "instance"
+	_, err = broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"ephemeral": true}`),
+	}, true)
+	assert.NoError(t, err)
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+
+	// Ephemeral instances can't be scaled past the maximum either.
+	_, err = broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		PlanID:    "aosb-cluster-plan-aws-m20",
+		ServiceID: testServiceID,
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+}
+
+func provisionEphemeralForTest(broker *Broker, ctx context.Context, instanceID string) error {
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"ephemeral": true}`),
+	}, true)
+	return err
+}
+
+func TestEphemeralTTL(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{EphemeralTTL: time.Hour})
+
+	if !assert.NoError(t, provisionEphemeralForTest(broker, ctx, "instance")) {
+		return
+	}
+	_, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+	assert.NoError(t, err)
+
+	status, err := broker.autoTermination("instance")
+	if assert.NoError(t, err) && assert.NotNil(t, status) && assert.NotNil(t, status.ExpiresAt) {
+		assert.False(t, status.DeleteWhenUnbound)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *status.ExpiresAt, time.Minute)
+	}
+
+	// Persistent instances don't expire.
+	_, err = broker.Provision(ctx, "persistent", brokerapi.ProvisionDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+	assert.NoError(t, err)
+
+	broker.Sweep()
+	assert.NotNil(t, client.Clusters["instance"])
+
+	// Expired instances are deleted even though they're still bound.
+	broker.sweep(time.Now().Add(time.Hour))
+	assert.Nil(t, client.Clusters["instance"])
+	assert.NotNil(t, client.Clusters["persistent"])
+
+	_, err = broker.store.GetInstance("instance")
+	assert.Equal(t, state.ErrNotFound, err)
+}
+
+func TestEphemeralTTLWithoutClient(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{EphemeralTTL: time.Hour})
+
+	if !assert.NoError(t, provisionEphemeralForTest(broker, ctx, "instance")) {
+		return
+	}
+
+	// Without a client, for example after a restart, expired instances are
+	// kept and flagged as overdue.
+	broker.sweeper.forget("instance")
+	later := time.Now().Add(time.Hour)
+	broker.sweep(later)
+	assert.NotNil(t, client.Clusters["instance"])
+
+	status, err := broker.autoTermination("instance")
+	if assert.NoError(t, err) && assert.NotNil(t, status) {
+		assert.NotNil(t, status.ExpiresAt)
+	}
+
+	list, err := broker.ListInstances(state.InstanceFilter{}, 0, 10)
+	if assert.NoError(t, err) && assert.Len(t, list.Instances, 1) {
+		assert.NotNil(t, list.Instances[0].ExpiresAt)
+	}
+
+	// The next request for the instance passes the client to delete it with.
+	_, err = broker.GetInstance(ctx, "instance")
+	assert.NoError(t, err)
+	broker.sweep(later)
+	assert.Nil(t, client.Clusters["instance"])
+}
+
+func TestOverdueEphemeralInstance(t *testing.T) {
+	broker, _, _ := setupTest()
+	broker.store.PutInstance(state.Instance{ID: "instance", Ephemeral: true, ExpiresAt: time.Now().Add(-time.Minute)})
+
+	status, err := broker.autoTermination("instance")
+	if assert.NoError(t, err) && assert.NotNil(t, status) {
+		assert.True(t, status.Overdue)
+	}
+
+	list, err := broker.ListInstances(state.InstanceFilter{}, 0, 10)
+	if assert.NoError(t, err) && assert.Len(t, list.Instances, 1) {
+		assert.True(t, list.Instances[0].Overdue)
+	}
+}
+
+func TestEphemeralDeleteWhenUnbound(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{EphemeralDeleteWhenUnbound: true})
+
+	if !assert.NoError(t, provisionEphemeralForTest(broker, ctx, "instance")) {
+		return
+	}
+	_, err := broker.Provision(ctx, "persistent", brokerapi.ProvisionDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+	assert.NoError(t, err)
+
+	for _, instanceID := range []string{"instance", "persistent"} {
+		_, err = broker.Bind(ctx, instanceID, "binding-"+instanceID, brokerapi.BindDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+		assert.NoError(t, err)
+		_, err = broker.Unbind(ctx, instanceID, "binding-"+instanceID, brokerapi.UnbindDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+		assert.NoError(t, err)
+	}
+
+	// Only the ephemeral instance is deleted once unbound.
+	broker.sweep(time.Now().Add(DefaultAutoTerminationGracePeriod))
+	assert.Nil(t, client.Clusters["instance"])
+	assert.NotNil(t, client.Clusters["persistent"])
+}
+
+func TestEphemeralMaxInstances(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{EphemeralMaxInstances: 2})
+
+	assert.NoError(t, provisionEphemeralForTest(broker, ctx, "instance-1"))
+	assert.NoError(t, provisionEphemeralForTest(broker, ctx, "instance-2"))
+
+	err := provisionEphemeralForTest(broker, ctx, "instance-3")
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		assert.Contains(t, err.Error(), "maximum of 2 ephemeral instances")
+	}
+	assert.Nil(t, client.Clusters["instance-3"])
+
+	// Persistent instances don't count towards the quota.
+	_, err = broker.Provision(ctx, "persistent", brokerapi.ProvisionDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+	assert.NoError(t, err)
+
+	// Deprovisioned instances free up the quota.
+	_, err = broker.Deprovision(ctx, "instance-1", brokerapi.DeprovisionDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+	assert.NoError(t, err)
+	assert.NoError(t, provisionEphemeralForTest(broker, ctx, "instance-3"))
+}
+
+func TestEphemeralMetrics(t *testing.T) {
+	_, _, ctx := setupTest()
+	registry := telemetry.NewRegistry()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Metrics: registry})
+
+	broker.Provision(ctx, "ephemeral", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"ephemeral": true}`),
+	}, true)
+	broker.Provision(ctx, "persistent", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	broker.Deprovision(ctx, "ephemeral", brokerapi.DeprovisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	snapshots := registry.Snapshot()
+	if assert.Len(t, snapshots, 1) {
+		assert.Equal(t, "broker_instance_operations_total", snapshots[0].Name)
+		assert.Equal(t, []telemetry.SeriesSnapshot{
+			{Labels: map[string]string{"operation": OperationDeprovision, "ephemeral": "true"}, Value: 1},
+			{Labels: map[string]string{"operation": OperationProvision, "ephemeral": "false"}, Value: 1},
+			{Labels: map[string]string{"operation": OperationProvision, "ephemeral": "true"}, Value: 1},
+		}, snapshots[0].Series)
+	}
+}
@@ -0,0 +1,92 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+)
+
+// Hints on how to fix common request errors, included in the description of
+// the error response.
+const (
+	remediationInvalidServiceID = "pick a service listed in the catalog"
+	remediationInvalidPlanID    = "pick a plan listed in the catalog for this service"
+	remediationInvalidParams    = `pass parameters as a JSON object, for example {"cluster": {"providerSettings": {"regionName": "US_EAST_1"}}}`
+	remediationUnauthorized     = "check the broker credentials are formatted as <PUBLIC_KEY>@<GROUP_ID> and the API key has access to the project"
+	remediationAtlasRejected    = "check the parameters against the Atlas API documentation for clusters and database users"
+	remediationRateLimited      = "retry the request after the time in the Retry-After header"
+
+	remediationInvalidRegion        = "pick a region the cloud provider of the plan offers, written as in Atlas, for example US_EAST_1 for AWS"
+	remediationNoPaymentInformation = "ask the owners of the Atlas organization to add a payment method, then retry"
+
+	remediationInvalidSearchNodes  = `pick a dedicated plan (M10 or larger) and pass 2 to 32 nodes of a search instance size, for example {"searchNodes": {"instanceSize": "S30_HIGHCPU_NVME", "nodeCount": 2}}`
+	remediationSearchNodesRejected = "check that the Atlas organization is entitled to dedicated search nodes and that they are available in the cluster's region"
+
+	remediationInvalidDatabase           = `pass "database" as a name of at most 63 characters without any of /\. "$*<>:|?`
+	remediationInvalidConnectionConcerns = `pass "w" as "majority" or a number of nodes, "readConcernLevel" as one of local, available, majority, linearizable, or snapshot, and "journal" as a boolean`
+
+	remediationMissingParameter    = "pass all parameters the provisioning schema of the plan lists as required"
+	remediationParameterPattern    = "pass a value following the naming conventions of the broker operators"
+	remediationUnsupportedFeature  = "pick a dedicated plan (M10 or larger) for backups, the BI connector, auto-scaling, and encryption at rest, and M30 or larger for sharding"
+	remediationPlaintextConnection = "omit the tls and ssl bind parameters, the broker requires TLS for all connections"
+	remediationPlaintextCluster    = "ask the broker operators to check the connection options of the cluster, Atlas clusters support TLS"
+	remediationSeedListUnavailable = "wait for the cluster to be deployed or bind with SRV enabled, seed lists aren't available for shared clusters"
+
+	remediationConnectionVerification = "check that the IP access list of the project allows connections from the broker and that the user's roles are valid, then retry"
+
+	remediationUnknownIntent       = "pass an intent configured by the broker operators, or omit intent to provision the requested plan"
+	remediationUnsatisfiableIntent = "pass a less demanding intent, or pick a plan instead"
+	remediationAmbiguousIntent     = "ask the broker operators to narrow the instance sizes of the intent, or pick a plan instead"
+
+	remediationInvalidReplicaSetName     = "use up to 64 ASCII letters, numbers, and hyphens, starting with a letter or number"
+	remediationUnsupportedReplicaSetName = "pick a dedicated plan (M10 or larger) for a replica set cluster, or omit replica_set_name to use the Atlas default"
+	remediationImmutableReplicaSetName   = "provision a new instance to use a different replica set name"
+
+	remediationInvalidClusterName       = "use up to 23 ASCII letters, numbers, and hyphens, starting with a letter or number"
+	remediationClusterRenameUnsupported = "wait for the cluster to be idle, renames aren't supported for shared clusters or while the cluster is changing"
+	remediationClusterRenamesDisabled   = "ask the broker operators to set BROKER_ALLOW_CLUSTER_RENAMES, or omit cluster_name"
+
+	remediationDiskSizeTooLarge = "pass a smaller diskSizeGB, or pick a larger plan for larger disks"
+
+	remediationBackupRequired = "omit providerBackupEnabled or set it to true, or pick a smaller plan for clusters without backups"
+
+	remediationProjectResolution = "check that the space, organization, or namespace is registered with an Atlas project in the inventory of the broker operators, then retry"
+	remediationProjectUnknown    = "retry the request through the platform the instance was provisioned from, or ask the broker operators to record the project of the instance"
+
+	remediationDeprecatedMongoDBVersion = "pick a MongoDB version listed as supported in the plan metadata, or omit mongoDBMajorVersion to use the Atlas default"
+
+	remediationExistingUsersDisabled       = "ask the broker operators to configure BROKER_SECRETS_DIR, or omit existing_user to create a user"
+	remediationExistingUserNotFound        = "pass the username of a database user which isn't managed by the broker and can access the cluster"
+	remediationExistingUserPasswordMissing = "ask the broker operators to add the password of the user to the secret store"
+
+	remediationOperationInProgress = "retry the request once the operation in progress has been accepted"
+	remediationClusterMaintenance  = "retry the request after the time in the Retry-After header, once Atlas has completed the maintenance"
+
+	remediationProvisionTimeout = "retry the request, or ask the broker operators to raise the provision timeout of the plan with BROKER_PROVISION_TIMEOUTS"
+
+	remediationEphemeralQuota = "deprovision an ephemeral instance which is no longer used, or provision a persistent instance"
+
+	remediationSingleBinding = "remove the existing binding first, instances of this plan can only have one binding"
+
+	remediationMissingLabels = `pass the missing labels as cluster labels, for example {"cluster": {"labels": [{"key": "owner", "value": "payments"}]}}`
+)
+
+// newRemediableError builds an error response for a request which could be
+// fixed by the user. The description includes a short hint on how to fix it.
+func newRemediableError(err error, statusCode int, loggerAction string, remediation string) error {
+	description := err.Error()
+	if remediation != "" {
+		description = fmt.Sprintf("%s. Remediation: %s", strings.TrimRight(description, "."), remediation)
+	}
+
+	return apiresponses.NewFailureResponse(errors.New(description), statusCode, loggerAction)
+}
+
+// newInvalidParamsError builds the error response for parameters which could
+// not be deserialized.
+func newInvalidParamsError(err error) error {
+	return newRemediableError(fmt.Errorf("Invalid parameters: %v", err), http.StatusBadRequest, "invalid-parameters", remediationInvalidParams)
+}
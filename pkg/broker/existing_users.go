@@ -0,0 +1,106 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// ErrSecretNotFound is returned by secret stores for unknown secrets.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretStore provides the passwords of database users which are managed
+// outside of the broker, using their usernames as secret names.
+type SecretStore interface {
+	GetSecret(name string) (string, error)
+}
+
+// DirectorySecretStore reads secrets from the files in a directory, named
+// after the secret. This is the layout of Kubernetes secret volumes and of
+// secrets rendered by the Vault agent.
+type DirectorySecretStore struct {
+	Path string
+}
+
+// GetSecret returns the contents of the file named after the secret, without
+// trailing newlines. Names which aren't plain file names are never found.
+func (s DirectorySecretStore) GetSecret(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", ErrSecretNotFound
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.Path, name))
+	if os.IsNotExist(err) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// existingUserFromParams returns the username passed as
+// {"existing_user": "..."}, or an empty string to create a user.
+func existingUserFromParams(rawParams []byte) (string, error) {
+	params := struct {
+		ExistingUser string `json:"existing_user"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return "", newInvalidParamsError(err)
+		}
+	}
+
+	return params.ExistingUser, nil
+}
+
+// existingUser fetches an externally managed database user and its password
+// for a binding. The user must exist, be able to access the cluster, and not
+// have been created by the broker for another binding, as that user is
+// deleted when its binding is.
+func (b Broker) existingUser(client atlas.Client, cluster *atlas.Cluster, username string) (*atlas.User, string, error) {
+	if b.config.SecretStore == nil {
+		err := errors.New("Binding existing users isn't enabled for this broker")
+		return nil, "", newRemediableError(err, http.StatusUnprocessableEntity, "existing-users-disabled", remediationExistingUsersDisabled)
+	}
+
+	user, err := client.GetUser(username)
+	if err == atlas.ErrUserNotFound {
+		err := fmt.Errorf(`Database user "%s" doesn't exist`, username)
+		return nil, "", newRemediableError(err, http.StatusUnprocessableEntity, "existing-user-not-found", remediationExistingUserNotFound)
+	}
+	if err != nil {
+		return nil, "", atlasToAPIError(err)
+	}
+
+	if _, ok := b.userAttributionFromLabels(user.Labels); ok {
+		err := fmt.Errorf(`Database user "%s" belongs to another binding`, username)
+		return nil, "", newRemediableError(err, http.StatusUnprocessableEntity, "existing-user-managed-by-broker", remediationExistingUserNotFound)
+	}
+
+	if !user.CanAccessCluster(cluster.Name) {
+		err := fmt.Errorf(`Database user "%s" can't access the cluster`, username)
+		return nil, "", newRemediableError(err, http.StatusUnprocessableEntity, "existing-user-not-found", remediationExistingUserNotFound)
+	}
+
+	password, err := b.config.SecretStore.GetSecret(username)
+	if err == ErrSecretNotFound {
+		err := fmt.Errorf(`No password for database user "%s" in the secret store`, username)
+		return nil, "", newRemediableError(err, http.StatusUnprocessableEntity, "existing-user-password-missing", remediationExistingUserPasswordMissing)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return user, password, nil
+}
@@ -0,0 +1,150 @@
+package broker
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// setupExistingUserTest provisions an instance with a broker reading
+// passwords from a temporary secrets directory, which the caller removes.
+func setupExistingUserTest(t *testing.T) (*Broker, MockAtlasClient, context.Context, string) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{SecretStore: DirectorySecretStore{Path: dir}})
+
+	_, err = broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	return broker, client, ctx, dir
+}
+
+func TestBindExistingUser(t *testing.T) {
+	broker, client, ctx, dir := setupExistingUserTest(t)
+	defer os.RemoveAll(dir)
+
+	client.Clusters["instance"].SrvAddress = "mongodb+srv://instance.mongodb.net"
+	client.Users["reporting"] = &atlas.User{Username: "reporting"}
+	ioutil.WriteFile(filepath.Join(dir, "reporting"), []byte("s3cret\n"), 0600)
+
+	spec, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"existing_user": "reporting"}`),
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	credentials := spec.Credentials.(ConnectionDetails)
+	assert.Equal(t, "reporting", credentials.Username)
+	assert.Equal(t, "s3cret", credentials.Password)
+	assert.Equal(t, "mongodb+srv://instance.mongodb.net", credentials.URI)
+
+	// No user is created for the binding, and the existing user is left as
+	// it is.
+	assert.Nil(t, client.Users["binding"])
+	assert.Empty(t, client.Users["reporting"].Labels)
+
+	_, err = broker.Unbind(ctx, "instance", "binding", brokerapi.UnbindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+	assert.NotNil(t, client.Users["reporting"], "Expected existing user to be kept")
+}
+
+func TestBindExistingUserRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     *atlas.User
+		password string
+	}{
+		{"unknown user", nil, "s3cret"},
+		{"missing password", &atlas.User{Username: "reporting"}, ""},
+		{"user scoped to another cluster", &atlas.User{Username: "reporting", Scopes: []atlas.Scope{{Name: "other", Type: atlas.ScopeTypeCluster}}}, "s3cret"},
+		{"user of another binding", &atlas.User{Username: "reporting", Labels: []atlas.Label{
+			{Key: "atlas-osb/broker-id", Value: DefaultBrokerID},
+			{Key: "atlas-osb/instance-id", Value: "other"},
+			{Key: "atlas-osb/binding-id", Value: "reporting"},
+		}}, "s3cret"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker, client, ctx, dir := setupExistingUserTest(t)
+			defer os.RemoveAll(dir)
+
+			if test.user != nil {
+				client.Users["reporting"] = test.user
+			}
+			if test.password != "" {
+				ioutil.WriteFile(filepath.Join(dir, "reporting"), []byte(test.password), 0600)
+			}
+
+			_, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+				PlanID:        testPlanID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(`{"existing_user": "reporting"}`),
+			}, true)
+			if assert.Error(t, err) {
+				assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+			}
+			assert.Nil(t, client.Users["binding"])
+		})
+	}
+}
+
+func TestBindExistingUserWithoutSecretStore(t *testing.T) {
+	broker, client, ctx := setupTest()
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.Users["reporting"] = &atlas.User{Username: "reporting"}
+
+	_, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"existing_user": "reporting"}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+}
+
+func TestDirectorySecretStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "reporting"), []byte("s3cret\n"), 0600)
+	store := DirectorySecretStore{Path: dir}
+
+	secret, err := store.GetSecret("reporting")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", secret)
+
+	for _, name := range []string{"unknown", "", "..", "../reporting", "sub/reporting"} {
+		_, err = store.GetSecret(name)
+		assert.Equal(t, ErrSecretNotFound, err, name)
+	}
+}
@@ -0,0 +1,112 @@
+package broker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// The overall health statuses of an instance, meant for dashboards.
+const (
+	healthStatusGreen  = "green"
+	healthStatusYellow = "yellow"
+	healthStatusRed    = "red"
+)
+
+// instanceHealth is the health summary of a cluster reported by GetInstance.
+type instanceHealth struct {
+	Status           string        `json:"status"`
+	State            string        `json:"state"`
+	PrimaryReachable bool          `json:"primaryReachable"`
+	NodeCount        int           `json:"nodeCount"`
+	Alerts           []atlas.Alert `json:"alerts"`
+}
+
+// clusterHealth will summarize the health of a cluster from its processes and
+// open alerts. The cluster state is taken from the already fetched cluster.
+//
+// A cluster is red if it's idle without a primary to accept writes, yellow if
+// it's changing or has open alerts, and green otherwise.
+func clusterHealth(client atlas.Client, cluster *atlas.Cluster) (*instanceHealth, error) {
+	processes, err := client.GetProcesses()
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := client.GetOpenAlerts()
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := clusterHosts(cluster)
+	members := clusterProcesses(processes, hosts)
+	health := &instanceHealth{
+		State:     cluster.StateName,
+		NodeCount: len(members),
+		Alerts:    []atlas.Alert{},
+	}
+
+	for _, process := range members {
+		if process.TypeName == atlas.ProcessTypeReplicaPrimary || process.TypeName == atlas.ProcessTypeShardMongos {
+			health.PrimaryReachable = true
+		}
+	}
+
+	for _, alert := range alerts {
+		if alert.ClusterName == cluster.Name || hosts[alert.HostnameAndPort] {
+			health.Alerts = append(health.Alerts, alert)
+		}
+	}
+
+	switch {
+	case cluster.StateName == atlas.ClusterStateIdle && !health.PrimaryReachable:
+		health.Status = healthStatusRed
+	case cluster.StateName != atlas.ClusterStateIdle || len(health.Alerts) > 0:
+		health.Status = healthStatusYellow
+	default:
+		health.Status = healthStatusGreen
+	}
+
+	return health, nil
+}
+
+// clusterProcesses returns the processes running on the hosts of a cluster.
+// Processes belong to the project, so those of other clusters are left out.
+func clusterProcesses(processes []atlas.Process, hosts map[string]bool) []atlas.Process {
+	members := []atlas.Process{}
+	for _, process := range processes {
+		if hosts[processHost(process)] {
+			members = append(members, process)
+		}
+	}
+
+	return members
+}
+
+// processHost returns the "host:port" pair a process is listening on.
+func processHost(process atlas.Process) string {
+	return fmt.Sprintf("%s:%d", process.Hostname, process.Port)
+}
+
+// clusterHosts returns the "host:port" pairs listed in the standard
+// connection string of a cluster.
+func clusterHosts(cluster *atlas.Cluster) map[string]bool {
+	hosts := map[string]bool{}
+
+	connectionString := cluster.ConnectionStrings.Standard
+	if i := strings.Index(connectionString, "://"); i >= 0 {
+		connectionString = connectionString[i+len("://"):]
+	}
+	if i := strings.IndexAny(connectionString, "/?"); i >= 0 {
+		connectionString = connectionString[:i]
+	}
+
+	for _, host := range strings.Split(connectionString, ",") {
+		if host != "" {
+			hosts[host] = true
+		}
+	}
+
+	return hosts
+}
@@ -0,0 +1,111 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupHealthTest(t *testing.T) (*Broker, MockAtlasClient, context.Context, string) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	cluster := client.Clusters[instanceID]
+	cluster.StateName = atlas.ClusterStateIdle
+	cluster.ConnectionStrings.Standard = "mongodb://instance-shard-00-00.mongodb.net:27017,instance-shard-00-01.mongodb.net:27017/?ssl=true"
+
+	client.Processes["primary"] = &atlas.Process{
+		Hostname: "instance-shard-00-00.mongodb.net",
+		Port:     27017,
+		TypeName: atlas.ProcessTypeReplicaPrimary,
+	}
+	client.Processes["secondary"] = &atlas.Process{
+		Hostname: "instance-shard-00-01.mongodb.net",
+		Port:     27017,
+		TypeName: "REPLICA_SECONDARY",
+	}
+
+	// Processes and alerts of other clusters in the project are ignored.
+	client.Processes["other"] = &atlas.Process{
+		Hostname: "other-shard-00-00.mongodb.net",
+		Port:     27017,
+		TypeName: atlas.ProcessTypeReplicaPrimary,
+	}
+	client.Alerts["other"] = &atlas.Alert{
+		ID:          "other",
+		ClusterName: "other",
+		Status:      atlas.AlertStatusOpen,
+	}
+
+	return broker, client, ctx, instanceID
+}
+
+func TestGetInstanceHealthy(t *testing.T) {
+	broker, _, ctx, instanceID := setupHealthTest(t)
+
+	spec, err := broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+
+	params := spec.Parameters.(map[string]interface{})
+	assert.Equal(t, &instanceHealth{
+		Status:           healthStatusGreen,
+		State:            atlas.ClusterStateIdle,
+		PrimaryReachable: true,
+		NodeCount:        2,
+		Alerts:           []atlas.Alert{},
+	}, params["health"])
+}
+
+func TestGetInstanceAlerting(t *testing.T) {
+	broker, client, ctx, instanceID := setupHealthTest(t)
+
+	alert := atlas.Alert{
+		ID:              "alert",
+		EventTypeName:   "OUTSIDE_METRIC_THRESHOLD",
+		Status:          atlas.AlertStatusOpen,
+		HostnameAndPort: "instance-shard-00-01.mongodb.net:27017",
+	}
+	client.Alerts["alert"] = &alert
+
+	spec, err := broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+
+	health := spec.Parameters.(map[string]interface{})["health"].(*instanceHealth)
+	assert.Equal(t, healthStatusYellow, health.Status)
+	assert.Equal(t, []atlas.Alert{alert}, health.Alerts)
+
+	// Without a primary the cluster can't accept writes.
+	delete(client.Processes, "primary")
+
+	spec, err = broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+
+	health = spec.Parameters.(map[string]interface{})["health"].(*instanceHealth)
+	assert.Equal(t, healthStatusRed, health.Status)
+	assert.False(t, health.PrimaryReachable)
+	assert.Equal(t, 1, health.NodeCount)
+}
+
+func TestGetInstanceHealthUnavailable(t *testing.T) {
+	broker, client, _, instanceID := setupHealthTest(t)
+
+	client.MonitoringErr = errors.New("monitoring unavailable")
+	ctx := context.WithValue(context.Background(), ContextKeyAtlasClient, client)
+
+	spec, err := broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+
+	params := spec.Parameters.(map[string]interface{})
+	assert.NotContains(t, params, "health")
+	assert.Contains(t, params, "cluster")
+}
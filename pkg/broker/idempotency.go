@@ -0,0 +1,112 @@
+package broker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// idempotencyTTL is how long the result of a successful mutating operation is
+// kept to be replayed to retries of an identical request. Platforms retry
+// requests which timed out or failed on the network level, which normally
+// happens within seconds.
+const idempotencyTTL = 10 * time.Minute
+
+// operationKey generates the key identifying an operation on a specific
+// instance or binding.
+func operationKey(operation string, ids ...string) string {
+	return operation + "/" + strings.Join(ids, "/")
+}
+
+// identifiedClient is implemented by Atlas clients which can identify the API
+// key and project their requests are made with.
+type identifiedClient interface {
+	Identity() string
+}
+
+// callerIdentity returns the identity of the Atlas client of a request, or an
+// empty string if it can't be identified.
+func callerIdentity(ctx context.Context) string {
+	client, ok := ctx.Value(ContextKeyAtlasClient).(identifiedClient)
+	if !ok {
+		return ""
+	}
+
+	return client.Identity()
+}
+
+// idempotent will run fn and record its result in case of success. Retries of
+// an identical request will receive the recorded result instead of running fn
+// again. Concurrent identical requests are serialized which means only one of
+// them will run fn.
+//
+// result must be a pointer which fn populates. Requests which differ from the
+// recorded one will run fn as usual, letting Atlas reject any conflicts. This
+// includes requests made with another API key or project, which would
+// otherwise receive results such as credentials without Atlas authorizing
+// them.
+func (b Broker) idempotent(ctx context.Context, key string, request interface{}, result interface{}, fn func() error) error {
+	hash, err := requestHash(struct {
+		Caller  string
+		Request interface{}
+	}{callerIdentity(ctx), request})
+	if err != nil {
+		return err
+	}
+
+	unlock := b.store.Lock(key)
+	defer unlock()
+
+	recorded, err := b.store.GetOperation(key)
+	if err != nil && err != state.ErrNotFound {
+		return err
+	}
+
+	if recorded != nil && !recorded.Expired() && recorded.RequestHash == hash {
+		b.logger.Infow("Replaying result of identical request", "operation_key", key)
+		return json.Unmarshal(recorded.Result, result)
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	rawResult, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return b.store.PutOperation(state.Operation{
+		Key:         key,
+		RequestHash: hash,
+		Result:      rawResult,
+		ExpiresAt:   time.Now().Add(idempotencyTTL),
+	})
+}
+
+// forgetOperations will remove recorded operations which would otherwise be
+// replayed incorrectly, for example a provision after the instance has been
+// deprovisioned.
+func (b Broker) forgetOperations(keys ...string) {
+	for _, key := range keys {
+		if err := b.store.DeleteOperation(key); err != nil {
+			b.logger.Errorw("Failed to remove recorded operation", "error", err, "operation_key", key)
+		}
+	}
+}
+
+// requestHash calculates a hash identifying the contents of a request.
+func requestHash(request interface{}) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
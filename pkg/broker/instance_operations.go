@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
 	"github.com/pivotal-cf/brokerapi"
 	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
 )
@@ -22,17 +24,46 @@ const (
 )
 
 type ContextParams struct {
-	InstanceName string `json:"instance_name"`
-	Namespace    string `json:"namespace"`
-	Platform     string `json:"platform"`
+	InstanceName     string `json:"instance_name"`
+	Namespace        string `json:"namespace"`
+	Platform         string `json:"platform"`
+	OrganizationGUID string `json:"organization_guid"`
+	SpaceGUID        string `json:"space_guid"`
 }
 
 // Provision will create a new Atlas cluster with the instance ID as its name.
-// The process is always async.
+// The process is always async. Retries of an identical request receive the
+// original result.
 func (b Broker) Provision(ctx context.Context, instanceID string, details brokerapi.ProvisionDetails, asyncAllowed bool) (spec brokerapi.ProvisionedServiceSpec, err error) {
-	b.logger.Infow("Provisioning instance", "instance_id", instanceID, "details", details)
+	b.logger.Infow("Provisioning instance", "instance_id", instanceID, "details", anonymizeProvisionDetails(details))
 
-	client, err := atlasClientFromContext(ctx)
+	unlock, err := b.lockInstanceOperations(instanceID)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	err = b.idempotent(ctx, operationKey(OperationProvision, instanceID), details, &spec, func() (err error) {
+		spec, err = b.provision(ctx, instanceID, details, asyncAllowed)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	b.forgetOperations(operationKey(OperationDeprovision, instanceID))
+	return
+}
+
+func (b Broker) provision(ctx context.Context, instanceID string, details brokerapi.ProvisionDetails, asyncAllowed bool) (spec brokerapi.ProvisionedServiceSpec, err error) {
+	// Provisioning is bound by the provision timeout of the plan. The
+	// instance size is only known once the cluster has been constructed, so
+	// the deadline is narrowed to it then.
+	started := time.Now()
+	ctx, cancel := context.WithDeadline(ctx, started.Add(b.provisionTimeout(details.PlanID, "")))
+	defer cancel()
+
+	client, err := b.atlasClientFromContext(ctx)
 	if err != nil {
 		return
 	}
@@ -43,35 +74,319 @@ func (b Broker) Provision(ctx context.Context, instanceID string, details broker
 		return
 	}
 
+	// The project may be resolved from the platform context rather than
+	// being the project of the API key.
+	projectID := ""
+	if b.config.ProjectResolver != nil {
+		projectID, err = b.resolveProject(ctx, details.RawContext)
+		if err != nil {
+			b.logger.Errorw("Failed to resolve the project of the instance", "error", err, "instance_id", instanceID)
+			return
+		}
+
+		client, err = clientForProject(client, projectID)
+		if err != nil {
+			return
+		}
+		b.logger.Infow("Resolved the project of the instance", "instance_id", instanceID, "project_id", projectID)
+	}
+
+	// Parameters may be enriched by the operator's transformers, and are
+	// validated as if they had been passed.
+	if len(b.config.ParameterTransformers) > 0 {
+		details.RawParameters, err = b.transformProvisionParameters(ProvisionRequest{
+			InstanceID:    instanceID,
+			ServiceID:     details.ServiceID,
+			PlanID:        details.PlanID,
+			RawParameters: details.RawParameters,
+			RawContext:    details.RawContext,
+		})
+		if err != nil {
+			b.logger.Errorw("Failed to transform parameters", "error", err, "instance_id", instanceID)
+			return
+		}
+	}
+
+	// Editions are provisioned with the plans of the standard services.
+	serviceID, planID, editionName := b.resolveEdition(details.ServiceID, details.PlanID)
+
+	// An intent passed instead of a plan is resolved to the smallest plan
+	// satisfying it, which is provisioned and recorded as if requested.
+	if len(b.config.PlanIntents) > 0 {
+		provider, instanceSize, err := b.resolvePlanIntent(client, serviceID, details.RawParameters)
+		if err != nil {
+			b.logger.Errorw("Failed to resolve plan intent", "error", err, "instance_id", instanceID, "details", anonymizeProvisionDetails(details))
+			return spec, err
+		}
+
+		if instanceSize != nil {
+			planID = planIDForInstanceSize(provider, *instanceSize)
+			details.PlanID = planID
+			if editionName != "" {
+				details.PlanID = planIDForEdition(provider, editionName, *instanceSize)
+			}
+			b.logger.Infow("Resolved plan intent", "instance_id", instanceID, "plan_id", details.PlanID)
+		}
+	}
+
+	// Plans may require parameters to be passed rather than defaulted.
+	err = b.validateRequiredParameters(client, serviceID, planID, details.RawParameters)
+	if err != nil {
+		b.logger.Errorw("Required parameters missing", "error", err, "instance_id", instanceID, "details", anonymizeProvisionDetails(details))
+		return
+	}
+
+	err = b.validateParameterPatterns(details.RawParameters)
+	if err != nil {
+		b.logger.Errorw("Parameters don't match their patterns", "error", err, "instance_id", instanceID, "details", anonymizeProvisionDetails(details))
+		return
+	}
+
 	// Construct a cluster definition from the instance ID, service, plan, and params.
 
 	contextParams := &ContextParams{}
 	_ = json.Unmarshal(details.RawContext, contextParams)
-	instanceID = contextParams.InstanceName
+	clusterName := instanceID
+	if contextParams.InstanceName != "" {
+		clusterName = contextParams.InstanceName
+	}
 	b.logger.Infow("Here is proper cluster name", "instance_name", contextParams.InstanceName)
 	b.logger.Infof("Here is proper cluster name ---->%s<---", contextParams.InstanceName)
 	// TODO - add this context info about k8s/namespace or pcf space into labels
-	cluster, err := clusterFromParams(client, instanceID, details.ServiceID, details.PlanID, details.RawParameters)
+	cluster, err := clusterFromParams(client, clusterName, serviceID, planID, details.RawParameters)
+	if err != nil {
+		b.logger.Errorw("Couldn't create cluster from the passed parameters", "error", err, "instance_id", instanceID, "details", anonymizeProvisionDetails(details))
+		return
+	}
+
+	auditing, err := b.applyEditionDefaults(editionName, cluster, details.RawParameters)
+	if err != nil {
+		return
+	}
+
+	// Clusters are deployed to the provider's default region unless the
+	// parameters pick one.
+	b.applyDefaultRegion(cluster)
+
+	err = b.validateRegionAvailability(client, cluster)
+	if err != nil {
+		b.logger.Errorw("Instance size unavailable in the requested region", "error", err, "instance_id", instanceID, "details", anonymizeProvisionDetails(details))
+		return
+	}
+
+	err = b.validatePlanPolicy(cluster, details.RawContext)
+	if err != nil {
+		b.logger.Errorw("Plan not allowed by the plan policy", "error", err, "instance_id", instanceID, "details", anonymizeProvisionDetails(details))
+		return
+	}
+
+	err = b.validateApproval(cluster, details.RawParameters)
+	if err != nil {
+		b.logger.Errorw("Plan requires approval", "error", err, "instance_id", instanceID)
+		return
+	}
+
+	// Production tiers may require backups, which are enabled unless the
+	// parameters disable them.
+	err = b.enforceBackups(cluster, nil, cluster.ProviderSettings.InstanceSizeName, details.RawParameters)
+	if err != nil {
+		b.logger.Errorw("Backups required for the plan", "error", err, "instance_id", instanceID)
+		return
+	}
+
+	err = validateCapabilities(cluster, cluster.ProviderSettings.InstanceSizeName)
+	if err != nil {
+		b.logger.Errorw("Unsupported features requested", "error", err, "instance_id", instanceID, "details", anonymizeProvisionDetails(details))
+		return
+	}
+
+	err = b.validateDiskSize(client, cluster, details.PlanID, cluster.ProviderSettings.ProviderName, cluster.ProviderSettings.InstanceSizeName)
 	if err != nil {
-		b.logger.Errorw("Couldn't create cluster from the passed parameters", "error", err, "instance_id", instanceID, "details", details)
+		b.logger.Errorw("Disk size too large", "error", err, "instance_id", instanceID, "disk_size_gb", cluster.DiskSizeGB)
+		return
+	}
+
+	err = b.validateMongoDBVersion(instanceID, cluster)
+	if err != nil {
+		b.logger.Errorw("Deprecated MongoDB version requested", "error", err, "instance_id", instanceID, "mongodb_version", cluster.MongoDBMajorVersion)
+		return
+	}
+
+	// The replica set name can only be set when the cluster is created.
+	replicaSetName, err := replicaSetNameFromParams(details.RawParameters)
+	if err != nil {
+		return
+	}
+	if replicaSetName != "" {
+		err = validateReplicaSetName(replicaSetName, cluster)
+		if err != nil {
+			b.logger.Errorw("Invalid replica set name requested", "error", err, "instance_id", instanceID, "replica_set_name", replicaSetName)
+			return
+		}
+		cluster.ReplicaSetName = replicaSetName
+	}
+
+	// Search nodes can only be deployed once the cluster exists. They are
+	// validated now and deployed when polling the last operation.
+	searchNodes, err := searchNodesFromParams(details.RawParameters)
+	if err != nil {
+		return
+	}
+	if searchNodes != nil {
+		err = validateSearchNodes(searchNodes, cluster)
+		if err != nil {
+			b.logger.Errorw("Invalid search nodes requested", "error", err, "instance_id", instanceID, "search_nodes", searchNodes)
+			return
+		}
+	}
+
+	// Ephemeral instances may be limited to smaller instance sizes.
+	ephemeral, err := ephemeralFromParams(details.RawParameters)
+	if err != nil {
+		return
+	}
+	if ephemeral {
+		err = b.validateEphemeralInstanceSize(cluster)
+		if err != nil {
+			b.logger.Errorw("Invalid ephemeral instance requested", "error", err, "instance_id", instanceID, "details", anonymizeProvisionDetails(details))
+			return
+		}
+
+		// The quota is held until the instance has been recorded as
+		// ephemeral, so it's counted by the next provision.
+		unlock := b.lockEphemeralQuota()
+		defer unlock()
+
+		err = b.validateEphemeralQuota()
+		if err != nil {
+			b.logger.Errorw("Ephemeral instance quota reached", "error", err, "instance_id", instanceID)
+			return
+		}
+	}
+
+	// Ephemeral instances may be required to be deleted once unbound.
+	deleteWhenUnbound, err := deleteWhenUnboundFromParams(details.RawParameters)
+	if err != nil {
+		return
+	}
+	deleteWhenUnbound = deleteWhenUnbound || (ephemeral && b.config.EphemeralDeleteWhenUnbound)
+
+	// Labels required by the label policy are checked once the passed labels
+	// have been merged with those derived from the context and the defaults.
+	cluster.Labels = b.clusterLabels(cluster.Labels, contextParams)
+	err = b.validateLabelPolicy(cluster.Labels)
+	if err != nil {
+		b.logger.Errorw("Required labels missing", "error", err, "instance_id", instanceID, "labels", cluster.Labels)
+		return
+	}
+	if ephemeral {
+		cluster.Labels = append(cluster.Labels, b.ephemeralClusterLabel())
+	}
+
+	// Larger clusters take longer to create, so how long provisioning may take
+	// depends on the plan. Clusters aren't created once it has been exceeded.
+	timeout := b.provisionTimeout(details.PlanID, cluster.ProviderSettings.InstanceSizeName)
+	ctx, cancel = context.WithDeadline(ctx, started.Add(timeout))
+	defer cancel()
+	if ctx.Err() != nil {
+		b.logger.Errorw("Provision timeout exceeded before creating the cluster", "instance_id", instanceID, "timeout", timeout)
+		err = provisionTimeoutError(timeout)
 		return
 	}
 
-	// Add default labels
-	// TODO - append the env info k8s, pcf, etc
-	var defaultLabel = atlas.Label{Key: "Infrastructure Tool", Value: "MongoDB Atlas Service Broker"}
-	cluster.Labels = make([]atlas.Label, 1)
-	cluster.Labels[0] = defaultLabel
 	// Create a new Atlas cluster from the generated definition
 	resultingCluster, err := client.CreateCluster(*cluster)
 
 	if err != nil {
-		b.logger.Errorw("Failed to create Atlas cluster", "error", err, "cluster", cluster)
+		b.logger.Errorw("Failed to create Atlas cluster", "error", err, "cluster", anonymizeCluster(cluster))
 		err = atlasToAPIError(err)
 		return
 	}
 
-	b.logger.Infow("Successfully started Atlas creation process", "instance_id", instanceID, "cluster", resultingCluster)
+	err = b.recordCatalogEntry(instanceID, details.ServiceID, details.PlanID, resultingCluster.StateName)
+	if err != nil {
+		return
+	}
+
+	if projectID != "" {
+		err = b.setProjectID(instanceID, projectID)
+		if err != nil {
+			return
+		}
+	}
+
+	err = b.recordLabels(instanceID, cluster.Labels)
+	if err != nil {
+		return
+	}
+
+	if editionName != "" {
+		err = b.setEdition(instanceID, editionName)
+		if err != nil {
+			return
+		}
+	}
+
+	// Auditing is configured for the whole project, so it's enabled
+	// alongside the cluster rather than as part of it.
+	if auditing {
+		_, err = client.UpdateAuditing(atlas.Auditing{Enabled: true})
+		if err != nil {
+			b.logger.Errorw("Failed to enable auditing", "error", err, "instance_id", instanceID, "edition", editionName)
+			err = atlasToAPIError(err)
+			return
+		}
+	}
+
+	if searchNodes != nil {
+		err = b.setPendingSearchNodes(instanceID, *searchNodes)
+		if err != nil {
+			return
+		}
+	}
+
+	if ephemeral {
+		err = b.setEphemeral(instanceID)
+		if err != nil {
+			return
+		}
+
+		// The client is kept for the sweeper to delete the cluster once
+		// the instance expires.
+		if b.config.EphemeralTTL > 0 {
+			b.sweeper.remember(instanceID, client)
+		}
+	}
+
+	if deleteWhenUnbound {
+		err = b.setDeleteWhenUnbound(instanceID)
+		if err != nil {
+			return
+		}
+	}
+
+	if replicaSetName != "" {
+		err = b.setReplicaSetName(instanceID, replicaSetName)
+		if err != nil {
+			return
+		}
+	}
+
+	// The cluster has been created at this point, so failing to record its
+	// project is not fatal. The instance is returned without it instead.
+	if _, err := b.recordProject(client, instanceID); err != nil {
+		b.logger.Warnw("Failed to record the project of the instance", "error", err, "instance_id", instanceID)
+	}
+
+	// The cluster is reported as stuck once the same deadline has passed.
+	deadline, _ := ctx.Deadline()
+	err = b.setProvisionDeadline(instanceID, deadline, timeout)
+	if err != nil {
+		return
+	}
+
+	b.logger.Infow("Successfully started Atlas creation process", "instance_id", instanceID, "cluster", anonymizeCluster(resultingCluster))
+	b.recordInstanceOperation(OperationProvision, ephemeral)
 
 	return brokerapi.ProvisionedServiceSpec{
 		IsAsync:       true,
@@ -81,10 +396,25 @@ func (b Broker) Provision(ctx context.Context, instanceID string, details broker
 }
 
 // Update will change the configuration of an existing Atlas cluster asynchronously.
+// Retries of an identical request receive the original result.
 func (b Broker) Update(ctx context.Context, instanceID string, details brokerapi.UpdateDetails, asyncAllowed bool) (spec brokerapi.UpdateServiceSpec, err error) {
-	b.logger.Infow("Updating instance", "instance_id", instanceID, "details", details)
+	b.logger.Infow("Updating instance", "instance_id", instanceID, "details", anonymizeUpdateDetails(details))
 
-	client, err := atlasClientFromContext(ctx)
+	unlock, err := b.lockInstanceOperations(instanceID)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	err = b.idempotent(ctx, operationKey(OperationUpdate, instanceID), details, &spec, func() (err error) {
+		spec, err = b.update(ctx, instanceID, details, asyncAllowed)
+		return
+	})
+	return
+}
+
+func (b Broker) update(ctx context.Context, instanceID string, details brokerapi.UpdateDetails, asyncAllowed bool) (spec brokerapi.UpdateServiceSpec, err error) {
+	client, err := b.instanceClient(ctx, instanceID, details.RawContext)
 	if err != nil {
 		return
 	}
@@ -95,23 +425,150 @@ func (b Broker) Update(ctx context.Context, instanceID string, details brokerapi
 		return
 	}
 
+	prepared, err := b.prepareUpdate(client, instanceID, details)
+	if err != nil {
+		return
+	}
+	existingCluster, cluster, ephemeral := prepared.existingCluster, prepared.cluster, prepared.ephemeral
+
+	err = rejectDuringMaintenance(ctx, existingCluster)
+	if err != nil {
+		b.logger.Warnw("Rejected update during cluster maintenance", "instance_id", instanceID, "state", existingCluster.StateName)
+		return
+	}
+
+	err = rejectDuringOperation(existingCluster, OperationUpdate)
+	if err != nil {
+		b.logger.Warnw("Rejected update during cluster operation", "instance_id", instanceID, "state", existingCluster.StateName)
+		return
+	}
+
+	err = b.clearPartialUpdate(instanceID)
+	if err != nil {
+		return
+	}
+
+	// Updates may replace the nodes of the cluster, which is detected by
+	// comparing the hosts once the update has completed.
+	err = b.recordHosts(instanceID, existingCluster)
+	if err != nil {
+		return
+	}
+
+	var resultingCluster *atlas.Cluster
+	if cluster.Name != existingCluster.Name {
+		resultingCluster, err = b.renameCluster(client, instanceID, existingCluster.Name, cluster)
+	} else {
+		resultingCluster, err = client.UpdateCluster(*cluster)
+	}
+	if err != nil {
+		b.logger.Errorw("Failed to update Atlas cluster", "error", err, "cluster", anonymizeCluster(cluster))
+		err = atlasToAPIError(err)
+		return
+	}
+
+	// Search nodes are deployed once Atlas has accepted the cluster change,
+	// so a rejected change leaves them as they are. If they fail, the
+	// cluster change is kept or rolled back depending on the policy.
+	if searchNodes := prepared.searchNodes; searchNodes != nil {
+		err = deploySearchNodes(client, resultingCluster.Name, *searchNodes)
+		if err != nil {
+			b.logger.Errorw("Failed to deploy search nodes", "error", err, "instance_id", instanceID, "search_nodes", searchNodes)
+
+			partial := state.PartialUpdate{
+				Succeeded: []string{updatePartCluster},
+				Failed:    []string{updatePartSearchNodes},
+				Error:     searchNodesToAPIError(err).Error(),
+			}
+			var rolledBack bool
+			rolledBack, err = b.partiallyUpdated(instanceID, partial, func() error {
+				return b.rollbackCluster(client, instanceID, existingCluster, resultingCluster)
+			})
+			if err != nil || rolledBack {
+				return brokerapi.UpdateServiceSpec{IsAsync: true, OperationData: OperationUpdate}, err
+			}
+		}
+	}
+
+	// The update has started at this point, so failing to record its
+	// changes is not fatal.
+	if err := b.recordParameterChanges(ctx, instanceID, existingCluster, cluster, details.PlanID); err != nil {
+		b.logger.Warnw("Failed to record the parameter changes of the instance", "error", err, "instance_id", instanceID)
+	}
+
+	err = b.recordCatalogEntry(instanceID, details.ServiceID, details.PlanID, resultingCluster.StateName)
+	if err != nil {
+		return
+	}
+
+	// Atlas keeps the labels of the cluster unless the update passes some.
+	if len(cluster.Labels) > 0 {
+		err = b.recordLabels(instanceID, cluster.Labels)
+		if err != nil {
+			return
+		}
+	}
+
+	b.logger.Infow("Successfully started Atlas cluster update process", "instance_id", instanceID, "cluster", anonymizeCluster(resultingCluster))
+	b.recordInstanceOperation(OperationUpdate, ephemeral)
+
+	return brokerapi.UpdateServiceSpec{
+		IsAsync:       true,
+		OperationData: OperationUpdate,
+		DashboardURL:  client.GetDashboardURL(resultingCluster.Name),
+	}, nil
+}
+
+// preparedUpdate is a validated update of a cluster which hasn't been
+// applied yet.
+type preparedUpdate struct {
+	existingCluster *atlas.Cluster
+	cluster         *atlas.Cluster
+	searchNodes     *atlas.SearchNodeSpec
+	ephemeral       bool
+}
+
+// prepareUpdate builds the cluster definition of an update and validates it
+// without changing anything, so updates can be previewed.
+func (b Broker) prepareUpdate(client atlas.Client, instanceID string, details brokerapi.UpdateDetails) (*preparedUpdate, error) {
 	// Fetch the cluster from Atlas. The Atlas API requires an instance size to
 	// be passed during updates (if there are other update to the provider, such
 	// as region). The plan is not included in the OSB call unless it has changed
 	// hence we need to fetch the current value from Atlas.
-	existingCluster, err := client.GetCluster(NormalizeClusterName(instanceID))
+	existingCluster, err := b.getInstanceCluster(client, instanceID)
 	if err != nil {
-		err = atlasToAPIError(err)
-		return
+		return nil, atlasToAPIError(err)
 	}
 
 	// Construct a cluster from the instance ID, service, plan, and params.
-	contextParams := &ContextParams{}
-	_ = json.Unmarshal(details.RawContext, contextParams)
+	// Plans whose instance size Atlas no longer offers are updated to their
+	// successor.
+	serviceID, planID, _ := b.resolveEdition(details.ServiceID, details.PlanID)
+	planID = b.withFallbackPlanID(client, serviceID, planID)
+	cluster, err := clusterFromParams(client, instanceID, serviceID, planID, details.RawParameters)
+	if err != nil {
+		return nil, err
+	}
 
-	cluster, err := clusterFromParams(client, instanceID, details.ServiceID, details.PlanID, contextParams.InstanceName, details.RawParameters)
+	// Renamed clusters keep their name unless it's changed again.
+	cluster.Name = existingCluster.Name
+	clusterName, err := clusterNameFromParams(details.RawParameters)
 	if err != nil {
-		return
+		return nil, err
+	}
+	if clusterName != "" && clusterName != existingCluster.Name {
+		err = b.validateClusterRename(existingCluster, clusterName)
+		if err != nil {
+			b.logger.Errorw("Cluster can't be renamed", "error", err, "instance_id", instanceID, "cluster_name", clusterName)
+			return nil, err
+		}
+		cluster.Name = clusterName
+	}
+
+	err = b.validateReplicaSetNameUpdate(instanceID, details.RawParameters)
+	if err != nil {
+		b.logger.Errorw("Replica set name can't be changed", "error", err, "instance_id", instanceID, "details", anonymizeUpdateDetails(details))
+		return nil, err
 	}
 
 	// Make sure the cluster provider has all the neccessary params for the
@@ -126,29 +583,116 @@ func (b Broker) Update(ctx context.Context, instanceID string, details brokerapi
 		if cluster.ProviderSettings.InstanceSizeName == "" {
 			cluster.ProviderSettings.InstanceSizeName = existingCluster.ProviderSettings.InstanceSizeName
 		}
+
+		// Only plan changes are subject to the plan policy and approval, so
+		// instances aren't locked by a policy introduced after they were
+		// provisioned.
+		if cluster.ProviderSettings.InstanceSizeName != existingCluster.ProviderSettings.InstanceSizeName {
+			err = b.validatePlanPolicy(cluster, details.RawContext)
+			if err != nil {
+				b.logger.Errorw("Plan not allowed by the plan policy", "error", err, "instance_id", instanceID, "details", anonymizeUpdateDetails(details))
+				return nil, err
+			}
+
+			err = b.validateApproval(cluster, details.RawParameters)
+			if err != nil {
+				b.logger.Errorw("Plan requires approval", "error", err, "instance_id", instanceID)
+				return nil, err
+			}
+		}
 	}
 
-	resultingCluster, err := client.UpdateCluster(*cluster)
+	// Features are validated against the tier the cluster is updated to.
+	instanceSizeName := existingCluster.ProviderSettings.InstanceSizeName
+	if cluster.ProviderSettings != nil {
+		instanceSizeName = cluster.ProviderSettings.InstanceSizeName
+	}
+	// Backups are enforced for the tier the cluster is updated to.
+	err = b.enforceBackups(cluster, existingCluster, instanceSizeName, details.RawParameters)
 	if err != nil {
-		b.logger.Errorw("Failed to update Atlas cluster", "error", err, "cluster", cluster)
-		err = atlasToAPIError(err)
-		return
+		b.logger.Errorw("Backups required for the plan", "error", err, "instance_id", instanceID)
+		return nil, err
 	}
 
-	b.logger.Infow("Successfully started Atlas cluster update process", "instance_id", instanceID, "cluster", resultingCluster)
+	err = validateCapabilities(cluster, instanceSizeName)
+	if err != nil {
+		b.logger.Errorw("Unsupported features requested", "error", err, "instance_id", instanceID, "details", anonymizeUpdateDetails(details))
+		return nil, err
+	}
 
-	return brokerapi.UpdateServiceSpec{
-		IsAsync:       true,
-		OperationData: OperationUpdate,
-		DashboardURL:  client.GetDashboardURL(resultingCluster.Name),
+	// Disk sizes are validated against the plan the cluster is updated to.
+	providerName := existingCluster.ProviderSettings.ProviderName
+	if cluster.ProviderSettings != nil {
+		providerName = cluster.ProviderSettings.ProviderName
+	}
+	err = b.validateDiskSize(client, cluster, details.PlanID, providerName, instanceSizeName)
+	if err != nil {
+		b.logger.Errorw("Disk size too large", "error", err, "instance_id", instanceID, "disk_size_gb", cluster.DiskSizeGB)
+		return nil, err
+	}
+
+	// Ephemeral instances can't be scaled past their maximum instance size.
+	ephemeral := b.isEphemeralCluster(existingCluster)
+	if ephemeral && cluster.ProviderSettings != nil {
+		err = b.validateEphemeralInstanceSize(cluster)
+		if err != nil {
+			b.logger.Errorw("Invalid ephemeral instance update requested", "error", err, "instance_id", instanceID, "details", anonymizeUpdateDetails(details))
+			return nil, err
+		}
+	}
+
+	// Search nodes are validated against the tier the cluster is updated to.
+	searchNodes, err := searchNodesFromParams(details.RawParameters)
+	if err != nil {
+		return nil, err
+	}
+	if searchNodes != nil {
+		tier := existingCluster
+		if cluster.ProviderSettings != nil {
+			tier = cluster
+		}
+
+		err = validateSearchNodes(searchNodes, tier)
+		if err != nil {
+			b.logger.Errorw("Invalid search nodes requested", "error", err, "instance_id", instanceID, "search_nodes", searchNodes)
+			return nil, err
+		}
+	}
+
+	return &preparedUpdate{
+		existingCluster: existingCluster,
+		cluster:         cluster,
+		searchNodes:     searchNodes,
+		ephemeral:       ephemeral,
 	}, nil
 }
 
-// Deprovision will destroy an Atlas cluster asynchronously.
+// Deprovision will destroy an Atlas cluster asynchronously. Retries of an
+// identical request receive the original result.
 func (b Broker) Deprovision(ctx context.Context, instanceID string, details brokerapi.DeprovisionDetails, asyncAllowed bool) (spec brokerapi.DeprovisionServiceSpec, err error) {
 	b.logger.Infow("Deprovisioning instance", "instance_id", instanceID, "details", details)
 
-	client, err := atlasClientFromContext(ctx)
+	unlock, err := b.lockInstanceOperations(instanceID)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	err = b.idempotent(ctx, operationKey(OperationDeprovision, instanceID), details, &spec, func() (err error) {
+		spec, err = b.deprovision(ctx, instanceID, details, asyncAllowed)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	// A new instance with the same ID may be provisioned once this one is gone.
+	b.forgetOperations(operationKey(OperationProvision, instanceID), operationKey(OperationUpdate, instanceID))
+	return
+}
+
+func (b Broker) deprovision(ctx context.Context, instanceID string, details brokerapi.DeprovisionDetails, asyncAllowed bool) (spec brokerapi.DeprovisionServiceSpec, err error) {
+	client, err := b.instanceClient(ctx, instanceID, nil)
 	if err != nil {
 		return
 	}
@@ -159,59 +703,260 @@ func (b Broker) Deprovision(ctx context.Context, instanceID string, details brok
 		return
 	}
 
-	err = client.DeleteCluster(NormalizeClusterName(instanceID))
+	ephemeral, err := b.isEphemeral(instanceID)
+	if err != nil {
+		return
+	}
+
+	// Clusters which are already gone are left to the deletion to report.
+	cluster, err := b.getInstanceCluster(client, instanceID)
+	if err != nil && err != atlas.ErrClusterNotFound {
+		b.logger.Errorw("Failed to get existing cluster", "error", err, "instance_id", instanceID)
+		err = atlasToAPIError(err)
+		return
+	}
+	if cluster != nil {
+		err = rejectDuringMaintenance(ctx, cluster)
+		if err != nil {
+			b.logger.Warnw("Rejected deprovision during cluster maintenance", "instance_id", instanceID, "state", cluster.StateName)
+			return
+		}
+
+		err = rejectDuringOperation(cluster, OperationDeprovision)
+		if err != nil {
+			b.logger.Warnw("Rejected deprovision during cluster operation", "instance_id", instanceID, "state", cluster.StateName)
+			return
+		}
+	}
+
+	clusterName := b.clusterName(instanceID)
+	err = client.DeleteCluster(clusterName)
 	if err != nil {
 		b.logger.Errorw("Failed to delete Atlas cluster", "error", err, "instance_id", instanceID)
 		err = atlasToAPIError(err)
 		return
 	}
 
+	// The record is removed before the deletion completes, so polls are
+	// passed the project of instances in resolved projects and the name of
+	// renamed clusters.
+	var projectID string
+	if b.config.ProjectResolver != nil {
+		if instance, err := b.store.GetInstance(instanceID); err == nil {
+			projectID = instance.ProjectID
+		}
+	}
+	if clusterName == NormalizeClusterName(instanceID) {
+		clusterName = ""
+	}
+	operationData := withOperationTarget(OperationDeprovision, projectID, clusterName)
+
+	b.store.DeleteInstance(instanceID)
+	b.sweeper.forget(instanceID)
+
 	b.logger.Infow("Successfully started Atlas cluster deletion process", "instance_id", instanceID)
+	b.recordInstanceOperation(OperationDeprovision, ephemeral)
 
 	return brokerapi.DeprovisionServiceSpec{
 		IsAsync:       true,
-		OperationData: OperationDeprovision,
+		OperationData: operationData,
 	}, nil
 }
 
-// GetInstance is currently not supported as specified by the
-// InstancesRetrievable setting in the service catalog.
+// GetInstance will fetch the configuration of an Atlas cluster. The
+// parameters include the cluster, its dedicated search nodes, the Atlas
+// project and organization, a pending auto-termination, a health summary,
+// whether Atlas is maintaining the cluster, and the connection limit of its
+// instance size.
 func (b Broker) GetInstance(ctx context.Context, instanceID string) (spec brokerapi.GetInstanceDetailsSpec, err error) {
 	b.logger.Infow("Fetching instance", "instance_id", instanceID)
-	err = brokerapi.NewFailureResponse(fmt.Errorf("Unknown instance ID %s", instanceID), 404, "get-instance")
+
+	client, err := b.instanceClient(ctx, instanceID, nil)
+	if err != nil {
+		return
+	}
+
+	cluster, err := b.getInstanceCluster(client, instanceID)
+	if err == atlas.ErrClusterNotFound {
+		err = brokerapi.NewFailureResponse(fmt.Errorf("Unknown instance ID %s", instanceID), 404, "get-instance")
+		return
+	}
+	if err != nil {
+		b.logger.Errorw("Failed to get existing cluster", "error", err, "instance_id", instanceID)
+		err = atlasToAPIError(err)
+		return
+	}
+
+	searchNodes, err := b.searchNodesStatusForInstance(client, instanceID, cluster)
+	if err != nil {
+		b.logger.Errorw("Failed to get search nodes", "error", err, "instance_id", instanceID)
+		err = atlasToAPIError(err)
+		return
+	}
+
+	params := map[string]interface{}{
+		"cluster":     cluster,
+		"searchNodes": searchNodes,
+		"ephemeral":   b.isEphemeralCluster(cluster),
+		"maintenance": clusterMaintenance(cluster),
+	}
+
+	// The project is informational, the instance is still returned without
+	// it if it isn't known.
+	projectID, orgID, err := b.instanceProject(instanceID)
+	switch {
+	case err != nil:
+		b.logger.Warnw("Failed to get the project of the instance", "error", err, "instance_id", instanceID)
+		err = nil
+	case projectID == "":
+		b.logger.Warnw("The project of the instance isn't recorded", "instance_id", instanceID)
+	default:
+		params["project_id"] = projectID
+		if orgID != "" {
+			params["org_id"] = orgID
+		}
+	}
+
+	autoTermination, err := b.autoTermination(instanceID)
+	if err != nil {
+		return
+	}
+	if autoTermination != nil {
+		params["auto_termination"] = autoTermination
+	}
+
+	// The health summary is best effort, the instance is still returned if
+	// it can't be determined.
+	health, err := clusterHealth(client, cluster)
+	if err != nil {
+		b.logger.Warnw("Failed to get cluster health", "error", err, "instance_id", instanceID)
+		err = nil
+	} else {
+		params["health"] = health
+	}
+
+	if b.config.IncludeBindings {
+		bindings, err := b.bindingSummaries(instanceID)
+		if err != nil {
+			return spec, err
+		}
+		params["bindings"] = bindings
+	}
+
+	if b.config.IncludeParameterHistory {
+		history, err := b.parameterHistory(instanceID)
+		if err != nil && err != state.ErrNotFound {
+			return spec, err
+		}
+		params["parameter_history"] = history
+	}
+
+	if b.config.CostTable != nil {
+		params["estimated_monthly_cost"] = b.config.CostTable.estimate(cluster)
+	}
+
+	if cluster.ProviderSettings != nil {
+		provider := &atlas.Provider{Name: cluster.ProviderSettings.ProviderName}
+		instanceSize := atlas.InstanceSize{Name: cluster.ProviderSettings.InstanceSizeName}
+		params["connectionLimit"] = atlas.ConnectionLimit(instanceSize.Name)
+
+		// Instances whose instance size Atlas no longer offers are reported
+		// with the plan of its successor, or flagged as orphaned.
+		if fallback := b.instanceSizeFallbackForCluster(client, instanceID, cluster); fallback != nil {
+			params["instance_size_fallback"] = fallback
+			if fallback.Successor != "" {
+				instanceSize.Name = fallback.Successor
+			}
+		}
+
+		spec.ServiceID = serviceIDForProvider(provider)
+		spec.PlanID = planIDForInstanceSize(provider, instanceSize)
+
+		// Instances provisioned with an edition are reported with its IDs.
+		serviceID, planID, err := b.editionIDs(instanceID, provider, instanceSize)
+		if err != nil {
+			return spec, err
+		}
+		if serviceID != "" {
+			spec.ServiceID = serviceID
+			spec.PlanID = planID
+		}
+	}
+
+	spec.DashboardURL = client.GetDashboardURL(cluster.Name)
+	spec.Parameters = params
 	return
 }
 
 // LastOperation should fetch the state of the provision/deprovision
-// of a cluster.
+// of a cluster. Provisions and updates also wait for dedicated search nodes.
 func (b Broker) LastOperation(ctx context.Context, instanceID string, details brokerapi.PollDetails) (resp brokerapi.LastOperation, err error) {
 	b.logger.Infow("Fetching state of last operation", "instance_id", instanceID, "details", details)
 
-	client, err := atlasClientFromContext(ctx)
+	// Deprovisions pass the project and the cluster name along, as the
+	// record of the instance has already been removed.
+	operation, projectID, clusterName := splitOperationTarget(details.OperationData)
+	var client atlas.Client
+	if projectID != "" {
+		client, err = b.atlasClientFromContext(ctx)
+		if err == nil {
+			client, err = clientForProject(client, projectID)
+		}
+	} else {
+		client, err = b.instanceClient(ctx, instanceID, nil)
+	}
 	if err != nil {
 		return
 	}
 
-	cluster, err := client.GetCluster(NormalizeClusterName(instanceID))
+	var cluster *atlas.Cluster
+	if operation == OperationDeprovision {
+		if clusterName == "" {
+			clusterName = b.clusterName(instanceID)
+		}
+		cluster, err = client.GetCluster(clusterName)
+	} else {
+		cluster, err = b.getInstanceCluster(client, instanceID)
+	}
 	if err != nil && err != atlas.ErrClusterNotFound {
 		b.logger.Errorw("Failed to get existing cluster", "error", err, "instance_id", instanceID)
 		err = atlasToAPIError(err)
 		return
 	}
 
-	b.logger.Infow("Found existing cluster", "cluster", cluster)
+	b.logger.Infow("Found existing cluster", "cluster", anonymizeCluster(cluster))
 
 	state := brokerapi.LastOperationState(brokerapi.Failed)
+	description := ""
+	var stateErr error
 
-	switch details.OperationData {
+	switch operation {
 	case OperationProvision:
 		switch cluster.StateName {
-		// Provision has succeeded if the cluster is in state "idle".
+		// Provision has succeeded if the cluster is in state "idle" and its
+		// search nodes, if any, are ready.
 		case atlas.ClusterStateIdle:
-			state = brokerapi.Succeeded
+			state, description, stateErr = b.searchNodesOperationState(client, instanceID, cluster)
 		case atlas.ClusterStateCreating:
 			state = brokerapi.InProgress
 		}
+
+		// Fail provisions which are stuck instead of polling forever.
+		if state == brokerapi.InProgress && stateErr == nil {
+			var timedOut bool
+			var timeoutDescription string
+			timedOut, timeoutDescription, stateErr = b.provisionTimedOut(instanceID)
+			if timedOut {
+				b.logger.Errorw("Provisioning timed out", "instance_id", instanceID, "cluster", anonymizeCluster(cluster))
+				state = brokerapi.Failed
+				description = timeoutDescription
+			}
+		}
+
+		// Owners see the cost of the cluster as soon as it's being created.
+		if state != brokerapi.Failed && description == "" {
+			description = b.costEstimateDescription(cluster)
+		}
 	case OperationDeprovision:
 		// The Atlas API may return a 404 response if a cluster is deleted or it
 		// will return the cluster with a state of "DELETED". Both of these
@@ -222,18 +967,43 @@ func (b Broker) LastOperation(ctx context.Context, instanceID string, details br
 			state = brokerapi.InProgress
 		}
 	case OperationUpdate:
+		// Partially applied updates have failed regardless of the cluster.
+		var partial bool
+		partial, description, stateErr = b.partialUpdateOperationState(instanceID)
+		if partial || stateErr != nil {
+			break
+		}
+
 		// We assume that the cluster transitions to the "UPDATING" state
 		// in a synchronous manner during the update request.
 		switch cluster.StateName {
 		case atlas.ClusterStateIdle:
-			state = brokerapi.Succeeded
+			state, description, stateErr = b.searchNodesOperationState(client, instanceID, cluster)
 		case atlas.ClusterStateUpdating:
 			state = brokerapi.InProgress
 		}
+
+		if state == brokerapi.Succeeded && stateErr == nil {
+			b.handleTopologyChange(instanceID, cluster)
+		}
+	}
+
+	if stateErr != nil {
+		b.logger.Errorw("Failed to get state of last operation", "error", stateErr, "instance_id", instanceID)
+		err = atlasToAPIError(stateErr)
+		return
+	}
+
+	// The record of deprovisioned instances has already been removed.
+	if operation != OperationDeprovision && cluster != nil {
+		if err := b.recordCatalogEntry(instanceID, "", "", cluster.StateName); err != nil {
+			b.logger.Warnw("Failed to record the cluster state of the instance", "error", err, "instance_id", instanceID)
+		}
 	}
 
 	return brokerapi.LastOperation{
-		State: state,
+		State:       state,
+		Description: description,
 	}, nil
 }
 
@@ -266,7 +1036,7 @@ func clusterFromParams(client atlas.Client, instanceID string, serviceID string,
 	if len(rawParams) > 0 {
 		err := json.Unmarshal(rawParams, &params)
 		if err != nil {
-			return nil, err
+			return nil, newInvalidParamsError(err)
 		}
 	}
 
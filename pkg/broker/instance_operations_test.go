@@ -1,6 +1,7 @@
 package broker
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
@@ -112,8 +113,9 @@ func TestProvisionParams(t *testing.T) {
 	}}`
 
 	instanceID := "instance"
+	// Sharded clusters require M30 or larger.
 	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
-		PlanID:        testPlanID,
+		PlanID:        "aosb-cluster-plan-aws-m30",
 		ServiceID:     testServiceID,
 		RawParameters: []byte(params),
 	}, true)
@@ -124,6 +126,7 @@ func TestProvisionParams(t *testing.T) {
 		StateName: "CREATING",
 
 		Name:                     instanceID,
+		Labels:                   []atlas.Label{atlas.Label{Key: "Infrastructure Tool", Value: "MongoDB Atlas Service Broker"}},
 		AutoScaling:              atlas.AutoScalingConfig{DiskGBEnabled: true},
 		BackupEnabled:            true,
 		BIConnector:              atlas.BIConnectorConfig{Enabled: true, ReadPreference: "primary"},
@@ -150,7 +153,7 @@ func TestProvisionParams(t *testing.T) {
 		},
 		ProviderSettings: &atlas.ProviderSettings{
 			ProviderName:     "AWS",
-			InstanceSizeName: "M10",
+			InstanceSizeName: "M30",
 			RegionName:       "EU_CENTRAL_1",
 			DiskIOPS:         10,
 			DiskTypeName:     "P4",
@@ -174,15 +177,42 @@ func TestProvisionAlreadyExisting(t *testing.T) {
 		ServiceID: testServiceID,
 	}, true)
 
-	// Try provisioning a second instance with the same ID
+	// Try provisioning a second, different, instance with the same ID
 	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
-		PlanID:    testPlanID,
+		PlanID:    "aosb-cluster-plan-aws-m20",
 		ServiceID: testServiceID,
 	}, true)
 
 	assert.EqualError(t, err, apiresponses.ErrInstanceAlreadyExists.Error())
 }
 
+func TestProvisionReplay(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	details := brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}
+
+	res, err := broker.Provision(ctx, instanceID, details, true)
+	assert.NoError(t, err)
+
+	// Retrying the identical request should return the original result.
+	replayed, err := broker.Provision(ctx, instanceID, details, true)
+	assert.NoError(t, err)
+	assert.Equal(t, res, replayed)
+	assert.Len(t, client.Clusters, 1)
+
+	// Once deprovisioned the same request should create a new cluster.
+	_, err = broker.Deprovision(ctx, instanceID, brokerapi.DeprovisionDetails{}, true)
+	assert.NoError(t, err)
+
+	_, err = broker.Provision(ctx, instanceID, details, true)
+	assert.NoError(t, err)
+	assert.NotNil(t, client.Clusters[instanceID], "Expected cluster to have been recreated")
+}
+
 func TestUpdate(t *testing.T) {
 	broker, client, ctx := setupTest()
 
@@ -191,6 +221,7 @@ func TestUpdate(t *testing.T) {
 		ServiceID: testServiceID,
 		PlanID:    testPlanID,
 	}, true)
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
 
 	res, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
 		PlanID:    "aosb-cluster-plan-aws-m20",
@@ -227,6 +258,7 @@ func TestUpdateWithoutPlan(t *testing.T) {
 		PlanID:        testPlanID,
 		RawParameters: []byte(params),
 	}, true)
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
 
 	cluster := client.Clusters[instanceID]
 	assert.Equal(t, "M10", cluster.ProviderSettings.InstanceSizeName)
@@ -386,3 +418,32 @@ func TestLastOperationDeprovision(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, brokerapi.Succeeded, resp.State)
 }
+
+func TestProvisionInvalidPlanHint(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    "aosb-cluster-plan-aws-m1000",
+		ServiceID: testServiceID,
+	}, true)
+
+	assert.EqualError(t, err, "Invalid plan ID. Remediation: pick a plan listed in the catalog for this service")
+	assert.Equal(t, http.StatusBadRequest, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+}
+
+func TestProvisionInvalidParamsHint(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": "M10"}`),
+	}, true)
+
+	if !assert.Error(t, err) {
+		return
+	}
+	assert.Contains(t, err.Error(), "Invalid parameters")
+	assert.Contains(t, err.Error(), `Remediation: pass parameters as a JSON object`)
+	assert.Equal(t, http.StatusBadRequest, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+}
@@ -0,0 +1,118 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// InstanceSizeExclusion excludes the instance sizes returned by Atlas which
+// match all of its set attributes, for example sizes with more than 256 GB of
+// RAM or NVMe variants. Unset attributes match all sizes.
+type InstanceSizeExclusion struct {
+	// Providers limits the exclusion to some providers. All providers are
+	// matched if empty.
+	Providers []string `json:"providers,omitempty"`
+
+	// NameContains matches sizes whose name contains the value, for example
+	// "NVME".
+	NameContains string `json:"nameContains,omitempty"`
+
+	// RAMSizeGBAbove and RAMSizeGBBelow match sizes with more or less RAM
+	// than the value.
+	RAMSizeGBAbove float64 `json:"ramSizeGBAbove,omitempty"`
+	RAMSizeGBBelow float64 `json:"ramSizeGBBelow,omitempty"`
+
+	// NumCPUsAbove and NumCPUsBelow match sizes with more or fewer CPUs than
+	// the value.
+	NumCPUsAbove float64 `json:"numCpusAbove,omitempty"`
+	NumCPUsBelow float64 `json:"numCpusBelow,omitempty"`
+}
+
+// dedicatedProviderNames are the providers whose instance sizes are fetched
+// from Atlas, and can be excluded.
+var dedicatedProviderNames = []string{"AWS", "GCP", "AZURE"}
+
+// Validate returns an error if the exclusion references unknown providers or
+// has no attributes, which would exclude all sizes.
+func (e InstanceSizeExclusion) Validate() error {
+	for _, providerName := range e.Providers {
+		if !containsString(dedicatedProviderNames, providerName) {
+			return fmt.Errorf(`unknown provider "%s", valid providers are %s`, providerName, strings.Join(dedicatedProviderNames, ", "))
+		}
+	}
+
+	if e.NameContains == "" && e.RAMSizeGBAbove == 0 && e.RAMSizeGBBelow == 0 && e.NumCPUsAbove == 0 && e.NumCPUsBelow == 0 {
+		return errors.New("no attributes to match, set at least one of nameContains, ramSizeGBAbove, ramSizeGBBelow, numCpusAbove, or numCpusBelow")
+	}
+
+	return nil
+}
+
+// matches returns whether an instance size of a provider is excluded. Sizes
+// for which Atlas returned no RAM or CPU data aren't matched by thresholds.
+func (e InstanceSizeExclusion) matches(providerName string, instanceSize atlas.InstanceSize) bool {
+	return (len(e.Providers) == 0 || containsString(e.Providers, providerName)) &&
+		(e.NameContains == "" || strings.Contains(instanceSize.Name, e.NameContains)) &&
+		(e.RAMSizeGBAbove == 0 || instanceSize.RAMSizeGB > e.RAMSizeGBAbove) &&
+		(e.RAMSizeGBBelow == 0 || (instanceSize.RAMSizeGB > 0 && instanceSize.RAMSizeGB < e.RAMSizeGBBelow)) &&
+		(e.NumCPUsAbove == 0 || instanceSize.NumCPUs > e.NumCPUsAbove) &&
+		(e.NumCPUsBelow == 0 || (instanceSize.NumCPUs > 0 && instanceSize.NumCPUs < e.NumCPUsBelow))
+}
+
+// excludeInstanceSizes returns a copy of a provider without the instance
+// sizes matching any of the exclusions. The provider is returned as is if
+// there are no exclusions, as providers may be shared through the cache.
+func excludeInstanceSizes(providerName string, provider *atlas.Provider, exclusions []InstanceSizeExclusion) *atlas.Provider {
+	if len(exclusions) == 0 {
+		return provider
+	}
+
+	filtered := *provider
+	filtered.InstanceSizes = make(map[string]atlas.InstanceSize)
+
+	for name, instanceSize := range provider.InstanceSizes {
+		excluded := false
+		for _, exclusion := range exclusions {
+			if exclusion.matches(providerName, instanceSize) {
+				excluded = true
+				break
+			}
+		}
+
+		if !excluded {
+			filtered.InstanceSizes[name] = instanceSize
+		}
+	}
+
+	return &filtered
+}
+
+// ReadInstanceSizeExclusionsFile will read and validate instance size
+// exclusions from a JSON file, for example
+// [{"ramSizeGBAbove": 256}, {"providers": ["AWS"], "nameContains": "NVME"}].
+func ReadInstanceSizeExclusionsFile(path string) ([]InstanceSizeExclusion, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var exclusions []InstanceSizeExclusion
+	err = json.Unmarshal(data, &exclusions)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, exclusion := range exclusions {
+		err = exclusion.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid instance size exclusion %d: %v", i, err)
+		}
+	}
+
+	return exclusions, nil
+}
@@ -0,0 +1,99 @@
+package broker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func instanceSizeNames(provider *atlas.Provider) []string {
+	names := []string{}
+	for name := range provider.InstanceSizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestExcludeInstanceSizesByRAM(t *testing.T) {
+	provider := &atlas.Provider{
+		Name: "AWS",
+		InstanceSizes: map[string]atlas.InstanceSize{
+			"M10":      atlas.InstanceSize{Name: "M10", RAMSizeGB: 2},
+			"M30":      atlas.InstanceSize{Name: "M30", RAMSizeGB: 8},
+			"M200":     atlas.InstanceSize{Name: "M200", RAMSizeGB: 256},
+			"M400":     atlas.InstanceSize{Name: "M400", RAMSizeGB: 512},
+			"M40_NVME": atlas.InstanceSize{Name: "M40_NVME", RAMSizeGB: 16},
+		},
+	}
+
+	// Thresholds are exclusive.
+	filtered := excludeInstanceSizes("AWS", provider, []InstanceSizeExclusion{{RAMSizeGBAbove: 256}})
+	assert.Equal(t, []string{"M10", "M200", "M30", "M40_NVME"}, instanceSizeNames(filtered))
+
+	filtered = excludeInstanceSizes("AWS", provider, []InstanceSizeExclusion{{RAMSizeGBBelow: 8}, {NameContains: "NVME"}})
+	assert.Equal(t, []string{"M200", "M30", "M400"}, instanceSizeNames(filtered))
+
+	// All set attributes must match.
+	filtered = excludeInstanceSizes("AWS", provider, []InstanceSizeExclusion{{RAMSizeGBAbove: 4, RAMSizeGBBelow: 300}})
+	assert.Equal(t, []string{"M10", "M400"}, instanceSizeNames(filtered))
+
+	filtered = excludeInstanceSizes("AWS", provider, []InstanceSizeExclusion{{Providers: []string{"GCP"}, RAMSizeGBAbove: 4}})
+	assert.Len(t, filtered.InstanceSizes, 5)
+
+	// The original provider may be cached, so it's left as is.
+	assert.Len(t, provider.InstanceSizes, 5)
+}
+
+func TestInstanceSizeExclusionsCatalog(t *testing.T) {
+	_, _, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		Whitelist:              Whitelist{"AWS": []string{"M10", "M20", "M30"}},
+		InstanceSizeExclusions: []InstanceSizeExclusion{{RAMSizeGBBelow: 4, Providers: []string{"AWS"}}},
+	})
+
+	// The mock M10 has 2 GB of RAM, the other sizes have no data.
+	services, err := broker.Services(ctx)
+	if !assert.NoError(t, err) || !assert.Len(t, services, 1) {
+		return
+	}
+	assert.Equal(t, []string{"M20", "M30"}, planNames(services[0].Plans))
+
+	// Excluded sizes can't be provisioned either.
+	_, err = broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.Error(t, err)
+}
+
+func TestReadInstanceSizeExclusionsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exclusions")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "exclusions.json")
+	ioutil.WriteFile(path, []byte(`[{"ramSizeGBAbove": 256}, {"providers": ["AWS"], "nameContains": "NVME"}]`), 0600)
+
+	exclusions, err := ReadInstanceSizeExclusionsFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []InstanceSizeExclusion{{RAMSizeGBAbove: 256}, {Providers: []string{"AWS"}, NameContains: "NVME"}}, exclusions)
+
+	ioutil.WriteFile(path, []byte(`[{"providers": ["AWS"]}]`), 0600)
+	_, err = ReadInstanceSizeExclusionsFile(path)
+	assert.Error(t, err)
+
+	ioutil.WriteFile(path, []byte(`[{"providers": ["TENANT"], "ramSizeGBAbove": 1}]`), 0600)
+	_, err = ReadInstanceSizeExclusionsFile(path)
+	assert.EqualError(t, err, `invalid instance size exclusion 0: unknown provider "TENANT", valid providers are AWS, GCP, AZURE`)
+}
@@ -0,0 +1,144 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// InstanceSizeFallbacks maps instance sizes Atlas may stop offering to their
+// successors, using plan IDs or names as keys, for example {"M20": "M30"}.
+// Instances of a removed size are reported and updated as the successor.
+type InstanceSizeFallbacks map[string]string
+
+// InstanceSizeFallback is reported for instances whose instance size Atlas
+// no longer offers.
+type InstanceSizeFallback struct {
+	// Removed is the instance size of the cluster, and Successor the size the
+	// instance is mapped to. Successor is empty for orphaned instances,
+	// which have no fallback configured.
+	Removed   string `json:"removed"`
+	Successor string `json:"successor,omitempty"`
+	Orphaned  bool   `json:"orphaned"`
+}
+
+// Validate returns an error for fallbacks to an empty instance size.
+func (f InstanceSizeFallbacks) Validate() error {
+	for plan, successor := range f {
+		if successor == "" {
+			return fmt.Errorf("missing successor for plan %s", plan)
+		}
+	}
+
+	return nil
+}
+
+// successor returns the configured successor of a plan. The plan ID takes
+// precedence over its name.
+func (f InstanceSizeFallbacks) successor(planID string, planName string) (string, bool) {
+	if successor, ok := f[planID]; ok {
+		return successor, true
+	}
+
+	successor, ok := f[planName]
+	return successor, ok
+}
+
+// ReadInstanceSizeFallbacksFile will read and validate the instance size
+// fallbacks from a JSON file.
+func ReadInstanceSizeFallbacksFile(path string) (InstanceSizeFallbacks, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fallbacks := InstanceSizeFallbacks{}
+	if err := json.Unmarshal(data, &fallbacks); err != nil {
+		return nil, err
+	}
+
+	if err := fallbacks.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid instance size fallbacks: %v", err)
+	}
+
+	return fallbacks, nil
+}
+
+// instanceSizeFallback returns nil if the provider offers an instance size.
+// Otherwise the configured successor is returned if the provider offers it,
+// or the instance is reported as orphaned.
+func (b Broker) instanceSizeFallback(provider *atlas.Provider, instanceSizeName string) *InstanceSizeFallback {
+	if _, ok := provider.InstanceSizes[instanceSizeName]; ok {
+		return nil
+	}
+
+	fallback := &InstanceSizeFallback{Removed: instanceSizeName, Orphaned: true}
+
+	planID := planIDForInstanceSize(provider, atlas.InstanceSize{Name: instanceSizeName})
+	successor, ok := b.config.InstanceSizeFallbacks.successor(planID, instanceSizeName)
+	if !ok {
+		return fallback
+	}
+
+	if _, offered := provider.InstanceSizes[successor]; !offered {
+		b.logger.Warnw("Fallback instance size isn't offered either", "provider", provider.Name, "instance_size", instanceSizeName, "successor", successor)
+		return fallback
+	}
+
+	fallback.Successor = successor
+	fallback.Orphaned = false
+	return fallback
+}
+
+// instanceSizeFallbackForCluster returns the fallback of a cluster of a
+// dedicated provider, or nil if its instance size is offered. The check is
+// best effort, so nil is also returned if the provider can't be fetched.
+func (b Broker) instanceSizeFallbackForCluster(client atlas.Client, instanceID string, cluster *atlas.Cluster) *InstanceSizeFallback {
+	providerName := cluster.ProviderSettings.ProviderName
+	if !containsString(dedicatedProviderNames, providerName) {
+		return nil
+	}
+
+	provider, err := providerByName(client, providerName)
+	if err != nil {
+		b.logger.Warnw("Failed to check the instance size of the instance", "error", err, "instance_id", instanceID)
+		return nil
+	}
+
+	fallback := b.instanceSizeFallback(provider, cluster.ProviderSettings.InstanceSizeName)
+	if fallback != nil && fallback.Orphaned {
+		b.logger.Warnw("Instance size is no longer offered and has no fallback", "instance_id", instanceID, "provider", providerName, "instance_size", fallback.Removed)
+	}
+
+	return fallback
+}
+
+// withFallbackPlanID maps the ID of a plan whose instance size the provider
+// no longer offers to the plan of its successor, so platforms can still
+// update instances with the plan they were provisioned with. Other plan IDs
+// are returned unchanged.
+func (b Broker) withFallbackPlanID(client atlas.Client, serviceID string, planID string) string {
+	if planID == "" || len(b.config.InstanceSizeFallbacks) == 0 {
+		return planID
+	}
+
+	provider, err := findProviderByServiceID(client, serviceID)
+	if err != nil || provider.Name == sharedProviderName {
+		return planID
+	}
+
+	prefix := planIDForInstanceSize(provider, atlas.InstanceSize{Name: ""})
+	if !strings.HasPrefix(planID, prefix) {
+		return planID
+	}
+
+	fallback := b.instanceSizeFallback(provider, strings.ToUpper(strings.TrimPrefix(planID, prefix)))
+	if fallback == nil || fallback.Orphaned {
+		return planID
+	}
+
+	return planIDForInstanceSize(provider, atlas.InstanceSize{Name: fallback.Successor})
+}
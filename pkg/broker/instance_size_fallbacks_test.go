@@ -0,0 +1,123 @@
+package broker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// removedSizeCluster is a cluster of an instance size the mock provider
+// doesn't offer, as if Atlas had removed it.
+func removedSizeCluster(client MockAtlasClient, instanceID string) {
+	client.Clusters[instanceID] = &atlas.Cluster{
+		Name:      instanceID,
+		StateName: atlas.ClusterStateIdle,
+		ProviderSettings: &atlas.ProviderSettings{
+			ProviderName:     "AWS",
+			InstanceSizeName: "M40",
+		},
+	}
+}
+
+func TestReadInstanceSizeFallbacksFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fallbacks")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "fallbacks.json")
+
+	ioutil.WriteFile(path, []byte(`{"M40": "M30", "aosb-cluster-plan-gcp-m40": "M50"}`), 0600)
+	fallbacks, err := ReadInstanceSizeFallbacksFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, InstanceSizeFallbacks{"M40": "M30", "aosb-cluster-plan-gcp-m40": "M50"}, fallbacks)
+
+	ioutil.WriteFile(path, []byte(`{"M40": ""}`), 0600)
+	_, err = ReadInstanceSizeFallbacksFile(path)
+	assert.Error(t, err)
+}
+
+func TestGetInstanceWithRemovedSizeFallback(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{InstanceSizeFallbacks: InstanceSizeFallbacks{"M40": "M30"}})
+	removedSizeCluster(client, "instance")
+
+	spec, err := broker.GetInstance(ctx, "instance")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "aosb-cluster-plan-aws-m30", spec.PlanID)
+	params := spec.Parameters.(map[string]interface{})
+	assert.Equal(t, &InstanceSizeFallback{Removed: "M40", Successor: "M30"}, params["instance_size_fallback"])
+}
+
+func TestGetInstanceWithRemovedSizeOrphaned(t *testing.T) {
+	_, client, ctx := setupTest()
+	removedSizeCluster(client, "instance")
+
+	// Fallbacks to sizes which aren't offered either don't help.
+	for _, fallbacks := range []InstanceSizeFallbacks{nil, {"M40": "M50"}} {
+		broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{InstanceSizeFallbacks: fallbacks})
+
+		spec, err := broker.GetInstance(ctx, "instance")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, "aosb-cluster-plan-aws-m40", spec.PlanID)
+		params := spec.Parameters.(map[string]interface{})
+		assert.Equal(t, &InstanceSizeFallback{Removed: "M40", Orphaned: true}, params["instance_size_fallback"])
+	}
+}
+
+func TestGetInstanceWithOfferedSize(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	spec, err := broker.GetInstance(ctx, "instance")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, spec.Parameters, "instance_size_fallback")
+	}
+}
+
+func TestUpdateRemovedSize(t *testing.T) {
+	_, client, ctx := setupTest()
+	removedSizeCluster(client, "instance")
+
+	details := brokerapi.UpdateDetails{
+		ServiceID: testServiceID,
+		PlanID:    "aosb-cluster-plan-aws-m40",
+	}
+
+	// Without a fallback the plan can't be found.
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{})
+	_, err := broker.Update(ctx, "instance", details, true)
+	assert.Error(t, err)
+	assert.Equal(t, "M40", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+
+	broker = NewBrokerWithConfig(zap.NewNop().Sugar(), Config{InstanceSizeFallbacks: InstanceSizeFallbacks{"aosb-cluster-plan-aws-m40": "M30"}})
+	_, err = broker.Update(ctx, "instance", details, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "M30", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+}
+
+func TestMissingPlans(t *testing.T) {
+	svc := catalogService{Plans: []catalogPlan{{Name: "M10"}, {Name: "M20"}}}
+	assert.Equal(t, []string{"M40"}, missingPlans(svc, []string{"M10", "M40"}))
+	assert.Empty(t, missingPlans(svc, []string{"M20"}))
+}
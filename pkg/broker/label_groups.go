@@ -0,0 +1,155 @@
+package broker
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// metricsLabelOther is the value of the active instances gauge for instances
+// whose label value isn't in the allow-list, or which don't have the label.
+const metricsLabelOther = "other"
+
+// groupPageSize is the number of instances fetched at a time when grouping.
+const groupPageSize = 100
+
+// invalidMetricLabelCharacters matches the characters which can't be used in
+// metric label names, for example the "/" of "atlas-osb/namespace".
+var invalidMetricLabelCharacters = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// LabelGroup is the number of instances with a value of a cluster label.
+type LabelGroup struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// LabelGroupList is the number of instances per value of a cluster label.
+// Instances without the label are counted in Unlabeled.
+type LabelGroupList struct {
+	Label     string       `json:"label"`
+	Groups    []LabelGroup `json:"groups"`
+	Unlabeled int          `json:"unlabeled"`
+}
+
+// handleGroupInstances serves the number of instances per value of the
+// cluster label passed in the label query parameter. Instances are filtered
+// like in listings.
+func (b Broker) handleGroupInstances(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	label := query.Get("label")
+	if label == "" {
+		respondWithError(w, newInvalidQueryError("label", label))
+		return
+	}
+
+	filter, err := instanceFilterFromQuery(query)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	list, err := b.GroupInstancesByLabel(filter, label)
+	if err != nil {
+		b.logger.Errorw("Failed to group instances", "error", err, "label", label)
+		respondWithError(w, err)
+		return
+	}
+
+	respond(w, http.StatusOK, list)
+}
+
+// GroupInstancesByLabel counts the instances matching the filter per value
+// of a cluster label. Groups are ordered by count, then by value.
+func (b Broker) GroupInstancesByLabel(filter state.InstanceFilter, label string) (*LabelGroupList, error) {
+	counts := map[string]int{}
+	list := &LabelGroupList{Label: label, Groups: []LabelGroup{}}
+
+	err := b.eachInstance(filter, func(instance state.Instance) {
+		if value := instance.Labels[label]; value != "" {
+			counts[value]++
+		} else {
+			list.Unlabeled++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for value, count := range counts {
+		list.Groups = append(list.Groups, LabelGroup{Value: value, Count: count})
+	}
+	sort.Slice(list.Groups, func(i, j int) bool {
+		if list.Groups[i].Count != list.Groups[j].Count {
+			return list.Groups[i].Count > list.Groups[j].Count
+		}
+		return list.Groups[i].Value < list.Groups[j].Value
+	})
+
+	return list, nil
+}
+
+// eachInstance calls fn for every recorded instance matching the filter,
+// fetching them a page at a time.
+func (b Broker) eachInstance(filter state.InstanceFilter, fn func(instance state.Instance)) error {
+	for offset := 0; ; offset += groupPageSize {
+		instances, err := b.store.ListInstances(filter, offset, groupPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, instance := range instances {
+			fn(instance)
+		}
+
+		if len(instances) < groupPageSize {
+			return nil
+		}
+	}
+}
+
+// collectActiveInstances sets the active instances gauge per value of the
+// configured cluster label. Values outside the allow-list are counted as
+// "other" to bound the number of series.
+func (b Broker) collectActiveInstances(set func(value float64, labelValues ...string)) {
+	counts := map[string]int{}
+	err := b.eachInstance(state.InstanceFilter{}, func(instance state.Instance) {
+		value := instance.Labels[b.config.MetricsLabel]
+		if !containsString(b.config.MetricsLabelValues, value) {
+			value = metricsLabelOther
+		}
+		counts[value]++
+	})
+	if err != nil {
+		b.logger.Errorw("Failed to count active instances", "error", err)
+		return
+	}
+
+	for value, count := range counts {
+		set(float64(count), value)
+	}
+}
+
+// metricLabelName turns a cluster label key into a valid metric label name.
+// Names can't start with a digit.
+func metricLabelName(key string) string {
+	name := invalidMetricLabelCharacters.ReplaceAllString(key, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// recordLabels stores the labels of the cluster of an instance, used to
+// group instances by label.
+func (b Broker) recordLabels(instanceID string, labels []atlas.Label) error {
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.Labels = map[string]string{}
+		for _, label := range labels {
+			instance.Labels[label.Key] = label.Value
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/telemetry"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// putLabeledInstances records instances with the owner labels, an empty
+// value meaning the instance isn't labeled.
+func putLabeledInstances(broker *Broker, owners map[string]string) {
+	for id, owner := range owners {
+		instance := state.Instance{ID: id, Provider: "AWS"}
+		if owner != "" {
+			instance.Labels = map[string]string{"owner": owner}
+		}
+		broker.store.PutInstance(instance)
+	}
+	broker.store.PutInstance(state.Instance{ID: "gcp", Provider: "GCP", Labels: map[string]string{"owner": "payments"}})
+}
+
+func TestGroupInstancesByLabel(t *testing.T) {
+	broker, _, _ := setupTest()
+	putLabeledInstances(broker, map[string]string{
+		"a": "payments",
+		"b": "search",
+		"c": "payments",
+		"d": "",
+		"e": "analytics",
+	})
+
+	list, err := broker.GroupInstancesByLabel(state.InstanceFilter{}, "owner")
+	assert.NoError(t, err)
+	assert.Equal(t, &LabelGroupList{
+		Label: "owner",
+		Groups: []LabelGroup{
+			{Value: "payments", Count: 3},
+			{Value: "analytics", Count: 1},
+			{Value: "search", Count: 1},
+		},
+		Unlabeled: 1,
+	}, list)
+
+	// Filters apply before grouping.
+	list, err = broker.GroupInstancesByLabel(state.InstanceFilter{Provider: "GCP"}, "owner")
+	assert.NoError(t, err)
+	assert.Equal(t, []LabelGroup{{Value: "payments", Count: 1}}, list.Groups)
+	assert.Equal(t, 0, list.Unlabeled)
+}
+
+func TestGroupInstancesByLabelPaginates(t *testing.T) {
+	broker, _, _ := setupTest()
+	for i := 0; i < groupPageSize*2+1; i++ {
+		broker.store.PutInstance(state.Instance{ID: fmt.Sprintf("instance-%d", i), Labels: map[string]string{"owner": "payments"}})
+	}
+
+	list, err := broker.GroupInstancesByLabel(state.InstanceFilter{}, "owner")
+	assert.NoError(t, err)
+	assert.Equal(t, []LabelGroup{{Value: "payments", Count: groupPageSize*2 + 1}}, list.Groups)
+}
+
+func TestAdminGroupInstances(t *testing.T) {
+	broker, router := setupAdminTest()
+	putLabeledInstances(broker, map[string]string{"a": "payments", "b": ""})
+
+	w := adminGet(router, "/admin/instances/groups?label=owner&provider=AWS")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var list LabelGroupList
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Equal(t, []LabelGroup{{Value: "payments", Count: 1}}, list.Groups)
+	assert.Equal(t, 1, list.Unlabeled)
+
+	assert.Equal(t, http.StatusBadRequest, adminGet(router, "/admin/instances/groups").Code)
+	assert.Equal(t, http.StatusBadRequest, adminGet(router, "/admin/instances/groups?label=owner&ephemeral=maybe").Code)
+}
+
+func TestActiveInstancesGauge(t *testing.T) {
+	registry := telemetry.NewRegistry()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		Metrics:            registry,
+		MetricsLabel:       "atlas-osb/owner",
+		MetricsLabelValues: []string{"payments", "search"},
+	})
+
+	for id, owner := range map[string]string{"a": "payments", "b": "payments", "c": "search", "d": "analytics", "e": ""} {
+		broker.store.PutInstance(state.Instance{ID: id, Labels: map[string]string{"atlas-osb/owner": owner}})
+	}
+
+	var buf bytes.Buffer
+	telemetry.WritePrometheus(&buf, registry.Snapshot())
+
+	// Values outside the allow-list and unlabeled instances share a series.
+	assert.Contains(t, buf.String(), `broker_active_instances{atlas_osb_owner="other"} 2`)
+	assert.Contains(t, buf.String(), `broker_active_instances{atlas_osb_owner="payments"} 2`)
+	assert.Contains(t, buf.String(), `broker_active_instances{atlas_osb_owner="search"} 1`)
+	assert.NotContains(t, buf.String(), "analytics")
+
+	// Without a label the gauge isn't exposed.
+	registry = telemetry.NewRegistry()
+	NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Metrics: registry})
+	buf.Reset()
+	telemetry.WritePrometheus(&buf, registry.Snapshot())
+	assert.NotContains(t, buf.String(), "broker_active_instances")
+}
+
+func TestProvisionRecordsLabels(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"labels": [{"key": "owner", "value": "payments"}]}}`),
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	instance, err := broker.store.GetInstance("instance")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "payments", instance.Labels["owner"])
+	}
+}
+
+func TestMetricLabelName(t *testing.T) {
+	assert.Equal(t, "cost_center", metricLabelName("cost_center"))
+	assert.Equal(t, "atlas_osb_namespace", metricLabelName("atlas-osb/namespace"))
+	assert.Equal(t, "_1owner", metricLabelName("1owner"))
+}
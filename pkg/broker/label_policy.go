@@ -0,0 +1,133 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// The suffixes of the keys of the cluster labels derived from the context of
+// a provision request, for example "atlas-osb/namespace".
+const (
+	clusterLabelPlatform     = "platform"
+	clusterLabelNamespace    = "namespace"
+	clusterLabelOrganization = "organization-guid"
+	clusterLabelSpace        = "space-guid"
+)
+
+// defaultClusterLabel is added to all clusters created by the broker.
+var defaultClusterLabel = atlas.Label{Key: "Infrastructure Tool", Value: "MongoDB Atlas Service Broker"}
+
+// LabelPolicy lists the cluster labels required for governance, for example
+// an owner or cost center. Defaults are used for required labels which
+// weren't passed, so only labels without a default block provisioning.
+type LabelPolicy struct {
+	Required []string          `json:"required"`
+	Defaults map[string]string `json:"defaults,omitempty"`
+}
+
+// Validate returns an error if the policy has empty label keys.
+func (p LabelPolicy) Validate() error {
+	for _, key := range p.Required {
+		if key == "" {
+			return errors.New("required labels can't have an empty key")
+		}
+	}
+
+	for key := range p.Defaults {
+		if key == "" {
+			return errors.New("default labels can't have an empty key")
+		}
+	}
+
+	return nil
+}
+
+// ReadLabelPolicyFile will read and validate a label policy from a JSON file,
+// for example {"required": ["owner", "cost_center"], "defaults": {"cost_center": "platform"}}.
+func ReadLabelPolicyFile(path string) (LabelPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return LabelPolicy{}, err
+	}
+
+	policy := LabelPolicy{}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return LabelPolicy{}, err
+	}
+
+	if err := policy.Validate(); err != nil {
+		return LabelPolicy{}, fmt.Errorf("invalid label policy: %v", err)
+	}
+
+	return policy, nil
+}
+
+// clusterLabels merges the labels of a new cluster. The broker's default
+// label comes first, followed by the labels passed as parameters and the
+// labels derived from the context, which replace passed labels with the same
+// key. Defaults of the label policy are added for keys which are still unset.
+func (b Broker) clusterLabels(passed []atlas.Label, contextParams *ContextParams) []atlas.Label {
+	derived := []atlas.Label{}
+	for _, label := range []atlas.Label{
+		{Key: b.userLabelKey(clusterLabelPlatform), Value: contextParams.Platform},
+		{Key: b.userLabelKey(clusterLabelNamespace), Value: contextParams.Namespace},
+		{Key: b.userLabelKey(clusterLabelOrganization), Value: contextParams.OrganizationGUID},
+		{Key: b.userLabelKey(clusterLabelSpace), Value: contextParams.SpaceGUID},
+	} {
+		if label.Value != "" {
+			derived = append(derived, label)
+		}
+	}
+
+	labels := []atlas.Label{defaultClusterLabel}
+	for _, label := range passed {
+		if label.Key != defaultClusterLabel.Key && !hasLabel(derived, label.Key) {
+			labels = append(labels, label)
+		}
+	}
+	labels = append(labels, derived...)
+
+	for _, key := range b.config.LabelPolicy.Required {
+		if value, ok := b.config.LabelPolicy.Defaults[key]; ok && !hasLabel(labels, key) {
+			labels = append(labels, atlas.Label{Key: key, Value: value})
+		}
+	}
+
+	return labels
+}
+
+// validateLabelPolicy returns a 422 naming the required labels which are
+// missing or empty after the labels have been merged.
+func (b Broker) validateLabelPolicy(labels []atlas.Label) error {
+	missing := []string{}
+	for _, key := range b.config.LabelPolicy.Required {
+		if !hasLabel(labels, key) {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("Missing required labels: %s", strings.Join(missing, ", "))
+	return newRemediableError(err, http.StatusUnprocessableEntity, "missing-required-labels", remediationMissingLabels)
+}
+
+// hasLabel returns whether a label with the key and a non-empty value is in
+// the list.
+func hasLabel(labels []atlas.Label, key string) bool {
+	for _, label := range labels {
+		if label.Key == key && label.Value != "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+package broker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testLabelPolicy = LabelPolicy{
+	Required: []string{"owner", "cost_center"},
+	Defaults: map[string]string{"cost_center": "platform"},
+}
+
+func TestReadLabelPolicyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "label-policy")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "labels.json")
+
+	ioutil.WriteFile(path, []byte(`{"required": ["owner", "cost_center"], "defaults": {"cost_center": "platform"}}`), 0600)
+	policy, err := ReadLabelPolicyFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, testLabelPolicy, policy)
+
+	ioutil.WriteFile(path, []byte(`{"required": [""]}`), 0600)
+	_, err = ReadLabelPolicyFile(path)
+	assert.Error(t, err)
+}
+
+func TestProvisionMissingRequiredLabels(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{LabelPolicy: testLabelPolicy})
+
+	// The cost center has a default, so only the owner is missing.
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"labels": [{"key": "owner", "value": ""}]}}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		assert.Contains(t, err.Error(), "Missing required labels: owner")
+		assert.NotContains(t, err.Error(), "cost_center")
+	}
+	assert.Empty(t, client.Clusters)
+
+	// Without defaults all missing labels are named.
+	broker = NewBrokerWithConfig(zap.NewNop().Sugar(), Config{LabelPolicy: LabelPolicy{Required: testLabelPolicy.Required}})
+	_, err = broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Missing required labels: owner, cost_center")
+	}
+}
+
+func TestProvisionWithRequiredLabels(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{LabelPolicy: testLabelPolicy})
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawContext:    []byte(`{"platform": "kubernetes", "namespace": "payments"}`),
+		RawParameters: []byte(`{"cluster": {"labels": [{"key": "owner", "value": "payments"}, {"key": "atlas-osb/namespace", "value": "other"}]}}`),
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	expected := []atlas.Label{
+		defaultClusterLabel,
+		{Key: "owner", Value: "payments"},
+		{Key: "atlas-osb/platform", Value: "kubernetes"},
+		{Key: "atlas-osb/namespace", Value: "payments"},
+		{Key: "cost_center", Value: "platform"},
+	}
+	assert.Equal(t, expected, client.Clusters[instanceID].Labels)
+}
+
+func TestProvisionRequiredLabelFromContext(t *testing.T) {
+	_, _, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{LabelPolicy: LabelPolicy{Required: []string{"atlas-osb/namespace"}}})
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:     testPlanID,
+		ServiceID:  testServiceID,
+		RawContext: []byte(`{"namespace": "payments"}`),
+	}, true)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,48 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// maintenanceRetryAfter is the Retry-After, in seconds, of requests rejected
+// while Atlas is maintaining a cluster.
+const maintenanceRetryAfter = "300"
+
+// maintenanceStates are the cluster states in which Atlas is maintaining or
+// repairing a cluster, and changes to it fail.
+var maintenanceStates = []string{atlas.ClusterStateRepairing}
+
+// maintenanceStatus reports whether Atlas is maintaining the cluster of an
+// instance in the parameters returned by GetInstance.
+type maintenanceStatus struct {
+	InProgress bool   `json:"in_progress"`
+	State      string `json:"state"`
+}
+
+// clusterMaintenance returns the maintenance status of a cluster.
+func clusterMaintenance(cluster *atlas.Cluster) maintenanceStatus {
+	return maintenanceStatus{
+		InProgress: containsString(maintenanceStates, cluster.StateName),
+		State:      cluster.StateName,
+	}
+}
+
+// rejectDuringMaintenance returns a 503 for operations on a cluster Atlas is
+// maintaining, asking platforms to retry after maintenanceRetryAfter instead
+// of failing the operation.
+func rejectDuringMaintenance(ctx context.Context, cluster *atlas.Cluster) error {
+	if !clusterMaintenance(cluster).InProgress {
+		return nil
+	}
+
+	if limits, ok := ctx.Value(contextKeyRetryAfter).(*rateLimitRecorder); ok {
+		limits.retryLater(maintenanceRetryAfter)
+	}
+
+	err := fmt.Errorf("Atlas is performing maintenance on the cluster (state %s)", cluster.StateName)
+	return newRemediableError(err, http.StatusServiceUnavailable, "cluster-maintenance", remediationClusterMaintenance)
+}
@@ -0,0 +1,100 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupMaintenanceTest provisions an instance whose cluster Atlas is
+// repairing. The returned context records the Retry-After of responses.
+func setupMaintenanceTest() (*Broker, MockAtlasClient, context.Context, *rateLimitRecorder) {
+	broker, client, ctx := setupTest()
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.SetClusterState("instance", atlas.ClusterStateRepairing)
+
+	limits := &rateLimitRecorder{}
+	return broker, client, context.WithValue(ctx, contextKeyRetryAfter, limits), limits
+}
+
+func TestOperationsDuringMaintenance(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation func(*Broker, context.Context) error
+	}{
+		{"update", func(broker *Broker, ctx context.Context) error {
+			_, err := broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+				PlanID:        testPlanID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(`{"cluster": {"diskSizeGB": 20}}`),
+			}, true)
+			return err
+		}},
+		{"bind", func(broker *Broker, ctx context.Context) error {
+			_, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+				PlanID:    testPlanID,
+				ServiceID: testServiceID,
+			}, true)
+			return err
+		}},
+		{"deprovision", func(broker *Broker, ctx context.Context) error {
+			_, err := broker.Deprovision(ctx, "instance", brokerapi.DeprovisionDetails{
+				PlanID:    testPlanID,
+				ServiceID: testServiceID,
+			}, true)
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker, client, ctx, limits := setupMaintenanceTest()
+
+			err := test.operation(broker, ctx)
+			if assert.Error(t, err) {
+				assert.Equal(t, http.StatusServiceUnavailable, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+			}
+
+			retryAfter, ok := limits.RetryAfter()
+			assert.True(t, ok)
+			assert.Equal(t, maintenanceRetryAfter, retryAfter)
+
+			// The cluster is left as it is.
+			cluster := client.Clusters["instance"]
+			if assert.NotNil(t, cluster) {
+				assert.Equal(t, atlas.ClusterStateRepairing, cluster.StateName)
+				assert.Zero(t, cluster.DiskSizeGB)
+			}
+			assert.Nil(t, client.Users["binding"])
+
+			// Once the maintenance is over the operation is accepted.
+			client.SetClusterState("instance", atlas.ClusterStateIdle)
+			assert.NoError(t, test.operation(broker, ctx))
+		})
+	}
+}
+
+func TestGetInstanceMaintenance(t *testing.T) {
+	broker, client, ctx, _ := setupMaintenanceTest()
+
+	spec, err := broker.GetInstance(ctx, "instance")
+	if assert.NoError(t, err) {
+		params := spec.Parameters.(map[string]interface{})
+		assert.Equal(t, maintenanceStatus{InProgress: true, State: atlas.ClusterStateRepairing}, params["maintenance"])
+	}
+
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+	spec, err = broker.GetInstance(ctx, "instance")
+	if assert.NoError(t, err) {
+		params := spec.Parameters.(map[string]interface{})
+		assert.Equal(t, maintenanceStatus{InProgress: false, State: atlas.ClusterStateIdle}, params["maintenance"])
+	}
+}
@@ -0,0 +1,123 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// The support statuses of MongoDB versions.
+const (
+	MongoDBVersionSupported  = "supported"
+	MongoDBVersionDeprecated = "deprecated"
+)
+
+// eolDateLayout is the format of end-of-life dates, for example "2025-04-30".
+const eolDateLayout = "2006-01-02"
+
+// MongoDBVersionStatus is the support status of a MongoDB version.
+type MongoDBVersionStatus struct {
+	Status string `json:"status"`
+
+	// EOLDate is the date the version reaches its end of life, empty if
+	// none has been announced.
+	EOLDate string `json:"eol_date,omitempty"`
+}
+
+// MongoDBVersions maps MongoDB major versions, for example "4.4", to their
+// support status. The table is maintained by the broker operators and
+// published in the metadata of all plans.
+type MongoDBVersions map[string]MongoDBVersionStatus
+
+// Validate returns an error for unknown statuses and invalid end-of-life
+// dates.
+func (v MongoDBVersions) Validate() error {
+	for version, status := range v {
+		if status.Status != MongoDBVersionSupported && status.Status != MongoDBVersionDeprecated {
+			return fmt.Errorf(`invalid status "%s" for version %s, valid statuses are %s and %s`, status.Status, version, MongoDBVersionSupported, MongoDBVersionDeprecated)
+		}
+
+		if status.EOLDate != "" {
+			if _, err := time.Parse(eolDateLayout, status.EOLDate); err != nil {
+				return fmt.Errorf(`invalid end-of-life date "%s" for version %s, use YYYY-MM-DD`, status.EOLDate, version)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReadMongoDBVersionsFile will read and validate the MongoDB version statuses
+// from a JSON file.
+func ReadMongoDBVersionsFile(path string) (MongoDBVersions, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := MongoDBVersions{}
+	if err := json.Unmarshal(data, &versions); err != nil {
+		return nil, err
+	}
+
+	if err := versions.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid MongoDB versions: %v", err)
+	}
+
+	return versions, nil
+}
+
+// deprecated returns whether a version is marked as deprecated or has
+// reached its end of life. Unknown versions aren't deprecated.
+func (v MongoDBVersions) deprecated(version string, now time.Time) bool {
+	status, ok := v[version]
+	if !ok {
+		return false
+	}
+
+	if status.Status == MongoDBVersionDeprecated {
+		return true
+	}
+
+	eolDate, err := time.Parse(eolDateLayout, status.EOLDate)
+	return err == nil && !now.Before(eolDate)
+}
+
+// withMongoDBVersions adds the MongoDB version statuses to the metadata of
+// all plans of a service.
+func withMongoDBVersions(svc catalogService, versions MongoDBVersions) catalogService {
+	if len(versions) == 0 {
+		return svc
+	}
+
+	plans := make([]catalogPlan, len(svc.Plans))
+	for i, plan := range svc.Plans {
+		plan.MongoDBVersions = versions
+		plans[i] = plan
+	}
+
+	svc.Plans = plans
+	return svc
+}
+
+// validateMongoDBVersion logs a warning for clusters provisioned with a
+// deprecated MongoDB version, or rejects them if deprecated versions are
+// configured to be rejected. Clusters using the Atlas default version pass.
+func (b Broker) validateMongoDBVersion(instanceID string, cluster *atlas.Cluster) error {
+	version := cluster.MongoDBMajorVersion
+	if version == "" || !b.config.MongoDBVersions.deprecated(version, time.Now()) {
+		return nil
+	}
+
+	if b.config.RejectDeprecatedVersions {
+		err := fmt.Errorf("MongoDB version %s is deprecated", version)
+		return newRemediableError(err, http.StatusUnprocessableEntity, "mongodb-version-deprecated", remediationDeprecatedMongoDBVersion)
+	}
+
+	b.logger.Warnw("Provisioning cluster with a deprecated MongoDB version", "instance_id", instanceID, "mongodb_version", version, "eol_date", b.config.MongoDBVersions[version].EOLDate)
+	return nil
+}
@@ -0,0 +1,135 @@
+package broker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testMongoDBVersions = MongoDBVersions{
+	"7.0": MongoDBVersionStatus{Status: MongoDBVersionSupported},
+	"6.0": MongoDBVersionStatus{Status: MongoDBVersionSupported, EOLDate: "2025-07-31"},
+	"5.0": MongoDBVersionStatus{Status: MongoDBVersionDeprecated, EOLDate: "2024-10-31"},
+}
+
+func TestReadMongoDBVersionsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "versions")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "versions.json")
+
+	ioutil.WriteFile(path, []byte(`{"7.0": {"status": "supported"}, "6.0": {"status": "supported", "eol_date": "2025-07-31"}, "5.0": {"status": "deprecated", "eol_date": "2024-10-31"}}`), 0600)
+	versions, err := ReadMongoDBVersionsFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, testMongoDBVersions, versions)
+
+	for _, invalid := range []string{
+		`{"5.0": {"status": "retired"}}`,
+		`{"5.0": {"status": "deprecated", "eol_date": "31.10.2024"}}`,
+		`["5.0"]`,
+	} {
+		ioutil.WriteFile(path, []byte(invalid), 0600)
+		_, err = ReadMongoDBVersionsFile(path)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestMongoDBVersionDeprecated(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.False(t, testMongoDBVersions.deprecated("7.0", now))
+	assert.False(t, testMongoDBVersions.deprecated("6.0", now))
+	assert.True(t, testMongoDBVersions.deprecated("5.0", now))
+	assert.False(t, testMongoDBVersions.deprecated("4.4", now), "Unknown versions aren't deprecated")
+
+	// Supported versions are deprecated once they reach their end of life.
+	assert.True(t, testMongoDBVersions.deprecated("6.0", time.Date(2025, 7, 31, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestCatalogMongoDBVersions(t *testing.T) {
+	_, _, ctx := setupTest()
+
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{MongoDBVersions: testMongoDBVersions})
+	services, err := broker.Services(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, svc := range services {
+		for _, plan := range svc.Plans {
+			if assert.NotNil(t, plan.Metadata, plan.ID) {
+				assert.Equal(t, testMongoDBVersions, plan.Metadata.AdditionalMetadata["mongodbVersions"], plan.ID)
+			}
+		}
+	}
+
+	// Without statuses the metadata is unchanged.
+	broker, _, _ = setupTest()
+	services, err = broker.Services(ctx)
+	assert.NoError(t, err)
+	for _, svc := range services {
+		for _, plan := range svc.Plans {
+			if plan.Metadata != nil {
+				assert.NotContains(t, plan.Metadata.AdditionalMetadata, "mongodbVersions")
+			}
+		}
+	}
+}
+
+func TestProvisionDeprecatedMongoDBVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		reject  bool
+		version string
+		status  int
+	}{
+		{"deprecated version is allowed by default", false, "5.0", 0},
+		{"deprecated version is rejected", true, "5.0", http.StatusUnprocessableEntity},
+		{"supported version is allowed", true, "7.0", 0},
+		{"default version is allowed", true, "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+				MongoDBVersions:          testMongoDBVersions,
+				RejectDeprecatedVersions: test.reject,
+			})
+
+			params := `{}`
+			if test.version != "" {
+				params = `{"cluster": {"mongoDBMajorVersion": "` + test.version + `"}}`
+			}
+
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:        testPlanID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(params),
+			}, true)
+
+			if test.status == 0 {
+				assert.NoError(t, err)
+				assert.NotNil(t, client.Clusters["instance"])
+				return
+			}
+
+			if assert.Error(t, err) {
+				assert.Equal(t, test.status, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+				assert.Contains(t, err.Error(), "deprecated")
+			}
+			assert.Nil(t, client.Clusters["instance"])
+		})
+	}
+}
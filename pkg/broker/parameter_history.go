@@ -0,0 +1,211 @@
+package broker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+)
+
+// maxParameterHistory is the number of parameter changes kept per instance.
+// Older changes are dropped first.
+const maxParameterHistory = 100
+
+// originatingIdentityKey is the context key brokerapi stores the
+// X-Broker-API-Originating-Identity header under.
+const originatingIdentityKey = "originatingIdentity"
+
+// recordedClusterFields are the cluster fields whose changes are recorded in
+// the parameter history, as dotted paths: the instance size, disk, backups,
+// region, MongoDB version, and labels. Changes of other fields aren't
+// recorded, so the history never picks up settings it wasn't meant to keep.
+var recordedClusterFields = []string{
+	"providerSettings.instanceSizeName",
+	"diskSizeGB",
+	"autoScaling.diskGBEnabled",
+	"providerSettings.diskIOPS",
+	"providerSettings.volumeType",
+	"backupEnabled",
+	"providerBackupEnabled",
+	"providerSettings.regionName",
+	"replicationSpecs",
+	"mongoDBMajorVersion",
+	"labels",
+}
+
+// ParameterHistory is the list of parameter changes of an instance in the
+// admin API, oldest first.
+type ParameterHistory struct {
+	InstanceID string                  `json:"instance_id"`
+	Changes    []state.ParameterChange `json:"changes"`
+}
+
+// parameterChanges compares the fields passed to an update with the cluster
+// before the update, returning the fields which changed as dotted paths,
+// for example "providerSettings.instanceSizeName". Fields which weren't
+// passed aren't compared.
+func parameterChanges(existing *atlas.Cluster, requested *atlas.Cluster) ([]state.FieldChange, error) {
+	before, err := flattenedFields(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := flattenedFields(requested)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []state.FieldChange{}
+	for field, value := range after {
+		if !reflect.DeepEqual(before[field], value) {
+			changes = append(changes, state.FieldChange{Field: field, Before: before[field], After: value})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// flattenedFields returns the recorded JSON fields of a cluster by dotted
+// path. Lists are kept as a single value.
+func flattenedFields(cluster *atlas.Cluster) (map[string]interface{}, error) {
+	data, err := json.Marshal(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	flattened := map[string]interface{}{}
+	flattenInto(flattened, "", fields)
+
+	for field := range flattened {
+		if !containsString(recordedClusterFields, field) {
+			delete(flattened, field)
+		}
+	}
+
+	return flattened, nil
+}
+
+func flattenInto(flattened map[string]interface{}, prefix string, fields map[string]interface{}) {
+	for name, value := range fields {
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenInto(flattened, prefix+name+".", nested)
+			continue
+		}
+
+		if value != nil {
+			flattened[prefix+name] = value
+		}
+	}
+}
+
+// originatingIdentity describes who requested an operation from the
+// X-Broker-API-Originating-Identity header, for example
+// "cloudfoundry:683ea748-3092-4ff4-b656-39cacc4d5360" or
+// "kubernetes:jane". Empty if the platform didn't pass the header.
+func originatingIdentity(ctx context.Context) string {
+	header, _ := ctx.Value(originatingIdentityKey).(string)
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 {
+		return header
+	}
+
+	platform, value := parts[0], parts[1]
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return header
+	}
+
+	identity := struct {
+		UserID   string `json:"user_id"`
+		Username string `json:"username"`
+	}{}
+	if err := json.Unmarshal(data, &identity); err != nil {
+		return header
+	}
+
+	for _, user := range []string{identity.Username, identity.UserID} {
+		if user != "" {
+			return fmt.Sprintf("%s:%s", platform, user)
+		}
+	}
+
+	return platform
+}
+
+// recordParameterChanges appends the changes of a successful update to the
+// history of an instance. It must be called before the new plan is recorded.
+// Updates which didn't change anything aren't recorded.
+func (b Broker) recordParameterChanges(ctx context.Context, instanceID string, existing *atlas.Cluster, requested *atlas.Cluster, planID string) error {
+	fields, err := parameterChanges(existing, requested)
+	if err != nil {
+		return err
+	}
+
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		change := state.ParameterChange{
+			Time:        time.Now().UTC(),
+			RequestedBy: originatingIdentity(ctx),
+			Fields:      fields,
+		}
+		if planID != "" && planID != instance.PlanID {
+			change.Fields = append([]state.FieldChange{{Field: "plan_id", Before: instance.PlanID, After: planID}}, change.Fields...)
+		}
+
+		if len(change.Fields) == 0 {
+			return
+		}
+
+		instance.ParameterHistory = append(instance.ParameterHistory, change)
+		if len(instance.ParameterHistory) > maxParameterHistory {
+			instance.ParameterHistory = instance.ParameterHistory[len(instance.ParameterHistory)-maxParameterHistory:]
+		}
+	})
+}
+
+// parameterHistory returns the recorded parameter changes of an instance.
+func (b Broker) parameterHistory(instanceID string) ([]state.ParameterChange, error) {
+	instance, err := b.store.GetInstance(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if instance.ParameterHistory == nil {
+		return []state.ParameterChange{}, nil
+	}
+
+	return instance.ParameterHistory, nil
+}
+
+// handleParameterHistory serves the parameter changes of an instance.
+func (b Broker) handleParameterHistory(w http.ResponseWriter, r *http.Request) {
+	instanceID := mux.Vars(r)["instance_id"]
+
+	changes, err := b.parameterHistory(instanceID)
+	if err == state.ErrNotFound {
+		respondWithError(w, apiresponses.NewFailureResponse(fmt.Errorf("Unknown instance ID %s", instanceID), http.StatusNotFound, "instance-not-found"))
+		return
+	}
+	if err != nil {
+		b.logger.Errorw("Failed to get parameter history", "error", err, "instance_id", instanceID)
+		respondWithError(w, err)
+		return
+	}
+
+	respond(w, http.StatusOK, ParameterHistory{InstanceID: instanceID, Changes: changes})
+}
@@ -0,0 +1,190 @@
+package broker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestParameterHistoryAccumulates(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+
+	identity := base64.StdEncoding.EncodeToString([]byte(`{"user_id": "683ea748-3092-4ff4-b656-39cacc4d5360"}`))
+	cfCtx := context.WithValue(ctx, originatingIdentityKey, "cloudfoundry "+identity)
+
+	_, err = broker.Update(cfCtx, "instance", brokerapi.UpdateDetails{
+		PlanID:    "aosb-cluster-plan-aws-m20",
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	_, err = broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:        "aosb-cluster-plan-aws-m20",
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"diskSizeGB": 50}}`),
+	}, true)
+	assert.NoError(t, err)
+
+	history, err := broker.parameterHistory("instance")
+	if !assert.NoError(t, err) || !assert.Len(t, history, 2) {
+		return
+	}
+
+	assert.Equal(t, "cloudfoundry:683ea748-3092-4ff4-b656-39cacc4d5360", history[0].RequestedBy)
+	assert.Contains(t, history[0].Fields, state.FieldChange{Field: "plan_id", Before: testPlanID, After: "aosb-cluster-plan-aws-m20"})
+	assert.Contains(t, history[0].Fields, state.FieldChange{Field: "providerSettings.instanceSizeName", Before: "M10", After: "M20"})
+	assert.False(t, history[0].Time.IsZero())
+
+	assert.Empty(t, history[1].RequestedBy)
+	assert.Contains(t, history[1].Fields, state.FieldChange{Field: "diskSizeGB", Before: nil, After: float64(50)})
+	for _, field := range history[1].Fields {
+		assert.NotEqual(t, "plan_id", field.Field)
+	}
+	assert.Equal(t, float64(50), client.Clusters["instance"].DiskSizeGB)
+}
+
+func TestParameterHistoryAllowList(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+
+	_, err = broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"mongoDBMajorVersion": "7.0", "biConnector": {"enabled": true}, "encryptionAtRestProvider": "AWS", "paused": true}}`),
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	history, err := broker.parameterHistory("instance")
+	if !assert.NoError(t, err) || !assert.Len(t, history, 1) {
+		return
+	}
+
+	// Only the MongoDB version is on the allow-list.
+	assert.Equal(t, []state.FieldChange{{Field: "mongoDBMajorVersion", Before: nil, After: "7.0"}}, history[0].Fields)
+}
+
+func TestParameterChangesIgnoresFieldsNotAllowed(t *testing.T) {
+	existing := &atlas.Cluster{Name: "instance", StateName: atlas.ClusterStateIdle, ProviderSettings: &atlas.ProviderSettings{ProviderName: "AWS", InstanceSizeName: "M10"}}
+	requested := &atlas.Cluster{
+		Name:             "renamed",
+		ReplicaSetName:   "rs",
+		Paused:           true,
+		BIConnector:      atlas.BIConnectorConfig{Enabled: true},
+		StateName:        atlas.ClusterStateUpdating,
+		SrvAddress:       "mongodb+srv://renamed.example.com",
+		ProviderSettings: &atlas.ProviderSettings{ProviderName: "AZURE", InstanceSizeName: "M10", DiskTypeName: "P4"},
+	}
+
+	changes, err := parameterChanges(existing, requested)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestParameterHistoryAdmin(t *testing.T) {
+	broker, router := setupAdminTest()
+	_, client, ctx := setupTest()
+
+	w := adminGet(router, "/admin/instances/unknown/history")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+
+	w = adminGet(router, "/admin/instances/instance/history")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"instance_id": "instance", "changes": []}`, w.Body.String())
+
+	broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:    "aosb-cluster-plan-aws-m20",
+		ServiceID: testServiceID,
+	}, true)
+
+	w = adminGet(router, "/admin/instances/instance/history")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	history := ParameterHistory{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Equal(t, "instance", history.InstanceID)
+	assert.Len(t, history.Changes, 1)
+}
+
+func TestGetInstanceParameterHistory(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{IncludeParameterHistory: true})
+
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+	broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:    "aosb-cluster-plan-aws-m20",
+		ServiceID: testServiceID,
+	}, true)
+
+	spec, err := broker.GetInstance(ctx, "instance")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	history := spec.Parameters.(map[string]interface{})["parameter_history"].([]state.ParameterChange)
+	assert.Len(t, history, 1)
+
+	// The history isn't included by default.
+	broker, _, ctx = setupTest()
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	spec, err = broker.GetInstance(ctx, "instance")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, spec.Parameters.(map[string]interface{}), "parameter_history")
+	}
+}
+
+func TestOriginatingIdentity(t *testing.T) {
+	encode := func(value string) string { return base64.StdEncoding.EncodeToString([]byte(value)) }
+
+	tests := map[string]string{
+		"": "",
+		"kubernetes " + encode(`{"username": "jane"}`): "kubernetes:jane",
+		"cloudfoundry " + encode(`{"user_id": "abc"}`): "cloudfoundry:abc",
+		"cloudfoundry " + encode(`{}`):                 "cloudfoundry",
+		"cloudfoundry not-base64":                      "cloudfoundry not-base64",
+	}
+
+	for header, expected := range tests {
+		ctx := context.WithValue(context.Background(), originatingIdentityKey, header)
+		assert.Equal(t, expected, originatingIdentity(ctx), header)
+	}
+}
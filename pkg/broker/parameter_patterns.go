@@ -0,0 +1,115 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ParameterPatterns lists provision parameters which must be passed with
+// values matching a pattern, for example naming conventions. Parameters are
+// dotted paths into the parameters. Labels are addressed by their key, for
+// example "cluster.labels.app_name".
+type ParameterPatterns map[string]*regexp.Regexp
+
+// ReadParameterPatternsFile will read parameter patterns from a JSON file.
+// The file contains an object with parameter paths as keys and regular
+// expressions as values, for example
+// {"cluster.labels.app_name": "^[a-z][a-z0-9-]{2,30}$"}.
+func ReadParameterPatternsFile(path string) (ParameterPatterns, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawPatterns map[string]string
+	if err := json.Unmarshal(data, &rawPatterns); err != nil {
+		return nil, err
+	}
+
+	patterns := ParameterPatterns{}
+	for parameter, rawPattern := range rawPatterns {
+		for _, key := range strings.Split(parameter, ".") {
+			if key == "" {
+				return nil, fmt.Errorf(`invalid parameter "%s"`, parameter)
+			}
+		}
+
+		pattern, err := regexp.Compile(rawPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for parameter %s: %v", parameter, err)
+		}
+
+		patterns[parameter] = pattern
+	}
+
+	return patterns, nil
+}
+
+// validateParameterPatterns returns a 422 with the pattern of the first
+// parameter, by path, which wasn't passed as a string matching its pattern.
+func (b Broker) validateParameterPatterns(rawParams []byte) error {
+	if len(b.config.ParameterPatterns) == 0 {
+		return nil
+	}
+
+	params := map[string]interface{}{}
+	if len(rawParams) > 0 {
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return newInvalidParamsError(err)
+		}
+	}
+
+	paths := make([]string, 0, len(b.config.ParameterPatterns))
+	for path := range b.config.ParameterPatterns {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		pattern := b.config.ParameterPatterns[path]
+
+		value, ok := parameterValue(params, path).(string)
+		if !ok || !pattern.MatchString(value) {
+			err := fmt.Errorf(`Parameter "%s" must be passed as a string matching the pattern %s`, path, pattern.String())
+			return newRemediableError(err, http.StatusUnprocessableEntity, "parameter-pattern-mismatch", remediationParameterPattern)
+		}
+	}
+
+	return nil
+}
+
+// parameterValue returns the value passed for a dotted parameter path, or nil
+// if none was passed. Lists of labels are indexed by the keys of the labels.
+func parameterValue(params map[string]interface{}, path string) interface{} {
+	var value interface{} = params
+	for _, key := range strings.Split(path, ".") {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			value = current[key]
+		case []interface{}:
+			value = labelValue(current, key)
+		default:
+			return nil
+		}
+	}
+
+	return value
+}
+
+// labelValue returns the value of the label with the key in a list of
+// labels, or nil if there's none.
+func labelValue(labels []interface{}, key string) interface{} {
+	for _, item := range labels {
+		label, ok := item.(map[string]interface{})
+		if ok && label["key"] == key {
+			return label["value"]
+		}
+	}
+
+	return nil
+}
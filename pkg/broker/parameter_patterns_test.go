@@ -0,0 +1,97 @@
+package broker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReadParameterPatternsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patterns")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "patterns.json")
+
+	ioutil.WriteFile(path, []byte(`{"cluster.labels.app_name": "^[a-z][a-z0-9-]{2,30}$"}`), 0600)
+	patterns, err := ReadParameterPatternsFile(path)
+	if assert.NoError(t, err) && assert.Contains(t, patterns, "cluster.labels.app_name") {
+		assert.Equal(t, "^[a-z][a-z0-9-]{2,30}$", patterns["cluster.labels.app_name"].String())
+	}
+
+	for _, invalid := range []string{
+		`{"cluster.name": "^[a-z"}`,
+		`{"cluster..name": "^[a-z]+$"}`,
+		`["cluster.name"]`,
+	} {
+		ioutil.WriteFile(path, []byte(invalid), 0600)
+		_, err = ReadParameterPatternsFile(path)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestProvisionParameterPatterns(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		valid  bool
+	}{
+		{"matching label", `{"cluster": {"labels": [{"key": "team", "value": "payments"}, {"key": "app_name", "value": "checkout-api"}]}}`, true},
+		{"label not matching", `{"cluster": {"labels": [{"key": "app_name", "value": "Checkout_API"}]}}`, false},
+		{"label missing", `{"cluster": {"labels": [{"key": "team", "value": "payments"}]}}`, false},
+		{"no parameters", ``, false},
+		{"not a string", `{"cluster": {"labels": [{"key": "app_name", "value": 42}]}}`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+				ParameterPatterns: ParameterPatterns{"cluster.labels.app_name": regexp.MustCompile(`^[a-z][a-z0-9-]{2,30}$`)},
+			})
+
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:        testPlanID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(test.params),
+			}, true)
+
+			if test.valid {
+				assert.NoError(t, err)
+				assert.NotNil(t, client.Clusters["instance"])
+				return
+			}
+
+			if assert.Error(t, err) {
+				assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+				assert.Contains(t, err.Error(), "^[a-z][a-z0-9-]{2,30}$")
+			}
+			assert.Nil(t, client.Clusters["instance"])
+		})
+	}
+}
+
+func TestParameterValue(t *testing.T) {
+	params := map[string]interface{}{
+		"cluster": map[string]interface{}{
+			"name":   "orders",
+			"labels": []interface{}{map[string]interface{}{"key": "owner", "value": "payments"}},
+		},
+	}
+
+	assert.Equal(t, "orders", parameterValue(params, "cluster.name"))
+	assert.Equal(t, "payments", parameterValue(params, "cluster.labels.owner"))
+	assert.Nil(t, parameterValue(params, "cluster.labels.team"))
+	assert.Nil(t, parameterValue(params, "cluster.name.first"))
+	assert.Nil(t, parameterValue(params, "user.roles"))
+}
@@ -0,0 +1,69 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+)
+
+// ProvisionRequest is the provisioning request passed to parameter
+// transformers.
+type ProvisionRequest struct {
+	InstanceID string
+	ServiceID  string
+	PlanID     string
+
+	// RawParameters are the parameters as passed or as returned by the
+	// previous transformer, a JSON object.
+	RawParameters json.RawMessage
+
+	// RawContext is the platform context, for example the Cloud Foundry
+	// space or Kubernetes namespace of the instance.
+	RawContext json.RawMessage
+}
+
+// ParameterTransformer enriches or transforms the parameters of provisioning
+// requests before they're validated, for example to derive parameters from
+// the platform context or an external system. Errors fail provisioning,
+// failure responses such as 422s are returned to the platform as they are.
+type ParameterTransformer interface {
+	TransformProvisionParameters(request ProvisionRequest) (json.RawMessage, error)
+}
+
+// ParameterTransformerFunc adapts a function to a ParameterTransformer.
+type ParameterTransformerFunc func(request ProvisionRequest) (json.RawMessage, error)
+
+// TransformProvisionParameters calls f.
+func (f ParameterTransformerFunc) TransformProvisionParameters(request ProvisionRequest) (json.RawMessage, error) {
+	return f(request)
+}
+
+// transformProvisionParameters runs the parameter transformers in order,
+// each receiving the parameters returned by the previous one. The result of
+// every transformer must be a JSON object, and is validated like passed
+// parameters afterwards. Without transformers the parameters are unchanged.
+func (b Broker) transformProvisionParameters(request ProvisionRequest) (json.RawMessage, error) {
+	if len(request.RawParameters) == 0 {
+		request.RawParameters = json.RawMessage(`{}`)
+	}
+
+	for i, transformer := range b.config.ParameterTransformers {
+		params, err := transformer.TransformProvisionParameters(request)
+		if _, ok := err.(*apiresponses.FailureResponse); ok {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parameter transformer %d failed: %v", i, err)
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(params, &object); err != nil || object == nil {
+			return nil, fmt.Errorf("parameter transformer %d returned parameters which aren't a JSON object", i)
+		}
+
+		request.RawParameters = params
+	}
+
+	return request.RawParameters, nil
+}
@@ -0,0 +1,143 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// defaultRegionTransformer sets the region of clusters which don't pass one,
+// picked from the platform context.
+var defaultRegionTransformer = ParameterTransformerFunc(func(request ProvisionRequest) (json.RawMessage, error) {
+	platformContext := struct {
+		Region string `json:"region"`
+	}{}
+	json.Unmarshal(request.RawContext, &platformContext)
+
+	params := map[string]interface{}{}
+	if err := json.Unmarshal(request.RawParameters, &params); err != nil {
+		return nil, err
+	}
+
+	cluster, _ := params["cluster"].(map[string]interface{})
+	if cluster == nil {
+		cluster = map[string]interface{}{}
+	}
+	providerSettings, _ := cluster["providerSettings"].(map[string]interface{})
+	if providerSettings == nil {
+		providerSettings = map[string]interface{}{}
+	}
+	if _, ok := providerSettings["regionName"]; !ok {
+		providerSettings["regionName"] = platformContext.Region
+	}
+
+	cluster["providerSettings"] = providerSettings
+	params["cluster"] = cluster
+	return json.Marshal(params)
+})
+
+func TestProvisionParameterTransformer(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   string
+		expected string
+	}{
+		{"region injected", ``, "EU_WEST_1"},
+		{"passed region kept", `{"cluster": {"providerSettings": {"regionName": "US_EAST_1"}}}`, "US_EAST_1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+				ParameterTransformers: []ParameterTransformer{defaultRegionTransformer},
+			})
+
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:        testPlanID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(test.params),
+				RawContext:    []byte(`{"platform": "kubernetes", "region": "EU_WEST_1"}`),
+			}, true)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, test.expected, client.Clusters["instance"].ProviderSettings.RegionName)
+		})
+	}
+}
+
+func TestProvisionParameterTransformersInOrder(t *testing.T) {
+	_, client, ctx := setupTest()
+
+	// The second transformer receives the output of the first one, which is
+	// validated like passed parameters afterwards.
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		ParameterTransformers: []ParameterTransformer{
+			ParameterTransformerFunc(func(request ProvisionRequest) (json.RawMessage, error) {
+				assert.JSONEq(t, `{}`, string(request.RawParameters))
+				assert.Equal(t, "instance", request.InstanceID)
+				assert.Equal(t, testPlanID, request.PlanID)
+				return json.RawMessage(`{"cluster": {"diskSizeGB": 40}}`), nil
+			}),
+			ParameterTransformerFunc(func(request ProvisionRequest) (json.RawMessage, error) {
+				assert.JSONEq(t, `{"cluster": {"diskSizeGB": 40}}`, string(request.RawParameters))
+				return json.RawMessage(`{"cluster": {"diskSizeGB": 40}, "replica_set_name": "invalid name!"}`), nil
+			}),
+		},
+	})
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+	assert.Nil(t, client.Clusters["instance"])
+}
+
+func TestProvisionParameterTransformerErrors(t *testing.T) {
+	rejected := apiresponses.NewFailureResponse(errors.New("No cost center for this space"), http.StatusUnprocessableEntity, "cost-center")
+
+	tests := []struct {
+		name   string
+		result json.RawMessage
+		err    error
+		status int
+	}{
+		{"failure response", nil, rejected, http.StatusUnprocessableEntity},
+		{"error", nil, errors.New("ticketing system unavailable"), 0},
+		{"not an object", json.RawMessage(`["cluster"]`), nil, 0},
+		{"invalid JSON", json.RawMessage(`{`), nil, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+				ParameterTransformers: []ParameterTransformer{
+					ParameterTransformerFunc(func(request ProvisionRequest) (json.RawMessage, error) {
+						return test.result, test.err
+					}),
+				},
+			})
+
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:    testPlanID,
+				ServiceID: testServiceID,
+			}, true)
+			if assert.Error(t, err) && test.status != 0 {
+				assert.Equal(t, test.status, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+			}
+			assert.Nil(t, client.Clusters["instance"])
+		})
+	}
+}
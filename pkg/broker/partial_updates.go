@@ -0,0 +1,183 @@
+package broker
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// The policies for updates which Atlas only partially applied.
+const (
+	// PartialUpdatePolicyKeep leaves the parts which succeeded in place, so
+	// retrying the update only has to apply the failed parts.
+	PartialUpdatePolicyKeep = "keep"
+
+	// PartialUpdatePolicyRollback reverts the parts which succeeded. Rolling
+	// back is best-effort and failures are logged.
+	PartialUpdatePolicyRollback = "rollback"
+)
+
+// The parts of an update which are applied to Atlas separately.
+const (
+	updatePartSearchNodes = "searchNodes"
+	updatePartCluster     = "cluster"
+)
+
+// ValidatePartialUpdatePolicy returns an error for unknown policies.
+func ValidatePartialUpdatePolicy(policy string) error {
+	if policy != PartialUpdatePolicyKeep && policy != PartialUpdatePolicyRollback {
+		return fmt.Errorf(`unknown policy "%s", valid policies are %s and %s`, policy, PartialUpdatePolicyKeep, PartialUpdatePolicyRollback)
+	}
+
+	return nil
+}
+
+// partiallyUpdated handles an update of which only some parts were applied
+// to Atlas. Depending on the policy the parts which succeeded are rolled back
+// or kept. The outcome is recorded and reported by LastOperation. Whether the
+// parts were rolled back is returned.
+func (b Broker) partiallyUpdated(instanceID string, partial state.PartialUpdate, rollback func() error) (bool, error) {
+	if b.config.PartialUpdatePolicy == PartialUpdatePolicyRollback {
+		err := rollback()
+		if err != nil {
+			b.logger.Errorw("Failed to roll back partially applied update", "error", err, "instance_id", instanceID, "parts", partial.Succeeded)
+		} else {
+			b.logger.Infow("Rolled back partially applied update", "instance_id", instanceID, "parts", partial.Succeeded)
+			partial.RolledBack = true
+		}
+	}
+
+	b.logger.Errorw("Update partially applied", "error", partial.Error, "instance_id", instanceID, "succeeded", partial.Succeeded, "failed", partial.Failed, "policy", b.config.PartialUpdatePolicy)
+
+	err := b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.PartialUpdate = &partial
+	})
+	return partial.RolledBack, err
+}
+
+// rollbackCluster restores the fields of a cluster which an update changed
+// to their previous values, renaming it back if the update renamed it. Atlas
+// applies the rollback once the update has completed.
+func (b Broker) rollbackCluster(client atlas.Client, instanceID string, previous *atlas.Cluster, updated *atlas.Cluster) error {
+	patch := clusterRollback(previous, updated)
+	if updated.Name == previous.Name {
+		_, err := client.PatchCluster(updated.Name, patch)
+		return err
+	}
+
+	patch.Name = previous.Name
+	rolledBack, err := client.PatchCluster(updated.Name, patch)
+	if err != nil {
+		return err
+	}
+
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.ClusterName = rolledBack.Name
+	})
+}
+
+// clusterRollback returns the patch setting the fields which differ between
+// the previous and the updated cluster back to their previous values. Settings
+// the update switched on are switched off explicitly.
+func clusterRollback(previous *atlas.Cluster, updated *atlas.Cluster) atlas.ClusterPatch {
+	patch := atlas.ClusterPatch{}
+
+	if !reflect.DeepEqual(previous.Labels, updated.Labels) {
+		patch.Labels = previous.Labels
+	}
+	if previous.AutoScaling != updated.AutoScaling {
+		patch.AutoScaling = &atlas.AutoScalingPatch{DiskGBEnabled: boolPointer(previous.AutoScaling.DiskGBEnabled)}
+	}
+	if previous.BackupEnabled != updated.BackupEnabled {
+		patch.BackupEnabled = boolPointer(previous.BackupEnabled)
+	}
+	if previous.BIConnector != updated.BIConnector {
+		patch.BIConnector = &atlas.BIConnectorPatch{
+			Enabled:        boolPointer(previous.BIConnector.Enabled),
+			ReadPreference: previous.BIConnector.ReadPreference,
+		}
+	}
+	if previous.ClusterType != updated.ClusterType {
+		patch.ClusterType = previous.ClusterType
+	}
+	if previous.DiskSizeGB != updated.DiskSizeGB {
+		patch.DiskSizeGB = previous.DiskSizeGB
+	}
+	if previous.EncryptionAtRestProvider != updated.EncryptionAtRestProvider {
+		patch.EncryptionAtRestProvider = previous.EncryptionAtRestProvider
+	}
+	if previous.MongoDBMajorVersion != updated.MongoDBMajorVersion {
+		patch.MongoDBMajorVersion = previous.MongoDBMajorVersion
+	}
+	if previous.NumShards != updated.NumShards {
+		patch.NumShards = previous.NumShards
+	}
+	if previous.Paused != updated.Paused {
+		patch.Paused = boolPointer(previous.Paused)
+	}
+	if previous.ProviderBackupEnabled != updated.ProviderBackupEnabled {
+		patch.ProviderBackupEnabled = boolPointer(previous.ProviderBackupEnabled)
+	}
+	if !reflect.DeepEqual(previous.ReplicationSpecs, updated.ReplicationSpecs) {
+		patch.ReplicationSpecs = previous.ReplicationSpecs
+	}
+	if !reflect.DeepEqual(previous.ProviderSettings, updated.ProviderSettings) {
+		patch.ProviderSettings = previous.ProviderSettings
+	}
+
+	return patch
+}
+
+func boolPointer(value bool) *bool {
+	return &value
+}
+
+// clearPartialUpdate forgets the outcome of a previous partially applied
+// update of an instance.
+func (b Broker) clearPartialUpdate(instanceID string) error {
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound || (err == nil && instance.PartialUpdate == nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.PartialUpdate = nil
+	})
+}
+
+// partialUpdateOperationState reports a partially applied update as failed,
+// describing which parts succeeded and failed. The recorded update result is
+// forgotten so a retry of the same request applies it again.
+func (b Broker) partialUpdateOperationState(instanceID string) (bool, string, error) {
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	partial := instance.PartialUpdate
+	if partial == nil {
+		return false, "", nil
+	}
+
+	b.forgetOperations(operationKey(OperationUpdate, instanceID))
+
+	outcome := "they are still applied, retry the update to apply the failed parts"
+	if partial.RolledBack {
+		outcome = "they were rolled back"
+	} else if b.config.PartialUpdatePolicy == PartialUpdatePolicyRollback {
+		outcome = "rolling them back failed, retry the update to apply the failed parts"
+	}
+
+	description := fmt.Sprintf("Update partially applied: %s succeeded, %s failed (%s); %s",
+		strings.Join(partial.Succeeded, ", "), strings.Join(partial.Failed, ", "), partial.Error, outcome)
+	return true, description, nil
+}
@@ -0,0 +1,170 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// partialUpdateTest provisions an instance and updates its plan and search
+// nodes, failing the search node deployment after the cluster change.
+func partialUpdateTest(t *testing.T, config Config, params string) (*Broker, MockAtlasClient, context.Context, brokerapi.UpdateServiceSpec) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), config)
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+
+	client.SearchDeploymentErr = &atlas.Error{StatusCode: http.StatusForbidden, Code: "SEARCH_DEPLOYMENT_NOT_ENABLED"}
+	ctx = context.WithValue(context.Background(), ContextKeyAtlasClient, client)
+
+	spec, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		PlanID:        "aosb-cluster-plan-aws-m30",
+		RawParameters: []byte(params),
+	}, true)
+	assert.NoError(t, err)
+
+	return broker, client, ctx, spec
+}
+
+const partialUpdateParams = `{"searchNodes": {"instanceSize": "S30_HIGHCPU_NVME", "nodeCount": 2}}`
+
+func TestPartialUpdateKeep(t *testing.T) {
+	broker, client, ctx, spec := partialUpdateTest(t, Config{PartialUpdatePolicy: PartialUpdatePolicyKeep}, partialUpdateParams)
+	assert.True(t, spec.IsAsync)
+
+	// The cluster change is kept.
+	assert.Equal(t, "M30", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+	assert.Nil(t, client.SearchDeployments["instance"])
+
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+	resp, err := broker.LastOperation(ctx, "instance", brokerapi.PollDetails{OperationData: OperationUpdate})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.Failed, resp.State)
+	assert.Contains(t, resp.Description, "cluster succeeded, searchNodes failed")
+	assert.Contains(t, resp.Description, "entitled to dedicated search nodes")
+	assert.Contains(t, resp.Description, "still applied")
+
+	// A retry of the same request is applied again rather than replayed.
+	client.SearchDeploymentErr = nil
+	ctx = context.WithValue(context.Background(), ContextKeyAtlasClient, client)
+	_, err = broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		PlanID:        "aosb-cluster-plan-aws-m30",
+		RawParameters: []byte(partialUpdateParams),
+	}, true)
+	assert.NoError(t, err)
+
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+	if assert.NotNil(t, client.SearchDeployments["instance"]) {
+		client.SearchDeployments["instance"].StateName = atlas.SearchDeploymentStateIdle
+	}
+	resp, err = broker.LastOperation(ctx, "instance", brokerapi.PollDetails{OperationData: OperationUpdate})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.Succeeded, resp.State)
+}
+
+func TestPartialUpdateRollback(t *testing.T) {
+	broker, client, ctx, _ := partialUpdateTest(t, Config{PartialUpdatePolicy: PartialUpdatePolicyRollback}, partialUpdateParams)
+
+	// The cluster is restored to its previous plan.
+	assert.Equal(t, "M10", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+	resp, err := broker.LastOperation(ctx, "instance", brokerapi.PollDetails{OperationData: OperationUpdate})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.Failed, resp.State)
+	assert.Contains(t, resp.Description, "cluster succeeded, searchNodes failed")
+	assert.Contains(t, resp.Description, "rolled back")
+}
+
+func TestPartialUpdateRollbackDisablesBackups(t *testing.T) {
+	_, client, _, _ := partialUpdateTest(t, Config{PartialUpdatePolicy: PartialUpdatePolicyRollback},
+		`{"cluster": {"providerBackupEnabled": true}, "searchNodes": {"instanceSize": "S30_HIGHCPU_NVME", "nodeCount": 2}}`)
+
+	// Backups enabled by the update are switched off again.
+	assert.False(t, client.Clusters["instance"].ProviderBackupEnabled)
+	assert.Equal(t, "M10", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+}
+
+func TestPartialUpdateRollbackRestoresClusterName(t *testing.T) {
+	broker, client, _, _ := partialUpdateTest(t, Config{PartialUpdatePolicy: PartialUpdatePolicyRollback, AllowClusterRenames: true},
+		`{"cluster_name": "renamed", "searchNodes": {"instanceSize": "S30_HIGHCPU_NVME", "nodeCount": 2}}`)
+
+	assert.Nil(t, client.Clusters["renamed"])
+	assert.NotNil(t, client.Clusters["instance"])
+	assert.Equal(t, "instance", broker.clusterName("instance"))
+}
+
+func TestRollbackClusterRestoresName(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{AllowClusterRenames: true})
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+
+	previous := *client.Clusters["instance"]
+	renamed := previous
+	renamed.Name = "renamed"
+	updated, err := broker.renameCluster(client, "instance", previous.Name, &renamed)
+	assert.NoError(t, err)
+
+	err = broker.rollbackCluster(client, "instance", &previous, updated)
+	assert.NoError(t, err)
+	assert.Nil(t, client.Clusters["renamed"])
+	assert.NotNil(t, client.Clusters["instance"])
+	assert.Equal(t, "instance", broker.clusterName("instance"))
+}
+
+func TestUpdateClusterFailureWithoutSearchNodes(t *testing.T) {
+	broker, client, _ := setupTest()
+	broker.Provision(context.WithValue(context.Background(), ContextKeyAtlasClient, client), "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	// Nothing was applied, so the update fails right away.
+	client.UpdateClusterErr = &atlas.Error{StatusCode: http.StatusBadRequest, Code: "INVALID_BACKUP_POLICY"}
+	ctx := context.WithValue(context.Background(), ContextKeyAtlasClient, client)
+	_, err := broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		ServiceID: testServiceID,
+		PlanID:    testPlanID,
+	}, true)
+	assert.Error(t, err)
+}
+
+func TestUpdateClusterFailureKeepsSearchNodes(t *testing.T) {
+	broker, client, _ := setupTest()
+	broker.Provision(context.WithValue(context.Background(), ContextKeyAtlasClient, client), "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	// Search nodes aren't deployed if the cluster change is rejected.
+	client.UpdateClusterErr = &atlas.Error{StatusCode: http.StatusBadRequest, Code: "INVALID_BACKUP_POLICY"}
+	ctx := context.WithValue(context.Background(), ContextKeyAtlasClient, client)
+	_, err := broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		RawParameters: []byte(partialUpdateParams),
+	}, true)
+	assert.Error(t, err)
+	assert.Nil(t, client.SearchDeployments["instance"])
+}
+
+func TestValidatePartialUpdatePolicy(t *testing.T) {
+	assert.NoError(t, ValidatePartialUpdatePolicy(PartialUpdatePolicyKeep))
+	assert.NoError(t, ValidatePartialUpdatePolicy(PartialUpdatePolicyRollback))
+	assert.Error(t, ValidatePartialUpdatePolicy("ignore"))
+}
@@ -0,0 +1,149 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+)
+
+// PlanDetails is the detailed description of a single plan served by the
+// plan details extension endpoint.
+type PlanDetails struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	ServiceID    string            `json:"service_id"`
+	Provider     string            `json:"provider"`
+	InstanceSize InstanceSizeSpecs `json:"instance_size"`
+	Features     []string          `json:"features"`
+	Regions      []atlas.Region    `json:"regions"`
+}
+
+// InstanceSizeSpecs describes the resources of the instance size of a plan.
+// Unknown values are left as zero.
+type InstanceSizeSpecs struct {
+	Name            string  `json:"name"`
+	VCPUs           float64 `json:"vcpus"`
+	RAMSizeGB       float64 `json:"ram_size_gb"`
+	MaxDiskSizeGB   float64 `json:"max_disk_size_gb"`
+	ConnectionLimit int     `json:"connection_limit"`
+}
+
+// AttachExtensionRoutes will attach the routes of the broker's extensions to
+// the OSB API to a router.
+func AttachExtensionRoutes(router *mux.Router, broker *Broker) {
+	router.HandleFunc("/v2/catalog/plans/{plan_id}", broker.handlePlanDetails).Methods(http.MethodGet)
+	router.HandleFunc("/v2/catalog/schemas", broker.handleCatalogSchemas).Methods(http.MethodGet)
+}
+
+// handlePlanDetails serves the details of a single plan in the catalog.
+func (b Broker) handlePlanDetails(w http.ResponseWriter, r *http.Request) {
+	planID := mux.Vars(r)["plan_id"]
+
+	details, err := b.PlanDetails(r.Context(), planID)
+	if err != nil {
+		b.logger.Errorw("Failed to get plan details", "error", err, "plan_id", planID)
+		respondWithError(w, err)
+		return
+	}
+
+	respond(w, http.StatusOK, details)
+}
+
+// PlanDetails will find a plan in the catalog and describe it using the
+// Atlas provider data. Plans which aren't in the catalog, including those
+// excluded by the whitelist, result in a 404.
+func (b Broker) PlanDetails(ctx context.Context, planID string) (*PlanDetails, error) {
+	b.logger.Infow("Retrieving plan details", "plan_id", planID)
+
+	client, err := b.atlasClientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := b.catalog(ctx)
+	if err != nil {
+		return nil, atlasToAPIError(err)
+	}
+
+	for _, service := range services {
+		for _, plan := range service.Plans {
+			if plan.ID != planID {
+				continue
+			}
+
+			providerName := service.Provider
+
+			provider, err := providerByName(client, providerName)
+			if err != nil {
+				return nil, atlasToAPIError(err)
+			}
+
+			instanceSize := provider.InstanceSizes[plan.Name]
+
+			return &PlanDetails{
+				ID:        plan.ID,
+				Name:      plan.Name,
+				ServiceID: service.ID,
+				Provider:  providerName,
+				InstanceSize: InstanceSizeSpecs{
+					Name:            plan.Name,
+					VCPUs:           instanceSize.NumCPUs,
+					RAMSizeGB:       instanceSize.RAMSizeGB,
+					MaxDiskSizeGB:   instanceSize.MaxDiskSizeGB,
+					ConnectionLimit: atlas.ConnectionLimit(plan.Name),
+				},
+				Features: instanceSizeFeatures(plan.Name),
+				Regions:  regionsOrEmpty(instanceSize.AvailableRegions),
+			}, nil
+		}
+	}
+
+	return nil, apiresponses.NewFailureResponse(fmt.Errorf("Unknown plan ID %s", planID), http.StatusNotFound, "plan-not-found")
+}
+
+// providerNameForServiceID returns the name of the provider a service ID was
+// generated for, including the services of editions.
+func providerNameForServiceID(serviceID string) string {
+	for _, providerName := range providerNames {
+		providerServiceID := serviceIDForProvider(&atlas.Provider{Name: providerName})
+		if providerServiceID == serviceID || strings.HasPrefix(serviceID, providerServiceID+"-") {
+			return providerName
+		}
+	}
+
+	return ""
+}
+
+// regionsOrEmpty makes sure regions are serialized as an empty list rather
+// than null.
+func regionsOrEmpty(regions []atlas.Region) []atlas.Region {
+	if regions == nil {
+		return []atlas.Region{}
+	}
+
+	return regions
+}
+
+// respond will write a JSON response with the specified status.
+func respond(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// respondWithError will write an error response in the same format as the
+// OSB API. Errors other than failure responses result in a 500.
+func respondWithError(w http.ResponseWriter, err error) {
+	if failure, ok := err.(*apiresponses.FailureResponse); ok {
+		respond(w, failure.ValidatedStatusCode(nil), failure.ErrorResponse())
+		return
+	}
+
+	respond(w, http.StatusInternalServerError, apiresponses.ErrorResponse{Description: err.Error()})
+}
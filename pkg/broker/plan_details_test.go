@@ -0,0 +1,75 @@
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestPlanDetails(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	details, err := broker.PlanDetails(ctx, testPlanID)
+	assert.NoError(t, err)
+
+	expected := &PlanDetails{
+		ID:        testPlanID,
+		Name:      "M10",
+		ServiceID: testServiceID,
+		Provider:  "AWS",
+		InstanceSize: InstanceSizeSpecs{
+			Name:            "M10",
+			VCPUs:           2,
+			RAMSizeGB:       2,
+			MaxDiskSizeGB:   128,
+			ConnectionLimit: 1500,
+		},
+		Features: []string{"autoScaling", "backup", "biConnector", "encryptionAtRest", "searchNodes"},
+		Regions: []atlas.Region{
+			atlas.Region{Key: "US_EAST_1", Name: "N. Virginia"},
+		},
+	}
+	assert.Equal(t, expected, details)
+}
+
+func TestPlanDetailsSharedTier(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	details, err := broker.PlanDetails(ctx, "aosb-cluster-plan-tenant-m5")
+	assert.NoError(t, err)
+	assert.Equal(t, "TENANT", details.Provider)
+	assert.Equal(t, float64(5), details.InstanceSize.MaxDiskSizeGB)
+	assert.Empty(t, details.Features)
+}
+
+func TestPlanDetailsHandler(t *testing.T) {
+	_, _, ctx := setupTest()
+	broker := NewBrokerWithWhitelist(zap.NewNop().Sugar(), Whitelist{"AWS": []string{"M10"}})
+
+	router := mux.NewRouter()
+	AttachExtensionRoutes(router, broker)
+
+	get := func(planID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v2/catalog/plans/"+planID, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req.WithContext(ctx))
+		return w
+	}
+
+	w := get(testPlanID)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var details PlanDetails
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, testPlanID, details.ID)
+
+	// Plans excluded by the whitelist and unknown plans aren't found.
+	assert.Equal(t, http.StatusNotFound, get("aosb-cluster-plan-aws-m20").Code)
+	assert.Equal(t, http.StatusNotFound, get("unknown").Code)
+}
@@ -0,0 +1,174 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// intentFeatures are the features an intent may require.
+var intentFeatures = []string{featureAutoScaling, featureBackup, featureBIConnector, featureEncryptionAtRest, featureSearchNodes, featureSharding}
+
+// PlanIntent are the constraints a plan must satisfy to be resolved for an
+// intent. Zero minimums aren't constrained.
+type PlanIntent struct {
+	MinVCPUs      float64 `json:"min_vcpus"`
+	MinRAMSizeGB  float64 `json:"min_ram_size_gb"`
+	MinDiskSizeGB float64 `json:"min_disk_size_gb"`
+
+	// Features lists the optional cluster features the plan must support.
+	Features []string `json:"features"`
+
+	// InstanceSizes limits the plans to these instance sizes if set.
+	InstanceSizes []string `json:"instance_sizes"`
+}
+
+// PlanIntents maps the names of intents, such as "production", to their
+// constraints.
+type PlanIntents map[string]PlanIntent
+
+// ReadPlanIntentsFile will read and validate the plan intents from a JSON
+// file.
+func ReadPlanIntentsFile(path string) (PlanIntents, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	intents := PlanIntents{}
+	if err := json.Unmarshal(data, &intents); err != nil {
+		return nil, err
+	}
+
+	if err := intents.Validate(); err != nil {
+		return nil, err
+	}
+
+	return intents, nil
+}
+
+// Validate returns an error for negative minimums and unknown features.
+func (i PlanIntents) Validate() error {
+	for name, intent := range i {
+		if intent.MinVCPUs < 0 || intent.MinRAMSizeGB < 0 || intent.MinDiskSizeGB < 0 {
+			return fmt.Errorf(`negative minimum for intent "%s"`, name)
+		}
+
+		for _, feature := range intent.Features {
+			if !containsString(intentFeatures, feature) {
+				return fmt.Errorf(`unknown feature "%s" for intent "%s", valid features are %s`, feature, name, strings.Join(intentFeatures, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// satisfiedBy returns whether an instance size satisfies the constraints of
+// the intent.
+func (i PlanIntent) satisfiedBy(instanceSize atlas.InstanceSize) bool {
+	if len(i.InstanceSizes) > 0 && !containsString(i.InstanceSizes, instanceSize.Name) {
+		return false
+	}
+
+	if instanceSize.NumCPUs < i.MinVCPUs || instanceSize.RAMSizeGB < i.MinRAMSizeGB || instanceSize.MaxDiskSizeGB < i.MinDiskSizeGB {
+		return false
+	}
+
+	features := instanceSizeFeatures(instanceSize.Name)
+	for _, feature := range i.Features {
+		if !containsString(features, feature) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// intentFromParams returns the intent passed as {"intent": "..."}, or an
+// empty string to provision the requested plan.
+func intentFromParams(rawParams []byte) (string, error) {
+	params := struct {
+		Intent string `json:"intent"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return "", newInvalidParamsError(err)
+		}
+	}
+
+	return params.Intent, nil
+}
+
+// resolvePlanIntent returns the provider of the service and its smallest
+// instance size satisfying the intent passed in the parameters, or a nil
+// instance size if no intent is passed. Instance sizes are compared by their
+// RAM, then their vCPUs, and only those in the whitelist are considered.
+// Unknown and unsatisfiable intents, and intents satisfied by several
+// instance sizes of the same size, result in a 422.
+func (b Broker) resolvePlanIntent(client atlas.Client, serviceID string, rawParams []byte) (*atlas.Provider, *atlas.InstanceSize, error) {
+	name, err := intentFromParams(rawParams)
+	if err != nil || name == "" {
+		return nil, nil, err
+	}
+
+	intent, ok := b.config.PlanIntents[name]
+	if !ok {
+		err := fmt.Errorf(`Unknown intent "%s"`, name)
+		return nil, nil, newRemediableError(err, http.StatusUnprocessableEntity, "unknown-intent", remediationUnknownIntent)
+	}
+
+	provider, err := findProviderByServiceID(client, serviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	whitelistedPlans, isWhitelisted := b.config.Whitelist[provider.Name]
+
+	candidates := []atlas.InstanceSize{}
+	for _, instanceSize := range provider.InstanceSizes {
+		if b.config.Whitelist != nil && (!isWhitelisted || !containsString(whitelistedPlans, instanceSize.Name)) {
+			continue
+		}
+
+		if intent.satisfiedBy(instanceSize) {
+			candidates = append(candidates, instanceSize)
+		}
+	}
+
+	if len(candidates) == 0 {
+		err := fmt.Errorf(`No plan of the service satisfies the intent "%s"`, name)
+		return nil, nil, newRemediableError(err, http.StatusUnprocessableEntity, "unsatisfiable-intent", remediationUnsatisfiableIntent)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].RAMSizeGB != candidates[j].RAMSizeGB {
+			return candidates[i].RAMSizeGB < candidates[j].RAMSizeGB
+		}
+		if candidates[i].NumCPUs != candidates[j].NumCPUs {
+			return candidates[i].NumCPUs < candidates[j].NumCPUs
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	smallest := candidates[0]
+	names := []string{smallest.Name}
+	for _, candidate := range candidates[1:] {
+		if candidate.RAMSizeGB == smallest.RAMSizeGB && candidate.NumCPUs == smallest.NumCPUs {
+			names = append(names, candidate.Name)
+		}
+	}
+	if len(names) > 1 {
+		err := fmt.Errorf(`The intent "%s" is satisfied by several plans of the same size: %s`, name, strings.Join(names, ", "))
+		return nil, nil, newRemediableError(err, http.StatusUnprocessableEntity, "ambiguous-intent", remediationAmbiguousIntent)
+	}
+
+	return provider, &smallest, nil
+}
@@ -0,0 +1,165 @@
+package broker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testIntentProvider = &atlas.Provider{
+	Name: "AWS",
+	InstanceSizes: map[string]atlas.InstanceSize{
+		"M10":      {Name: "M10", NumCPUs: 2, RAMSizeGB: 2, MaxDiskSizeGB: 128},
+		"M20":      {Name: "M20", NumCPUs: 2, RAMSizeGB: 4, MaxDiskSizeGB: 256},
+		"M30":      {Name: "M30", NumCPUs: 2, RAMSizeGB: 8, MaxDiskSizeGB: 512},
+		"M40":      {Name: "M40", NumCPUs: 4, RAMSizeGB: 16, MaxDiskSizeGB: 1024},
+		"M40_NVME": {Name: "M40_NVME", NumCPUs: 4, RAMSizeGB: 16, MaxDiskSizeGB: 380},
+	},
+}
+
+var testPlanIntents = PlanIntents{
+	"development": PlanIntent{},
+	"production":  PlanIntent{MinRAMSizeGB: 6, Features: []string{featureBackup}},
+	"sharded":     PlanIntent{Features: []string{featureSharding}},
+	"analytics":   PlanIntent{MinVCPUs: 4},
+	"nvme":        PlanIntent{MinVCPUs: 4, InstanceSizes: []string{"M40_NVME"}},
+	"huge":        PlanIntent{MinRAMSizeGB: 64},
+}
+
+func TestReadPlanIntentsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "intents")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "intents.json")
+
+	ioutil.WriteFile(path, []byte(`{"production": {"min_vcpus": 2, "min_ram_size_gb": 8, "features": ["backup"], "instance_sizes": ["M30", "M40"]}}`), 0600)
+	intents, err := ReadPlanIntentsFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, PlanIntents{"production": PlanIntent{
+		MinVCPUs:      2,
+		MinRAMSizeGB:  8,
+		Features:      []string{featureBackup},
+		InstanceSizes: []string{"M30", "M40"},
+	}}, intents)
+
+	for _, invalid := range []string{
+		`{"production": {"features": ["auditing"]}}`,
+		`{"production": {"min_ram_size_gb": -1}}`,
+		`["production"]`,
+	} {
+		ioutil.WriteFile(path, []byte(invalid), 0600)
+		_, err = ReadPlanIntentsFile(path)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestResolvePlanIntent(t *testing.T) {
+	tests := []struct {
+		intent   string
+		expected string
+		status   int
+	}{
+		{"development", "M10", 0},
+		{"production", "M30", 0},
+		{"sharded", "M30", 0},
+		{"nvme", "M40_NVME", 0},
+		{"analytics", "", http.StatusUnprocessableEntity},
+		{"huge", "", http.StatusUnprocessableEntity},
+		{"unknown", "", http.StatusUnprocessableEntity},
+	}
+
+	for _, test := range tests {
+		t.Run(test.intent, func(t *testing.T) {
+			_, client, _ := setupTest()
+			client.Providers["AWS"] = testIntentProvider
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{PlanIntents: testPlanIntents})
+
+			provider, instanceSize, err := broker.resolvePlanIntent(client, testServiceID, []byte(`{"intent": "`+test.intent+`"}`))
+			if test.status != 0 {
+				if assert.Error(t, err) {
+					assert.Equal(t, test.status, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+				}
+				return
+			}
+
+			if assert.NoError(t, err) && assert.NotNil(t, instanceSize) {
+				assert.Equal(t, "AWS", provider.Name)
+				assert.Equal(t, test.expected, instanceSize.Name)
+			}
+		})
+	}
+}
+
+func TestResolvePlanIntentAmbiguous(t *testing.T) {
+	_, client, _ := setupTest()
+	client.Providers["AWS"] = testIntentProvider
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{PlanIntents: testPlanIntents})
+
+	_, _, err := broker.resolvePlanIntent(client, testServiceID, []byte(`{"intent": "analytics"}`))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "M40, M40_NVME")
+	}
+
+	// Without an intent the requested plan is provisioned.
+	_, instanceSize, err := broker.resolvePlanIntent(client, testServiceID, []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Nil(t, instanceSize)
+}
+
+func TestResolvePlanIntentWhitelist(t *testing.T) {
+	_, client, _ := setupTest()
+	client.Providers["AWS"] = testIntentProvider
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		PlanIntents: testPlanIntents,
+		Whitelist:   Whitelist{"AWS": []string{"M10", "M20"}},
+	})
+
+	_, _, err := broker.resolvePlanIntent(client, testServiceID, []byte(`{"intent": "production"}`))
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+}
+
+func TestProvisionWithIntent(t *testing.T) {
+	_, client, ctx := setupTest()
+	client.Providers["AWS"] = testIntentProvider
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{PlanIntents: testPlanIntents})
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"intent": "production"}`),
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "M30", client.Clusters["instance"].ProviderSettings.InstanceSizeName)
+
+	instance, err := broker.store.GetInstance("instance")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "aosb-cluster-plan-aws-m30", instance.PlanID)
+	}
+
+	// Unsatisfiable intents aren't provisioned.
+	_, err = broker.Provision(ctx, "other", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"intent": "huge"}`),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+	assert.Nil(t, client.Clusters["other"])
+}
@@ -0,0 +1,90 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// PlanOrder maps provider names to the names or IDs of plans in the order they
+// should be listed in the catalog. Plans which aren't listed follow in the
+// default order.
+type PlanOrder map[string][]string
+
+// ReadPlanOrderFile will read and validate a plan order from a JSON file, for
+// example {"AWS": ["M30", "M10"]}.
+func ReadPlanOrderFile(path string) (PlanOrder, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	order := PlanOrder{}
+	if err := json.Unmarshal(data, &order); err != nil {
+		return nil, err
+	}
+
+	for providerName := range order {
+		if !containsString(providerNames, providerName) {
+			return nil, fmt.Errorf(`invalid plan order: unknown provider "%s", valid providers are %s`, providerName, strings.Join(providerNames, ", "))
+		}
+	}
+
+	return order, nil
+}
+
+// sortPlans orders plans by their tier, smallest first, and then by name.
+func sortPlans(plans []catalogPlan) {
+	sort.SliceStable(plans, func(i, j int) bool {
+		tierI, okI := instanceSizeTier(plans[i].Name)
+		tierJ, okJ := instanceSizeTier(plans[j].Name)
+
+		switch {
+		case okI != okJ:
+			return okI
+		case tierI != tierJ:
+			return tierI < tierJ
+		default:
+			return plans[i].Name < plans[j].Name
+		}
+	})
+}
+
+// withPlanOrder returns a copy of the service with the listed plans first, in
+// the listed order. The entries which don't match any plan are returned as
+// well.
+func withPlanOrder(svc catalogService, order []string) (catalogService, []string) {
+	plans := []catalogPlan{}
+	listed := map[string]bool{}
+	unknown := []string{}
+
+	for _, entry := range order {
+		found := false
+		for _, plan := range svc.Plans {
+			if plan.Name != entry && plan.ID != entry {
+				continue
+			}
+
+			found = true
+			if !listed[plan.ID] {
+				listed[plan.ID] = true
+				plans = append(plans, plan)
+			}
+		}
+
+		if !found {
+			unknown = append(unknown, entry)
+		}
+	}
+
+	for _, plan := range svc.Plans {
+		if !listed[plan.ID] {
+			plans = append(plans, plan)
+		}
+	}
+
+	svc.Plans = plans
+	return svc, unknown
+}
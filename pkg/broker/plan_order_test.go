@@ -0,0 +1,109 @@
+package broker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func planNames(plans []brokerapi.ServicePlan) []string {
+	names := []string{}
+	for _, plan := range plans {
+		names = append(names, plan.Name)
+	}
+
+	return names
+}
+
+func awsPlanNames(t *testing.T, services []brokerapi.Service) []string {
+	for _, service := range services {
+		if providerNameForServiceID(service.ID) == "AWS" {
+			return planNames(service.Plans)
+		}
+	}
+
+	t.Fatal("Expected an AWS service")
+	return nil
+}
+
+func TestDefaultPlanOrder(t *testing.T) {
+	_, _, ctx := setupTest()
+
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{})
+	services, err := broker.Services(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"M10", "M20", "M30"}, awsPlanNames(t, services))
+}
+
+func TestPlanOrder(t *testing.T) {
+	_, _, ctx := setupTest()
+
+	// Listed plans come first, the rest follow in the default order and
+	// unknown plans are ignored.
+	config := Config{
+		PlanOrder: PlanOrder{"AWS": []string{"M30", "M99"}},
+	}
+
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), config)
+	services, err := broker.Services(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []string{"M30", "M10", "M20"}, awsPlanNames(t, services))
+}
+
+func TestPlanOrderByID(t *testing.T) {
+	_, _, ctx := setupTest()
+
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{Whitelist: Whitelist{"AWS": []string{"M10", "M20", "M30"}}})
+	services, err := broker.catalog(ctx)
+	if !assert.NoError(t, err) || !assert.Len(t, services, 1) || !assert.Len(t, services[0].Plans, 3) {
+		return
+	}
+
+	m20 := services[0].Plans[1]
+	ordered, unknown := withPlanOrder(services[0], []string{m20.ID, "M30"})
+
+	assert.Empty(t, unknown)
+	assert.Equal(t, []string{"M20", "M30", "M10"}, planNames(toAPIService(ordered).Plans))
+}
+
+func TestPlanOrderBeforeWhitelist(t *testing.T) {
+	_, _, ctx := setupTest()
+
+	config := Config{
+		Whitelist: Whitelist{"AWS": []string{"M10", "M30"}},
+		PlanOrder: PlanOrder{"AWS": []string{"M30", "M20"}},
+	}
+
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), config)
+	services, err := broker.Services(ctx)
+	if !assert.NoError(t, err) || !assert.Len(t, services, 1) {
+		return
+	}
+
+	assert.Equal(t, []string{"M30", "M10"}, planNames(services[0].Plans))
+}
+
+func TestReadPlanOrderFileUnknownProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan-order")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "plan-order.json")
+	ioutil.WriteFile(path, []byte(`{"AWZ": ["M10"]}`), 0600)
+
+	_, err = ReadPlanOrderFile(path)
+	assert.EqualError(t, err, `invalid plan order: unknown provider "AWZ", valid providers are AWS, GCP, AZURE, TENANT`)
+}
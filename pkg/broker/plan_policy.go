@@ -0,0 +1,155 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// PlanRange is the range of instance sizes, by tier, which may be used.
+// Either end may be left empty to leave it open.
+type PlanRange struct {
+	Min string `json:"min,omitempty"`
+	Max string `json:"max,omitempty"`
+}
+
+// Validate returns an error if either end isn't an instance size name.
+func (r PlanRange) Validate() error {
+	for _, name := range []string{r.Min, r.Max} {
+		if _, ok := instanceSizeTier(name); name != "" && !ok {
+			return fmt.Errorf(`invalid instance size "%s"`, name)
+		}
+	}
+
+	return nil
+}
+
+// allows returns whether an instance size is within the range. Instance sizes
+// without a tier are only allowed by unrestricted ranges.
+func (r PlanRange) allows(instanceSizeName string) bool {
+	if r.Min == "" && r.Max == "" {
+		return true
+	}
+
+	tier, ok := instanceSizeTier(instanceSizeName)
+	if !ok {
+		return false
+	}
+
+	if minTier, ok := instanceSizeTier(r.Min); ok && tier < minTier {
+		return false
+	}
+
+	if maxTier, ok := instanceSizeTier(r.Max); ok && tier > maxTier {
+		return false
+	}
+
+	return true
+}
+
+func (r PlanRange) String() string {
+	switch {
+	case r.Min == "":
+		return "up to " + r.Max
+	case r.Max == "":
+		return r.Min + " or larger"
+	default:
+		return fmt.Sprintf("from %s to %s", r.Min, r.Max)
+	}
+}
+
+// PlanPolicy limits the plans which may be provisioned depending on the
+// platform context of the request. Ranges are looked up by Cloud Foundry
+// space, Kubernetes namespace, and Cloud Foundry organization, in that order,
+// and the first match applies. Contexts without a match are unrestricted.
+type PlanPolicy struct {
+	Spaces        map[string]PlanRange `json:"spaces,omitempty"`
+	Namespaces    map[string]PlanRange `json:"namespaces,omitempty"`
+	Organizations map[string]PlanRange `json:"organizations,omitempty"`
+}
+
+// rangeFor returns the plan range applying to a platform context.
+func (p PlanPolicy) rangeFor(context ContextParams) (PlanRange, bool) {
+	lookups := []struct {
+		ranges map[string]PlanRange
+		key    string
+	}{
+		{p.Spaces, context.SpaceGUID},
+		{p.Namespaces, context.Namespace},
+		{p.Organizations, context.OrganizationGUID},
+	}
+
+	for _, lookup := range lookups {
+		if r, ok := lookup.ranges[lookup.key]; ok && lookup.key != "" {
+			return r, true
+		}
+	}
+
+	return PlanRange{}, false
+}
+
+// validatePlanPolicy rejects clusters whose instance size is outside of the
+// range allowed for the platform context of the request.
+func (b Broker) validatePlanPolicy(cluster *atlas.Cluster, rawContext json.RawMessage) error {
+	if cluster.ProviderSettings == nil {
+		return nil
+	}
+
+	context := ContextParams{}
+	if len(rawContext) > 0 {
+		_ = json.Unmarshal(rawContext, &context)
+	}
+
+	allowed, ok := b.config.PlanPolicy.rangeFor(context)
+	instanceSizeName := cluster.ProviderSettings.InstanceSizeName
+	if !ok || allowed.allows(instanceSizeName) {
+		return nil
+	}
+
+	err := fmt.Errorf("Plan %s is not allowed for this %s, allowed plans are %s", instanceSizeName, contextKind(context), allowed)
+	return newRemediableError(err, http.StatusUnprocessableEntity, "plan-not-allowed", fmt.Sprintf("pick a plan %s or ask the broker operator to change the plan policy", allowed))
+}
+
+// contextKind describes the platform context a request was made from.
+func contextKind(context ContextParams) string {
+	switch {
+	case context.SpaceGUID != "":
+		return "space"
+	case context.Namespace != "":
+		return "namespace"
+	default:
+		return "organization"
+	}
+}
+
+// ReadPlanPolicyFile will read a plan policy from a JSON file, for example
+// {"spaces": {"<SPACE_GUID>": {"max": "M20"}}}.
+func ReadPlanPolicyFile(path string) (PlanPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return PlanPolicy{}, err
+	}
+
+	var policy PlanPolicy
+	err = json.Unmarshal(data, &policy)
+	if err != nil {
+		return PlanPolicy{}, err
+	}
+
+	for kind, ranges := range map[string]map[string]PlanRange{
+		"space":        policy.Spaces,
+		"namespace":    policy.Namespaces,
+		"organization": policy.Organizations,
+	} {
+		for key, r := range ranges {
+			if err := r.Validate(); err != nil {
+				return PlanPolicy{}, fmt.Errorf("invalid plan range for %s %s: %v", kind, key, err)
+			}
+		}
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,107 @@
+package broker
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const testSpaceContext = `{"platform": "cloudfoundry", "organization_guid": "org", "space_guid": "dev"}`
+
+func setupPlanPolicyTest() (*Broker, MockAtlasClient, context.Context) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		PlanPolicy: PlanPolicy{
+			Spaces:        map[string]PlanRange{"dev": PlanRange{Max: "M20"}},
+			Organizations: map[string]PlanRange{"org": PlanRange{Min: "M30"}},
+		},
+	})
+
+	return broker, client, ctx
+}
+
+func TestPlanPolicyRejectsLargerPlan(t *testing.T) {
+	broker, client, ctx := setupPlanPolicyTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:     "aosb-cluster-plan-aws-m30",
+		ServiceID:  testServiceID,
+		RawContext: []byte(testSpaceContext),
+	}, true)
+
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		assert.Contains(t, err.Error(), "up to M20")
+	}
+	assert.Nil(t, client.Clusters["instance"])
+}
+
+func TestPlanPolicyAllowsPlanInRange(t *testing.T) {
+	broker, _, ctx := setupPlanPolicyTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:     "aosb-cluster-plan-aws-m20",
+		ServiceID:  testServiceID,
+		RawContext: []byte(testSpaceContext),
+	}, true)
+	assert.NoError(t, err)
+
+	// Updates to a plan outside of the range are rejected as well.
+	_, err = broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		PlanID:     "aosb-cluster-plan-aws-m30",
+		ServiceID:  testServiceID,
+		RawContext: []byte(testSpaceContext),
+	}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+}
+
+func TestPlanPolicyPrecedence(t *testing.T) {
+	broker, _, ctx := setupPlanPolicyTest()
+
+	// Other spaces of the organization fall back on the organization range.
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:     "aosb-cluster-plan-aws-m20",
+		ServiceID:  testServiceID,
+		RawContext: []byte(`{"organization_guid": "org", "space_guid": "prod"}`),
+	}, true)
+	assert.Error(t, err)
+
+	// Contexts without a range are unrestricted.
+	_, err = broker.Provision(ctx, "other", brokerapi.ProvisionDetails{
+		PlanID:     "aosb-cluster-plan-aws-m30",
+		ServiceID:  testServiceID,
+		RawContext: []byte(`{"namespace": "default"}`),
+	}, true)
+	assert.NoError(t, err)
+}
+
+func TestReadPlanPolicyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan-policy")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policy.json")
+	ioutil.WriteFile(path, []byte(`{"namespaces": {"dev": {"min": "M10", "max": "M20"}}}`), 0600)
+
+	policy, err := ReadPlanPolicyFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, PlanPolicy{Namespaces: map[string]PlanRange{"dev": PlanRange{Min: "M10", Max: "M20"}}}, policy)
+
+	ioutil.WriteFile(path, []byte(`{"namespaces": {"dev": {"max": "large"}}}`), 0600)
+
+	_, err = ReadPlanPolicyFile(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,31 @@
+package broker
+
+import "github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+
+// recommendedMaxPoolSize divides the connection limit of a cluster between
+// the expected number of bindings, recommending at least one connection.
+// The instance size of the cluster is used if it's known, as it may differ
+// from the plan while an update is applied. Zero is returned if no bindings
+// are expected or the connection limit is unknown, omitting the
+// recommendation.
+func (b Broker) recommendedMaxPoolSize(cluster *atlas.Cluster, planInstanceSizeName string) int {
+	if b.config.ExpectedBindings <= 0 {
+		return 0
+	}
+
+	instanceSizeName := planInstanceSizeName
+	if cluster.ProviderSettings != nil && cluster.ProviderSettings.InstanceSizeName != "" {
+		instanceSizeName = cluster.ProviderSettings.InstanceSizeName
+	}
+
+	limit := atlas.ConnectionLimit(instanceSizeName)
+	if limit == 0 {
+		return 0
+	}
+
+	if size := limit / b.config.ExpectedBindings; size > 0 {
+		return size
+	}
+
+	return 1
+}
@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRecommendedMaxPoolSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		expected     int
+		instanceSize string
+		poolSize     int
+	}{
+		{"M10 shared by ten bindings", 10, "M10", 150},
+		{"M20 shared by four bindings", 4, "M20", 750},
+		{"at least one connection", 5000, "M10", 1},
+		{"unknown connection limit", 10, "M1000", 0},
+		{"no expected bindings", 0, "M10", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ExpectedBindings: test.expected})
+			cluster := &atlas.Cluster{ProviderSettings: &atlas.ProviderSettings{InstanceSizeName: test.instanceSize}}
+			assert.Equal(t, test.poolSize, broker.recommendedMaxPoolSize(cluster, "M30"))
+		})
+	}
+
+	// The plan's instance size is used if the cluster's isn't known.
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ExpectedBindings: 10})
+	assert.Equal(t, 300, broker.recommendedMaxPoolSize(&atlas.Cluster{}, "M20"))
+}
+
+func TestBindRecommendedMaxPoolSize(t *testing.T) {
+	for expected, poolSize := range map[int]int{0: 0, 10: 150} {
+		_, _, ctx := setupTest()
+		broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ExpectedBindings: expected})
+
+		broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+			PlanID:    testPlanID,
+			ServiceID: testServiceID,
+		}, true)
+
+		spec, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+			PlanID:    testPlanID,
+			ServiceID: testServiceID,
+		}, true)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		credentials := spec.Credentials.(ConnectionDetails)
+		assert.Equal(t, poolSize, credentials.RecommendedMaxPoolSize, expected)
+	}
+
+	// The recommendation is returned with credential references, as it isn't
+	// secret.
+	_, _, ctx := setupTest()
+	store := newMemoryCredentialStore()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ExpectedBindings: 10, CredentialStore: store})
+
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	spec, err := broker.Bind(ctx, "instance", "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, CredentialReference{CredentialRef: "memory:binding", RecommendedMaxPoolSize: 150}, spec.Credentials)
+		assert.NotContains(t, store.credentials["binding"], "recommended_max_pool_size")
+	}
+}
@@ -0,0 +1,41 @@
+package broker
+
+import (
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// recordProject will store the Atlas project and organization an instance
+// was provisioned in, for cross-referencing instances with Atlas billing.
+func (b Broker) recordProject(client atlas.Client, instanceID string) (*state.Instance, error) {
+	project, err := client.GetProject()
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded *state.Instance
+	err = b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.ProjectID = project.ID
+		instance.OrgID = project.OrgID
+		recorded = instance
+	})
+
+	return recorded, err
+}
+
+// instanceProject returns the Atlas project and organization recorded for an
+// instance when it was provisioned. They're empty for instances without a
+// record. The project isn't fetched from the client instead, as that's the
+// project of the request's API key rather than the one the instance was
+// provisioned in.
+func (b Broker) instanceProject(instanceID string) (projectID string, orgID string, err error) {
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		return "", "", nil
+	}
+	if err != nil {
+		return
+	}
+
+	return instance.ProjectID, instance.OrgID, nil
+}
@@ -0,0 +1,329 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// DefaultProjectResolutionTimeout is how long the project resolver may take
+// to determine the project of an instance before provisioning fails.
+const DefaultProjectResolutionTimeout = 10 * time.Second
+
+// ProjectResolver determines the Atlas project an instance is provisioned in
+// from the platform context, for example by looking up the owner of a Cloud
+// Foundry space or Kubernetes namespace in an inventory. The API key of the
+// request must have access to the project. Errors fail provisioning, the
+// instance is never provisioned in another project instead.
+type ProjectResolver interface {
+	ResolveProject(ctx context.Context, rawContext json.RawMessage) (string, error)
+}
+
+// ProjectResolverFunc adapts a function to a ProjectResolver.
+type ProjectResolverFunc func(ctx context.Context, rawContext json.RawMessage) (string, error)
+
+// ResolveProject calls f.
+func (f ProjectResolverFunc) ResolveProject(ctx context.Context, rawContext json.RawMessage) (string, error) {
+	return f(ctx, rawContext)
+}
+
+// StaticProjectResolver maps platform context values to the IDs of Atlas
+// projects: Cloud Foundry space and organization GUIDs and Kubernetes
+// namespaces, for example {"payments": "5d0f..."}. Spaces take precedence
+// over their organization.
+type StaticProjectResolver map[string]string
+
+// ResolveProject returns the project of the first platform context value
+// with one, or an error if there's none.
+func (r StaticProjectResolver) ResolveProject(ctx context.Context, rawContext json.RawMessage) (string, error) {
+	platformContext := struct {
+		SpaceGUID        string `json:"space_guid"`
+		OrganizationGUID string `json:"organization_guid"`
+		Namespace        string `json:"namespace"`
+	}{}
+
+	if len(rawContext) > 0 {
+		if err := json.Unmarshal(rawContext, &platformContext); err != nil {
+			return "", err
+		}
+	}
+
+	for _, value := range []string{platformContext.SpaceGUID, platformContext.OrganizationGUID, platformContext.Namespace} {
+		if projectID, ok := r[value]; ok && value != "" {
+			return projectID, nil
+		}
+	}
+
+	return "", errors.New("no project is mapped to the space, organization, or namespace")
+}
+
+// ReadStaticProjectResolverFile will read the projects of platform context
+// values from a JSON file.
+func ReadStaticProjectResolverFile(path string) (StaticProjectResolver, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := StaticProjectResolver{}
+	if err := json.Unmarshal(data, &resolver); err != nil {
+		return nil, err
+	}
+
+	for value, projectID := range resolver {
+		if strings.TrimSpace(value) == "" || strings.TrimSpace(projectID) == "" {
+			return nil, fmt.Errorf(`invalid project mapping "%s": "%s"`, value, projectID)
+		}
+	}
+
+	return resolver, nil
+}
+
+// cachingProjectResolver keeps the projects resolved for a space,
+// organization, or namespace for the TTL. Failures aren't cached, so they're
+// retried on the next request.
+type cachingProjectResolver struct {
+	resolver ProjectResolver
+	ttl      time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]cachedProject
+}
+
+type cachedProject struct {
+	projectID string
+	expiresAt time.Time
+}
+
+// NewCachingProjectResolver wraps a resolver calling out to an external
+// inventory, so instances in the same space or namespace don't look up
+// their project more than once per TTL. Projects are cached by the space
+// GUID, the organization GUID, or the namespace of the platform context, in
+// that order. Contexts without any of them aren't cached.
+func NewCachingProjectResolver(resolver ProjectResolver, ttl time.Duration) ProjectResolver {
+	return &cachingProjectResolver{resolver: resolver, ttl: ttl, entries: map[string]cachedProject{}}
+}
+
+func (r *cachingProjectResolver) ResolveProject(ctx context.Context, rawContext json.RawMessage) (string, error) {
+	key := projectCacheKey(rawContext)
+	if key == "" {
+		return r.resolver.ResolveProject(ctx, rawContext)
+	}
+
+	now := time.Now()
+
+	r.mutex.Lock()
+	entry, ok := r.entries[key]
+	r.mutex.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.projectID, nil
+	}
+
+	projectID, err := r.resolver.ResolveProject(ctx, rawContext)
+	if err != nil {
+		return "", err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Expired entries are dropped whenever a project is cached, so the
+	// cache doesn't grow with contexts which are no longer used.
+	for cachedKey, cached := range r.entries {
+		if !now.Before(cached.expiresAt) {
+			delete(r.entries, cachedKey)
+		}
+	}
+	r.entries[key] = cachedProject{projectID: projectID, expiresAt: now.Add(r.ttl)}
+
+	return projectID, nil
+}
+
+// projectCacheKey returns the value the project of a platform context is
+// cached by, or an empty string if it has none.
+func projectCacheKey(rawContext json.RawMessage) string {
+	platformContext := struct {
+		SpaceGUID        string `json:"space_guid"`
+		OrganizationGUID string `json:"organization_guid"`
+		Namespace        string `json:"namespace"`
+	}{}
+
+	if len(rawContext) == 0 || json.Unmarshal(rawContext, &platformContext) != nil {
+		return ""
+	}
+
+	switch {
+	case platformContext.SpaceGUID != "":
+		return "space:" + platformContext.SpaceGUID
+	case platformContext.OrganizationGUID != "":
+		return "organization:" + platformContext.OrganizationGUID
+	case platformContext.Namespace != "":
+		return "namespace:" + platformContext.Namespace
+	}
+
+	return ""
+}
+
+// resolveProject determines the project of a new instance with the
+// configured resolver, within the resolution timeout. Failures and empty
+// projects are returned as a 422 including the reason.
+func (b Broker) resolveProject(ctx context.Context, rawContext json.RawMessage) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.config.ProjectResolutionTimeout)
+	defer cancel()
+
+	type result struct {
+		projectID string
+		err       error
+	}
+
+	// Resolvers which ignore the context can't hold up provisioning.
+	results := make(chan result, 1)
+	go func() {
+		projectID, err := b.config.ProjectResolver.ResolveProject(ctx, rawContext)
+		results <- result{projectID, err}
+	}()
+
+	var resolved result
+	select {
+	case resolved = <-results:
+	case <-ctx.Done():
+		resolved.err = fmt.Errorf("timed out after %s", b.config.ProjectResolutionTimeout)
+	}
+
+	if resolved.err == nil && resolved.projectID == "" {
+		resolved.err = errors.New("no project was returned")
+	}
+
+	if resolved.err != nil {
+		err := fmt.Errorf("Failed to resolve the Atlas project of the instance: %v", resolved.err)
+		return "", newRemediableError(err, http.StatusUnprocessableEntity, "project-resolution-failed", remediationProjectResolution)
+	}
+
+	return resolved.projectID, nil
+}
+
+// projectScopedClient is implemented by Atlas clients which can act on other
+// projects their API key has access to.
+type projectScopedClient interface {
+	ForProject(projectID string) atlas.Client
+}
+
+// clientForProject returns a copy of a client acting on another project,
+// keeping the provider cache of the broker's clients.
+func clientForProject(client atlas.Client, projectID string) (atlas.Client, error) {
+	if caching, ok := client.(cachingClient); ok {
+		scoped, err := clientForProject(caching.Client, projectID)
+		caching.Client = scoped
+		return caching, err
+	}
+
+	scoped, ok := client.(projectScopedClient)
+	if !ok {
+		return nil, errors.New("Atlas client can't act on other projects")
+	}
+
+	return scoped.ForProject(projectID), nil
+}
+
+// instanceClient returns the client of the request acting on the project of
+// an instance. The sweeper keeps it for expiring instances it has no client
+// for, so they can be deleted once they expire.
+func (b Broker) instanceClient(ctx context.Context, instanceID string, rawContext json.RawMessage) (atlas.Client, error) {
+	client, err := b.projectInstanceClient(ctx, instanceID, rawContext)
+	if err != nil {
+		return nil, err
+	}
+
+	b.rememberExpiringClient(instanceID, client)
+	return client, nil
+}
+
+// projectInstanceClient returns the client of the request acting on the
+// project an instance was provisioned in, if the broker resolves projects.
+// The project of instances without a recorded one is resolved again from the
+// platform context, if the request has one, and recorded. Otherwise the
+// request is rejected, it never acts on the project of the API key instead.
+func (b Broker) projectInstanceClient(ctx context.Context, instanceID string, rawContext json.RawMessage) (atlas.Client, error) {
+	client, err := b.atlasClientFromContext(ctx)
+	if err != nil || b.config.ProjectResolver == nil {
+		return client, err
+	}
+
+	instance, err := b.store.GetInstance(instanceID)
+	if err != nil && err != state.ErrNotFound {
+		return nil, err
+	}
+
+	if instance != nil && instance.ProjectID != "" {
+		return clientForProject(client, instance.ProjectID)
+	}
+
+	if len(rawContext) == 0 {
+		err := fmt.Errorf("The Atlas project of instance %s isn't known and the request has no platform context to resolve it from", instanceID)
+		return nil, newRemediableError(err, http.StatusUnprocessableEntity, "project-unknown", remediationProjectUnknown)
+	}
+
+	projectID, err := b.resolveProject(ctx, rawContext)
+	if err != nil {
+		return nil, err
+	}
+
+	if instance != nil {
+		err := b.setProjectID(instanceID, projectID)
+		if err != nil {
+			b.logger.Errorw("Failed to record the resolved project of the instance", "error", err, "instance_id", instanceID, "project_id", projectID)
+		}
+	}
+
+	return clientForProject(client, projectID)
+}
+
+// setProjectID records the project an instance was provisioned in, before
+// the project is fetched from Atlas along with its organization.
+func (b Broker) setProjectID(instanceID string, projectID string) error {
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.ProjectID = projectID
+	})
+}
+
+// operationTargetSeparator separates the operation from the project and the
+// cluster name in the operation data of deprovisions. Their record is removed
+// before the deletion completes, so the project of instances in resolved
+// projects and the name of renamed clusters are passed along.
+const operationTargetSeparator = ":"
+
+// withOperationTarget adds a project and a cluster name to the data of an
+// operation. Either may be empty.
+func withOperationTarget(operation string, projectID string, clusterName string) string {
+	if clusterName != "" {
+		return strings.Join([]string{operation, projectID, clusterName}, operationTargetSeparator)
+	}
+	if projectID != "" {
+		return operation + operationTargetSeparator + projectID
+	}
+
+	return operation
+}
+
+// splitOperationTarget returns the operation, the project and the cluster
+// name, if any, of operation data.
+func splitOperationTarget(operationData string) (operation string, projectID string, clusterName string) {
+	parts := strings.SplitN(operationData, operationTargetSeparator, 3)
+	switch len(parts) {
+	case 3:
+		return parts[0], parts[1], parts[2]
+	case 2:
+		return parts[0], parts[1], ""
+	}
+
+	return operationData, "", ""
+}
@@ -0,0 +1,307 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// projectRecordingClient records the project of every cluster request.
+type projectRecordingClient struct {
+	MockAtlasClient
+	projects *[]string
+}
+
+func (c projectRecordingClient) ForProject(projectID string) atlas.Client {
+	c.ProjectID = projectID
+	return c
+}
+
+func (c projectRecordingClient) CreateCluster(cluster atlas.Cluster) (*atlas.Cluster, error) {
+	*c.projects = append(*c.projects, c.ProjectID)
+	return c.MockAtlasClient.CreateCluster(cluster)
+}
+
+func (c projectRecordingClient) GetCluster(name string) (*atlas.Cluster, error) {
+	*c.projects = append(*c.projects, c.ProjectID)
+	return c.MockAtlasClient.GetCluster(name)
+}
+
+func (c projectRecordingClient) DeleteCluster(name string) error {
+	*c.projects = append(*c.projects, c.ProjectID)
+	return c.MockAtlasClient.DeleteCluster(name)
+}
+
+// fakeInventory resolves the projects of Kubernetes namespaces, counting
+// its lookups.
+type fakeInventory struct {
+	projects map[string]string
+	lookups  int
+}
+
+func (i *fakeInventory) ResolveProject(ctx context.Context, rawContext json.RawMessage) (string, error) {
+	i.lookups++
+
+	platformContext := struct {
+		Namespace string `json:"namespace"`
+	}{}
+	if err := json.Unmarshal(rawContext, &platformContext); err != nil {
+		return "", err
+	}
+
+	projectID, ok := i.projects[platformContext.Namespace]
+	if !ok {
+		return "", errors.New("namespace not found in the inventory")
+	}
+
+	return projectID, nil
+}
+
+func setupProjectResolutionTest(resolver ProjectResolver) (*Broker, MockAtlasClient, context.Context, *[]string) {
+	_, client, _ := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ProjectResolver: resolver})
+
+	projects := &[]string{}
+	ctx := context.WithValue(context.Background(), ContextKeyAtlasClient, projectRecordingClient{MockAtlasClient: client, projects: projects})
+	return broker, client, ctx, projects
+}
+
+func TestStaticProjectResolver(t *testing.T) {
+	resolver := StaticProjectResolver{"space": "space-project", "org": "org-project", "payments": "payments-project"}
+
+	tests := []struct {
+		context  string
+		expected string
+	}{
+		{`{"platform": "cloudfoundry", "organization_guid": "org", "space_guid": "space"}`, "space-project"},
+		{`{"platform": "cloudfoundry", "organization_guid": "org", "space_guid": "other"}`, "org-project"},
+		{`{"platform": "kubernetes", "namespace": "payments"}`, "payments-project"},
+		{`{"platform": "kubernetes", "namespace": "other"}`, ""},
+		{``, ""},
+	}
+
+	for _, test := range tests {
+		projectID, err := resolver.ResolveProject(context.Background(), json.RawMessage(test.context))
+		if test.expected == "" {
+			assert.Error(t, err, test.context)
+			continue
+		}
+
+		assert.NoError(t, err, test.context)
+		assert.Equal(t, test.expected, projectID, test.context)
+	}
+}
+
+func TestReadStaticProjectResolverFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "projects")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "projects.json")
+
+	ioutil.WriteFile(path, []byte(`{"payments": "payments-project"}`), 0600)
+	resolver, err := ReadStaticProjectResolverFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, StaticProjectResolver{"payments": "payments-project"}, resolver)
+
+	for _, invalid := range []string{`{"payments": ""}`, `{"": "project"}`, `["payments"]`} {
+		ioutil.WriteFile(path, []byte(invalid), 0600)
+		_, err = ReadStaticProjectResolverFile(path)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCachingProjectResolver(t *testing.T) {
+	inventory := &fakeInventory{projects: map[string]string{"payments": "payments-project"}}
+	resolver := NewCachingProjectResolver(inventory, time.Hour)
+
+	// Contexts are cached by their namespace, regardless of other fields.
+	for _, rawContext := range []string{`{"namespace": "payments"}`, `{"platform": "kubernetes", "namespace": "payments", "instance_name": "orders"}`} {
+		projectID, err := resolver.ResolveProject(context.Background(), json.RawMessage(rawContext))
+		assert.NoError(t, err)
+		assert.Equal(t, "payments-project", projectID)
+	}
+	assert.Equal(t, 1, inventory.lookups, "Expected the project to be cached")
+
+	// Failures are looked up again.
+	for i := 0; i < 2; i++ {
+		_, err := resolver.ResolveProject(context.Background(), json.RawMessage(`{"namespace": "other"}`))
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 3, inventory.lookups)
+}
+
+func TestCachingProjectResolverExpiry(t *testing.T) {
+	inventory := &fakeInventory{projects: map[string]string{"payments": "payments-project", "orders": "orders-project"}}
+	resolver := NewCachingProjectResolver(inventory, 10*time.Millisecond).(*cachingProjectResolver)
+
+	resolver.ResolveProject(context.Background(), json.RawMessage(`{"namespace": "payments"}`))
+	time.Sleep(20 * time.Millisecond)
+
+	// Expired entries are looked up again, and dropped once another project
+	// is cached.
+	resolver.ResolveProject(context.Background(), json.RawMessage(`{"namespace": "orders"}`))
+	assert.Equal(t, 2, inventory.lookups)
+	assert.Len(t, resolver.entries, 1)
+	assert.Contains(t, resolver.entries, "namespace:orders")
+}
+
+func TestProjectCacheKey(t *testing.T) {
+	tests := []struct {
+		context  string
+		expected string
+	}{
+		{`{"platform": "cloudfoundry", "organization_guid": "org", "space_guid": "space"}`, "space:space"},
+		{`{"platform": "cloudfoundry", "organization_guid": "org"}`, "organization:org"},
+		{`{"platform": "kubernetes", "namespace": "payments"}`, "namespace:payments"},
+		{`{"platform": "kubernetes"}`, ""},
+		{`invalid`, ""},
+		{``, ""},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, projectCacheKey(json.RawMessage(test.context)), test.context)
+	}
+}
+
+func TestInstanceClientUnknownProject(t *testing.T) {
+	inventory := &fakeInventory{projects: map[string]string{"payments": "payments-project"}}
+	broker, client, ctx, projects := setupProjectResolutionTest(inventory)
+
+	// Instances without a recorded project aren't looked up in the project
+	// of the API key.
+	client.Clusters["instance"] = &atlas.Cluster{Name: "instance", StateName: atlas.ClusterStateIdle, ProviderSettings: &atlas.ProviderSettings{ProviderName: "AWS", InstanceSizeName: "M10"}}
+	broker.store.PutInstance(state.Instance{ID: "instance"})
+
+	_, err := broker.GetInstance(ctx, "instance")
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		assert.Contains(t, err.Error(), "The Atlas project of instance instance isn't known")
+	}
+
+	_, err = broker.Deprovision(ctx, "unknown", brokerapi.DeprovisionDetails{PlanID: testPlanID, ServiceID: testServiceID}, true)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+	assert.Empty(t, *projects)
+
+	// Requests with a platform context resolve the project again, which is
+	// recorded for later requests.
+	_, err = broker.Update(ctx, "instance", brokerapi.UpdateDetails{
+		PlanID:     testPlanID,
+		ServiceID:  testServiceID,
+		RawContext: json.RawMessage(`{"platform": "kubernetes", "namespace": "payments"}`),
+	}, true)
+	assert.NoError(t, err)
+
+	instance, err := broker.store.GetInstance("instance")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "payments-project", instance.ProjectID)
+	}
+
+	_, err = broker.GetInstance(ctx, "instance")
+	assert.NoError(t, err)
+
+	for _, projectID := range *projects {
+		assert.Equal(t, "payments-project", projectID)
+	}
+	assert.NotEmpty(t, *projects)
+}
+
+func TestProvisionResolvedProject(t *testing.T) {
+	inventory := &fakeInventory{projects: map[string]string{"payments": "payments-project"}}
+	broker, client, ctx, projects := setupProjectResolutionTest(inventory)
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:     testPlanID,
+		ServiceID:  testServiceID,
+		RawContext: json.RawMessage(`{"platform": "kubernetes", "namespace": "payments"}`),
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	instance, err := broker.store.GetInstance("instance")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "payments-project", instance.ProjectID)
+	}
+
+	// Later operations act on the resolved project, even after the record
+	// of the instance has been removed.
+	client.SetClusterState("instance", atlas.ClusterStateIdle)
+	_, err = broker.LastOperation(ctx, "instance", brokerapi.PollDetails{OperationData: OperationProvision})
+	assert.NoError(t, err)
+
+	spec, err := broker.Deprovision(ctx, "instance", brokerapi.DeprovisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = broker.LastOperation(ctx, "instance", brokerapi.PollDetails{OperationData: spec.OperationData})
+	assert.NoError(t, err)
+
+	for _, projectID := range *projects {
+		assert.Equal(t, "payments-project", projectID)
+	}
+	assert.NotEmpty(t, *projects)
+}
+
+func TestProvisionProjectResolutionFailure(t *testing.T) {
+	blocked := make(chan struct{})
+	defer close(blocked)
+
+	tests := []struct {
+		name     string
+		resolver ProjectResolver
+		timeout  time.Duration
+		reason   string
+	}{
+		{"unknown namespace", &fakeInventory{}, 0, "namespace not found in the inventory"},
+		{"empty project", ProjectResolverFunc(func(ctx context.Context, rawContext json.RawMessage) (string, error) {
+			return "", nil
+		}), 0, "no project was returned"},
+		{"timeout", ProjectResolverFunc(func(ctx context.Context, rawContext json.RawMessage) (string, error) {
+			<-blocked
+			return "late-project", nil
+		}), 10 * time.Millisecond, "timed out"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, _ := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ProjectResolver: test.resolver, ProjectResolutionTimeout: test.timeout})
+			ctx := context.WithValue(context.Background(), ContextKeyAtlasClient, client)
+
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:     testPlanID,
+				ServiceID:  testServiceID,
+				RawContext: json.RawMessage(`{"platform": "kubernetes", "namespace": "payments"}`),
+			}, true)
+			if assert.Error(t, err) {
+				assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+				assert.Contains(t, err.Error(), test.reason)
+			}
+
+			// The instance isn't provisioned in the project of the API key.
+			assert.Nil(t, client.Clusters["instance"])
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvisionRecordsProject(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	instance, err := broker.store.GetInstance(instanceID)
+	assert.NoError(t, err)
+	assert.Equal(t, testProjectID, instance.ProjectID)
+	assert.Equal(t, testOrgID, instance.OrgID)
+
+	spec, err := broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+
+	params := spec.Parameters.(map[string]interface{})
+	assert.Equal(t, testProjectID, params["project_id"])
+	assert.Equal(t, testOrgID, params["org_id"])
+}
+
+func TestGetInstanceUnrecordedProject(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	// Instances without a record, for example after the state was lost, are
+	// returned without a project rather than the one of the request's API
+	// key, which isn't recorded either.
+	broker.store.DeleteInstance(instanceID)
+
+	spec, err := broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+	assert.NotContains(t, spec.Parameters, "project_id")
+	assert.NotContains(t, spec.Parameters, "org_id")
+
+	_, err = broker.store.GetInstance(instanceID)
+	assert.Equal(t, state.ErrNotFound, err)
+}
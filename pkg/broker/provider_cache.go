@@ -0,0 +1,156 @@
+package broker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// providerCache caches providers fetched from Atlas. Providers are fetched
+// from the unauthenticated private API, so they are the same for all
+// clients and can be shared between requests.
+type providerCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]providerCacheEntry
+
+	// generation is incremented when the cache is invalidated, so providers
+	// fetched before are not cached.
+	generation int
+}
+
+type providerCacheEntry struct {
+	provider  *atlas.Provider
+	expiresAt time.Time
+}
+
+func newProviderCache(ttl time.Duration) *providerCache {
+	return &providerCache{
+		ttl:     ttl,
+		entries: make(map[string]providerCacheEntry),
+	}
+}
+
+// get will return a cached provider, fetching it using the client if it
+// isn't cached or has expired.
+func (c *providerCache) get(client atlas.Client, name string) (*atlas.Provider, error) {
+	c.mutex.Lock()
+	entry, ok := c.entries[name]
+	generation := c.generation
+	c.mutex.Unlock()
+
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.provider, nil
+	}
+
+	provider, err := client.GetProvider(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.put(name, provider, generation)
+	return provider, nil
+}
+
+// refresh will fetch a provider using the client and cache it, regardless of
+// whether the cached provider has expired. The cached provider is kept if it
+// can't be fetched.
+func (c *providerCache) refresh(client atlas.Client, name string) error {
+	c.mutex.Lock()
+	generation := c.generation
+	c.mutex.Unlock()
+
+	provider, err := client.GetProvider(name)
+	if err != nil {
+		return err
+	}
+
+	c.put(name, provider, generation)
+	return nil
+}
+
+// put caches a provider fetched during a generation of the cache, unless
+// the cache has been invalidated since.
+func (c *providerCache) put(name string, provider *atlas.Provider, generation int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.generation == generation {
+		c.entries[name] = providerCacheEntry{
+			provider:  provider,
+			expiresAt: time.Now().Add(c.ttl),
+		}
+	}
+}
+
+// invalidate removes all cached providers. Providers which are being
+// fetched while the cache is invalidated are returned but not cached.
+func (c *providerCache) invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = make(map[string]providerCacheEntry)
+	c.generation++
+}
+
+// cachingClient is an Atlas client which fetches providers through a cache.
+// Excluded instance sizes are removed from the providers it returns.
+type cachingClient struct {
+	atlas.Client
+	cache      *providerCache
+	exclusions []InstanceSizeExclusion
+}
+
+func (c cachingClient) GetProvider(name string) (*atlas.Provider, error) {
+	provider, err := c.cache.get(c.Client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return excludeInstanceSizes(name, provider, c.exclusions), nil
+}
+
+// PrewarmProviders will fetch all providers available in the catalog into the
+// cache so the first requests don't have to. It's meant to be called on
+// startup and also verifies Atlas can be reached.
+func (b Broker) PrewarmProviders(client atlas.Client) error {
+	errs := b.prewarmProviders(client)
+	for _, providerName := range providerNames {
+		if err, ok := errs[providerName]; ok {
+			return fmt.Errorf("failed to fetch provider %s: %v", providerName, err)
+		}
+	}
+
+	return nil
+}
+
+// prewarmProviders will fetch all whitelisted providers into the cache,
+// returning the errors by provider.
+func (b Broker) prewarmProviders(client atlas.Client) map[string]error {
+	errs := map[string]error{}
+	for _, providerName := range b.whitelistedProviderNames() {
+		_, err := b.providers.get(client, providerName)
+		if err != nil {
+			errs[providerName] = err
+		}
+	}
+
+	return errs
+}
+
+// whitelistedProviderNames returns the providers which may be in the
+// catalog.
+func (b Broker) whitelistedProviderNames() []string {
+	names := []string{}
+	for _, providerName := range providerNames {
+		if _, whitelisted := b.config.Whitelist[providerName]; b.config.Whitelist != nil && !whitelisted {
+			continue
+		}
+
+		names = append(names, providerName)
+	}
+
+	return names
+}
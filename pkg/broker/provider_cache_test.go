@@ -0,0 +1,61 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// countingClient counts the providers fetched from Atlas.
+type countingClient struct {
+	MockAtlasClient
+	fetched map[string]int
+	err     error
+}
+
+func (c countingClient) GetProvider(name string) (*atlas.Provider, error) {
+	c.fetched[name]++
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return c.MockAtlasClient.GetProvider(name)
+}
+
+func TestProviderCache(t *testing.T) {
+	_, mock, _ := setupTest()
+	client := countingClient{MockAtlasClient: mock, fetched: map[string]int{}}
+
+	cache := newProviderCache(time.Hour)
+	cache.get(client, "AWS")
+	cache.get(client, "AWS")
+	assert.Equal(t, 1, client.fetched["AWS"], "Expected provider to be fetched once")
+
+	// Expired providers are fetched again.
+	cache = newProviderCache(-time.Second)
+	cache.get(client, "GCP")
+	cache.get(client, "GCP")
+	assert.Equal(t, 2, client.fetched["GCP"])
+}
+
+func TestPrewarmProviders(t *testing.T) {
+	_, mock, _ := setupTest()
+	client := countingClient{MockAtlasClient: mock, fetched: map[string]int{}}
+
+	broker := NewBrokerWithWhitelist(zap.NewNop().Sugar(), Whitelist{"AWS": []string{"M10"}})
+	assert.NoError(t, broker.PrewarmProviders(client))
+	assert.Equal(t, map[string]int{"AWS": 1}, client.fetched, "Expected only whitelisted providers to be fetched")
+
+	// Prewarmed providers are used by requests.
+	_, err := broker.providers.get(client, "AWS")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, client.fetched["AWS"])
+
+	client.err = errors.New("connection refused")
+	broker = NewBroker(zap.NewNop().Sugar())
+	assert.EqualError(t, broker.PrewarmProviders(client), "failed to fetch provider AWS: connection refused")
+}
@@ -0,0 +1,81 @@
+package broker
+
+import (
+	"net/http"
+	"sync"
+)
+
+// defaultRetryAfter is the Retry-After, in seconds, of rate limited requests
+// if Atlas didn't specify one.
+const defaultRetryAfter = "60"
+
+// rateLimitRecorder is an http.RoundTripper which records whether any request
+// to Atlas was rate limited, together with the Retry-After Atlas returned.
+type rateLimitRecorder struct {
+	transport http.RoundTripper
+
+	mutex      sync.Mutex
+	limited    bool
+	retryAfter string
+}
+
+func (r *rateLimitRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := r.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		r.mutex.Lock()
+		r.limited = true
+		r.retryAfter = resp.Header.Get("Retry-After")
+		r.mutex.Unlock()
+	}
+
+	return resp, err
+}
+
+// retryLater records a Retry-After for a 503 response the broker returns
+// itself, for example while Atlas is maintaining a cluster.
+func (r *rateLimitRecorder) retryLater(retryAfter string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.limited = true
+	r.retryAfter = retryAfter
+}
+
+// RetryAfter returns the Retry-After of the last rate limited request, or
+// false if no request was rate limited.
+func (r *rateLimitRecorder) RetryAfter() (string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.limited {
+		return "", false
+	}
+
+	if r.retryAfter == "" {
+		return defaultRetryAfter, true
+	}
+
+	return r.retryAfter, true
+}
+
+// retryAfterWriter adds the Retry-After header to 503 responses caused by
+// Atlas rate limiting, so platforms back off before retrying.
+type retryAfterWriter struct {
+	http.ResponseWriter
+	limits *rateLimitRecorder
+}
+
+func (w *retryAfterWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable {
+		if retryAfter, ok := w.limits.RetryAfter(); ok {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,53 @@
+package broker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRateLimitTest(retryAfter string) *httptest.ResponseRecorder {
+	atlasServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Trigger the digest process for unauthenticated requests.
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer atlasServer.Close()
+
+	broker, _, _ := setupTest()
+	handler := AuthMiddleware(atlasServer.URL, "")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := broker.GetInstance(r.Context(), "instance")
+		respondWithError(w, err)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/service_instances/instance", nil)
+	req.SetBasicAuth("public-key@group-id", "private-key")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	recorder := setupRateLimitTest("30")
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "30", recorder.Header().Get("Retry-After"))
+}
+
+func TestRateLimitDefaultRetryAfter(t *testing.T) {
+	recorder := setupRateLimitTest("")
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, defaultRetryAfter, recorder.Header().Get("Retry-After"))
+}
@@ -0,0 +1,382 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// Defaults of the startup reconcile.
+const (
+	DefaultReconcileBatchSize        = 100
+	DefaultReconcileConcurrency      = 4
+	DefaultReconcileRateLimitBackoff = 30 * time.Second
+	DefaultReconcileRetryInterval    = time.Minute
+)
+
+const (
+	// maxReconcileBatchSize is the most clusters Atlas returns per page.
+	maxReconcileBatchSize = 500
+
+	// maxReconcileRateLimitRetries is how often a rate limited page is
+	// fetched again before the reconcile is interrupted.
+	maxReconcileRateLimitRetries = 5
+
+	// reconcileCheckpointKey is the key of the operation the progress of an
+	// interrupted reconcile is recorded under. reconcileCheckpointTTL is
+	// how long it's resumed from, older checkpoints start over.
+	reconcileCheckpointKey = "reconcile/checkpoint"
+	reconcileCheckpointTTL = 24 * time.Hour
+)
+
+// ValidateReconcileSettings checks the batch size and concurrency of the
+// startup reconcile.
+func ValidateReconcileSettings(batchSize int, concurrency int) error {
+	if batchSize < 1 || batchSize > maxReconcileBatchSize {
+		return fmt.Errorf("batch size %d must be between 1 and %d", batchSize, maxReconcileBatchSize)
+	}
+
+	if concurrency < 1 {
+		return fmt.Errorf("concurrency %d must be at least 1", concurrency)
+	}
+
+	return nil
+}
+
+// ReconcileResult summarizes a completed reconcile. Clusters is the number of
+// clusters listed in Atlas, Managed those belonging to an instance, and
+// Missing the instances without a cluster in Atlas.
+type ReconcileResult struct {
+	Clusters int
+	Managed  int
+	Missing  int
+}
+
+// reconcileCheckpoint is the progress of a reconcile. Pages only line up if
+// they're fetched from the same project with the same batch size.
+type reconcileCheckpoint struct {
+	ProjectID      string   `json:"projectId"`
+	BatchSize      int      `json:"batchSize"`
+	TotalCount     int      `json:"totalCount"`
+	CompletedPages []int    `json:"completedPages"`
+	Managed        []string `json:"managed"`
+}
+
+func (c reconcileCheckpoint) pages() int {
+	return (c.TotalCount + c.BatchSize - 1) / c.BatchSize
+}
+
+// RunReconcile will reconcile the state store with the clusters in Atlas
+// once, using the reconcile client. Interrupted reconciles are retried at
+// the retry interval, resuming where they left off, until they complete or
+// the context is cancelled.
+func (b Broker) RunReconcile(ctx context.Context) {
+	if b.config.ReconcileClient == nil {
+		return
+	}
+
+	for {
+		result, err := b.Reconcile(ctx, b.config.ReconcileClient)
+		if err == nil {
+			b.logger.Infow("Reconciled the state with Atlas", "clusters", result.Clusters, "managed", result.Managed, "missing", result.Missing)
+			return
+		}
+
+		b.logger.Errorw("Reconcile interrupted, resuming later", "error", err, "retry_interval", b.config.ReconcileRetryInterval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.config.ReconcileRetryInterval):
+		}
+	}
+}
+
+// Reconcile will page through the clusters of the client's project in
+// batches, fetching up to ReconcileConcurrency pages at once, and record the
+// state of each cluster on its instance. Instances whose clusters aren't
+// listed are logged once all pages have been fetched.
+//
+// Progress is checkpointed in the store after every page, so a reconcile
+// interrupted by an error, rate limiting, or the context resumes from the
+// remaining pages. Clusters created or deleted in the meantime may shift
+// between pages, they're reconciled on the next run.
+func (b Broker) Reconcile(ctx context.Context, client atlas.Client) (*ReconcileResult, error) {
+	project, err := client.GetProject()
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := b.reconcileInstances(project.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := b.reconcileCheckpoint(project.ID)
+
+	r := &reconciler{
+		broker:     b,
+		client:     client,
+		instances:  instances,
+		checkpoint: checkpoint,
+		completed:  map[int]bool{},
+		managed:    map[string]bool{},
+	}
+	for _, page := range checkpoint.CompletedPages {
+		r.completed[page] = true
+	}
+	for _, instanceID := range checkpoint.Managed {
+		r.managed[instanceID] = true
+	}
+
+	// The first page tells how many there are.
+	if !r.completed[1] {
+		if err := r.reconcilePage(ctx, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.reconcilePages(ctx); err != nil {
+		return nil, err
+	}
+
+	result := &ReconcileResult{Clusters: r.checkpoint.TotalCount, Managed: len(r.managed)}
+	for clusterName, instanceID := range instances {
+		if !r.managed[instanceID] {
+			result.Missing++
+			b.logger.Warnw("Instance has no cluster in Atlas", "instance_id", instanceID, "cluster_name", clusterName)
+		}
+	}
+
+	b.store.DeleteOperation(reconcileCheckpointKey)
+	return result, nil
+}
+
+// reconcileInstances returns the IDs of the instances in a project by the
+// names of their clusters. Instances without a recorded project are in the
+// project of the API key.
+func (b Broker) reconcileInstances(projectID string) (map[string]string, error) {
+	instances := map[string]string{}
+	for offset := 0; ; offset += sweepPageSize {
+		page, err := b.store.ListInstances(state.InstanceFilter{}, offset, sweepPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, instance := range page {
+			if instance.ProjectID == "" || instance.ProjectID == projectID {
+				instances[b.clusterName(instance.ID)] = instance.ID
+			}
+		}
+
+		if len(page) < sweepPageSize {
+			return instances, nil
+		}
+	}
+}
+
+// reconcileCheckpoint returns the checkpoint to resume from, or a new one if
+// it can't be resumed.
+func (b Broker) reconcileCheckpoint(projectID string) reconcileCheckpoint {
+	fresh := reconcileCheckpoint{ProjectID: projectID, BatchSize: b.config.ReconcileBatchSize}
+
+	operation, err := b.store.GetOperation(reconcileCheckpointKey)
+	if err != nil || operation.Expired() {
+		return fresh
+	}
+
+	var checkpoint reconcileCheckpoint
+	if err := json.Unmarshal(operation.Result, &checkpoint); err != nil {
+		b.logger.Warnw("Discarding invalid reconcile checkpoint", "error", err)
+		return fresh
+	}
+
+	if checkpoint.ProjectID != fresh.ProjectID || checkpoint.BatchSize != fresh.BatchSize {
+		return fresh
+	}
+
+	b.logger.Infow("Resuming reconcile", "completed_pages", len(checkpoint.CompletedPages), "pages", checkpoint.pages())
+	return checkpoint
+}
+
+// reconciler keeps the progress of a single reconcile.
+type reconciler struct {
+	broker    Broker
+	client    atlas.Client
+	instances map[string]string
+
+	mutex      sync.Mutex
+	checkpoint reconcileCheckpoint
+	completed  map[int]bool
+	managed    map[string]bool
+}
+
+// reconcilePages will reconcile all pages which haven't been completed,
+// fetching them concurrently. The first error stops pages from being started
+// and is returned once the pages in flight are done.
+func (r *reconciler) reconcilePages(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pages := make(chan int)
+	errs := make(chan error, r.broker.config.ReconcileConcurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.broker.config.ReconcileConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pages {
+				if err := r.reconcilePage(ctx, page); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+	r.mutex.Lock()
+	total := r.checkpoint.pages()
+	r.mutex.Unlock()
+
+feed:
+	for page := 2; page <= total; page++ {
+		r.mutex.Lock()
+		done := r.completed[page]
+		r.mutex.Unlock()
+		if done {
+			continue
+		}
+
+		select {
+		case pages <- page:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(pages)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// reconcilePage will fetch a page of clusters, record their states, and
+// checkpoint the page as completed.
+func (r *reconciler) reconcilePage(ctx context.Context, pageNum int) error {
+	page, err := r.listClusters(ctx, pageNum)
+	if err != nil {
+		return err
+	}
+
+	var managed []string
+	for _, cluster := range page.Results {
+		instanceID, ok := r.instances[cluster.Name]
+		if !ok {
+			continue
+		}
+
+		if err := r.broker.recordClusterState(instanceID, cluster.StateName); err != nil {
+			return err
+		}
+		managed = append(managed, instanceID)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.checkpoint.TotalCount = page.TotalCount
+	r.completed[pageNum] = true
+	for _, instanceID := range managed {
+		r.managed[instanceID] = true
+	}
+
+	r.checkpoint.CompletedPages = sortedPages(r.completed)
+	r.checkpoint.Managed = make([]string, 0, len(r.managed))
+	for instanceID := range r.managed {
+		r.checkpoint.Managed = append(r.checkpoint.Managed, instanceID)
+	}
+	sort.Strings(r.checkpoint.Managed)
+
+	data, err := json.Marshal(r.checkpoint)
+	if err != nil {
+		return err
+	}
+
+	err = r.broker.store.PutOperation(state.Operation{
+		Key:       reconcileCheckpointKey,
+		Result:    data,
+		ExpiresAt: time.Now().Add(reconcileCheckpointTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	r.broker.logger.Infow("Reconciled page of clusters", "page", pageNum, "completed_pages", len(r.completed), "pages", r.checkpoint.pages())
+	return nil
+}
+
+// listClusters will fetch a page of clusters, waiting for the rate limit
+// backoff whenever Atlas rate limits the request.
+func (r *reconciler) listClusters(ctx context.Context, pageNum int) (*atlas.ClusterPage, error) {
+	for retries := 0; ; retries++ {
+		page, err := r.client.ListClusters(pageNum, r.checkpoint.BatchSize)
+		if err != atlas.ErrRateLimited {
+			return page, err
+		}
+		if retries == maxReconcileRateLimitRetries {
+			return nil, err
+		}
+
+		r.broker.logger.Warnw("Reconcile rate limited by Atlas, backing off", "page", pageNum, "backoff", r.broker.config.ReconcileRateLimitBackoff)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(r.broker.config.ReconcileRateLimitBackoff):
+		}
+	}
+}
+
+// recordClusterState will record the state of a cluster on its instance,
+// unless the instance has been removed in the meantime.
+func (b Broker) recordClusterState(instanceID string, clusterState string) error {
+	unlock := b.store.Lock("instance/" + instanceID)
+	defer unlock()
+
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if instance.ClusterState == clusterState {
+		return nil
+	}
+
+	instance.ClusterState = clusterState
+	return b.store.PutInstance(*instance)
+}
+
+func sortedPages(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	return keys
+}
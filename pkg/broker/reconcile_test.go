@@ -0,0 +1,164 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// pagingClient records the pages of clusters listed and how many were listed
+// at once. Pages in failures fail the first time they're listed.
+type pagingClient struct {
+	MockAtlasClient
+	failures map[int]error
+
+	mutex    sync.Mutex
+	pages    []int
+	inFlight int
+	maxInUse int
+}
+
+func (c *pagingClient) ListClusters(pageNum int, itemsPerPage int) (*atlas.ClusterPage, error) {
+	c.mutex.Lock()
+	c.pages = append(c.pages, pageNum)
+	c.inFlight++
+	if c.inFlight > c.maxInUse {
+		c.maxInUse = c.inFlight
+	}
+	err, failed := c.failures[pageNum]
+	delete(c.failures, pageNum)
+	c.mutex.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	c.mutex.Lock()
+	c.inFlight--
+	c.mutex.Unlock()
+
+	if failed {
+		return nil, err
+	}
+
+	return c.MockAtlasClient.ListClusters(pageNum, itemsPerPage)
+}
+
+// setupReconcileTest creates a broker with instances whose clusters are in
+// Atlas, and the specified number of instances without a cluster and
+// clusters without an instance.
+func setupReconcileTest(instances int, missing int, unmanaged int) (*Broker, MockAtlasClient) {
+	_, client, _ := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		ReconcileBatchSize:        100,
+		ReconcileConcurrency:      4,
+		ReconcileRateLimitBackoff: time.Millisecond,
+	})
+
+	for i := 0; i < instances; i++ {
+		instanceID := fmt.Sprintf("instance-%04d", i)
+		broker.store.PutInstance(state.Instance{ID: instanceID, ClusterState: atlas.ClusterStateCreating})
+		client.Clusters[NormalizeClusterName(instanceID)] = &atlas.Cluster{Name: NormalizeClusterName(instanceID), StateName: atlas.ClusterStateIdle}
+	}
+
+	for i := 0; i < missing; i++ {
+		broker.store.PutInstance(state.Instance{ID: fmt.Sprintf("missing-%04d", i)})
+	}
+
+	for i := 0; i < unmanaged; i++ {
+		name := fmt.Sprintf("unmanaged-%04d", i)
+		client.Clusters[name] = &atlas.Cluster{Name: name, StateName: atlas.ClusterStateIdle}
+	}
+
+	return broker, client
+}
+
+func TestReconcile(t *testing.T) {
+	broker, mock := setupReconcileTest(2000, 3, 450)
+	client := &pagingClient{MockAtlasClient: mock}
+
+	result, err := broker.Reconcile(context.Background(), client)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, &ReconcileResult{Clusters: 2450, Managed: 2000, Missing: 3}, result)
+	assert.Len(t, client.pages, 25)
+	assert.True(t, client.maxInUse <= 4, "Expected at most 4 pages to be listed at once, got %d", client.maxInUse)
+
+	instance, err := broker.store.GetInstance("instance-1234")
+	if assert.NoError(t, err) {
+		assert.Equal(t, atlas.ClusterStateIdle, instance.ClusterState)
+	}
+
+	// Completed reconciles aren't resumed.
+	_, err = broker.store.GetOperation(reconcileCheckpointKey)
+	assert.Equal(t, state.ErrNotFound, err)
+}
+
+func TestReconcileRateLimited(t *testing.T) {
+	broker, mock := setupReconcileTest(500, 0, 0)
+	client := &pagingClient{MockAtlasClient: mock, failures: map[int]error{1: atlas.ErrRateLimited, 3: atlas.ErrRateLimited}}
+
+	result, err := broker.Reconcile(context.Background(), client)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 500, result.Managed)
+	}
+
+	// Rate limited pages are listed again after the backoff.
+	assert.Len(t, client.pages, 7)
+}
+
+func TestReconcileResumes(t *testing.T) {
+	broker, mock := setupReconcileTest(1000, 1, 0)
+	client := &pagingClient{MockAtlasClient: mock, failures: map[int]error{6: errors.New("connection reset")}}
+
+	_, err := broker.Reconcile(context.Background(), client)
+	assert.EqualError(t, err, "connection reset")
+
+	// Only the pages which weren't completed are listed again.
+	completed := map[int]bool{}
+	for _, page := range client.pages {
+		completed[page] = page != 6
+	}
+	client.pages = nil
+
+	result, err := broker.Reconcile(context.Background(), client)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, &ReconcileResult{Clusters: 1000, Managed: 1000, Missing: 1}, result)
+	assert.Contains(t, client.pages, 6)
+	for _, page := range client.pages {
+		assert.False(t, completed[page], "Expected page %d not to be listed again", page)
+	}
+}
+
+func TestReconcileCancelled(t *testing.T) {
+	broker, mock := setupReconcileTest(300, 0, 0)
+	client := &pagingClient{MockAtlasClient: mock}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := broker.Reconcile(ctx, client)
+	assert.Equal(t, context.Canceled, err)
+
+	// The first page was checkpointed before the others were stopped.
+	_, err = broker.store.GetOperation(reconcileCheckpointKey)
+	assert.NoError(t, err)
+}
+
+func TestValidateReconcileSettings(t *testing.T) {
+	assert.NoError(t, ValidateReconcileSettings(DefaultReconcileBatchSize, DefaultReconcileConcurrency))
+	assert.Error(t, ValidateReconcileSettings(0, 1))
+	assert.Error(t, ValidateReconcileSettings(501, 1))
+	assert.Error(t, ValidateReconcileSettings(100, 0))
+}
@@ -0,0 +1,149 @@
+package broker
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// regionNameSchemaPath is the path of the region in the provision schema.
+var regionNameSchemaPath = []string{"cluster", "providerSettings", "regionName"}
+
+// availableRegionKeys returns the sorted keys of the regions an instance
+// size is available in. Nil is returned if Atlas doesn't list its regions.
+func availableRegionKeys(instanceSize atlas.InstanceSize) []string {
+	if len(instanceSize.AvailableRegions) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(instanceSize.AvailableRegions))
+	for i, region := range instanceSize.AvailableRegions {
+		keys[i] = region.Key
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// clusterRegions returns the regions a cluster is deployed to, either the
+// region of its provider settings or the regions of its replication specs.
+func clusterRegions(cluster *atlas.Cluster) []string {
+	var regions []string
+	if cluster.ProviderSettings != nil && cluster.ProviderSettings.RegionName != "" {
+		regions = append(regions, cluster.ProviderSettings.RegionName)
+	}
+
+	for _, spec := range cluster.ReplicationSpecs {
+		for region := range spec.RegionsConfig {
+			if !containsString(regions, region) {
+				regions = append(regions, region)
+			}
+		}
+	}
+
+	sort.Strings(regions)
+	return regions
+}
+
+// validateRegionAvailability rejects clusters deployed to regions in which
+// Atlas doesn't offer their instance size, if the broker validates region
+// availability. Instance sizes without region data, and providers which
+// can't be fetched, are left for Atlas to validate.
+func (b Broker) validateRegionAvailability(client atlas.Client, cluster *atlas.Cluster) error {
+	if !b.config.ValidateRegionAvailability || cluster.ProviderSettings == nil {
+		return nil
+	}
+
+	regions := clusterRegions(cluster)
+	if len(regions) == 0 {
+		return nil
+	}
+
+	providerName := cluster.ProviderSettings.ProviderName
+	instanceSizeName := cluster.ProviderSettings.InstanceSizeName
+	provider, err := providerByName(client, providerName)
+	if err != nil {
+		b.logger.Warnw("Failed to fetch provider, region availability isn't validated", "error", err, "provider", providerName)
+		return nil
+	}
+
+	available := availableRegionKeys(provider.InstanceSizes[instanceSizeName])
+	if available == nil {
+		return nil
+	}
+
+	for _, region := range regions {
+		if !containsString(available, region) {
+			err := fmt.Errorf(`Instance size %s isn't available in region "%s" of %s, available regions are %s`, instanceSizeName, region, providerName, strings.Join(available, ", "))
+			remediation := fmt.Sprintf("pick one of the regions %s, or a plan available in %s", strings.Join(available, ", "), region)
+			return newRemediableError(err, http.StatusUnprocessableEntity, "region-unavailable", remediation)
+		}
+	}
+
+	return nil
+}
+
+// withRegionSchemas returns a copy of the service with the provision schema
+// of each plan limiting the region to the ones its instance size is
+// available in, if the broker validates region availability.
+func (b Broker) withRegionSchemas(svc catalogService, provider *atlas.Provider) catalogService {
+	if !b.config.ValidateRegionAvailability || provider == nil {
+		return svc
+	}
+
+	plans := make([]catalogPlan, len(svc.Plans))
+	for i, plan := range svc.Plans {
+		available := availableRegionKeys(provider.InstanceSizes[plan.Name])
+		if available != nil {
+			plan.ProvisionSchema = withRegionEnum(plan.ProvisionSchema, available)
+		}
+
+		plans[i] = plan
+	}
+
+	svc.Plans = plans
+	return svc
+}
+
+// withRegionEnum returns a copy of a provision schema, or a new one if nil,
+// with the region limited to the specified regions. Only the objects along
+// the region's path are copied.
+func withRegionEnum(schema map[string]interface{}, regions []string) map[string]interface{} {
+	if schema == nil {
+		schema = openParametersSchema()
+	}
+
+	root := copySchemaObject(schema)
+	object := root
+	for _, key := range regionNameSchemaPath {
+		object["type"] = "object"
+
+		properties, _ := object["properties"].(map[string]interface{})
+		properties = copySchemaObject(properties)
+		object["properties"] = properties
+
+		property, _ := properties[key].(map[string]interface{})
+		property = copySchemaObject(property)
+		properties[key] = property
+
+		object = property
+	}
+
+	object["type"] = "string"
+	object["enum"] = regions
+	return root
+}
+
+// copySchemaObject returns a shallow copy of a schema object, or an empty
+// object if nil.
+func copySchemaObject(object map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		copied[key] = value
+	}
+
+	return copied
+}
@@ -0,0 +1,108 @@
+package broker
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestProvisionRegionAvailability(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		status int
+	}{
+		{"available region", `{"cluster": {"providerSettings": {"regionName": "US_EAST_1"}}}`, 0},
+		{"unavailable region", `{"cluster": {"providerSettings": {"regionName": "EU_WEST_1"}}}`, http.StatusUnprocessableEntity},
+		{"unavailable multi-region", `{"cluster": {"replicationSpecs": [{"numShards": 1, "regionsConfig": {"US_EAST_1": {"electableNodes": 2}, "EU_WEST_1": {"electableNodes": 1}}}]}}`, http.StatusUnprocessableEntity},
+		{"region picked by Atlas", `{}`, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ValidateRegionAvailability: true})
+
+			_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+				PlanID:        testPlanID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(test.params),
+			}, true)
+			if test.status == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			if assert.Error(t, err) {
+				assert.Equal(t, test.status, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+				assert.Contains(t, err.Error(), `Instance size M10 isn't available in region "EU_WEST_1" of AWS, available regions are US_EAST_1`)
+				assert.Contains(t, err.Error(), "Remediation: pick one of the regions US_EAST_1, or a plan available in EU_WEST_1")
+			}
+			assert.Nil(t, client.Clusters["instance"])
+		})
+	}
+}
+
+func TestProvisionRegionAvailabilityDisabled(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"providerSettings": {"regionName": "EU_WEST_1"}}}`),
+	}, true)
+	assert.NoError(t, err)
+}
+
+func TestProvisionRegionAvailabilityWithoutRegionData(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ValidateRegionAvailability: true})
+
+	// M30 doesn't list its regions, so Atlas validates them.
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        "aosb-cluster-plan-aws-m30",
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"providerSettings": {"regionName": "EU_WEST_1"}}}`),
+	}, true)
+	assert.NoError(t, err)
+	assert.NotNil(t, client.Clusters["instance"])
+}
+
+func TestCatalogRegionSchemas(t *testing.T) {
+	_, _, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{ValidateRegionAvailability: true})
+
+	services, err := broker.catalog(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, plan := range services[0].Plans {
+		if plan.Name != "M10" {
+			assert.Nil(t, plan.ProvisionSchema, plan.Name)
+			continue
+		}
+
+		cluster := plan.ProvisionSchema["properties"].(map[string]interface{})["cluster"].(map[string]interface{})
+		providerSettings := cluster["properties"].(map[string]interface{})["providerSettings"].(map[string]interface{})
+		regionName := providerSettings["properties"].(map[string]interface{})["regionName"]
+		assert.Equal(t, map[string]interface{}{"type": "string", "enum": []string{"US_EAST_1"}}, regionName)
+	}
+}
+
+func TestWithRegionEnumKeepsSchema(t *testing.T) {
+	schema := requiredParametersSchema([]string{"cluster.providerSettings.regionName"})
+	narrowed := withRegionEnum(schema, []string{"EU_WEST_1", "US_EAST_1"})
+
+	settings := narrowed["properties"].(map[string]interface{})["cluster"].(map[string]interface{})["properties"].(map[string]interface{})["providerSettings"].(map[string]interface{})
+	assert.Equal(t, []string{"regionName"}, settings["required"])
+	assert.Equal(t, []string{"EU_WEST_1", "US_EAST_1"}, settings["properties"].(map[string]interface{})["regionName"].(map[string]interface{})["enum"])
+
+	// The original schema isn't changed.
+	original := schema["properties"].(map[string]interface{})["cluster"].(map[string]interface{})["properties"].(map[string]interface{})["providerSettings"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{}, original["properties"].(map[string]interface{})["regionName"])
+}
@@ -0,0 +1,87 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// replicaSetNamePattern matches the replica set names Atlas accepts.
+var replicaSetNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]*$`)
+
+// maxReplicaSetNameLength is the longest replica set name Atlas accepts.
+const maxReplicaSetNameLength = 64
+
+// replicaSetNameFromParams returns the replica set name passed as
+// {"replica_set_name": "..."}, or an empty string to use the Atlas default.
+func replicaSetNameFromParams(rawParams []byte) (string, error) {
+	params := struct {
+		ReplicaSetName string `json:"replica_set_name"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return "", newInvalidParamsError(err)
+		}
+	}
+
+	return params.ReplicaSetName, nil
+}
+
+// validateReplicaSetName rejects replica set names Atlas doesn't accept, and
+// names for clusters which don't have a single replica set of their own:
+// sharded clusters and shared instance sizes.
+func validateReplicaSetName(name string, cluster *atlas.Cluster) error {
+	if len(name) > maxReplicaSetNameLength || !replicaSetNamePattern.MatchString(name) {
+		err := fmt.Errorf(`Invalid replica set name "%s"`, name)
+		return newRemediableError(err, http.StatusBadRequest, "invalid-replica-set-name", remediationInvalidReplicaSetName)
+	}
+
+	if cluster.ProviderSettings != nil && isSharedInstanceSize(cluster.ProviderSettings.InstanceSizeName) {
+		err := errors.New("The replica set name of shared clusters can't be set")
+		return newRemediableError(err, http.StatusUnprocessableEntity, "replica-set-name-unsupported", remediationUnsupportedReplicaSetName)
+	}
+
+	if containsString(requestedFeatures(cluster), featureSharding) {
+		err := errors.New("The replica set name of sharded clusters can't be set")
+		return newRemediableError(err, http.StatusUnprocessableEntity, "replica-set-name-unsupported", remediationUnsupportedReplicaSetName)
+	}
+
+	return nil
+}
+
+// validateReplicaSetNameUpdate rejects updates changing the replica set name,
+// which Atlas only lets us set when creating a cluster. Passing the name the
+// instance was provisioned with is allowed.
+func (b Broker) validateReplicaSetNameUpdate(instanceID string, rawParams []byte) error {
+	name, err := replicaSetNameFromParams(rawParams)
+	if err != nil || name == "" {
+		return err
+	}
+
+	instance, err := b.store.GetInstance(instanceID)
+	if err != nil && err != state.ErrNotFound {
+		return err
+	}
+
+	if instance != nil && instance.ReplicaSetName == name {
+		return nil
+	}
+
+	err = errors.New("The replica set name can't be changed after the cluster has been created")
+	return newRemediableError(err, http.StatusUnprocessableEntity, "replica-set-name-immutable", remediationImmutableReplicaSetName)
+}
+
+// setReplicaSetName records the replica set name an instance was provisioned
+// with.
+func (b Broker) setReplicaSetName(instanceID string, name string) error {
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.ReplicaSetName = name
+	})
+}
@@ -0,0 +1,121 @@
+package broker
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateReplicaSetName(t *testing.T) {
+	dedicated := &atlas.Cluster{ProviderSettings: &atlas.ProviderSettings{InstanceSizeName: "M10"}}
+
+	for _, name := range []string{"rs0", "migration-rs-1", "A1"} {
+		assert.NoError(t, validateReplicaSetName(name, dedicated), name)
+	}
+
+	for _, name := range []string{"-rs0", "rs_0", "rs/0", "rs 0", "rs.0", string(make([]byte, 65))} {
+		err := validateReplicaSetName(name, dedicated)
+		if assert.Error(t, err, name) {
+			assert.Equal(t, http.StatusBadRequest, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		}
+	}
+
+	long := make([]byte, maxReplicaSetNameLength)
+	for i := range long {
+		long[i] = 'a'
+	}
+	assert.NoError(t, validateReplicaSetName(string(long), dedicated))
+
+	// Names can only be set for dedicated replica sets.
+	for _, cluster := range []*atlas.Cluster{
+		{ProviderSettings: &atlas.ProviderSettings{InstanceSizeName: InstanceSizeNameM2}},
+		{ProviderSettings: &atlas.ProviderSettings{InstanceSizeName: "M30"}, ClusterType: atlas.ClusterTypeSharded},
+	} {
+		err := validateReplicaSetName("rs0", cluster)
+		if assert.Error(t, err) {
+			assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+		}
+	}
+}
+
+func TestProvisionWithReplicaSetName(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"replica_set_name": "migration-rs"}`),
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cluster := client.Clusters[instanceID]
+	assert.Equal(t, "migration-rs", cluster.ReplicaSetName)
+
+	// Atlas reports the name on the processes of the cluster, which is
+	// what the seed list is built from.
+	cluster.ConnectionStrings.Standard = "mongodb://instance-shard-00-00.mongodb.net:27017/?ssl=true"
+	client.Processes["instance-shard-00-00.mongodb.net"] = &atlas.Process{
+		Hostname:       "instance-shard-00-00.mongodb.net",
+		Port:           27017,
+		ReplicaSetName: cluster.ReplicaSetName,
+		TypeName:       atlas.ProcessTypeReplicaPrimary,
+	}
+
+	spec, err := broker.Bind(ctx, instanceID, "binding", brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"srv": false}`),
+	}, true)
+	assert.NoError(t, err)
+	assert.Contains(t, spec.Credentials.(ConnectionDetails).URI, "replicaSet=migration-rs")
+}
+
+func TestProvisionWithInvalidReplicaSetName(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"replica_set_name": "rs_0"}`),
+	}, true)
+	assert.Error(t, err)
+	assert.Nil(t, client.Clusters["instance"])
+}
+
+func TestUpdateReplicaSetName(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"replica_set_name": "rs0"}`),
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+
+	update := func(params string) error {
+		_, err := broker.update(ctx, instanceID, brokerapi.UpdateDetails{
+			ServiceID:     testServiceID,
+			RawParameters: []byte(params),
+		}, true)
+		return err
+	}
+
+	// Passing the same name again is allowed.
+	assert.NoError(t, update(`{"replica_set_name": "rs0"}`))
+
+	err = update(`{"replica_set_name": "rs1"}`)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+}
@@ -0,0 +1,180 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// RequiredParameters lists the provision parameters which must be passed for
+// plans, using plan IDs or names as keys. Parameters are dotted paths into the
+// parameters, for example {"M10": ["cluster.providerSettings.regionName"]}.
+type RequiredParameters map[string][]string
+
+// jsonSchemaDraft is the JSON Schema version of the plan schemas.
+const jsonSchemaDraft = "http://json-schema.org/draft-04/schema#"
+
+// Validate returns an error for empty parameter paths.
+func (r RequiredParameters) Validate() error {
+	for plan, paths := range r {
+		for _, path := range paths {
+			for _, key := range strings.Split(path, ".") {
+				if key == "" {
+					return fmt.Errorf(`invalid required parameter "%s" for plan %s`, path, plan)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// forPlan returns the required parameters of a plan. Parameters listed for
+// the plan ID take precedence over the ones listed for its name.
+func (r RequiredParameters) forPlan(planID string, planName string) []string {
+	if paths, ok := r[planID]; ok {
+		return paths
+	}
+
+	return r[planName]
+}
+
+// validateRequiredParameters returns a 422 naming the first required
+// parameter of the plan which wasn't passed. It runs before the parameters
+// are otherwise validated.
+func (b Broker) validateRequiredParameters(client atlas.Client, serviceID string, planID string, rawParams []byte) error {
+	if len(b.config.RequiredParameters) == 0 {
+		return nil
+	}
+
+	// Invalid plans are rejected later, along with their parameters.
+	planName := ""
+	if provider, err := findProviderByServiceID(client, serviceID); err == nil {
+		if instanceSize, err := findInstanceSizeByPlanID(provider, planID); err == nil {
+			planName = instanceSize.Name
+		}
+	}
+
+	paths := b.config.RequiredParameters.forPlan(planID, planName)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	params := map[string]interface{}{}
+	if len(rawParams) > 0 {
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return newInvalidParamsError(err)
+		}
+	}
+
+	for _, path := range paths {
+		if !hasParameter(params, path) {
+			return newRemediableError(fmt.Errorf(`Missing required parameter "%s"`, path), http.StatusUnprocessableEntity, "missing-required-parameter", remediationMissingParameter)
+		}
+	}
+
+	return nil
+}
+
+// hasParameter returns whether a non-empty value was passed for a dotted
+// parameter path.
+func hasParameter(params map[string]interface{}, path string) bool {
+	var value interface{} = params
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+
+		value = object[key]
+	}
+
+	return value != nil && value != ""
+}
+
+// requiredParametersSchema builds the JSON Schema of provision parameters
+// requiring the specified paths. The types of the required values are left
+// to be validated with the other parameters.
+func requiredParametersSchema(paths []string) map[string]interface{} {
+	return withRequiredParameters(openParametersSchema(), paths)
+}
+
+// withRequiredParameters adds the specified paths to the required properties
+// of an existing schema, which is modified in place.
+func withRequiredParameters(schema map[string]interface{}, paths []string) map[string]interface{} {
+	for _, path := range paths {
+		object := schema
+		for _, key := range strings.Split(path, ".") {
+			// Parents of required values are objects.
+			object["type"] = "object"
+
+			required, _ := object["required"].([]string)
+			if !containsString(required, key) {
+				object["required"] = append(required, key)
+			}
+
+			properties, _ := object["properties"].(map[string]interface{})
+			if properties == nil {
+				properties = map[string]interface{}{}
+				object["properties"] = properties
+			}
+
+			property, _ := properties[key].(map[string]interface{})
+			if property == nil {
+				property = map[string]interface{}{}
+				properties[key] = property
+			}
+
+			object = property
+		}
+	}
+
+	return schema
+}
+
+// withRequiredParameterSchemas returns a copy of the service with the
+// required parameters of its plans reflected in their provisioning schemas.
+func (b Broker) withRequiredParameterSchemas(svc catalogService) catalogService {
+	if len(b.config.RequiredParameters) == 0 {
+		return svc
+	}
+
+	plans := make([]catalogPlan, len(svc.Plans))
+	for i, plan := range svc.Plans {
+		paths := b.config.RequiredParameters.forPlan(plan.ID, plan.Name)
+		if len(paths) > 0 && plan.ProvisionSchema != nil {
+			plan.ProvisionSchema = withRequiredParameters(plan.ProvisionSchema, paths)
+		} else if len(paths) > 0 {
+			plan.ProvisionSchema = requiredParametersSchema(paths)
+		}
+
+		plans[i] = plan
+	}
+
+	svc.Plans = plans
+	return svc
+}
+
+// ReadRequiredParametersFile will read and validate the required provision
+// parameters of plans from a JSON file.
+func ReadRequiredParametersFile(path string) (RequiredParameters, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	required := RequiredParameters{}
+	if err := json.Unmarshal(data, &required); err != nil {
+		return nil, err
+	}
+
+	if err := required.Validate(); err != nil {
+		return nil, err
+	}
+
+	return required, nil
+}
@@ -0,0 +1,106 @@
+package broker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestProvisionRequiredParameters(t *testing.T) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		RequiredParameters: RequiredParameters{"M10": []string{"cluster.providerSettings.regionName"}},
+	})
+
+	for _, params := range []string{"", `{}`, `{"cluster": {"providerSettings": {"regionName": ""}}}`} {
+		_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+			PlanID:        testPlanID,
+			ServiceID:     testServiceID,
+			RawParameters: []byte(params),
+		}, true)
+
+		failure, ok := err.(*apiresponses.FailureResponse)
+		if assert.True(t, ok, "Expected a failure response for %s", params) {
+			assert.Equal(t, 422, failure.ValidatedStatusCode(nil))
+			assert.Contains(t, failure.Error(), `Missing required parameter "cluster.providerSettings.regionName"`)
+		}
+	}
+	assert.Empty(t, client.Clusters)
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"providerSettings": {"regionName": "EU_WEST_1"}}}`),
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "EU_WEST_1", client.Clusters["instance"].ProviderSettings.RegionName)
+}
+
+func TestRequiredParametersSchema(t *testing.T) {
+	_, _, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		Whitelist:          Whitelist{"AWS": []string{"M10", "M20"}},
+		RequiredParameters: RequiredParameters{testPlanID: []string{"cluster.providerSettings.regionName", "cluster.diskSizeGB"}},
+	})
+
+	services, err := broker.Services(ctx)
+	if !assert.NoError(t, err) || !assert.Len(t, services, 1) {
+		return
+	}
+
+	plans := services[0].Plans
+	if !assert.Len(t, plans, 2) || !assert.NotNil(t, plans[0].Schemas) {
+		return
+	}
+
+	expected := map[string]interface{}{
+		"$schema":  jsonSchemaDraft,
+		"type":     "object",
+		"required": []string{"cluster"},
+		"properties": map[string]interface{}{
+			"cluster": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"providerSettings", "diskSizeGB"},
+				"properties": map[string]interface{}{
+					"providerSettings": map[string]interface{}{
+						"type":     "object",
+						"required": []string{"regionName"},
+						"properties": map[string]interface{}{
+							"regionName": map[string]interface{}{},
+						},
+					},
+					"diskSizeGB": map[string]interface{}{},
+				},
+			},
+		},
+	}
+	assert.Equal(t, expected, plans[0].Schemas.Instance.Create.Parameters)
+
+	// Plans without required parameters have no schemas.
+	assert.Nil(t, plans[1].Schemas)
+}
+
+func TestReadRequiredParametersFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "required-parameters")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "required.json")
+	ioutil.WriteFile(path, []byte(`{"M10": ["cluster.providerSettings.regionName"]}`), 0600)
+
+	required, err := ReadRequiredParametersFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, RequiredParameters{"M10": []string{"cluster.providerSettings.regionName"}}, required)
+
+	ioutil.WriteFile(path, []byte(`{"M10": ["cluster..regionName"]}`), 0600)
+	_, err = ReadRequiredParametersFile(path)
+	assert.EqualError(t, err, `invalid required parameter "cluster..regionName" for plan M10`)
+}
@@ -0,0 +1,236 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi"
+)
+
+// Limits on the number of dedicated search nodes Atlas accepts per cluster.
+const (
+	minSearchNodeCount = 2
+	maxSearchNodeCount = 32
+)
+
+// searchNodeInstanceSizePattern matches the instance sizes available for
+// dedicated search nodes, for example "S30_HIGHCPU_NVME".
+var searchNodeInstanceSizePattern = regexp.MustCompile(`^S[0-9]+_(LOWCPU|HIGHCPU)_NVME$`)
+
+// searchNodesStatus is the search node configuration of an instance as
+// reported by GetInstance.
+type searchNodesStatus struct {
+	atlas.SearchNodeSpec
+	StateName string `json:"stateName"`
+}
+
+// searchNodeStatePending is reported for search nodes which will be deployed
+// once the cluster is ready.
+const searchNodeStatePending = "PENDING"
+
+// searchNodesFromParams will extract the requested dedicated search nodes
+// from the raw parameters, passed as "searchNodes". Nil is returned if none
+// were requested.
+func searchNodesFromParams(rawParams []byte) (*atlas.SearchNodeSpec, error) {
+	params := struct {
+		SearchNodes *atlas.SearchNodeSpec `json:"searchNodes"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return nil, newInvalidParamsError(err)
+		}
+	}
+
+	return params.SearchNodes, nil
+}
+
+// validateSearchNodes will make sure the requested search nodes can be
+// deployed alongside the cluster. Search nodes are only available for
+// dedicated tiers.
+func validateSearchNodes(spec *atlas.SearchNodeSpec, cluster *atlas.Cluster) error {
+	var err error
+
+	switch {
+	case cluster.ProviderSettings == nil:
+		err = errors.New("Search nodes require a cluster tier")
+	case cluster.ProviderSettings.ProviderName == "TENANT" || isSharedInstanceSize(cluster.ProviderSettings.InstanceSizeName):
+		err = fmt.Errorf("Search nodes are not supported for instance size %q", cluster.ProviderSettings.InstanceSizeName)
+	case spec.NodeCount < minSearchNodeCount || spec.NodeCount > maxSearchNodeCount:
+		err = fmt.Errorf("Search node count must be between %d and %d, got %d", minSearchNodeCount, maxSearchNodeCount, spec.NodeCount)
+	case !searchNodeInstanceSizePattern.MatchString(spec.InstanceSize):
+		err = fmt.Errorf("Invalid search node instance size %q", spec.InstanceSize)
+	}
+
+	if err != nil {
+		return newRemediableError(err, http.StatusUnprocessableEntity, "invalid-search-nodes", remediationInvalidSearchNodes)
+	}
+
+	return nil
+}
+
+// isSharedInstanceSize returns whether the instance size is a shared tier.
+func isSharedInstanceSize(instanceSizeName string) bool {
+	switch instanceSizeName {
+	case "M0", InstanceSizeNameM2, InstanceSizeNameM5:
+		return true
+	}
+
+	return false
+}
+
+// searchNodesToAPIError converts an error from deploying search nodes into
+// an error response. Atlas rejects search nodes for organizations which
+// aren't entitled to them with a client error, whose description is only
+// logged by the callers.
+func searchNodesToAPIError(err error) error {
+	if isSearchNodesRejection(err) {
+		err := errors.New("Atlas refused to deploy the dedicated search nodes")
+		return newRemediableError(err, http.StatusUnprocessableEntity, "search-nodes-rejected", remediationSearchNodesRejected)
+	}
+
+	return atlasToAPIError(err)
+}
+
+// isSearchNodesRejection returns whether Atlas refused to deploy search nodes
+// as opposed to failing to process the request.
+func isSearchNodesRejection(err error) bool {
+	atlasErr, ok := err.(*atlas.Error)
+	return ok && atlasErr.StatusCode >= 400 && atlasErr.StatusCode < 500
+}
+
+// deploySearchNodes will create or change the dedicated search nodes of a
+// cluster.
+func deploySearchNodes(client atlas.Client, clusterName string, spec atlas.SearchNodeSpec) error {
+	deployment := atlas.SearchDeployment{Specs: []atlas.SearchNodeSpec{spec}}
+
+	_, err := client.GetSearchDeployment(clusterName)
+	if err == atlas.ErrSearchDeploymentNotFound {
+		_, err = client.CreateSearchDeployment(clusterName, deployment)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = client.UpdateSearchDeployment(clusterName, deployment)
+	return err
+}
+
+// setPendingSearchNodes will record search nodes to be deployed once the
+// cluster of an instance is ready.
+func (b Broker) setPendingSearchNodes(instanceID string, spec atlas.SearchNodeSpec) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.PendingSearchNodes = data
+	})
+}
+
+// clearPendingSearchNodes will forget the search nodes waiting to be deployed
+// for an instance.
+func (b Broker) clearPendingSearchNodes(instanceID string) error {
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.PendingSearchNodes = nil
+	})
+}
+
+// pendingSearchNodes will find the search nodes waiting to be deployed for an
+// instance. Nil is returned if there are none.
+func (b Broker) pendingSearchNodes(instanceID string) (*atlas.SearchNodeSpec, error) {
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound || (err == nil && len(instance.PendingSearchNodes) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var spec atlas.SearchNodeSpec
+	err = json.Unmarshal(instance.PendingSearchNodes, &spec)
+	return &spec, err
+}
+
+// searchNodesStatusForInstance will find the search node configuration of
+// an instance, either deployed or pending. Nil is returned if the instance
+// has no search nodes.
+func (b Broker) searchNodesStatusForInstance(client atlas.Client, instanceID string, cluster *atlas.Cluster) (*searchNodesStatus, error) {
+	pending, err := b.pendingSearchNodes(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return &searchNodesStatus{SearchNodeSpec: *pending, StateName: searchNodeStatePending}, nil
+	}
+
+	if cluster.ProviderSettings != nil && cluster.ProviderSettings.ProviderName == "TENANT" {
+		return nil, nil
+	}
+
+	deployment, err := client.GetSearchDeployment(cluster.Name)
+	if err == atlas.ErrSearchDeploymentNotFound || (err == nil && len(deployment.Specs) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &searchNodesStatus{SearchNodeSpec: deployment.Specs[0], StateName: deployment.StateName}, nil
+}
+
+// searchNodesOperationState will determine the state of a provision or update
+// for which the cluster is ready. Pending search nodes are deployed at this
+// point and the operation only succeeds once they are ready as well.
+// Deployments rejected by Atlas fail the operation with a description.
+func (b Broker) searchNodesOperationState(client atlas.Client, instanceID string, cluster *atlas.Cluster) (brokerapi.LastOperationState, string, error) {
+	pending, err := b.pendingSearchNodes(instanceID)
+	if err != nil {
+		return brokerapi.Failed, "", err
+	}
+
+	if pending != nil {
+		err = deploySearchNodes(client, cluster.Name, *pending)
+		if err != nil {
+			// Only give up on search nodes rejected by Atlas. Other errors are
+			// retried on the next poll.
+			if !isSearchNodesRejection(err) {
+				return brokerapi.Failed, "", err
+			}
+
+			b.logger.Errorw("Failed to deploy search nodes", "error", err, "instance_id", instanceID)
+			b.clearPendingSearchNodes(instanceID)
+			return brokerapi.Failed, searchNodesToAPIError(err).Error(), nil
+		}
+
+		b.logger.Infow("Successfully started search node deployment", "instance_id", instanceID, "search_nodes", pending)
+		b.clearPendingSearchNodes(instanceID)
+		return brokerapi.InProgress, "Deploying search nodes", nil
+	}
+
+	if cluster.ProviderSettings != nil && cluster.ProviderSettings.ProviderName == "TENANT" {
+		return brokerapi.Succeeded, "", nil
+	}
+
+	deployment, err := client.GetSearchDeployment(cluster.Name)
+	if err == atlas.ErrSearchDeploymentNotFound {
+		return brokerapi.Succeeded, "", nil
+	}
+	if err != nil {
+		return brokerapi.Failed, "", err
+	}
+
+	if deployment.StateName != atlas.SearchDeploymentStateIdle {
+		return brokerapi.InProgress, "Deploying search nodes", nil
+	}
+
+	return brokerapi.Succeeded, "", nil
+}
@@ -0,0 +1,173 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvisionSearchNodes(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"searchNodes": {"instanceSize": "S30_HIGHCPU_NVME", "nodeCount": 2}}`),
+	}, true)
+	assert.NoError(t, err)
+	assert.Nil(t, client.SearchDeployments[instanceID], "Expected search nodes to wait for the cluster")
+
+	// Search nodes are deployed once the cluster is ready.
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+	resp, err := broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationProvision,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.InProgress, resp.State)
+
+	expectedSpecs := []atlas.SearchNodeSpec{
+		atlas.SearchNodeSpec{InstanceSize: "S30_HIGHCPU_NVME", NodeCount: 2},
+	}
+	if assert.NotNil(t, client.SearchDeployments[instanceID]) {
+		assert.Equal(t, expectedSpecs, client.SearchDeployments[instanceID].Specs)
+	}
+
+	// Only the pending search nodes are cleared from the record.
+	instance, err := broker.store.GetInstance(instanceID)
+	if assert.NoError(t, err) {
+		assert.Empty(t, instance.PendingSearchNodes)
+		assert.Equal(t, testPlanID, instance.PlanID)
+	}
+
+	client.SearchDeployments[instanceID].StateName = atlas.SearchDeploymentStateIdle
+	resp, err = broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationProvision,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.Succeeded, resp.State)
+}
+
+func TestProvisionInvalidSearchNodes(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	tests := map[string]string{
+		"shared tier":    `{"cluster": {"providerSettings": {"instanceSizeName": "M2"}}, "searchNodes": {"instanceSize": "S30_HIGHCPU_NVME", "nodeCount": 2}}`,
+		"too few nodes":  `{"searchNodes": {"instanceSize": "S30_HIGHCPU_NVME", "nodeCount": 1}}`,
+		"too many nodes": `{"searchNodes": {"instanceSize": "S30_HIGHCPU_NVME", "nodeCount": 33}}`,
+		"invalid size":   `{"searchNodes": {"instanceSize": "M30", "nodeCount": 2}}`,
+	}
+
+	for name, params := range tests {
+		_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+			PlanID:        testPlanID,
+			ServiceID:     testServiceID,
+			RawParameters: []byte(params),
+		}, true)
+
+		if assert.Error(t, err, name) {
+			assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil), name)
+		}
+		assert.Nil(t, client.Clusters["instance"], "Expected no cluster to be created for %s", name)
+	}
+}
+
+func TestUpdateSearchNodes(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+
+	// Search nodes are deployed right away for existing clusters.
+	_, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"searchNodes": {"instanceSize": "S20_HIGHCPU_NVME", "nodeCount": 3}}`),
+	}, true)
+	assert.NoError(t, err)
+
+	expectedSpecs := []atlas.SearchNodeSpec{
+		atlas.SearchNodeSpec{InstanceSize: "S20_HIGHCPU_NVME", NodeCount: 3},
+	}
+	if assert.NotNil(t, client.SearchDeployments[instanceID]) {
+		assert.Equal(t, expectedSpecs, client.SearchDeployments[instanceID].Specs)
+	}
+}
+
+func TestUpdateSearchNodesNotEntitled(t *testing.T) {
+	broker, client, _ := setupTest()
+	client.SearchDeploymentErr = &atlas.Error{StatusCode: http.StatusForbidden, Code: "SEARCH_DEPLOYMENT_NOT_ENABLED"}
+	ctx := context.WithValue(context.Background(), ContextKeyAtlasClient, client)
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+
+	// The cluster change has been applied when the search nodes are
+	// rejected, so the update fails as partially applied.
+	_, err := broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"searchNodes": {"instanceSize": "S20_HIGHCPU_NVME", "nodeCount": 2}}`),
+	}, true)
+	assert.NoError(t, err)
+
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+	resp, err := broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{OperationData: OperationUpdate})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.Failed, resp.State)
+	assert.Contains(t, resp.Description, "entitled to dedicated search nodes")
+}
+
+func TestGetInstanceSearchNodes(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"searchNodes": {"instanceSize": "S30_HIGHCPU_NVME", "nodeCount": 2}}`),
+	}, true)
+
+	spec, err := broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+	assert.Equal(t, testServiceID, spec.ServiceID)
+	assert.Equal(t, testPlanID, spec.PlanID)
+
+	params := spec.Parameters.(map[string]interface{})
+	assert.Equal(t, &searchNodesStatus{
+		SearchNodeSpec: atlas.SearchNodeSpec{InstanceSize: "S30_HIGHCPU_NVME", NodeCount: 2},
+		StateName:      searchNodeStatePending,
+	}, params["searchNodes"])
+	assert.Equal(t, 1500, params["connectionLimit"])
+
+	// Once deployed the state is reported by Atlas.
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+	broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationProvision,
+	})
+
+	spec, err = broker.GetInstance(ctx, instanceID)
+	assert.NoError(t, err)
+	params = spec.Parameters.(map[string]interface{})
+	assert.Equal(t, atlas.SearchDeploymentStateUpdating, params["searchNodes"].(*searchNodesStatus).StateName)
+}
+
+func TestGetInstanceNonexistent(t *testing.T) {
+	broker, _, ctx := setupTest()
+
+	_, err := broker.GetInstance(ctx, "instance")
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusNotFound, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+}
@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// errSeedListUnavailable is returned when a seed list is requested for a
+// cluster whose nodes can't be enumerated, for example shared clusters or
+// clusters which haven't been deployed yet.
+var errSeedListUnavailable = errors.New("The hosts of the cluster could not be determined, a connection string without SRV is not available")
+
+// srvFromParams returns whether a binding should use an SRV connection
+// string, which is the default. Passing {"srv": false} requests a seed list
+// for drivers which can't resolve SRV records.
+func srvFromParams(rawParams []byte) (bool, error) {
+	params := struct {
+		SRV *bool `json:"srv"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return false, newInvalidParamsError(err)
+		}
+	}
+
+	return params.SRV == nil || *params.SRV, nil
+}
+
+// bindingURI returns the connection string of a new binding, either the SRV
+// address of the cluster or a seed list of its nodes.
+func bindingURI(client atlas.Client, cluster *atlas.Cluster, rawParams []byte) (string, error) {
+	srv, err := srvFromParams(rawParams)
+	if err != nil {
+		return "", err
+	}
+
+	if srv {
+		return cluster.SrvAddress, nil
+	}
+
+	processes, err := client.GetProcesses()
+	if err != nil {
+		return "", atlasToAPIError(err)
+	}
+
+	return seedListConnectionString(cluster, processes)
+}
+
+// seedListConnectionString builds a standard "mongodb://" connection string
+// listing the nodes of a cluster. Replica sets include their name so drivers
+// discover the topology, sharded clusters list their mongos routers.
+func seedListConnectionString(cluster *atlas.Cluster, processes []atlas.Process) (string, error) {
+	seeds := []string{}
+	replicaSetName := ""
+	sharded := false
+
+	for _, process := range clusterProcesses(processes, clusterHosts(cluster)) {
+		seeds = append(seeds, processHost(process))
+
+		if process.TypeName == atlas.ProcessTypeShardMongos {
+			sharded = true
+		} else if process.ReplicaSetName != "" {
+			replicaSetName = process.ReplicaSetName
+		}
+	}
+
+	if len(seeds) == 0 || (!sharded && replicaSetName == "") {
+		return "", newRemediableError(errSeedListUnavailable, http.StatusUnprocessableEntity, "seed-list-unavailable", remediationSeedListUnavailable)
+	}
+
+	sort.Strings(seeds)
+
+	query := url.Values{}
+	query.Set("ssl", "true")
+	query.Set("authSource", "admin")
+	if !sharded {
+		query.Set("replicaSet", replicaSetName)
+	}
+
+	return "mongodb://" + strings.Join(seeds, ",") + "/?" + query.Encode(), nil
+}
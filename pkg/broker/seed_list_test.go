@@ -0,0 +1,98 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSeedListTest(t *testing.T) (*Broker, MockAtlasClient, context.Context, string) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	cluster := client.Clusters[instanceID]
+	cluster.SrvAddress = "mongodb+srv://instance.mongodb.net"
+	cluster.ConnectionStrings.Standard = "mongodb://instance-shard-00-00.mongodb.net:27017,instance-shard-00-01.mongodb.net:27017/?ssl=true"
+
+	return broker, client, ctx, instanceID
+}
+
+func TestBindSRV(t *testing.T) {
+	broker, _, ctx, instanceID := setupSeedListTest(t)
+
+	spec, err := broker.Bind(ctx, instanceID, "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "mongodb+srv://instance.mongodb.net", spec.Credentials.(ConnectionDetails).URI)
+}
+
+func TestBindSeedList(t *testing.T) {
+	broker, client, ctx, instanceID := setupSeedListTest(t)
+
+	for name, typeName := range map[string]string{
+		"instance-shard-00-01.mongodb.net": "REPLICA_SECONDARY",
+		"instance-shard-00-00.mongodb.net": atlas.ProcessTypeReplicaPrimary,
+		"other-shard-00-00.mongodb.net":    atlas.ProcessTypeReplicaPrimary,
+	} {
+		client.Processes[name] = &atlas.Process{
+			Hostname:       name,
+			Port:           27017,
+			ReplicaSetName: "instance-shard-0",
+			TypeName:       typeName,
+		}
+	}
+
+	spec, err := broker.Bind(ctx, instanceID, "binding", brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"srv": false}`),
+	}, true)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "mongodb://instance-shard-00-00.mongodb.net:27017,instance-shard-00-01.mongodb.net:27017/?authSource=admin&replicaSet=instance-shard-0&ssl=true", spec.Credentials.(ConnectionDetails).URI)
+}
+
+func TestSeedListSharded(t *testing.T) {
+	cluster := &atlas.Cluster{
+		ConnectionStrings: atlas.ConnectionStrings{
+			Standard: "mongodb://instance-mongos-00-00.mongodb.net:27016/?ssl=true",
+		},
+	}
+
+	uri, err := seedListConnectionString(cluster, []atlas.Process{
+		atlas.Process{Hostname: "instance-mongos-00-00.mongodb.net", Port: 27016, TypeName: atlas.ProcessTypeShardMongos},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "mongodb://instance-mongos-00-00.mongodb.net:27016/?authSource=admin&ssl=true", uri)
+}
+
+func TestBindSeedListUnavailable(t *testing.T) {
+	broker, client, ctx, instanceID := setupSeedListTest(t)
+
+	bindingID := "binding"
+	_, err := broker.Bind(ctx, instanceID, bindingID, brokerapi.BindDetails{
+		PlanID:        testPlanID,
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"srv": false}`),
+	}, true)
+
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+	}
+	assert.Nil(t, client.Users[bindingID], "Expected no user to be created")
+}
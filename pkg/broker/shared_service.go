@@ -0,0 +1,54 @@
+package broker
+
+import (
+	"fmt"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// The policies for including the shared service in the catalog.
+const (
+	// SharedServiceAlways always includes the shared service, whether or not
+	// its instance sizes can be provisioned.
+	SharedServiceAlways = "always"
+
+	// SharedServiceProbe only includes the shared service if Atlas offers
+	// its instance sizes in at least one region.
+	SharedServiceProbe = "probe"
+)
+
+// ValidateSharedServicePolicy returns an error for unknown policies.
+func ValidateSharedServicePolicy(policy string) error {
+	if policy != SharedServiceAlways && policy != SharedServiceProbe {
+		return fmt.Errorf(`unknown policy "%s", valid policies are %s and %s`, policy, SharedServiceAlways, SharedServiceProbe)
+	}
+
+	return nil
+}
+
+// sharedServiceAvailable returns whether the shared service is included in
+// the catalog. When probing, the shared provider is fetched through the
+// provider cache, so the result is cached and refreshed with the rest of the
+// catalog. The service is omitted if the provider can't be fetched or none of
+// the shared instance sizes are offered in any region, for example for
+// organizations which can only deploy dedicated clusters.
+func (b Broker) sharedServiceAvailable(client atlas.Client) bool {
+	if b.config.SharedService != SharedServiceProbe {
+		return true
+	}
+
+	provider, err := client.GetProvider(sharedProviderName)
+	if err != nil {
+		b.logger.Warnw("Failed to probe the shared instance sizes, the shared service is omitted", "error", err)
+		return false
+	}
+
+	for _, plan := range sharedService.Plans {
+		if instanceSize, ok := provider.InstanceSizes[plan.Name]; ok && len(instanceSize.AvailableRegions) > 0 {
+			return true
+		}
+	}
+
+	b.logger.Infow("Shared instance sizes can't be provisioned, the shared service is omitted")
+	return false
+}
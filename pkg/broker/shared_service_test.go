@@ -0,0 +1,81 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testSharedProvider = &atlas.Provider{
+	Name: "TENANT",
+	InstanceSizes: map[string]atlas.InstanceSize{
+		"M2": atlas.InstanceSize{Name: "M2", AvailableRegions: []atlas.Region{{Key: "US_EAST_1"}}},
+		"M5": atlas.InstanceSize{Name: "M5", AvailableRegions: []atlas.Region{{Key: "US_EAST_1"}}},
+	},
+}
+
+func TestValidateSharedServicePolicy(t *testing.T) {
+	assert.NoError(t, ValidateSharedServicePolicy(SharedServiceAlways))
+	assert.NoError(t, ValidateSharedServicePolicy(SharedServiceProbe))
+	assert.Error(t, ValidateSharedServicePolicy("never"))
+}
+
+func TestCatalogSharedService(t *testing.T) {
+	dedicatedOnly := &atlas.Provider{Name: "TENANT", InstanceSizes: map[string]atlas.InstanceSize{
+		"M2": atlas.InstanceSize{Name: "M2"},
+	}}
+
+	tests := []struct {
+		name     string
+		policy   string
+		provider *atlas.Provider
+		expected bool
+	}{
+		{"always present by default", "", dedicatedOnly, true},
+		{"present when probed", SharedServiceProbe, testSharedProvider, true},
+		{"omitted without available regions", SharedServiceProbe, dedicatedOnly, false},
+		{"omitted without shared instance sizes", SharedServiceProbe, &atlas.Provider{Name: "TENANT"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			client.Providers["TENANT"] = test.provider
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{SharedService: test.policy})
+
+			services, err := broker.Services(ctx)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			found := false
+			for _, svc := range services {
+				if svc.ID == sharedService.ID {
+					found = true
+				}
+			}
+			assert.Equal(t, test.expected, found)
+		})
+	}
+}
+
+func TestCatalogSharedServiceProbeCached(t *testing.T) {
+	_, client, ctx := setupTest()
+	client.Providers["TENANT"] = &atlas.Provider{Name: "TENANT"}
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{SharedService: SharedServiceProbe})
+
+	services, _ := broker.Services(ctx)
+	assert.Len(t, services, len(providerNames)-1)
+
+	// The probe result is cached with the providers until the catalog is
+	// refreshed.
+	client.Providers["TENANT"] = testSharedProvider
+	services, _ = broker.Services(ctx)
+	assert.Len(t, services, len(providerNames)-1)
+
+	broker.providers.invalidate()
+	services, _ = broker.Services(ctx)
+	assert.Len(t, services, len(providerNames))
+}
@@ -0,0 +1,54 @@
+package broker
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// singleBindingEnabled returns whether any plan is limited to a single
+// binding per instance.
+func (b Broker) singleBindingEnabled() bool {
+	return b.config.SingleBinding || len(b.config.SingleBindingPlans) > 0
+}
+
+// singleBindingApplies returns whether instances of the plan are limited to
+// a single binding, either broker-wide or by plan ID or name.
+func (b Broker) singleBindingApplies(planID string, planName string) bool {
+	return b.config.SingleBinding || containsString(b.config.SingleBindingPlans, planID) || containsString(b.config.SingleBindingPlans, planName)
+}
+
+// lockBindings serializes binds of an instance if bindings are limited, so
+// the check for existing bindings and recording the new one can't race. The
+// returned function releases the lock.
+func (b Broker) lockBindings(instanceID string) func() {
+	if !b.singleBindingEnabled() {
+		return func() {}
+	}
+
+	return b.store.Lock("bindings/" + instanceID)
+}
+
+// validateSingleBinding rejects a binding of an instance limited to a single
+// binding which already has another one. The binding itself doesn't count so
+// retries of the same binding aren't rejected.
+func (b Broker) validateSingleBinding(instanceID string, bindingID string, planID string, planName string) error {
+	if !b.singleBindingApplies(planID, planName) {
+		return nil
+	}
+
+	bindings, err := b.store.ListBindings(state.BindingFilter{InstanceID: instanceID}, 0, 2)
+	if err != nil {
+		return err
+	}
+
+	for _, binding := range bindings {
+		if binding.ID != bindingID {
+			err := fmt.Errorf("Instance %s already has binding %s, only one binding is allowed per instance", instanceID, binding.ID)
+			return newRemediableError(err, http.StatusUnprocessableEntity, "single-binding", remediationSingleBinding)
+		}
+	}
+
+	return nil
+}
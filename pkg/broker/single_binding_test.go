@@ -0,0 +1,101 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func setupSingleBindingTest(config Config) (*Broker, MockAtlasClient, context.Context) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), config)
+
+	broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	return broker, client, ctx
+}
+
+func bindInstance(broker *Broker, ctx context.Context, bindingID string) error {
+	_, err := broker.Bind(ctx, "instance", bindingID, brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	return err
+}
+
+func TestSingleBinding(t *testing.T) {
+	for name, config := range map[string]Config{
+		"broker-wide": {SingleBinding: true},
+		"by plan ID":  {SingleBindingPlans: []string{testPlanID}},
+		"by plan":     {SingleBindingPlans: []string{"M10"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			broker, client, ctx := setupSingleBindingTest(config)
+
+			assert.NoError(t, bindInstance(broker, ctx, "first"))
+			err := bindInstance(broker, ctx, "second")
+			if assert.Error(t, err) {
+				assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+			}
+			assert.Nil(t, client.Users["second"], "Expected no user to be created")
+
+			// Retries of the existing binding are still answered.
+			assert.NoError(t, bindInstance(broker, ctx, "first"))
+
+			// Once the binding is removed another one can be created.
+			_, err = broker.Unbind(ctx, "instance", "first", brokerapi.UnbindDetails{
+				PlanID:    testPlanID,
+				ServiceID: testServiceID,
+			}, true)
+			assert.NoError(t, err)
+			assert.NoError(t, bindInstance(broker, ctx, "second"))
+		})
+	}
+}
+
+func TestSingleBindingOff(t *testing.T) {
+	for name, config := range map[string]Config{
+		"disabled":   {},
+		"other plan": {SingleBindingPlans: []string{"M30"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			broker, _, ctx := setupSingleBindingTest(config)
+
+			assert.NoError(t, bindInstance(broker, ctx, "first"))
+			assert.NoError(t, bindInstance(broker, ctx, "second"))
+		})
+	}
+}
+
+func TestSingleBindingConcurrent(t *testing.T) {
+	broker, _, ctx := setupSingleBindingTest(Config{SingleBinding: true})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = bindInstance(broker, ctx, fmt.Sprintf("binding-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+}
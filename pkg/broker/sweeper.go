@@ -0,0 +1,185 @@
+package broker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// sweepPageSize is how many instances are read from the store at once when
+// sweeping.
+const sweepPageSize = 100
+
+// sweeper keeps the Atlas clients needed to delete instances in the
+// background. Atlas credentials are passed with each request and never
+// stored, so the client of the request which scheduled a deletion is kept in
+// memory until the deletion.
+type sweeper struct {
+	mutex   sync.Mutex
+	clients map[string]atlas.Client
+}
+
+func newSweeper() *sweeper {
+	return &sweeper{clients: map[string]atlas.Client{}}
+}
+
+func (s *sweeper) remember(instanceID string, client atlas.Client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.clients[instanceID] = client
+}
+
+func (s *sweeper) forget(instanceID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.clients, instanceID)
+}
+
+func (s *sweeper) client(instanceID string) (atlas.Client, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	client, ok := s.clients[instanceID]
+	return client, ok
+}
+
+// RunSweeper will sweep the instances at the specified interval until the
+// context is cancelled.
+func (b Broker) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.Sweep()
+		}
+	}
+}
+
+// Sweep will delete the clusters of all instances whose scheduled deletion is
+// due or which have expired. Failures are logged and retried on the next
+// sweep.
+func (b Broker) Sweep() {
+	b.sweep(time.Now())
+}
+
+func (b Broker) sweep(now time.Time) {
+	var due []string
+	for offset := 0; ; offset += sweepPageSize {
+		instances, err := b.store.ListInstances(state.InstanceFilter{}, offset, sweepPageSize)
+		if err != nil {
+			b.logger.Errorw("Failed to list instances to sweep", "error", err)
+			return
+		}
+
+		for _, instance := range instances {
+			if isDeletionDue(instance, now) {
+				due = append(due, instance.ID)
+			}
+		}
+
+		if len(instances) < sweepPageSize {
+			break
+		}
+	}
+
+	for _, instanceID := range due {
+		if err := b.sweepInstance(instanceID, now); err != nil {
+			b.logger.Errorw("Failed to delete swept instance", "error", err, "instance_id", instanceID)
+		}
+	}
+}
+
+// sweepInstance will delete the cluster of an instance if its deletion is
+// still due once the instance is locked. Binds cancel the deletion under the
+// same lock, unless the instance has expired.
+func (b Broker) sweepInstance(instanceID string, now time.Time) error {
+	unlock := b.store.Lock("instance/" + instanceID)
+	defer unlock()
+
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !isDeletionDue(*instance, now) {
+		return nil
+	}
+
+	expired := isDue(instance.ExpiresAt, now)
+
+	bindings, err := b.store.ListBindings(state.BindingFilter{InstanceID: instanceID}, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	// Without credentials, for example after the state has been imported
+	// without an Atlas key, the deletion can't happen. Expired instances are
+	// kept overdue until a request for them passes credentials again, other
+	// deletions are dropped rather than retried forever.
+	client, ok := b.sweeper.client(instanceID)
+	if !ok && expired {
+		b.logger.Warnw("Deferring deletion of expired instance without Atlas credentials", "instance_id", instanceID, "expires_at", instance.ExpiresAt)
+		return nil
+	}
+	if (len(bindings) > 0 && !expired) || !ok {
+		if !ok {
+			b.logger.Warnw("Dropping deletion of instance without Atlas credentials", "instance_id", instanceID)
+		}
+		instance.DeletionScheduledAt = time.Time{}
+		return b.store.PutInstance(*instance)
+	}
+
+	err = client.DeleteCluster(b.clusterName(instanceID))
+	if err != nil && err != atlas.ErrClusterNotFound {
+		return err
+	}
+
+	b.store.DeleteInstance(instanceID)
+	b.sweeper.forget(instanceID)
+
+	// A new instance with the same ID may be provisioned once this one is gone.
+	b.forgetOperations(operationKey(OperationProvision, instanceID), operationKey(OperationUpdate, instanceID))
+
+	if expired {
+		b.logger.Infow("Started deletion of expired instance", "instance_id", instanceID, "expires_at", instance.ExpiresAt)
+	} else {
+		b.logger.Infow("Started deletion of unbound instance", "instance_id", instanceID)
+	}
+	b.recordInstanceOperation(OperationDeprovision, instance.Ephemeral)
+	return nil
+}
+
+// rememberExpiringClient keeps the client of a request for an expiring
+// instance if the sweeper has none for it.
+func (b Broker) rememberExpiringClient(instanceID string, client atlas.Client) {
+	if _, ok := b.sweeper.client(instanceID); ok {
+		return
+	}
+
+	instance, err := b.store.GetInstance(instanceID)
+	if err != nil || instance.ExpiresAt.IsZero() {
+		return
+	}
+
+	b.sweeper.remember(instanceID, client)
+}
+
+func isDeletionDue(instance state.Instance, now time.Time) bool {
+	return isDue(instance.DeletionScheduledAt, now) || isDue(instance.ExpiresAt, now)
+}
+
+func isDue(at time.Time, now time.Time) bool {
+	return !at.IsZero() && !now.Before(at)
+}
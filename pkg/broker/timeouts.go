@@ -0,0 +1,120 @@
+package broker
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// defaultProvisionTimeouts are the provision timeouts used for plans without
+// an override, by the largest tier number they apply to. Larger clusters take
+// longer to create.
+var defaultProvisionTimeouts = []struct {
+	maxTier int
+	timeout time.Duration
+}{
+	{5, 15 * time.Minute},
+	{30, 30 * time.Minute},
+	{60, time.Hour},
+	{200, 2 * time.Hour},
+}
+
+// defaultLargestProvisionTimeout is used for tiers larger than those in
+// defaultProvisionTimeouts and for instance sizes which can't be parsed.
+const defaultLargestProvisionTimeout = 3 * time.Hour
+
+// provisionTimeout returns how long provisioning a cluster of the plan may
+// take. Overrides for the plan ID take precedence over overrides for the
+// instance size.
+func (b Broker) provisionTimeout(planID string, instanceSizeName string) time.Duration {
+	if timeout, ok := b.config.ProvisionTimeouts[planID]; ok {
+		return timeout
+	}
+
+	if timeout, ok := b.config.ProvisionTimeouts[instanceSizeName]; ok {
+		return timeout
+	}
+
+	return defaultProvisionTimeout(instanceSizeName)
+}
+
+// defaultProvisionTimeout returns the default provision timeout for an
+// instance size.
+func defaultProvisionTimeout(instanceSizeName string) time.Duration {
+	tier, ok := instanceSizeTier(instanceSizeName)
+	if !ok {
+		return defaultLargestProvisionTimeout
+	}
+
+	for _, class := range defaultProvisionTimeouts {
+		if tier <= class.maxTier {
+			return class.timeout
+		}
+	}
+
+	return defaultLargestProvisionTimeout
+}
+
+// provisionTimeoutError is returned for provisions which exceeded their
+// timeout before the cluster could be created.
+func provisionTimeoutError(timeout time.Duration) error {
+	err := fmt.Errorf("Provisioning did not complete within %s", timeout)
+	return newRemediableError(err, http.StatusGatewayTimeout, "provision-timed-out", remediationProvisionTimeout)
+}
+
+// setProvisionDeadline will record the deadline of provisioning an instance
+// with the specified timeout.
+func (b Broker) setProvisionDeadline(instanceID string, deadline time.Time, timeout time.Duration) error {
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.ProvisionDeadline = deadline
+		instance.ProvisionTimeout = timeout
+	})
+}
+
+// provisionTimedOut returns whether provisioning of an instance has exceeded
+// its deadline together with a description for the failed operation, so
+// LastOperation can fail stuck provisions. Instances without a recorded
+// deadline never time out.
+func (b Broker) provisionTimedOut(instanceID string) (bool, string, error) {
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	if instance.ProvisionDeadline.IsZero() || time.Now().Before(instance.ProvisionDeadline) {
+		return false, "", nil
+	}
+
+	return true, fmt.Sprintf("Provisioning did not complete within %s", instance.ProvisionTimeout), nil
+}
+
+// ParseProvisionTimeouts parses a comma-separated list of "plan=duration"
+// pairs, where plan is a plan ID or name, for example "M10=20m,M60=90m".
+func ParseProvisionTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf(`invalid provision timeout "%s", expected "plan=duration"`, pair)
+		}
+
+		timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf(`invalid provision timeout "%s", expected a positive duration`, pair)
+		}
+
+		timeouts[strings.TrimSpace(parts[0])] = timeout
+	}
+
+	return timeouts, nil
+}
@@ -0,0 +1,120 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDefaultProvisionTimeout(t *testing.T) {
+	broker, _, _ := setupTest()
+
+	expected := map[string]time.Duration{
+		"M2":       15 * time.Minute,
+		"M10":      30 * time.Minute,
+		"M30":      30 * time.Minute,
+		"R40":      time.Hour,
+		"M60":      time.Hour,
+		"M80_NVME": 2 * time.Hour,
+		"M300":     3 * time.Hour,
+		"unknown":  3 * time.Hour,
+	}
+
+	for instanceSizeName, timeout := range expected {
+		assert.Equal(t, timeout, broker.provisionTimeout("plan", instanceSizeName), instanceSizeName)
+	}
+}
+
+func TestProvisionTimeoutOverrides(t *testing.T) {
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		ProvisionTimeouts: map[string]time.Duration{
+			"M10":                       5 * time.Minute,
+			"aosb-cluster-plan-gcp-m10": 10 * time.Minute,
+		},
+	})
+
+	// Plan IDs take precedence over plan names.
+	assert.Equal(t, 5*time.Minute, broker.provisionTimeout("aosb-cluster-plan-aws-m10", "M10"))
+	assert.Equal(t, 10*time.Minute, broker.provisionTimeout("aosb-cluster-plan-gcp-m10", "M10"))
+	assert.Equal(t, 30*time.Minute, broker.provisionTimeout("aosb-cluster-plan-aws-m20", "M20"))
+}
+
+func TestLastOperationProvisionTimeout(t *testing.T) {
+	broker, client, ctx := setupTest()
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	instance, err := broker.store.GetInstance(instanceID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 30*time.Minute, instance.ProvisionTimeout)
+	}
+
+	resp, err := broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationProvision,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.InProgress, resp.State)
+
+	// Move the deadline into the past to simulate a stuck creation.
+	broker.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.ProvisionDeadline = time.Now().Add(-time.Minute)
+	})
+
+	resp, err = broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationProvision,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.Failed, resp.State)
+	assert.Equal(t, "Provisioning did not complete within 30m0s", resp.Description)
+
+	// Clusters which finished are never considered stuck.
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+	resp, err = broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationProvision,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.Succeeded, resp.State)
+}
+
+func TestProvisionTimeoutBoundsProvisioning(t *testing.T) {
+	broker, client, ctx := setupTest()
+	broker.config.ProvisionTimeouts = map[string]time.Duration{
+		testPlanID: time.Nanosecond,
+	}
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Provisioning did not complete within 1ns")
+	}
+
+	// The cluster isn't created once the timeout has been exceeded.
+	assert.Nil(t, client.Clusters[instanceID])
+}
+
+func TestParseProvisionTimeouts(t *testing.T) {
+	timeouts, err := ParseProvisionTimeouts("M10=20m, aosb-cluster-plan-aws-m60 = 2h,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{
+		"M10":                       20 * time.Minute,
+		"aosb-cluster-plan-aws-m60": 2 * time.Hour,
+	}, timeouts)
+
+	_, err = ParseProvisionTimeouts("M10")
+	assert.Error(t, err)
+
+	_, err = ParseProvisionTimeouts("M10=soon")
+	assert.Error(t, err)
+}
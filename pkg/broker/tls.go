@@ -0,0 +1,133 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+)
+
+// requireTLS enables TLS in a connection string, replacing any options which
+// disable it. ssl, the legacy alias of tls, is removed so it can't conflict.
+// Certificates must be valid if strictCertificates is set. The returned bool
+// reports whether the connection string had TLS disabled.
+func requireTLS(connectionString string, strictCertificates bool) (string, bool, error) {
+	disabled := false
+
+	connectionString, err := withQuery(connectionString, func(query url.Values) {
+		for _, option := range []string{"ssl", "tls"} {
+			if value, ok := query[option]; ok && strings.EqualFold(value[0], "false") {
+				disabled = true
+			}
+		}
+
+		query.Del("ssl")
+		query.Set("tls", "true")
+
+		if strictCertificates {
+			query.Del("tlsInsecure")
+			query.Set("tlsAllowInvalidCertificates", "false")
+		}
+	})
+
+	return connectionString, disabled, err
+}
+
+// requireTLSForBinding enables TLS in the connection strings of a binding if
+// the broker is configured to require or enforce it. Connection strings which
+// had TLS disabled are logged, as Atlas clusters always support TLS.
+func (b Broker) requireTLSForBinding(instanceID string, uri string, connectionStrings atlas.ConnectionStrings) (string, atlas.ConnectionStrings, error) {
+	if !b.config.RequireTLS && !b.config.EnforceTLS {
+		return uri, connectionStrings, nil
+	}
+
+	var err error
+	for _, connectionString := range []*string{
+		&uri,
+		&connectionStrings.Standard,
+		&connectionStrings.StandardSrv,
+		&connectionStrings.Private,
+		&connectionStrings.PrivateSrv,
+	} {
+		var disabled bool
+		*connectionString, disabled, err = requireTLS(*connectionString, b.config.RequireValidCertificates)
+		if err != nil {
+			return uri, connectionStrings, err
+		}
+
+		if disabled {
+			b.logger.Warnw("Enabled TLS in connection string which had it disabled", "instance_id", instanceID)
+		}
+	}
+
+	return uri, connectionStrings, nil
+}
+
+// errPlaintextConnection is returned for bindings which would connect
+// without TLS while TLS is enforced.
+var errPlaintextConnection = errors.New("Bindings must connect using TLS, plaintext connections are refused")
+
+// plaintextRequested returns whether the bind parameters ask for a
+// connection without TLS, passed as {"tls": false} or {"ssl": false}.
+func plaintextRequested(rawParams []byte) (bool, error) {
+	params := struct {
+		TLS *bool `json:"tls"`
+		SSL *bool `json:"ssl"`
+	}{}
+
+	if len(rawParams) > 0 {
+		err := json.Unmarshal(rawParams, &params)
+		if err != nil {
+			return false, newInvalidParamsError(err)
+		}
+	}
+
+	return (params.TLS != nil && !*params.TLS) || (params.SSL != nil && !*params.SSL), nil
+}
+
+// tlsDisabled returns whether a connection string disables TLS.
+func tlsDisabled(connectionString string) (bool, error) {
+	_, disabled, err := requireTLS(connectionString, false)
+	return disabled, err
+}
+
+// validateTLSEnforced refuses bindings which would produce a plaintext
+// connection if TLS is enforced, either because the parameters ask for one
+// or because the connection strings of the cluster disable TLS. It runs
+// before the user is created so refused bindings leave nothing behind.
+func (b Broker) validateTLSEnforced(uri string, connectionStrings atlas.ConnectionStrings, rawParams []byte) error {
+	if !b.config.EnforceTLS {
+		return nil
+	}
+
+	requested, err := plaintextRequested(rawParams)
+	if err != nil {
+		return err
+	}
+	if requested {
+		return newRemediableError(errPlaintextConnection, http.StatusUnprocessableEntity, "plaintext-connection-refused", remediationPlaintextConnection)
+	}
+
+	for _, connectionString := range []string{
+		uri,
+		connectionStrings.Standard,
+		connectionStrings.StandardSrv,
+		connectionStrings.Private,
+		connectionStrings.PrivateSrv,
+	} {
+		disabled, err := tlsDisabled(connectionString)
+		if err != nil {
+			return err
+		}
+
+		if disabled {
+			err := errors.New("The cluster doesn't support TLS, plaintext connections are refused")
+			return newRemediableError(err, http.StatusUnprocessableEntity, "plaintext-connection-refused", remediationPlaintextCluster)
+		}
+	}
+
+	return nil
+}
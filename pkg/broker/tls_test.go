@@ -0,0 +1,121 @@
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRequireTLS(t *testing.T) {
+	tests := []struct {
+		connectionString   string
+		strictCertificates bool
+		expected           string
+		disabled           bool
+	}{
+		{"", false, "", false},
+		{"mongodb+srv://cluster.mongodb.net", false, "mongodb+srv://cluster.mongodb.net/?tls=true", false},
+		{"mongodb://h1,h2/?replicaSet=rs&ssl=true", false, "mongodb://h1,h2/?replicaSet=rs&tls=true", false},
+		{"mongodb://h1/?ssl=false", false, "mongodb://h1/?tls=true", true},
+		{"mongodb://h1/?tls=FALSE&tlsInsecure=true", true, "mongodb://h1/?tls=true&tlsAllowInvalidCertificates=false", true},
+	}
+
+	for _, test := range tests {
+		connectionString, disabled, err := requireTLS(test.connectionString, test.strictCertificates)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, connectionString)
+		assert.Equal(t, test.disabled, disabled)
+	}
+}
+
+func TestBindRequireTLS(t *testing.T) {
+	_, client, ctx := setupTest()
+
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		RequireTLS:               true,
+		RequireValidCertificates: true,
+	})
+
+	instanceID := "instance"
+	broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+
+	// The connection options of the cluster can't disable TLS.
+	client.Clusters[instanceID].SrvAddress = "mongodb+srv://cluster.mongodb.net/?tls=false&tlsAllowInvalidCertificates=true"
+	client.Clusters[instanceID].ConnectionStrings = atlas.ConnectionStrings{
+		Standard: "mongodb://h1:27017,h2:27017/?ssl=false&replicaSet=rs",
+	}
+
+	spec, err := broker.Bind(ctx, instanceID, "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	credentials := spec.Credentials.(ConnectionDetails)
+	assert.Equal(t, "mongodb+srv://cluster.mongodb.net/?tls=true&tlsAllowInvalidCertificates=false", credentials.URI)
+
+	var connectionStrings atlas.ConnectionStrings
+	assert.NoError(t, json.Unmarshal([]byte(credentials.ConnectionString), &connectionStrings))
+	assert.Equal(t, "mongodb://h1:27017,h2:27017/?replicaSet=rs&tls=true&tlsAllowInvalidCertificates=false", connectionStrings.Standard)
+}
+
+func TestBindEnforceTLS(t *testing.T) {
+	tests := []struct {
+		name              string
+		params            string
+		srvAddress        string
+		connectionStrings atlas.ConnectionStrings
+		refused           bool
+	}{
+		{"TLS is enabled", `{}`, "mongodb+srv://cluster.mongodb.net", atlas.ConnectionStrings{}, false},
+		{"TLS requested", `{"tls": true}`, "mongodb+srv://cluster.mongodb.net", atlas.ConnectionStrings{}, false},
+		{"plaintext requested with tls", `{"tls": false}`, "mongodb+srv://cluster.mongodb.net", atlas.ConnectionStrings{}, true},
+		{"plaintext requested with ssl", `{"ssl": false}`, "mongodb+srv://cluster.mongodb.net", atlas.ConnectionStrings{}, true},
+		{"plaintext cluster", `{}`, "mongodb+srv://cluster.mongodb.net/?tls=false", atlas.ConnectionStrings{}, true},
+		{"plaintext connection string", `{}`, "mongodb+srv://cluster.mongodb.net", atlas.ConnectionStrings{Standard: "mongodb://h1:27017/?ssl=false"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, client, ctx := setupTest()
+			broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{EnforceTLS: true})
+
+			instanceID := "instance"
+			broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+				PlanID:    testPlanID,
+				ServiceID: testServiceID,
+			}, true)
+			client.Clusters[instanceID].SrvAddress = test.srvAddress
+			client.Clusters[instanceID].ConnectionStrings = test.connectionStrings
+
+			spec, err := broker.Bind(ctx, instanceID, "binding", brokerapi.BindDetails{
+				PlanID:        testPlanID,
+				ServiceID:     testServiceID,
+				RawParameters: []byte(test.params),
+			}, true)
+
+			if test.refused {
+				if assert.Error(t, err) {
+					assert.Equal(t, http.StatusUnprocessableEntity, err.(*apiresponses.FailureResponse).ValidatedStatusCode(nil))
+				}
+				assert.Nil(t, client.Users["binding"], "Expected no user to be created")
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, "mongodb+srv://cluster.mongodb.net/?tls=true", spec.Credentials.(ConnectionDetails).URI)
+			}
+		})
+	}
+}
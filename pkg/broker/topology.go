@@ -0,0 +1,169 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+)
+
+// EventConnectionStringsChanged is the event sent to the topology webhook
+// when the hosts of a cluster have changed.
+const EventConnectionStringsChanged = "connection_strings_changed"
+
+// webhookTimeout is how long delivering a webhook notification may take.
+const webhookTimeout = 10 * time.Second
+
+// TopologyChangeEvent notifies bound apps that the hosts of a cluster have
+// changed after an update. Seed list connection strings issued before the
+// update no longer work, SRV connection strings are unaffected.
+type TopologyChangeEvent struct {
+	Event             string                  `json:"event"`
+	InstanceID        string                  `json:"instance_id"`
+	PreviousHosts     []string                `json:"previous_hosts"`
+	Hosts             []string                `json:"hosts"`
+	SrvAddress        string                  `json:"srv_address"`
+	ConnectionStrings atlas.ConnectionStrings `json:"connection_strings"`
+	Timestamp         time.Time               `json:"timestamp"`
+}
+
+// sortedClusterHosts returns the hosts of a cluster in a stable order.
+func sortedClusterHosts(cluster *atlas.Cluster) []string {
+	hosts := []string{}
+	for host := range clusterHosts(cluster) {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	return hosts
+}
+
+// recordHosts will store the hosts of a cluster before it's updated, so a
+// change of topology can be detected once the update has completed.
+func (b Broker) recordHosts(instanceID string, cluster *atlas.Cluster) error {
+	return b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.Hosts = sortedClusterHosts(cluster)
+	})
+}
+
+// handleTopologyChange compares the hosts of an updated cluster with those
+// recorded before the update. If they changed the bind results kept for
+// retries are forgotten and the recorded credentials are marked stale, as
+// they contain stale connection strings, and the topology webhook is
+// notified if configured.
+func (b Broker) handleTopologyChange(instanceID string, cluster *atlas.Cluster) {
+	instance, err := b.store.GetInstance(instanceID)
+	if err == state.ErrNotFound || (err == nil && len(instance.Hosts) == 0) {
+		return
+	}
+	if err != nil {
+		b.logger.Errorw("Failed to get recorded hosts", "error", err, "instance_id", instanceID)
+		return
+	}
+
+	hosts := sortedClusterHosts(cluster)
+	previousHosts := instance.Hosts
+
+	// The hosts are only compared once per update.
+	err = b.updateInstance(instanceID, func(instance *state.Instance) {
+		instance.Hosts = nil
+	})
+	if err != nil {
+		b.logger.Errorw("Failed to clear recorded hosts", "error", err, "instance_id", instanceID)
+	}
+
+	if equalStrings(previousHosts, hosts) {
+		return
+	}
+
+	b.logger.Infow("Cluster hosts changed", "instance_id", instanceID, "previous_hosts", previousHosts, "hosts", hosts)
+
+	err = b.store.DeleteOperationsWithPrefix(operationKey(operationBind, instanceID) + "/")
+	if err != nil {
+		b.logger.Errorw("Failed to remove recorded bindings", "error", err, "instance_id", instanceID)
+	}
+
+	err = b.markCredentialsStale(instanceID)
+	if err != nil {
+		b.logger.Errorw("Failed to mark binding credentials stale", "error", err, "instance_id", instanceID)
+	}
+
+	if b.config.TopologyWebhookURL == "" {
+		return
+	}
+
+	err = b.notifyWebhook(TopologyChangeEvent{
+		Event:             EventConnectionStringsChanged,
+		InstanceID:        instanceID,
+		PreviousHosts:     previousHosts,
+		Hosts:             hosts,
+		SrvAddress:        anonymizeConnectionString(cluster.SrvAddress),
+		ConnectionStrings: anonymizeConnectionStrings(cluster.ConnectionStrings),
+		Timestamp:         time.Now().UTC(),
+	})
+	if err != nil {
+		b.logger.Errorw("Failed to notify topology webhook", "error", err, "instance_id", instanceID)
+	}
+}
+
+// markCredentialsStale flags the recorded credentials of all bindings of an
+// instance, so fetching them tells apps that they're out of date.
+func (b Broker) markCredentialsStale(instanceID string) error {
+	for offset := 0; ; offset += sweepPageSize {
+		bindings, err := b.store.ListBindings(state.BindingFilter{InstanceID: instanceID}, offset, sweepPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, binding := range bindings {
+			binding.CredentialsStale = true
+			if err := b.store.PutBinding(binding); err != nil {
+				return err
+			}
+		}
+
+		if len(bindings) < sweepPageSize {
+			return nil
+		}
+	}
+}
+
+// notifyWebhook will post an event as JSON to the topology webhook.
+func (b Broker) notifyWebhook(event interface{}) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(b.config.TopologyWebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
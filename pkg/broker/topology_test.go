@@ -0,0 +1,128 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// setupTopologyTest provisions and binds an instance, then updates it so its
+// hosts are changed to hosts once the update completes.
+func setupTopologyTest(t *testing.T, webhookURL string, hosts string) (*Broker, MockAtlasClient, context.Context, string) {
+	_, client, ctx := setupTest()
+	broker := NewBrokerWithConfig(zap.NewNop().Sugar(), Config{TopologyWebhookURL: webhookURL})
+
+	instanceID := "instance"
+	_, err := broker.Provision(ctx, instanceID, brokerapi.ProvisionDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	client.Clusters[instanceID].ConnectionStrings.Standard = "mongodb://old-00.mongodb.net:27017,old-01.mongodb.net:27017/?ssl=true"
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+
+	_, err = broker.Bind(ctx, instanceID, "binding", brokerapi.BindDetails{
+		PlanID:    testPlanID,
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	_, err = broker.Update(ctx, instanceID, brokerapi.UpdateDetails{
+		PlanID:    "aosb-cluster-plan-aws-m20",
+		ServiceID: testServiceID,
+	}, true)
+	assert.NoError(t, err)
+
+	client.Clusters[instanceID].ConnectionStrings.Standard = hosts
+	client.SetClusterState(instanceID, atlas.ClusterStateIdle)
+
+	return broker, client, ctx, instanceID
+}
+
+func TestTopologyChangeNotification(t *testing.T) {
+	events := make(chan TopologyChangeEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event TopologyChangeEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events <- event
+	}))
+	defer webhook.Close()
+
+	broker, _, ctx, instanceID := setupTopologyTest(t, webhook.URL, "mongodb://new-00.mongodb.net:27017,new-01.mongodb.net:27017/?ssl=true")
+
+	resp, err := broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationUpdate,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, brokerapi.Succeeded, resp.State)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, EventConnectionStringsChanged, event.Event)
+		assert.Equal(t, instanceID, event.InstanceID)
+		assert.Equal(t, []string{"old-00.mongodb.net:27017", "old-01.mongodb.net:27017"}, event.PreviousHosts)
+		assert.Equal(t, []string{"new-00.mongodb.net:27017", "new-01.mongodb.net:27017"}, event.Hosts)
+	default:
+		t.Fatal("Expected the webhook to be notified")
+	}
+
+	// The stale credentials are no longer replayed.
+	_, err = broker.store.GetOperation(operationKey(operationBind, instanceID, "binding"))
+	assert.Error(t, err)
+
+	// Later polls don't notify again.
+	broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationUpdate,
+	})
+	assert.Len(t, events, 0)
+}
+
+func TestTopologyUnchanged(t *testing.T) {
+	notified := false
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified = true
+	}))
+	defer webhook.Close()
+
+	broker, _, ctx, instanceID := setupTopologyTest(t, webhook.URL, "mongodb://old-01.mongodb.net:27017,old-00.mongodb.net:27017/?ssl=true")
+
+	_, err := broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationUpdate,
+	})
+	assert.NoError(t, err)
+	assert.False(t, notified)
+
+	_, err = broker.store.GetOperation(operationKey(operationBind, instanceID, "binding"))
+	assert.NoError(t, err)
+
+	spec, err := broker.GetBinding(ctx, instanceID, "binding")
+	if assert.NoError(t, err) {
+		assert.Nil(t, spec.Parameters)
+	}
+}
+
+func TestTopologyChangeWithoutWebhook(t *testing.T) {
+	broker, _, ctx, instanceID := setupTopologyTest(t, "", "mongodb://new-00.mongodb.net:27017/?ssl=true")
+
+	_, err := broker.LastOperation(ctx, instanceID, brokerapi.PollDetails{
+		OperationData: OperationUpdate,
+	})
+	assert.NoError(t, err)
+
+	_, err = broker.store.GetOperation(operationKey(operationBind, instanceID, "binding"))
+	assert.Error(t, err)
+
+	// Fetching the binding flags its credentials as stale.
+	spec, err := broker.GetBinding(ctx, instanceID, "binding")
+	if assert.NoError(t, err) {
+		assert.Equal(t, true, spec.Parameters.(map[string]interface{})["credentials_stale"])
+	}
+}
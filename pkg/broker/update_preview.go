@@ -0,0 +1,154 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/state"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/pivotal-cf/brokerapi/domain/apiresponses"
+)
+
+// The kinds of updates. Resizes change the instance size of the cluster,
+// reconfigurations only change other settings.
+const (
+	UpdateTypeResize      = "resize"
+	UpdateTypeReconfigure = "reconfigure"
+)
+
+// UpdatePreview describes the impact an update would have on a cluster,
+// without performing it.
+type UpdatePreview struct {
+	Type string `json:"type"`
+
+	// Online is true if the cluster stays available during the update.
+	// Atlas applies changes to dedicated clusters in a rolling fashion, but
+	// moving from or to a shared instance size migrates the cluster.
+	Online bool `json:"online"`
+
+	InstanceSize    InstanceSizeChange `json:"instance_size"`
+	DiskSizeGB      *DiskSizeChange    `json:"disk_size_gb,omitempty"`
+	ConnectionLimit ConnectionChange   `json:"connection_limit"`
+
+	// Warnings point out changes which are valid but may need attention.
+	Warnings []string `json:"warnings"`
+}
+
+// InstanceSizeChange is the instance size before and after an update.
+type InstanceSizeChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DiskSizeChange is the disk size before and after an update.
+type DiskSizeChange struct {
+	From float64 `json:"from"`
+	To   float64 `json:"to"`
+}
+
+// ConnectionChange is the connection limit before and after an update, zero
+// if unknown.
+type ConnectionChange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// handleUpdatePreview serves the impact of an update of an instance. The
+// body has the same format as an OSB update request. As previews fetch the
+// cluster, the request must pass an Atlas key.
+func (b Broker) handleUpdatePreview(w http.ResponseWriter, r *http.Request) {
+	instanceID := mux.Vars(r)["instance_id"]
+
+	details := brokerapi.UpdateDetails{}
+	if err := json.NewDecoder(r.Body).Decode(&details); err != nil {
+		respondWithError(w, newInvalidParamsError(err))
+		return
+	}
+
+	client, err := b.atlasClientFromContext(r.Context())
+	if err != nil {
+		respondWithError(w, apiresponses.NewFailureResponse(errors.New("Update previews need an Atlas key, pass its name in the atlas_key query parameter"), http.StatusBadRequest, "atlas-key-required"))
+		return
+	}
+
+	preview, err := b.PreviewUpdate(client, instanceID, details)
+	if err != nil {
+		b.logger.Errorw("Failed to preview update", "error", err, "instance_id", instanceID)
+		respondWithError(w, err)
+		return
+	}
+
+	respond(w, http.StatusOK, preview)
+}
+
+// PreviewUpdate will validate an update the same way Update does and
+// describe its impact without changing the cluster. The service ID defaults
+// to the one the instance was recorded with, since previews of plan changes
+// need it to look up the plan.
+func (b Broker) PreviewUpdate(client atlas.Client, instanceID string, details brokerapi.UpdateDetails) (*UpdatePreview, error) {
+	if details.ServiceID == "" {
+		instance, err := b.store.GetInstance(instanceID)
+		if err != nil && err != state.ErrNotFound {
+			return nil, err
+		}
+		if instance != nil {
+			details.ServiceID = instance.ServiceID
+		}
+	}
+
+	prepared, err := b.prepareUpdate(client, instanceID, details)
+	if err != nil {
+		return nil, err
+	}
+
+	return updatePreview(prepared.existingCluster, prepared.cluster), nil
+}
+
+// updatePreview compares a cluster with the definition it would be updated
+// to.
+func updatePreview(existing *atlas.Cluster, cluster *atlas.Cluster) *UpdatePreview {
+	from := existing.ProviderSettings.InstanceSizeName
+	to := from
+	if cluster.ProviderSettings != nil {
+		to = cluster.ProviderSettings.InstanceSizeName
+	}
+
+	preview := &UpdatePreview{
+		Type:            UpdateTypeReconfigure,
+		Online:          true,
+		InstanceSize:    InstanceSizeChange{From: from, To: to},
+		ConnectionLimit: ConnectionChange{From: atlas.ConnectionLimit(from), To: atlas.ConnectionLimit(to)},
+		Warnings:        []string{},
+	}
+
+	if from != to {
+		preview.Type = UpdateTypeResize
+	}
+
+	if from != to && (isSharedInstanceSize(from) || isSharedInstanceSize(to)) {
+		preview.Online = false
+		preview.Warnings = append(preview.Warnings, "Changing from or to a shared instance size migrates the cluster, which is unavailable for several minutes")
+	}
+
+	if cluster.Name != "" && cluster.Name != existing.Name {
+		preview.Warnings = append(preview.Warnings, fmt.Sprintf("Renaming the cluster from %s to %s changes its hosts, seed list connection strings of existing bindings stop working", existing.Name, cluster.Name))
+	}
+
+	if cluster.DiskSizeGB != 0 && cluster.DiskSizeGB != existing.DiskSizeGB {
+		preview.DiskSizeGB = &DiskSizeChange{From: existing.DiskSizeGB, To: cluster.DiskSizeGB}
+
+		if cluster.DiskSizeGB < existing.DiskSizeGB {
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("The disk size decreases from %g GB to %g GB, which fails if the data doesn't fit", existing.DiskSizeGB, cluster.DiskSizeGB))
+		}
+	}
+
+	if limits := preview.ConnectionLimit; limits.To > 0 && limits.To < limits.From {
+		preview.Warnings = append(preview.Warnings, fmt.Sprintf("The connection limit decreases from %d to %d", limits.From, limits.To))
+	}
+
+	return preview
+}
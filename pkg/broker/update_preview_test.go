@@ -0,0 +1,98 @@
+package broker
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/mongodb/mongodb-atlas-service-broker/pkg/atlas"
+	"github.com/pivotal-cf/brokerapi"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func setupUpdatePreviewTest(t *testing.T) (*Broker, MockAtlasClient, *mux.Router) {
+	broker, client, ctx := setupTest()
+	broker = NewBrokerWithConfig(zap.NewNop().Sugar(), Config{
+		AtlasKeys: map[string]atlas.Client{"legacy": client},
+	})
+
+	_, err := broker.Provision(ctx, "instance", brokerapi.ProvisionDetails{
+		PlanID:        "aosb-cluster-plan-aws-m20",
+		ServiceID:     testServiceID,
+		RawParameters: []byte(`{"cluster": {"diskSizeGB": 40}}`),
+	}, true)
+	assert.NoError(t, err)
+
+	router := mux.NewRouter()
+	AttachAdminRoutes(router, broker, testAdminToken)
+
+	return broker, client, router
+}
+
+func TestUpdatePreviewResize(t *testing.T) {
+	_, client, router := setupUpdatePreviewTest(t)
+	before := *client.Clusters["instance"]
+
+	w := adminPost(router, "/admin/instances/instance/update-preview?atlas_key=legacy", []byte(`{"plan_id": "aosb-cluster-plan-aws-m10"}`))
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+
+	preview := UpdatePreview{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.Equal(t, UpdateTypeResize, preview.Type)
+	assert.True(t, preview.Online)
+	assert.Equal(t, InstanceSizeChange{From: "M20", To: "M10"}, preview.InstanceSize)
+	assert.Equal(t, ConnectionChange{From: atlas.ConnectionLimit("M20"), To: atlas.ConnectionLimit("M10")}, preview.ConnectionLimit)
+	assert.Nil(t, preview.DiskSizeGB)
+	assert.Len(t, preview.Warnings, 1)
+
+	// Nothing is changed.
+	assert.Equal(t, before, *client.Clusters["instance"])
+}
+
+func TestUpdatePreviewReconfigure(t *testing.T) {
+	_, _, router := setupUpdatePreviewTest(t)
+
+	w := adminPost(router, "/admin/instances/instance/update-preview?atlas_key=legacy", []byte(`{"parameters": {"cluster": {"diskSizeGB": 20}}}`))
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+
+	preview := UpdatePreview{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.Equal(t, UpdateTypeReconfigure, preview.Type)
+	assert.True(t, preview.Online)
+	assert.Equal(t, InstanceSizeChange{From: "M20", To: "M20"}, preview.InstanceSize)
+	assert.Equal(t, &DiskSizeChange{From: 40, To: 20}, preview.DiskSizeGB)
+	assert.Equal(t, []string{"The disk size decreases from 40 GB to 20 GB, which fails if the data doesn't fit"}, preview.Warnings)
+}
+
+func TestUpdatePreviewValidation(t *testing.T) {
+	_, _, router := setupUpdatePreviewTest(t)
+
+	// Invalid updates are rejected the same way Update would.
+	w := adminPost(router, "/admin/instances/instance/update-preview?atlas_key=legacy", []byte(`{"plan_id": "aosb-cluster-plan-aws-m99"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid plan ID")
+
+	w = adminPost(router, "/admin/instances/unknown/update-preview?atlas_key=legacy", []byte(`{}`))
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	// Previews need a client to fetch the cluster with.
+	w = adminPost(router, "/admin/instances/instance/update-preview", []byte(`{}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "atlas_key")
+}
+
+func TestUpdatePreviewSharedTier(t *testing.T) {
+	preview := updatePreview(
+		&atlas.Cluster{ProviderSettings: &atlas.ProviderSettings{InstanceSizeName: InstanceSizeNameM2}},
+		&atlas.Cluster{ProviderSettings: &atlas.ProviderSettings{InstanceSizeName: "M10"}},
+	)
+
+	assert.Equal(t, UpdateTypeResize, preview.Type)
+	assert.False(t, preview.Online)
+}
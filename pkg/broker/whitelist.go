@@ -4,10 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"strings"
 )
 
+// Whitelist maps provider names to the names of the plans which should be
+// available for that provider. Providers missing from the whitelist are
+// unavailable.
 type Whitelist map[string][]string
 
+// ReadWhitelistFile will read and validate a whitelist from a JSON file.
 func ReadWhitelistFile(path string) (Whitelist, error) {
 	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -19,7 +24,18 @@ func ReadWhitelistFile(path string) (Whitelist, error) {
 		return nil, err
 	}
 
-	for whitelistProviderName, _ := range whitelist {
+	if err := whitelist.Validate(); err != nil {
+		return nil, err
+	}
+
+	return whitelist, nil
+}
+
+// Validate ensures the whitelist only references known providers. A typo in a
+// provider name would otherwise silently cause the intended restriction to
+// never apply.
+func (w Whitelist) Validate() error {
+	for whitelistProviderName := range w {
 		var isValid bool
 		for _, providerName := range providerNames {
 			if whitelistProviderName == providerName {
@@ -27,9 +43,9 @@ func ReadWhitelistFile(path string) (Whitelist, error) {
 			}
 		}
 		if !isValid {
-			return nil, fmt.Errorf("invalid whitelist")
+			return fmt.Errorf(`invalid whitelist: unknown provider "%s", valid providers are %s`, whitelistProviderName, strings.Join(providerNames, ", "))
 		}
 	}
 
-	return whitelist, nil
+	return nil
 }
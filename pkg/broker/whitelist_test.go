@@ -0,0 +1,39 @@
+package broker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadWhitelistFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whitelist")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "whitelist.json")
+	ioutil.WriteFile(path, []byte(`{"AWS": ["M10"], "TENANT": ["M2"]}`), 0600)
+
+	whitelist, err := ReadWhitelistFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, Whitelist{"AWS": []string{"M10"}, "TENANT": []string{"M2"}}, whitelist)
+}
+
+func TestReadWhitelistFileUnknownProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whitelist")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "whitelist.json")
+	ioutil.WriteFile(path, []byte(`{"AWS": ["M10"], "AWZ": ["M10"]}`), 0600)
+
+	_, err = ReadWhitelistFile(path)
+	assert.EqualError(t, err, `invalid whitelist: unknown provider "AWZ", valid providers are AWS, GCP, AZURE, TENANT`)
+}
@@ -0,0 +1,238 @@
+package state
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ExportVersion is the version of the export format. Exports of other
+// versions can't be imported.
+const ExportVersion = 1
+
+// The ways secrets, such as binding credentials, are handled in exports.
+const (
+	SecretsExclude = "exclude"
+	SecretsEncrypt = "encrypt"
+)
+
+// exportPageSize is how many records are read from the store at once.
+const exportPageSize = 100
+
+// Export is a versioned copy of the instances and bindings of a store, used
+// for backups and to migrate between stores.
+type Export struct {
+	Version    int        `json:"version"`
+	ExportedAt time.Time  `json:"exportedAt"`
+	Secrets    string     `json:"secrets"`
+	Instances  []Instance `json:"instances"`
+	Bindings   []Binding  `json:"bindings"`
+}
+
+// ExportStore will copy all instances and bindings of a store. Secrets are
+// excluded or encrypted with key, which must be 16, 24, or 32 bytes long.
+// Bindings whose instance has no record are left out, so the export can be
+// imported.
+func ExportStore(store Store, secrets string, key []byte) (*Export, error) {
+	var aead cipher.AEAD
+	switch secrets {
+	case SecretsExclude:
+	case SecretsEncrypt:
+		var err error
+		if aead, err = newAEAD(key); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf(`unknown secrets mode "%s", expected "%s" or "%s"`, secrets, SecretsExclude, SecretsEncrypt)
+	}
+
+	export := &Export{
+		Version:    ExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Secrets:    secrets,
+		Instances:  []Instance{},
+		Bindings:   []Binding{},
+	}
+
+	instanceIDs := map[string]bool{}
+	for offset := 0; ; offset += exportPageSize {
+		instances, err := store.ListInstances(InstanceFilter{}, offset, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, instance := range instances {
+			instanceIDs[instance.ID] = true
+		}
+		export.Instances = append(export.Instances, instances...)
+
+		if len(instances) < exportPageSize {
+			break
+		}
+	}
+
+	for offset := 0; ; offset += exportPageSize {
+		bindings, err := store.ListBindings(BindingFilter{}, offset, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, binding := range bindings {
+			if !instanceIDs[binding.InstanceID] {
+				continue
+			}
+
+			switch {
+			case aead == nil:
+				binding.Credentials = nil
+			case len(binding.Credentials) > 0:
+				binding.Credentials, err = encryptSecret(aead, binding.Credentials)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			export.Bindings = append(export.Bindings, binding)
+		}
+
+		if len(bindings) < exportPageSize {
+			break
+		}
+	}
+
+	return export, nil
+}
+
+// ImportStore will validate an export and write its instances and bindings
+// to a store, replacing existing records with the same IDs. Nothing is
+// written if the export is invalid. Encrypted secrets are decrypted with key.
+// Bindings without credentials, such as those of exports excluding secrets,
+// keep the credentials of the existing record.
+func ImportStore(store Store, export *Export, key []byte) error {
+	if export.Version != ExportVersion {
+		return fmt.Errorf("unsupported export version %d, expected %d", export.Version, ExportVersion)
+	}
+
+	var aead cipher.AEAD
+	switch export.Secrets {
+	case SecretsExclude:
+	case SecretsEncrypt:
+		var err error
+		if aead, err = newAEAD(key); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf(`unknown secrets mode "%s"`, export.Secrets)
+	}
+
+	instanceIDs := map[string]bool{}
+	for _, instance := range export.Instances {
+		if instance.ID == "" {
+			return errors.New("instance without ID")
+		}
+		if instanceIDs[instance.ID] {
+			return fmt.Errorf("duplicate instance %s", instance.ID)
+		}
+		instanceIDs[instance.ID] = true
+	}
+
+	bindingIDs := map[string]bool{}
+	bindings := make([]Binding, len(export.Bindings))
+	for i, binding := range export.Bindings {
+		if binding.ID == "" {
+			return errors.New("binding without ID")
+		}
+		if bindingIDs[binding.ID] {
+			return fmt.Errorf("duplicate binding %s", binding.ID)
+		}
+		bindingIDs[binding.ID] = true
+
+		if !instanceIDs[binding.InstanceID] {
+			return fmt.Errorf("binding %s references unknown instance %s", binding.ID, binding.InstanceID)
+		}
+
+		switch {
+		case aead != nil && len(binding.Credentials) > 0:
+			var err error
+			binding.Credentials, err = decryptSecret(aead, binding.Credentials)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt credentials of binding %s: %v", binding.ID, err)
+			}
+		case len(binding.Credentials) == 0:
+			// Exports without secrets don't wipe the credentials of
+			// bindings the store already has.
+			existing, err := store.GetBinding(binding.ID)
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+			if existing != nil {
+				binding.Credentials = existing.Credentials
+			}
+		}
+
+		bindings[i] = binding
+	}
+
+	for _, instance := range export.Instances {
+		if err := store.PutInstance(instance); err != nil {
+			return err
+		}
+	}
+
+	for _, binding := range bindings {
+		if err := store.PutBinding(binding); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, errors.New("an encryption key is required to encrypt secrets")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret encrypts a JSON value into a JSON string containing the
+// base64 encoded nonce and ciphertext.
+func encryptSecret(aead cipher.AEAD, secret json.RawMessage) (json.RawMessage, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := aead.Seal(nonce, nonce, secret, nil)
+	return json.Marshal(base64.StdEncoding.EncodeToString(sealed))
+}
+
+// decryptSecret reverses encryptSecret.
+func decryptSecret(aead cipher.AEAD, encrypted json.RawMessage) (json.RawMessage, error) {
+	var encoded string
+	if err := json.Unmarshal(encrypted, &encoded); err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
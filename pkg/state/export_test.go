@@ -0,0 +1,133 @@
+package state
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testExportKey = []byte("0123456789abcdef0123456789abcdef")
+
+func setupExportTest() *MemoryStore {
+	store := NewMemoryStore()
+	store.PutInstance(Instance{ID: "instance-1", PlanID: "plan", Ephemeral: true, Hosts: []string{"h1:27017"}})
+	store.PutInstance(Instance{ID: "instance-2", ProjectID: "project"})
+	store.PutBinding(Binding{ID: "binding-1", InstanceID: "instance-1", Credentials: []byte(`{"password":"hunter2"}`)})
+	store.PutBinding(Binding{ID: "binding-2", InstanceID: "instance-2", Credentials: []byte(`{"password":"other"}`)})
+
+	// Bindings of instances without a record can't be imported.
+	store.PutBinding(Binding{ID: "orphan", InstanceID: "deleted", Credentials: []byte(`{}`)})
+	return store
+}
+
+func TestExportRoundTripEncrypted(t *testing.T) {
+	source := setupExportTest()
+
+	export, err := ExportStore(source, SecretsEncrypt, testExportKey)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, export.Instances, 2)
+	assert.Len(t, export.Bindings, 2)
+
+	// The export is serialized to JSON without leaking secrets.
+	data, err := json.Marshal(export)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+
+	var decoded Export
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+
+	target := NewMemoryStore()
+	assert.NoError(t, ImportStore(target, &decoded, testExportKey))
+
+	for _, id := range []string{"instance-1", "instance-2"} {
+		expected, _ := source.GetInstance(id)
+		found, err := target.GetInstance(id)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, found)
+	}
+
+	binding, err := target.GetBinding("binding-1")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"password":"hunter2"}`, string(binding.Credentials))
+
+	_, err = target.GetBinding("orphan")
+	assert.Equal(t, ErrNotFound, err)
+
+	// Secrets can't be decrypted with another key.
+	err = ImportStore(NewMemoryStore(), &decoded, []byte("fedcba9876543210fedcba9876543210"))
+	assert.Error(t, err)
+}
+
+func TestExportRoundTripExcludedSecrets(t *testing.T) {
+	export, err := ExportStore(setupExportTest(), SecretsExclude, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	data, err := json.Marshal(export)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+
+	target := NewMemoryStore()
+	assert.NoError(t, ImportStore(target, export, nil))
+
+	binding, err := target.GetBinding("binding-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "instance-1", binding.InstanceID)
+	assert.Empty(t, binding.Credentials)
+}
+
+func TestImportExcludedSecretsKeepsCredentials(t *testing.T) {
+	store := setupExportTest()
+	export, err := ExportStore(store, SecretsExclude, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Importing into the same store doesn't wipe the existing credentials.
+	assert.NoError(t, ImportStore(store, export, nil))
+
+	binding, err := store.GetBinding("binding-1")
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"password":"hunter2"}`, string(binding.Credentials))
+	}
+}
+
+func TestExportRequiresKey(t *testing.T) {
+	_, err := ExportStore(NewMemoryStore(), SecretsEncrypt, nil)
+	assert.Error(t, err)
+
+	_, err = ExportStore(NewMemoryStore(), "plaintext", nil)
+	assert.Error(t, err)
+}
+
+func TestImportValidation(t *testing.T) {
+	tests := []struct {
+		export   Export
+		expected string
+	}{
+		{Export{Version: 2, Secrets: SecretsExclude}, "unsupported export version 2, expected 1"},
+		{Export{Version: ExportVersion, Secrets: "plaintext"}, `unknown secrets mode "plaintext"`},
+		{
+			Export{Version: ExportVersion, Secrets: SecretsExclude, Instances: []Instance{{ID: "a"}, {ID: "a"}}},
+			"duplicate instance a",
+		},
+		{
+			Export{Version: ExportVersion, Secrets: SecretsExclude, Instances: []Instance{{ID: "a"}}, Bindings: []Binding{{ID: "b", InstanceID: "c"}}},
+			"binding b references unknown instance c",
+		},
+	}
+
+	for _, test := range tests {
+		store := NewMemoryStore()
+		err := ImportStore(store, &test.export, nil)
+		assert.EqualError(t, err, test.expected)
+
+		// Nothing is written if the export is invalid.
+		instances, _ := store.ListInstances(InstanceFilter{}, 0, 10)
+		assert.Empty(t, instances)
+	}
+}
@@ -0,0 +1,274 @@
+package state
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Ensure MemoryStore adheres to the Store interface.
+var _ Store = &MemoryStore{}
+
+// MemoryStore is a Store keeping all state in memory. State is lost when the
+// broker is restarted.
+type MemoryStore struct {
+	mutex      sync.Mutex
+	operations map[string]Operation
+	instances  map[string]Instance
+	bindings   map[string]Binding
+	locks      map[string]*keyLock
+}
+
+// keyLock is a lock for a single key. It keeps track of how many callers are
+// holding or waiting for the lock so it can be removed once unused.
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewMemoryStore creates a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		operations: make(map[string]Operation),
+		instances:  make(map[string]Instance),
+		bindings:   make(map[string]Binding),
+		locks:      make(map[string]*keyLock),
+	}
+}
+
+// GetOperation will find a recorded operation by its key.
+func (s *MemoryStore) GetOperation(key string) (*Operation, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	operation, ok := s.operations[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &operation, nil
+}
+
+// PutOperation will record an operation, replacing any existing operation
+// with the same key. Expired operations are pruned at the same time.
+func (s *MemoryStore) PutOperation(operation Operation) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, existing := range s.operations {
+		if existing.Expired() {
+			delete(s.operations, key)
+		}
+	}
+
+	s.operations[operation.Key] = operation
+	return nil
+}
+
+// DeleteOperation will remove a recorded operation. Removing an operation
+// which doesn't exist is not an error.
+func (s *MemoryStore) DeleteOperation(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.operations, key)
+	return nil
+}
+
+// DeleteOperationsWithPrefix will remove all recorded operations with a key
+// starting with prefix.
+func (s *MemoryStore) DeleteOperationsWithPrefix(prefix string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key := range s.operations {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.operations, key)
+		}
+	}
+
+	return nil
+}
+
+// GetInstance will find an instance record by its ID.
+func (s *MemoryStore) GetInstance(id string) (*Instance, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	instance, ok := s.instances[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &instance, nil
+}
+
+// PutInstance will record an instance, replacing any existing record with
+// the same ID.
+func (s *MemoryStore) PutInstance(instance Instance) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.instances[instance.ID] = instance
+	return nil
+}
+
+// DeleteInstance will remove an instance record. Removing an instance which
+// doesn't exist is not an error.
+func (s *MemoryStore) DeleteInstance(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.instances, id)
+	return nil
+}
+
+// ListInstances will return a page of the instance records matching the
+// filter, ordered by ID.
+func (s *MemoryStore) ListInstances(filter InstanceFilter, offset int, limit int) ([]Instance, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := make([]string, 0, len(s.instances))
+	for id := range s.instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	instances := []Instance{}
+	for _, id := range ids {
+		if len(instances) >= limit {
+			break
+		}
+
+		instance := s.instances[id]
+		if !filter.Matches(instance) {
+			continue
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+// GetBinding will find a binding record by its ID.
+func (s *MemoryStore) GetBinding(id string) (*Binding, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	binding, ok := s.bindings[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &binding, nil
+}
+
+// PutBinding will record a binding, replacing any existing record with the
+// same ID.
+func (s *MemoryStore) PutBinding(binding Binding) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.bindings[binding.ID] = binding
+	return nil
+}
+
+// DeleteBinding will remove a binding record. Removing a binding which
+// doesn't exist is not an error.
+func (s *MemoryStore) DeleteBinding(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.bindings, id)
+	return nil
+}
+
+// ListBindings will return a page of the binding records matching the
+// filter, ordered by ID.
+func (s *MemoryStore) ListBindings(filter BindingFilter, offset int, limit int) ([]Binding, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := make([]string, 0, len(s.bindings))
+	for id := range s.bindings {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	bindings := []Binding{}
+	for _, id := range ids {
+		if len(bindings) >= limit {
+			break
+		}
+
+		binding := s.bindings[id]
+		if !filter.Matches(binding) {
+			continue
+		}
+
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		bindings = append(bindings, binding)
+	}
+
+	return bindings, nil
+}
+
+// Lock acquires an exclusive lock for the specified key.
+func (s *MemoryStore) Lock(key string) func() {
+	s.mutex.Lock()
+	lock, ok := s.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		s.locks[key] = lock
+	}
+	lock.refs++
+	s.mutex.Unlock()
+
+	lock.Lock()
+
+	return s.unlockFunc(key, lock)
+}
+
+// TryLock acquires an exclusive lock for the specified key unless another
+// caller holds or waits for it.
+func (s *MemoryStore) TryLock(key string) (func(), bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.locks[key]; ok {
+		return nil, false
+	}
+
+	// The lock is new, so acquiring it doesn't block.
+	lock := &keyLock{refs: 1}
+	lock.Lock()
+	s.locks[key] = lock
+
+	return s.unlockFunc(key, lock), true
+}
+
+// unlockFunc returns the function releasing a lock, which removes it once
+// no other callers hold or wait for it.
+func (s *MemoryStore) unlockFunc(key string, lock *keyLock) func() {
+	return func() {
+		lock.Unlock()
+
+		s.mutex.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(s.locks, key)
+		}
+		s.mutex.Unlock()
+	}
+}
@@ -0,0 +1,245 @@
+package state
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperations(t *testing.T) {
+	store := NewMemoryStore()
+
+	_, err := store.GetOperation("key")
+	assert.Equal(t, ErrNotFound, err)
+
+	operation := Operation{
+		Key:         "key",
+		RequestHash: "hash",
+		ExpiresAt:   time.Now().Add(time.Minute),
+	}
+	assert.NoError(t, store.PutOperation(operation))
+
+	found, err := store.GetOperation("key")
+	assert.NoError(t, err)
+	assert.Equal(t, &operation, found)
+
+	assert.NoError(t, store.DeleteOperation("key"))
+	_, err = store.GetOperation("key")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestDeleteOperationsWithPrefix(t *testing.T) {
+	store := NewMemoryStore()
+
+	for _, key := range []string{"bind/instance/a", "bind/instance/b", "bind/other/a"} {
+		assert.NoError(t, store.PutOperation(Operation{Key: key, ExpiresAt: time.Now().Add(time.Minute)}))
+	}
+
+	assert.NoError(t, store.DeleteOperationsWithPrefix("bind/instance/"))
+
+	_, err := store.GetOperation("bind/instance/a")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = store.GetOperation("bind/instance/b")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = store.GetOperation("bind/other/a")
+	assert.NoError(t, err)
+}
+
+func TestInstances(t *testing.T) {
+	store := NewMemoryStore()
+
+	_, err := store.GetInstance("instance")
+	assert.Equal(t, ErrNotFound, err)
+
+	instance := Instance{
+		ID:                 "instance",
+		PendingSearchNodes: []byte(`{"nodeCount":2}`),
+	}
+	assert.NoError(t, store.PutInstance(instance))
+
+	found, err := store.GetInstance("instance")
+	assert.NoError(t, err)
+	assert.Equal(t, &instance, found)
+
+	assert.NoError(t, store.DeleteInstance("instance"))
+	_, err = store.GetInstance("instance")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func instanceIDs(instances []Instance) []string {
+	ids := []string{}
+	for _, instance := range instances {
+		ids = append(ids, instance.ID)
+	}
+
+	return ids
+}
+
+func TestListInstancesPagination(t *testing.T) {
+	store := NewMemoryStore()
+	for _, id := range []string{"c", "a", "e", "b", "d"} {
+		store.PutInstance(Instance{ID: id})
+	}
+
+	tests := []struct {
+		offset   int
+		limit    int
+		expected []string
+	}{
+		{0, 2, []string{"a", "b"}},
+		{2, 2, []string{"c", "d"}},
+		{4, 2, []string{"e"}},
+		{5, 2, []string{}},
+		{0, 10, []string{"a", "b", "c", "d", "e"}},
+		{0, 0, []string{}},
+	}
+
+	for _, test := range tests {
+		instances, err := store.ListInstances(InstanceFilter{}, test.offset, test.limit)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, instanceIDs(instances), "offset %d, limit %d", test.offset, test.limit)
+	}
+}
+
+func TestListInstancesFilter(t *testing.T) {
+	store := NewMemoryStore()
+	store.PutInstance(Instance{ID: "a", Provider: "AWS", PlanID: "plan-1", ProjectID: "project-1", ClusterState: "IDLE"})
+	store.PutInstance(Instance{ID: "b", Provider: "GCP", PlanID: "plan-2", ProjectID: "project-1", ClusterState: "CREATING", Ephemeral: true})
+	store.PutInstance(Instance{ID: "c", Provider: "AWS", PlanID: "plan-2", ProjectID: "project-2", ClusterState: "IDLE", Ephemeral: true})
+
+	ephemeral := true
+	persistent := false
+
+	tests := []struct {
+		filter   InstanceFilter
+		expected []string
+	}{
+		{InstanceFilter{Provider: "AWS"}, []string{"a", "c"}},
+		{InstanceFilter{PlanID: "plan-2"}, []string{"b", "c"}},
+		{InstanceFilter{ProjectID: "project-1"}, []string{"a", "b"}},
+		{InstanceFilter{ClusterState: "CREATING"}, []string{"b"}},
+		{InstanceFilter{Ephemeral: &ephemeral}, []string{"b", "c"}},
+		{InstanceFilter{Ephemeral: &persistent}, []string{"a"}},
+		{InstanceFilter{Provider: "AWS", Ephemeral: &ephemeral}, []string{"c"}},
+		{InstanceFilter{Provider: "AZURE"}, []string{}},
+	}
+
+	for _, test := range tests {
+		instances, err := store.ListInstances(test.filter, 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, instanceIDs(instances), "filter %+v", test.filter)
+	}
+
+	// The offset applies to the matching instances.
+	instances, err := store.ListInstances(InstanceFilter{Provider: "AWS"}, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, instanceIDs(instances))
+}
+
+func TestListBindings(t *testing.T) {
+	store := NewMemoryStore()
+	store.PutBinding(Binding{ID: "a", InstanceID: "instance-1"})
+	store.PutBinding(Binding{ID: "b", InstanceID: "instance-2"})
+	store.PutBinding(Binding{ID: "c", InstanceID: "instance-1"})
+
+	bindings, err := store.ListBindings(BindingFilter{InstanceID: "instance-1"}, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, bindings, 2)
+	assert.Equal(t, "a", bindings[0].ID)
+	assert.Equal(t, "c", bindings[1].ID)
+
+	bindings, err = store.ListBindings(BindingFilter{}, 1, 1)
+	assert.NoError(t, err)
+	assert.Len(t, bindings, 1)
+	assert.Equal(t, "b", bindings[0].ID)
+}
+
+func TestBindings(t *testing.T) {
+	store := NewMemoryStore()
+
+	_, err := store.GetBinding("binding")
+	assert.Equal(t, ErrNotFound, err)
+
+	binding := Binding{
+		ID:          "binding",
+		InstanceID:  "instance",
+		Credentials: []byte(`{"username":"binding"}`),
+	}
+	assert.NoError(t, store.PutBinding(binding))
+
+	found, err := store.GetBinding("binding")
+	assert.NoError(t, err)
+	assert.Equal(t, &binding, found)
+
+	assert.NoError(t, store.DeleteBinding("binding"))
+	_, err = store.GetBinding("binding")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestPruneExpiredOperations(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.PutOperation(Operation{Key: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+	store.PutOperation(Operation{Key: "valid", ExpiresAt: time.Now().Add(time.Minute)})
+
+	_, err := store.GetOperation("expired")
+	assert.Equal(t, ErrNotFound, err)
+
+	_, err = store.GetOperation("valid")
+	assert.NoError(t, err)
+}
+
+func TestLock(t *testing.T) {
+	store := NewMemoryStore()
+
+	var wg sync.WaitGroup
+	counter := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := store.Lock("key")
+			defer unlock()
+
+			// Non-atomic increment which is only safe while holding the lock.
+			value := counter
+			time.Sleep(time.Microsecond)
+			counter = value + 1
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 50, counter)
+	assert.Empty(t, store.locks, "Expected unused locks to be removed")
+}
+
+func TestTryLock(t *testing.T) {
+	store := NewMemoryStore()
+
+	unlock, ok := store.TryLock("key")
+	if !assert.True(t, ok) {
+		return
+	}
+
+	_, ok = store.TryLock("key")
+	assert.False(t, ok, "Expected held lock not to be acquired")
+
+	unlockOther, ok := store.TryLock("other")
+	assert.True(t, ok, "Expected locks of other keys to be independent")
+	unlockOther()
+
+	unlock()
+	unlock, ok = store.TryLock("key")
+	assert.True(t, ok, "Expected released lock to be acquired")
+	unlock()
+
+	// Locks acquired by waiting are respected as well.
+	unlock = store.Lock("key")
+	_, ok = store.TryLock("key")
+	assert.False(t, ok)
+	unlock()
+
+	assert.Empty(t, store.locks, "Expected unused locks to be removed")
+}
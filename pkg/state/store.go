@@ -0,0 +1,211 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a record doesn't exist in the store.
+var ErrNotFound = errors.New("record not found")
+
+// Store persists the state the broker needs in addition to what's kept in
+// Atlas. Implementations must be safe for concurrent use.
+type Store interface {
+	GetOperation(key string) (*Operation, error)
+	PutOperation(operation Operation) error
+	DeleteOperation(key string) error
+	DeleteOperationsWithPrefix(prefix string) error
+
+	GetInstance(id string) (*Instance, error)
+	PutInstance(instance Instance) error
+	DeleteInstance(id string) error
+
+	// ListInstances returns the instances matching the filter, ordered by
+	// ID, skipping the first offset matches and returning at most limit.
+	ListInstances(filter InstanceFilter, offset int, limit int) ([]Instance, error)
+
+	GetBinding(id string) (*Binding, error)
+	PutBinding(binding Binding) error
+	DeleteBinding(id string) error
+
+	// ListBindings returns the bindings matching the filter like
+	// ListInstances.
+	ListBindings(filter BindingFilter, offset int, limit int) ([]Binding, error)
+
+	// Lock acquires an exclusive lock for the specified key, blocking until
+	// it's available. The returned function releases the lock.
+	Lock(key string) func()
+
+	// TryLock acquires an exclusive lock for the specified key if it isn't
+	// held or waited for, without blocking. The returned function releases
+	// the lock, and false is returned if it couldn't be acquired.
+	TryLock(key string) (func(), bool)
+}
+
+// Operation is the recorded result of a mutating broker operation. It's used
+// to replay the original result to retries of an identical request.
+type Operation struct {
+	Key         string          `json:"key"`
+	RequestHash string          `json:"requestHash"`
+	Result      json.RawMessage `json:"result"`
+	ExpiresAt   time.Time       `json:"expiresAt"`
+}
+
+// Expired returns whether the operation should no longer be replayed.
+func (o Operation) Expired() bool {
+	return !time.Now().Before(o.ExpiresAt)
+}
+
+// Instance is the broker's record of a service instance for configuration
+// which can't be applied to Atlas right away.
+type Instance struct {
+	ID string `json:"id"`
+
+	// ServiceID, PlanID, and Provider are the catalog entry the instance was
+	// provisioned or last updated with.
+	ServiceID string `json:"serviceId,omitempty"`
+	PlanID    string `json:"planId,omitempty"`
+	Provider  string `json:"provider,omitempty"`
+
+	// ClusterState is the state of the cluster when the broker last saw it,
+	// for example "CREATING" or "IDLE".
+	ClusterState string `json:"clusterState,omitempty"`
+
+	// PendingSearchNodes is the requested search node configuration which
+	// will be deployed once the cluster is ready.
+	PendingSearchNodes json.RawMessage `json:"pendingSearchNodes,omitempty"`
+
+	// ProvisionDeadline is when provisioning of the instance is considered
+	// stuck if it hasn't completed. ProvisionTimeout is the time it was
+	// given.
+	ProvisionDeadline time.Time     `json:"provisionDeadline,omitempty"`
+	ProvisionTimeout  time.Duration `json:"provisionTimeout,omitempty"`
+
+	// Ephemeral marks throwaway instances, for example those created in
+	// shared sandboxes, so they can be told apart from persistent ones.
+	Ephemeral bool `json:"ephemeral,omitempty"`
+
+	// Hosts are the hosts of the cluster before an update, used to detect
+	// a change of topology once the update has completed.
+	Hosts []string `json:"hosts,omitempty"`
+
+	// ProjectID and OrgID identify the Atlas project and organization the
+	// instance was provisioned in.
+	ProjectID string `json:"projectId,omitempty"`
+	OrgID     string `json:"orgId,omitempty"`
+
+	// ReplicaSetName is the replica set name the cluster was provisioned
+	// with, empty if Atlas picked the name.
+	ReplicaSetName string `json:"replicaSetName,omitempty"`
+
+	// ClusterName is the name of the cluster after it has been renamed,
+	// empty for clusters named after the instance.
+	ClusterName string `json:"clusterName,omitempty"`
+
+	// Labels are the labels of the cluster when it was last provisioned or
+	// updated with labels, used to group instances by label.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// PartialUpdate is the outcome of the last update if Atlas only applied
+	// some of its parts, nil otherwise.
+	PartialUpdate *PartialUpdate `json:"partialUpdate,omitempty"`
+
+	// ParameterHistory lists the parameter changes of successful updates,
+	// oldest first.
+	ParameterHistory []ParameterChange `json:"parameterHistory,omitempty"`
+
+	// Edition is the name of the edition the instance was provisioned with,
+	// empty for the standard services.
+	Edition string `json:"edition,omitempty"`
+
+	// DeleteWhenUnbound marks instances whose cluster is deleted once their
+	// last binding has been removed. DeletionScheduledAt is when that
+	// happens, unset while the instance has bindings.
+	DeleteWhenUnbound   bool      `json:"deleteWhenUnbound,omitempty"`
+	DeletionScheduledAt time.Time `json:"deletionScheduledAt,omitempty"`
+
+	// ExpiresAt is when the cluster of an ephemeral instance is deleted,
+	// regardless of its bindings. Unset if the instance doesn't expire.
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// PartialUpdate describes an update of which some parts were applied to
+// Atlas and others failed.
+type PartialUpdate struct {
+	Succeeded []string `json:"succeeded"`
+	Failed    []string `json:"failed"`
+	Error     string   `json:"error"`
+
+	// RolledBack is set if the parts which succeeded have been reverted.
+	RolledBack bool `json:"rolledBack,omitempty"`
+}
+
+// ParameterChange is the record of the parameters changed by an update, and
+// who requested it if the platform passed an originating identity.
+type ParameterChange struct {
+	Time        time.Time     `json:"time"`
+	RequestedBy string        `json:"requestedBy,omitempty"`
+	Fields      []FieldChange `json:"fields"`
+}
+
+// FieldChange is the value of a parameter before and after an update. Field
+// is a dotted path, for example "providerSettings.instanceSizeName".
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Binding is the broker's record of a binding, kept so its credentials can be
+// retrieved after it has been created.
+type Binding struct {
+	ID         string `json:"id"`
+	InstanceID string `json:"instanceId"`
+
+	// Credentials are the credentials returned when the binding was created.
+	// CredentialsStale is set once the hosts of the cluster have changed
+	// since, so seed list connection strings in them no longer work.
+	Credentials      json.RawMessage `json:"credentials"`
+	CredentialsStale bool            `json:"credentialsStale,omitempty"`
+
+	// ExistingUser is the externally managed database user the binding was
+	// created for, empty if the broker created a user. It's kept on unbind.
+	ExistingUser string `json:"existingUser,omitempty"`
+
+	// CreatedAt is when the binding was first recorded. Zero for bindings
+	// recorded by older versions of the broker.
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+
+	// Roles summarizes the roles of the database user created for the
+	// binding, for example "readWrite@app". Empty for existing users.
+	Roles []string `json:"roles,omitempty"`
+}
+
+// InstanceFilter selects instances to list. Empty fields match all instances.
+type InstanceFilter struct {
+	Provider     string
+	PlanID       string
+	ProjectID    string
+	ClusterState string
+	Ephemeral    *bool
+}
+
+// Matches returns whether an instance is selected by the filter.
+func (f InstanceFilter) Matches(instance Instance) bool {
+	return (f.Provider == "" || f.Provider == instance.Provider) &&
+		(f.PlanID == "" || f.PlanID == instance.PlanID) &&
+		(f.ProjectID == "" || f.ProjectID == instance.ProjectID) &&
+		(f.ClusterState == "" || f.ClusterState == instance.ClusterState) &&
+		(f.Ephemeral == nil || *f.Ephemeral == instance.Ephemeral)
+}
+
+// BindingFilter selects bindings to list. Empty fields match all bindings.
+type BindingFilter struct {
+	InstanceID string
+}
+
+// Matches returns whether a binding is selected by the filter.
+func (f BindingFilter) Matches(binding Binding) bool {
+	return f.InstanceID == "" || f.InstanceID == binding.InstanceID
+}
@@ -0,0 +1,285 @@
+package telemetry
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The kinds of metrics supported by the registry.
+const (
+	KindCounter   = "counter"
+	KindGauge     = "gauge"
+	KindHistogram = "histogram"
+)
+
+// DefaultDurationBuckets are the histogram buckets used for request
+// durations, in seconds. Atlas API calls typically take between a few hundred
+// milliseconds and a few seconds.
+var DefaultDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry holds all metrics exposed by the broker. Both the Prometheus
+// endpoint and the OTLP exporter read from the same registry.
+type Registry struct {
+	mutex   sync.Mutex
+	start   time.Time
+	metrics []*metric
+}
+
+// metric is a single named metric with a set of label names and one series
+// per unique combination of label values.
+type metric struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	buckets    []float64
+
+	// collect sets the values of gauges when a snapshot is taken.
+	collect GaugeCollector
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+// series contains the values for a single combination of label values.
+type series struct {
+	labelValues []string
+
+	// Used by counters and gauges.
+	value float64
+
+	// Used by histograms. bucketCounts is not cumulative and has one more
+	// element than the buckets, used for values above the largest bucket.
+	count        uint64
+	sum          float64
+	bucketCounts []uint64
+
+	// exemplars has the latest exemplar of each bucket, nil for buckets
+	// without one.
+	exemplars []*Exemplar
+}
+
+// Exemplar links a single observation of a histogram to the sampled trace
+// it was made in, so a latency spike can be followed to a trace.
+type Exemplar struct {
+	TraceID string
+	SpanID  string
+	Value   float64
+	Time    time.Time
+}
+
+// NewRegistry creates a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		start: time.Now(),
+	}
+}
+
+// CounterVec is a counter partitioned by a set of labels.
+type CounterVec struct {
+	metric *metric
+}
+
+// HistogramVec is a histogram partitioned by a set of labels.
+type HistogramVec struct {
+	metric *metric
+}
+
+// GaugeCollector computes the current values of a gauge, calling set once
+// per combination of label values. It's called whenever a snapshot is taken,
+// so values which are no longer set disappear.
+type GaugeCollector func(set func(value float64, labelValues ...string))
+
+// NewCounterVec registers a new counter with the specified label names.
+func (r *Registry) NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{metric: r.register(name, help, KindCounter, nil, labelNames)}
+}
+
+// NewHistogramVec registers a new histogram with the specified buckets and
+// label names.
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{metric: r.register(name, help, KindHistogram, buckets, labelNames)}
+}
+
+// NewGaugeFunc registers a new gauge with the specified label names, whose
+// values are computed by the collector when a snapshot is taken.
+func (r *Registry) NewGaugeFunc(name string, help string, collect GaugeCollector, labelNames ...string) {
+	r.register(name, help, KindGauge, nil, labelNames).collect = collect
+}
+
+func (r *Registry) register(name string, help string, kind string, buckets []float64, labelNames []string) *metric {
+	m := &metric{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+	}
+
+	r.mutex.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mutex.Unlock()
+
+	return m
+}
+
+// Inc increments the counter for the specified label values by one.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the specified label values.
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	c.metric.mutex.Lock()
+	defer c.metric.mutex.Unlock()
+
+	c.metric.seriesFor(labelValues).value += value
+}
+
+// Observe records a single value in the histogram for the specified label
+// values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.observe(value, nil, labelValues)
+}
+
+// ObserveContext records a single value like Observe. If the context has a
+// sampled span, the value is kept as the exemplar of its bucket. Without
+// tracing this is the same as Observe.
+func (h *HistogramVec) ObserveContext(ctx context.Context, value float64, labelValues ...string) {
+	var exemplar *Exemplar
+	if span := SpanFromContext(ctx); span != nil && span.Sampled() {
+		exemplar = &Exemplar{TraceID: span.TraceID, SpanID: span.SpanID, Value: value, Time: time.Now()}
+	}
+
+	h.observe(value, exemplar, labelValues)
+}
+
+func (h *HistogramVec) observe(value float64, exemplar *Exemplar, labelValues []string) {
+	h.metric.mutex.Lock()
+	defer h.metric.mutex.Unlock()
+
+	s := h.metric.seriesFor(labelValues)
+	s.count++
+	s.sum += value
+
+	bucket := sort.SearchFloat64s(h.metric.buckets, value)
+	s.bucketCounts[bucket]++
+	if exemplar != nil {
+		s.exemplars[bucket] = exemplar
+	}
+}
+
+// seriesFor finds or creates the series for the specified label values. The
+// metric mutex must be held by the caller.
+func (m *metric) seriesFor(labelValues []string) *series {
+	key := strings.Join(labelValues, "\xff")
+
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{
+			labelValues: labelValues,
+		}
+		if m.kind == KindHistogram {
+			s.bucketCounts = make([]uint64, len(m.buckets)+1)
+			s.exemplars = make([]*Exemplar, len(m.buckets)+1)
+		}
+
+		m.series[key] = s
+	}
+
+	return s
+}
+
+// MetricSnapshot is a point in time copy of a metric and all its series.
+type MetricSnapshot struct {
+	Name    string
+	Help    string
+	Kind    string
+	Buckets []float64
+	Series  []SeriesSnapshot
+}
+
+// SeriesSnapshot is a point in time copy of a single series.
+type SeriesSnapshot struct {
+	Labels       map[string]string
+	Value        float64
+	Count        uint64
+	Sum          float64
+	BucketCounts []uint64
+
+	// Exemplars has an element per bucket of histograms, nil for buckets
+	// without an exemplar.
+	Exemplars []*Exemplar
+}
+
+// Snapshot copies the current state of all metrics. Series are sorted by
+// their label values to give a stable output.
+func (r *Registry) Snapshot() []MetricSnapshot {
+	r.mutex.Lock()
+	metrics := append([]*metric(nil), r.metrics...)
+	r.mutex.Unlock()
+
+	snapshots := []MetricSnapshot{}
+	for _, m := range metrics {
+		snapshots = append(snapshots, m.snapshot())
+	}
+
+	return snapshots
+}
+
+// StartTime returns when the registry was created, which is the start time
+// of all cumulative metrics.
+func (r *Registry) StartTime() time.Time {
+	return r.start
+}
+
+func (m *metric) snapshot() MetricSnapshot {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.collect != nil {
+		m.series = make(map[string]*series)
+		m.collect(func(value float64, labelValues ...string) {
+			m.seriesFor(labelValues).value = value
+		})
+	}
+
+	keys := []string{}
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	snapshot := MetricSnapshot{
+		Name:    m.name,
+		Help:    m.help,
+		Kind:    m.kind,
+		Buckets: m.buckets,
+	}
+
+	for _, key := range keys {
+		s := m.series[key]
+
+		labels := map[string]string{}
+		for i, name := range m.labelNames {
+			if i < len(s.labelValues) {
+				labels[name] = s.labelValues[i]
+			}
+		}
+
+		snapshot.Series = append(snapshot.Series, SeriesSnapshot{
+			Labels:       labels,
+			Value:        s.value,
+			Count:        s.count,
+			Sum:          s.sum,
+			BucketCounts: append([]uint64(nil), s.bucketCounts...),
+			Exemplars:    append([]*Exemplar(nil), s.exemplars...),
+		})
+	}
+
+	return snapshot
+}
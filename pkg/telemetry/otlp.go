@@ -0,0 +1,332 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP enum values used in the JSON encoding.
+const (
+	otlpSpanKindServer           = 2
+	otlpStatusCodeOK             = 1
+	otlpStatusCodeError          = 2
+	otlpTemporalityCumulative    = 2
+	otlpTracesPath               = "/v1/traces"
+	otlpMetricsPath              = "/v1/metrics"
+	otlpInstrumentationScopeName = "atlas-osb"
+)
+
+// OTLPExporter periodically pushes metrics and spans to an OpenTelemetry
+// collector using OTLP over HTTP with JSON encoding. Either the registry or
+// the tracer may be nil, in which case that signal isn't exported.
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	interval time.Duration
+	resource map[string]string
+
+	registry *Registry
+	tracer   *Tracer
+	http     *http.Client
+
+	started  bool
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewOTLPExporter creates a new exporter pushing to the collector at
+// endpoint, for example "http://localhost:4318".
+func NewOTLPExporter(endpoint string, headers map[string]string, interval time.Duration, resource map[string]string, registry *Registry, tracer *Tracer) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		headers:  headers,
+		interval: interval,
+		resource: resource,
+		registry: registry,
+		tracer:   tracer,
+		http:     &http.Client{Timeout: 10 * time.Second},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start begins exporting in the background. Errors are passed to onError.
+func (e *OTLPExporter) Start(onError func(error)) {
+	e.started = true
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := e.Export(context.Background()); err != nil {
+					onError(err)
+				}
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops the background export and flushes all pending data.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+
+	if e.started {
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return e.Export(ctx)
+}
+
+// Export pushes the current metrics and all finished spans to the collector.
+func (e *OTLPExporter) Export(ctx context.Context) error {
+	if e.tracer != nil {
+		spans := e.tracer.Drain()
+		if len(spans) > 0 {
+			if err := e.post(ctx, otlpTracesPath, e.tracesPayload(spans)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if e.registry != nil {
+		if err := e.post(ctx, otlpMetricsPath, e.metricsPayload(e.registry.Snapshot())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *OTLPExporter) post(ctx context.Context, path string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP export to %s failed with status %d", path, resp.StatusCode)
+	}
+
+	return nil
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+func otlpAttributes(attributes map[string]string) []otlpKeyValue {
+	keys := []string{}
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := []otlpKeyValue{}
+	for _, key := range keys {
+		result = append(result, otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: attributes[key]}})
+	}
+
+	return result
+}
+
+// otlpTime formats a time as a string containing Unix nanoseconds. 64-bit
+// integers are encoded as strings in the OTLP JSON encoding.
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func (e *OTLPExporter) resourcePayload() map[string]interface{} {
+	return map[string]interface{}{"attributes": otlpAttributes(e.resource)}
+}
+
+func (e *OTLPExporter) tracesPayload(spans []*Span) interface{} {
+	otlpSpans := []map[string]interface{}{}
+	for _, span := range spans {
+		status := otlpStatusCodeOK
+		if span.Error {
+			status = otlpStatusCodeError
+		}
+
+		otlpSpans = append(otlpSpans, map[string]interface{}{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"parentSpanId":      span.ParentSpanID,
+			"name":              span.Name,
+			"kind":              otlpSpanKindServer,
+			"startTimeUnixNano": otlpTime(span.Start),
+			"endTimeUnixNano":   otlpTime(span.End),
+			"attributes":        otlpAttributes(span.Attributes),
+			"status":            map[string]interface{}{"code": status},
+		})
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": e.resourcePayload(),
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": otlpInstrumentationScopeName},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+// otlpExemplars converts the exemplars of histogram buckets, skipping
+// buckets without one.
+func otlpExemplars(exemplars []*Exemplar) []interface{} {
+	result := []interface{}{}
+	for _, e := range exemplars {
+		if e == nil {
+			continue
+		}
+
+		result = append(result, map[string]interface{}{
+			"timeUnixNano": otlpTime(e.Time),
+			"asDouble":     e.Value,
+			"traceId":      e.TraceID,
+			"spanId":       e.SpanID,
+		})
+	}
+
+	return result
+}
+
+func (e *OTLPExporter) metricsPayload(snapshots []MetricSnapshot) interface{} {
+	start := otlpTime(e.registry.StartTime())
+	now := otlpTime(time.Now())
+
+	metrics := []interface{}{}
+	for _, m := range snapshots {
+		dataPoints := []interface{}{}
+
+		switch m.Kind {
+		case KindCounter:
+			for _, s := range m.Series {
+				dataPoints = append(dataPoints, map[string]interface{}{
+					"attributes":        otlpAttributes(s.Labels),
+					"startTimeUnixNano": start,
+					"timeUnixNano":      now,
+					"asDouble":          s.Value,
+				})
+			}
+
+			metrics = append(metrics, map[string]interface{}{
+				"name":        m.Name,
+				"description": m.Help,
+				"sum": map[string]interface{}{
+					"aggregationTemporality": otlpTemporalityCumulative,
+					"isMonotonic":            true,
+					"dataPoints":             dataPoints,
+				},
+			})
+		case KindGauge:
+			for _, s := range m.Series {
+				dataPoints = append(dataPoints, map[string]interface{}{
+					"attributes":   otlpAttributes(s.Labels),
+					"timeUnixNano": now,
+					"asDouble":     s.Value,
+				})
+			}
+
+			metrics = append(metrics, map[string]interface{}{
+				"name":        m.Name,
+				"description": m.Help,
+				"gauge": map[string]interface{}{
+					"dataPoints": dataPoints,
+				},
+			})
+		case KindHistogram:
+			for _, s := range m.Series {
+				bucketCounts := []string{}
+				for _, count := range s.BucketCounts {
+					bucketCounts = append(bucketCounts, strconv.FormatUint(count, 10))
+				}
+
+				dataPoint := map[string]interface{}{
+					"attributes":        otlpAttributes(s.Labels),
+					"startTimeUnixNano": start,
+					"timeUnixNano":      now,
+					"count":             strconv.FormatUint(s.Count, 10),
+					"sum":               s.Sum,
+					"bucketCounts":      bucketCounts,
+					"explicitBounds":    m.Buckets,
+				}
+				if exemplars := otlpExemplars(s.Exemplars); len(exemplars) > 0 {
+					dataPoint["exemplars"] = exemplars
+				}
+
+				dataPoints = append(dataPoints, dataPoint)
+			}
+
+			metrics = append(metrics, map[string]interface{}{
+				"name":        m.Name,
+				"description": m.Help,
+				"histogram": map[string]interface{}{
+					"aggregationTemporality": otlpTemporalityCumulative,
+					"dataPoints":             dataPoints,
+				},
+			})
+		}
+	}
+
+	return map[string]interface{}{
+		"resourceMetrics": []interface{}{
+			map[string]interface{}{
+				"resource": e.resourcePayload(),
+				"scopeMetrics": []interface{}{
+					map[string]interface{}{
+						"scope":   map[string]interface{}{"name": otlpInstrumentationScopeName},
+						"metrics": metrics,
+					},
+				},
+			},
+		},
+	}
+}
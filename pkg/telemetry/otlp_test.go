@@ -0,0 +1,129 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// collector is a fake OTLP collector recording all received payloads.
+type collector struct {
+	mutex    sync.Mutex
+	payloads map[string][]map[string]interface{}
+	headers  http.Header
+}
+
+func setupCollector(t *testing.T) (*collector, *httptest.Server) {
+	c := &collector{payloads: map[string][]map[string]interface{}{}}
+
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var payload map[string]interface{}
+		if !assert.NoError(t, json.NewDecoder(req.Body).Decode(&payload)) {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		c.mutex.Lock()
+		c.payloads[req.URL.Path] = append(c.payloads[req.URL.Path], payload)
+		c.headers = req.Header
+		c.mutex.Unlock()
+	}))
+
+	return c, s
+}
+
+func TestExportOnShutdown(t *testing.T) {
+	c, server := setupCollector(t)
+	defer server.Close()
+
+	tel, err := New(Config{
+		MetricsExporters:   []string{ExporterPrometheus, ExporterOTLP},
+		TracesExporter:     ExporterOTLP,
+		TracesSampleRatio:  1,
+		OTLPEndpoint:       server.URL,
+		OTLPHeaders:        map[string]string{"Api-Key": "secret"},
+		OTLPExportInterval: time.Hour,
+		ServiceName:        "atlas-osb",
+	}, func(err error) {
+		assert.NoError(t, err)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/v2/catalog", func(w http.ResponseWriter, r *http.Request) {
+		assert.NotNil(t, SpanFromContext(r.Context()), "Expected span in request context")
+	}).Methods("GET")
+	router.Use(tel.Middleware())
+
+	req := httptest.NewRequest("GET", "/v2/catalog", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Nothing is exported until the interval has passed or the exporter is
+	// shut down.
+	c.mutex.Lock()
+	assert.Empty(t, c.payloads)
+	c.mutex.Unlock()
+
+	assert.NoError(t, tel.Shutdown(context.Background()))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	assert.Equal(t, "secret", c.headers.Get("Api-Key"))
+	assert.Len(t, c.payloads[otlpTracesPath], 1)
+	assert.Len(t, c.payloads[otlpMetricsPath], 1)
+
+	traces, _ := json.Marshal(c.payloads[otlpTracesPath][0])
+	assert.Contains(t, string(traces), `"name":"catalog"`)
+
+	metrics, _ := json.Marshal(c.payloads[otlpMetricsPath][0])
+	assert.Contains(t, string(metrics), `"name":"broker_requests_total"`)
+	assert.Contains(t, string(metrics), `"name":"broker_request_duration_seconds"`)
+	assert.Contains(t, string(metrics), `"exemplars":[`)
+}
+
+func TestPrometheusOnlyByDefault(t *testing.T) {
+	tel, err := New(Config{MetricsExporters: []string{ExporterPrometheus}}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.True(t, tel.PrometheusEnabled())
+	assert.Nil(t, tel.exporter, "Expected no OTLP exporter")
+	assert.Nil(t, tel.tracer, "Expected tracing to be disabled")
+	assert.NoError(t, tel.Shutdown(context.Background()))
+}
+
+func TestInvalidConfig(t *testing.T) {
+	_, err := New(Config{MetricsExporters: []string{"statsd"}}, nil)
+	assert.EqualError(t, err, `invalid metrics exporter "statsd"`)
+
+	_, err = New(Config{TracesExporter: ExporterOTLP, TracesSampleRatio: 1}, nil)
+	assert.EqualError(t, err, "an OTLP endpoint is required to use the OTLP exporter")
+
+	_, err = New(Config{TracesExporter: ExporterOTLP, TracesSampleRatio: 2, OTLPEndpoint: "http://collector"}, nil)
+	assert.Error(t, err)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		_, err = New(Config{MetricsExporters: []string{ExporterOTLP}, OTLPEndpoint: "http://collector", OTLPExportInterval: interval}, nil)
+		assert.EqualError(t, err, "OTLP export interval must be positive, got "+interval.String())
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders("Api-Key=secret, X-Tenant = broker")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Api-Key": "secret", "X-Tenant": "broker"}, headers)
+
+	_, err = ParseHeaders("invalid")
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package telemetry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The content types of the Prometheus and OpenMetrics text formats.
+const (
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// PrometheusHandler returns an HTTP handler exposing all metrics in the
+// registry using the Prometheus text format. Scrapers accepting OpenMetrics
+// get that format instead, which includes the histogram exemplars.
+func PrometheusHandler(registry *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			w.Header().Set("Content-Type", openMetricsContentType)
+			WriteOpenMetrics(w, registry.Snapshot())
+			return
+		}
+
+		w.Header().Set("Content-Type", prometheusContentType)
+		WritePrometheus(w, registry.Snapshot())
+	})
+}
+
+// WritePrometheus writes the metric snapshots to w using the Prometheus text
+// format.
+func WritePrometheus(w io.Writer, snapshots []MetricSnapshot) error {
+	return writeText(w, snapshots, false)
+}
+
+// WriteOpenMetrics writes the metric snapshots to w using the OpenMetrics
+// text format, with the exemplars of histogram buckets.
+func WriteOpenMetrics(w io.Writer, snapshots []MetricSnapshot) error {
+	return writeText(w, snapshots, true)
+}
+
+func writeText(w io.Writer, snapshots []MetricSnapshot, openMetrics bool) error {
+	buf := bufio.NewWriter(w)
+
+	for _, m := range snapshots {
+		// OpenMetrics names counter families without the "_total" suffix of
+		// their samples.
+		family := m.Name
+		if openMetrics && m.Kind == KindCounter {
+			family = strings.TrimSuffix(family, "_total")
+		}
+
+		fmt.Fprintf(buf, "# HELP %s %s\n", family, escapeHelp(m.Help))
+		fmt.Fprintf(buf, "# TYPE %s %s\n", family, m.Kind)
+
+		for _, s := range m.Series {
+			switch m.Kind {
+			case KindCounter, KindGauge:
+				fmt.Fprintf(buf, "%s%s %s\n", m.Name, formatLabels(s.Labels, "", ""), formatFloat(s.Value))
+			case KindHistogram:
+				// Prometheus buckets are cumulative.
+				var cumulative uint64
+				for i, bound := range m.Buckets {
+					cumulative += s.BucketCounts[i]
+					fmt.Fprintf(buf, "%s_bucket%s %d%s\n", m.Name, formatLabels(s.Labels, "le", formatFloat(bound)), cumulative, bucketExemplar(s, i, openMetrics))
+				}
+				fmt.Fprintf(buf, "%s_bucket%s %d%s\n", m.Name, formatLabels(s.Labels, "le", "+Inf"), s.Count, bucketExemplar(s, len(m.Buckets), openMetrics))
+				fmt.Fprintf(buf, "%s_sum%s %s\n", m.Name, formatLabels(s.Labels, "", ""), formatFloat(s.Sum))
+				fmt.Fprintf(buf, "%s_count%s %d\n", m.Name, formatLabels(s.Labels, "", ""), s.Count)
+			}
+		}
+	}
+
+	if openMetrics {
+		fmt.Fprint(buf, "# EOF\n")
+	}
+
+	return buf.Flush()
+}
+
+// bucketExemplar formats the exemplar of a histogram bucket as an
+// OpenMetrics line suffix, or returns an empty string if the bucket has none.
+func bucketExemplar(s SeriesSnapshot, bucket int, openMetrics bool) string {
+	if !openMetrics || bucket >= len(s.Exemplars) || s.Exemplars[bucket] == nil {
+		return ""
+	}
+
+	e := s.Exemplars[bucket]
+	labels := formatLabels(map[string]string{"trace_id": e.TraceID, "span_id": e.SpanID}, "", "")
+	timestamp := strconv.FormatFloat(float64(e.Time.UnixNano())/1e9, 'f', 3, 64)
+	return fmt.Sprintf(" # %s %s %s", labels, formatFloat(e.Value), timestamp)
+}
+
+// formatLabels formats a set of labels as `{name="value",...}`. An extra label
+// is appended if extraName is not empty, used for the histogram "le" label.
+func formatLabels(labels map[string]string, extraName string, extraValue string) string {
+	names := []string{}
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []string{}
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(labels[name])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
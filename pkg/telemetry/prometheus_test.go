@@ -0,0 +1,130 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	registry := NewRegistry()
+
+	requests := registry.NewCounterVec("requests_total", "Number of requests.", "operation")
+	requests.Inc("provision")
+	requests.Inc("provision")
+	requests.Inc("bind")
+
+	duration := registry.NewHistogramVec("duration_seconds", "Request duration.", []float64{1, 5}, "operation")
+	duration.Observe(0.5, "provision")
+	duration.Observe(2, "provision")
+	duration.Observe(10, "provision")
+
+	var buf bytes.Buffer
+	err := WritePrometheus(&buf, registry.Snapshot())
+	assert.NoError(t, err)
+
+	expected := `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{operation="bind"} 1
+requests_total{operation="provision"} 2
+# HELP duration_seconds Request duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{operation="provision",le="1"} 1
+duration_seconds_bucket{operation="provision",le="5"} 2
+duration_seconds_bucket{operation="provision",le="+Inf"} 3
+duration_seconds_sum{operation="provision"} 12.5
+duration_seconds_count{operation="provision"} 3
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWritePrometheusGauge(t *testing.T) {
+	registry := NewRegistry()
+
+	values := map[string]float64{"payments": 2, "search": 1}
+	registry.NewGaugeFunc("instances", "Number of instances.", func(set func(value float64, labelValues ...string)) {
+		for owner, value := range values {
+			set(value, owner)
+		}
+	}, "owner")
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf, registry.Snapshot())
+	assert.Equal(t, `# HELP instances Number of instances.
+# TYPE instances gauge
+instances{owner="payments"} 2
+instances{owner="search"} 1
+`, buf.String())
+
+	// Values which are no longer collected disappear.
+	delete(values, "search")
+	buf.Reset()
+	WritePrometheus(&buf, registry.Snapshot())
+	assert.NotContains(t, buf.String(), "search")
+}
+
+func TestPrometheusEscaping(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounterVec("escaped_total", "Line\nbreak.", "value").Inc(`quote" and \`)
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf, registry.Snapshot())
+
+	assert.Contains(t, buf.String(), `# HELP escaped_total Line\nbreak.`)
+	assert.Contains(t, buf.String(), `escaped_total{value="quote\" and \\"} 1`)
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounterVec("requests_total", "Number of requests.", "operation").Inc("provision")
+
+	ctx, span := NewTracer(1).StartSpan(context.Background(), "provision", "")
+	duration := registry.NewHistogramVec("duration_seconds", "Request duration.", []float64{1, 5}, "operation")
+	duration.ObserveContext(ctx, 2, "provision")
+	duration.Observe(0.5, "provision")
+
+	var buf bytes.Buffer
+	err := WriteOpenMetrics(&buf, registry.Snapshot())
+	assert.NoError(t, err)
+
+	output := buf.String()
+	assert.Contains(t, output, "# TYPE requests counter\nrequests_total{operation=\"provision\"} 1\n")
+	assert.Contains(t, output, `duration_seconds_bucket{operation="provision",le="1"} 1`+"\n")
+	assert.Contains(t, output, fmt.Sprintf(`duration_seconds_bucket{operation="provision",le="5"} 2 # {span_id="%s",trace_id="%s"} 2 `, span.SpanID, span.TraceID))
+	assert.True(t, strings.HasSuffix(output, "\n# EOF\n"), "Expected output to end with EOF marker")
+}
+
+func TestExemplarsOnlyForSampledSpans(t *testing.T) {
+	registry := NewRegistry()
+	duration := registry.NewHistogramVec("duration_seconds", "Request duration.", []float64{1}, "operation")
+
+	ctx, _ := NewTracer(0).StartSpan(context.Background(), "provision", "")
+	duration.ObserveContext(ctx, 0.5, "provision")
+	duration.ObserveContext(context.Background(), 2, "provision")
+
+	var buf bytes.Buffer
+	WriteOpenMetrics(&buf, registry.Snapshot())
+	assert.NotContains(t, buf.String(), "trace_id")
+}
+
+func TestPrometheusHandlerNegotiatesOpenMetrics(t *testing.T) {
+	registry := NewRegistry()
+	handler := PrometheusHandler(registry)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;q=0.5")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, openMetricsContentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# EOF\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, prometheusContentType, rec.Header().Get("Content-Type"))
+	assert.Empty(t, rec.Body.String())
+}
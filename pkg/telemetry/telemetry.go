@@ -0,0 +1,229 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// The supported exporters for metrics and traces.
+const (
+	ExporterPrometheus = "prometheus"
+	ExporterOTLP       = "otlp"
+	ExporterNone       = "none"
+)
+
+// Config controls which exporters are used for metrics and traces.
+type Config struct {
+	// MetricsExporters contains the metrics exporters to enable, any of
+	// "prometheus" and "otlp".
+	MetricsExporters []string
+	// TracesExporter is either "none" or "otlp".
+	TracesExporter string
+	// TracesSampleRatio is the ratio of traces which are sampled, between 0
+	// and 1.
+	TracesSampleRatio float64
+
+	OTLPEndpoint       string
+	OTLPHeaders        map[string]string
+	OTLPExportInterval time.Duration
+
+	ServiceName    string
+	ServiceVersion string
+}
+
+// Telemetry collects metrics and traces for the broker HTTP API and exports
+// them using the configured exporters.
+type Telemetry struct {
+	registry   *Registry
+	tracer     *Tracer
+	exporter   *OTLPExporter
+	prometheus bool
+
+	requests *CounterVec
+	duration *HistogramVec
+}
+
+// New sets up metrics, tracing, and the configured exporters. Export to OTLP
+// starts immediately in the background; errors are passed to onError.
+func New(config Config, onError func(error)) (*Telemetry, error) {
+	t := &Telemetry{
+		registry: NewRegistry(),
+	}
+
+	otlpMetrics := false
+	for _, exporter := range config.MetricsExporters {
+		switch exporter {
+		case ExporterPrometheus:
+			t.prometheus = true
+		case ExporterOTLP:
+			otlpMetrics = true
+		default:
+			return nil, fmt.Errorf(`invalid metrics exporter "%s"`, exporter)
+		}
+	}
+
+	switch config.TracesExporter {
+	case ExporterNone, "":
+	case ExporterOTLP:
+		if config.TracesSampleRatio < 0 || config.TracesSampleRatio > 1 {
+			return nil, fmt.Errorf("traces sample ratio must be between 0 and 1, got %v", config.TracesSampleRatio)
+		}
+		t.tracer = NewTracer(config.TracesSampleRatio)
+	default:
+		return nil, fmt.Errorf(`invalid traces exporter "%s"`, config.TracesExporter)
+	}
+
+	if otlpMetrics || t.tracer != nil {
+		if config.OTLPEndpoint == "" {
+			return nil, fmt.Errorf("an OTLP endpoint is required to use the OTLP exporter")
+		}
+
+		if config.OTLPExportInterval <= 0 {
+			return nil, fmt.Errorf("OTLP export interval must be positive, got %s", config.OTLPExportInterval)
+		}
+
+		var registry *Registry
+		if otlpMetrics {
+			registry = t.registry
+		}
+
+		resource := map[string]string{
+			"service.name":    config.ServiceName,
+			"service.version": config.ServiceVersion,
+		}
+
+		t.exporter = NewOTLPExporter(config.OTLPEndpoint, config.OTLPHeaders, config.OTLPExportInterval, resource, registry, t.tracer)
+		t.exporter.Start(onError)
+	}
+
+	t.requests = t.registry.NewCounterVec("broker_requests_total", "Number of handled broker API requests.", "operation", "code")
+	t.duration = t.registry.NewHistogramVec("broker_request_duration_seconds", "Duration of broker API requests in seconds.", DefaultDurationBuckets, "operation")
+
+	return t, nil
+}
+
+// PrometheusEnabled returns whether the Prometheus endpoint should be served.
+func (t *Telemetry) PrometheusEnabled() bool {
+	return t.prometheus
+}
+
+// Registry returns the registry metrics are exported from, so other
+// components can record their own metrics.
+func (t *Telemetry) Registry() *Registry {
+	return t.registry
+}
+
+// PrometheusHandler returns the handler for the Prometheus endpoint.
+func (t *Telemetry) PrometheusHandler() http.Handler {
+	return PrometheusHandler(t.registry)
+}
+
+// Shutdown flushes all pending metrics and traces to the OTLP collector.
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	if t.exporter == nil {
+		return nil
+	}
+
+	return t.exporter.Shutdown(ctx)
+}
+
+// Middleware records metrics and a span for every request handled by the
+// router.
+func (t *Telemetry) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			operation := operationForRequest(r)
+			start := time.Now()
+
+			var span *Span
+			if t.tracer != nil {
+				var ctx context.Context
+				ctx, span = t.tracer.StartSpan(r.Context(), operation, r.Header.Get("traceparent"))
+				span.SetAttribute("http.method", r.Method)
+				span.SetAttribute("http.target", r.URL.Path)
+				r = r.WithContext(ctx)
+			}
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			t.requests.Inc(operation, strconv.Itoa(recorder.status))
+			t.duration.ObserveContext(r.Context(), time.Since(start).Seconds(), operation)
+
+			if span != nil {
+				span.SetAttribute("http.status_code", strconv.Itoa(recorder.status))
+				span.Error = recorder.status >= 500
+				span.Finish()
+			}
+		})
+	}
+}
+
+// osbOperations maps the routes of the OSB API to operation names.
+var osbOperations = map[string]string{
+	"GET /v2/catalog":                                                                      "catalog",
+	"GET /v2/catalog/plans/{plan_id}":                                                      "plan_details",
+	"GET /v2/service_instances/{instance_id}":                                              "get_instance",
+	"PUT /v2/service_instances/{instance_id}":                                              "provision",
+	"PATCH /v2/service_instances/{instance_id}":                                            "update",
+	"DELETE /v2/service_instances/{instance_id}":                                           "deprovision",
+	"GET /v2/service_instances/{instance_id}/last_operation":                               "last_operation",
+	"GET /v2/service_instances/{instance_id}/service_bindings/{binding_id}":                "get_binding",
+	"PUT /v2/service_instances/{instance_id}/service_bindings/{binding_id}":                "bind",
+	"DELETE /v2/service_instances/{instance_id}/service_bindings/{binding_id}":             "unbind",
+	"GET /v2/service_instances/{instance_id}/service_bindings/{binding_id}/last_operation": "last_binding_operation",
+}
+
+// operationForRequest returns a low cardinality name for the operation a
+// request performs, based on the matched route.
+func operationForRequest(r *http.Request) string {
+	template := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if t, err := route.GetPathTemplate(); err == nil {
+			template = t
+		}
+	}
+
+	if operation, ok := osbOperations[r.Method+" "+template]; ok {
+		return operation
+	}
+
+	return "other"
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// ParseHeaders parses a comma-separated list of "key=value" pairs, the format
+// used for OTLP exporter headers.
+func ParseHeaders(value string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf(`invalid header "%s", expected "key=value"`, pair)
+		}
+
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return headers, nil
+}
@@ -0,0 +1,184 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBufferedSpans is the maximum number of finished spans kept in memory
+// while waiting to be exported. The oldest spans are dropped once the limit
+// is reached to bound memory usage if the collector is unreachable.
+const maxBufferedSpans = 2048
+
+// Tracer creates spans and buffers them until they are exported. Spans are
+// sampled based on their trace ID, honoring the decision of a sampled parent
+// propagated using the W3C "traceparent" header.
+type Tracer struct {
+	sampleRatio float64
+
+	mutex    sync.Mutex
+	finished []*Span
+}
+
+// Span represents a single traced operation.
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+	Error        bool
+
+	sampled bool
+	tracer  *Tracer
+}
+
+type spanContextKey struct{}
+
+// NewTracer creates a new Tracer which samples the specified ratio of traces,
+// between 0 and 1.
+func NewTracer(sampleRatio float64) *Tracer {
+	return &Tracer{
+		sampleRatio: sampleRatio,
+	}
+}
+
+// StartSpan starts a new span. If traceparent is a valid W3C trace context
+// the span will continue that trace.
+func (t *Tracer) StartSpan(ctx context.Context, name string, traceparent string) (context.Context, *Span) {
+	span := &Span{
+		Name:       name,
+		Start:      time.Now(),
+		Attributes: map[string]string{},
+		tracer:     t,
+	}
+
+	traceID, parentSpanID, parentSampled, ok := parseTraceparent(traceparent)
+	if ok {
+		span.TraceID = traceID
+		span.ParentSpanID = parentSpanID
+		span.sampled = parentSampled
+	} else {
+		span.TraceID = randomHex(16)
+		span.sampled = t.shouldSample(span.TraceID)
+	}
+	span.SpanID = randomHex(8)
+
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// SpanFromContext returns the span stored in the context, if any.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// Sampled returns whether the span will be recorded and exported.
+func (s *Span) Sampled() bool {
+	return s.sampled
+}
+
+// SetAttribute adds an attribute to the span.
+func (s *Span) SetAttribute(key string, value string) {
+	s.Attributes[key] = value
+}
+
+// Traceparent formats the span context as a W3C "traceparent" header value.
+func (s *Span) Traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", s.TraceID, s.SpanID, flags)
+}
+
+// Finish ends the span and buffers it for export if sampled.
+func (s *Span) Finish() {
+	s.End = time.Now()
+	if !s.sampled {
+		return
+	}
+
+	t := s.tracer
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.finished = append(t.finished, s)
+	if len(t.finished) > maxBufferedSpans {
+		t.finished = t.finished[len(t.finished)-maxBufferedSpans:]
+	}
+}
+
+// Drain returns and removes all finished spans from the buffer.
+func (t *Tracer) Drain() []*Span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	spans := t.finished
+	t.finished = nil
+	return spans
+}
+
+// shouldSample decides whether a new trace should be sampled. The decision is
+// based on the trace ID so it's consistent for the whole trace.
+func (t *Tracer) shouldSample(traceID string) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+
+	id, err := hex.DecodeString(traceID[16:])
+	if err != nil {
+		return false
+	}
+
+	// Compare the lower 63 bits of the trace ID against the ratio.
+	value := binary.BigEndian.Uint64(id) >> 1
+	return float64(value) < t.sampleRatio*float64(uint64(1)<<63)
+}
+
+// parseTraceparent parses a W3C "traceparent" header of the form
+// "00-<trace ID>-<parent ID>-<flags>".
+func parseTraceparent(header string) (traceID string, spanID string, sampled bool, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return
+	}
+
+	if !isHex(parts[1]) || !isHex(parts[2]) || strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return
+	}
+
+	return parts[1], parts[2], flags[0]&1 == 1, true
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// randomHex generates a random hex string of the specified number of bytes.
+func randomHex(numberOfBytes int) string {
+	b := make([]byte, numberOfBytes)
+	if _, err := rand.Read(b); err != nil {
+		panic("Error during ID generation: " + err.Error())
+	}
+
+	return hex.EncodeToString(b)
+}
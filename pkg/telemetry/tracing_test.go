@@ -0,0 +1,55 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartSpanContinuesTrace(t *testing.T) {
+	tracer := NewTracer(0)
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx, span := tracer.StartSpan(context.Background(), "provision", traceparent)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", span.ParentSpanID)
+	assert.True(t, span.Sampled(), "Expected sampled parent to be honored despite ratio 0")
+	assert.Equal(t, span, SpanFromContext(ctx))
+	assert.True(t, strings.HasPrefix(span.Traceparent(), "00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+
+	span.Finish()
+	assert.Len(t, tracer.Drain(), 1)
+	assert.Empty(t, tracer.Drain(), "Expected buffer to be empty after draining")
+}
+
+func TestStartSpanInvalidTraceparent(t *testing.T) {
+	tracer := NewTracer(1)
+
+	for _, traceparent := range []string{"", "invalid", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"} {
+		_, span := tracer.StartSpan(context.Background(), "provision", traceparent)
+		assert.Len(t, span.TraceID, 32)
+		assert.Empty(t, span.ParentSpanID)
+		assert.True(t, span.Sampled())
+	}
+}
+
+func TestSampling(t *testing.T) {
+	never := NewTracer(0)
+	_, span := never.StartSpan(context.Background(), "provision", "")
+	span.Finish()
+	assert.Empty(t, never.Drain(), "Expected unsampled span to not be recorded")
+
+	half := NewTracer(0.5)
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		_, span := half.StartSpan(context.Background(), "provision", "")
+		if span.Sampled() {
+			sampled++
+		}
+	}
+
+	assert.InDelta(t, 500, sampled, 100)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultBrokerURL is the URL of the broker the state commands connect to.
+var DefaultBrokerURL = "http://" + DefaultServerHost + ":" + strconv.Itoa(DefaultServerPort)
+
+// The broker state lives in the memory of the running broker, so the export
+// and import commands go through its admin API. The broker must be started
+// with BROKER_ADMIN_TOKEN set.
+
+// runExportCommand writes the state of a running broker to stdout or a file.
+func runExportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	brokerURL := flags.String("broker-url", getEnvOrDefault("BROKER_URL", DefaultBrokerURL), "URL of the running broker.")
+	secrets := flags.String("secrets", "exclude", `How to handle binding credentials, "exclude" or "encrypt".`)
+	output := flags.String("output", "", "File to write the export to instead of stdout.")
+	flags.Parse(args)
+
+	query := url.Values{"secrets": []string{*secrets}}
+	resp, err := adminRequest(http.MethodGet, *brokerURL+"/admin/state?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+// runImportCommand loads an export from stdin or a file into a running
+// broker.
+func runImportCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	brokerURL := flags.String("broker-url", getEnvOrDefault("BROKER_URL", DefaultBrokerURL), "URL of the running broker.")
+	input := flags.String("input", "", "File to read the export from instead of stdin.")
+	atlasKey := flags.String("atlas-key", "", "Name of the configured Atlas key used to carry out scheduled deletions.")
+	flags.Parse(args)
+
+	in := io.Reader(os.Stdin)
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	target := *brokerURL + "/admin/state"
+	if *atlasKey != "" {
+		target += "?" + url.Values{"atlas_key": []string{*atlasKey}}.Encode()
+	}
+
+	resp, err := adminRequest(http.MethodPost, target, in)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// adminRequest sends a request to the admin API using the admin token from
+// the environment. Responses other than 200 OK are returned as errors.
+func adminRequest(method string, target string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+getEnvOrPanic("BROKER_ADMIN_TOKEN"))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("broker responded with %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return resp, nil
+}